@@ -1,8 +1,16 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -13,10 +21,70 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// GetAPIKeyUser authenticates a request via the Authorization header using
-// an API key (Bearer or ApiKey scheme). It looks up matching keys by prefix,
-// verifies via bcrypt, and returns the associated user.
+// Reasons a valid API key is refused for a request.
+var (
+	ErrAPIKeyIPNotAllowed = errors.New("API key is not allowed from this address")
+	ErrAPIKeyRateLimited  = errors.New("API key rate limit exceeded")
+)
+
+const (
+	// apiKeyRateWindow is the window per-key rate limits are counted in.
+	apiKeyRateWindow = time.Minute
+
+	// Verified keys are cached for apiKeyCacheTTL; the cache is reset when it
+	// holds apiKeyCacheSize keys.
+	apiKeyCacheTTL  = 5 * time.Minute
+	apiKeyCacheSize = 1000
+
+	// apiKeyTouchInterval limits how often last_used_at is written per key.
+	apiKeyTouchInterval = time.Minute
+
+	// Keys look like dg_<key ID>_<secret>; the key ID is apiKeyIDBytes hex-encoded.
+	apiKeyFormatPrefix = "dg_"
+	apiKeyIDBytes      = 8
+)
+
+const apiKeyResultContextKey contextKey = "apiKeyResult"
+
+// APIKeyResult is the outcome of checking the API key sent with a request.
+type APIKeyResult struct {
+	KeyID int
+
+	// User is nil when Err is set.
+	User *models.AuthenticatedUser
+
+	// Err is ErrAPIKeyIPNotAllowed or ErrAPIKeyRateLimited when the key is
+	// valid but refused for this request.
+	Err error
+
+	// RetryAfter is set with ErrAPIKeyRateLimited.
+	RetryAfter time.Duration
+}
+
+// WithAPIKeyResult stores the API key check for a request in its context, so
+// GetAPIKeyUser does not check the key (and count it against the rate limit)
+// again. A nil result records that the request carries no valid key.
+func WithAPIKeyResult(r *http.Request, res *APIKeyResult) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiKeyResultContextKey, res))
+}
+
+// GetAPIKeyUser returns the user of the API key sent with the request, or nil
+// if there is none or the key is refused by its allowlist or rate limit.
 func GetAPIKeyUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
+	res, ok := r.Context().Value(apiKeyResultContextKey).(*APIKeyResult)
+	if !ok {
+		res = AuthenticateAPIKey(app, r)
+	}
+	if res == nil {
+		return nil
+	}
+	return res.User
+}
+
+// AuthenticateAPIKey checks the API key in the Authorization header (Bearer or
+// ApiKey scheme) or X-API-Key header, then applies the key's address
+// allowlist and rate limit. It returns nil when the request has no valid key.
+func AuthenticateAPIKey(app *server.App, r *http.Request) *APIKeyResult {
 	app.SysConfigMu.RLock()
 	apiKeyEnabled := app.SystemConfig.APIKeyEnabled
 	app.SysConfigMu.RUnlock()
@@ -45,44 +113,109 @@ func GetAPIKeyUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 		return nil
 	}
 
-	keyPrefix := apiKey[:8]
+	key := lookupAPIKey(app, apiKey)
+	if key == nil {
+		return nil
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		ForgetAPIKey(app, key.ID)
+		return nil
+	}
+
+	if len(key.AllowedCIDRs) > 0 && !ipAllowed(ClientIP(app, r), key.AllowedCIDRs) {
+		return &APIKeyResult{KeyID: key.ID, Err: ErrAPIKeyIPNotAllowed}
+	}
+	if key.RateLimit > 0 {
+		if wait := takeAPIKeyRequest(app, key.ID, key.RateLimit); wait > 0 {
+			return &APIKeyResult{KeyID: key.ID, Err: ErrAPIKeyRateLimited, RetryAfter: wait}
+		}
+	}
+
+	touchAPIKey(app, key.ID)
+
+	user := &models.AuthenticatedUser{
+		Username:    key.Username,
+		DisplayName: key.Username,
+		Groups:      append([]string(nil), key.Groups...),
+		Source:      "apikey",
+		Scopes:      ParseScopes(key.Permissions),
+	}
+	return &APIKeyResult{KeyID: key.ID, User: user}
+}
+
+// lookupAPIKey returns the stored key matching apiKey, from the cache of
+// verified keys or the database. Expired keys are returned too.
+func lookupAPIKey(app *server.App, apiKey string) *models.APIKey {
+	digest := HashAPIKey(apiKey)
+
+	app.APIKeyCacheMu.Lock()
+	cached, ok := app.APIKeyCache[digest]
+	app.APIKeyCacheMu.Unlock()
+	if ok && time.Since(cached.VerifiedAt) < apiKeyCacheTTL {
+		key := cached.Key
+		return &key
+	}
+
+	key := verifyAPIKey(app, apiKey, digest)
+	if key == nil {
+		return nil
+	}
+
+	app.APIKeyCacheMu.Lock()
+	if app.APIKeyCache == nil || len(app.APIKeyCache) >= apiKeyCacheSize {
+		app.APIKeyCache = make(map[string]*server.CachedAPIKey)
+	}
+	app.APIKeyCache[digest] = &server.CachedAPIKey{Key: *key, VerifiedAt: time.Now()}
+	app.APIKeyCacheMu.Unlock()
+	return key
+}
+
+// verifyAPIKey finds the stored key matching apiKey by its lookup ID and
+// compares digests in constant time. Keys still stored as bcrypt hashes are
+// verified with bcrypt once and then rewritten as SHA-256 digests.
+func verifyAPIKey(app *server.App, apiKey, digest string) *models.APIKey {
+	lookupID := APIKeyLookupID(apiKey)
 
-	// Find matching key by prefix
+	// Keys from before the dg_ format were looked up by their first 8 characters
 	rows, err := app.DB.Query(
-		"SELECT id, key_hash, username, groups, permissions, expires_at FROM api_keys WHERE key_prefix = ?",
-		keyPrefix,
+		"SELECT id, key_hash, username, groups, permissions, expires_at, COALESCE(allowed_cidrs, '[]'), COALESCE(rate_limit, 0) FROM api_keys WHERE key_prefix IN (?, ?)",
+		lookupID, apiKey[:8],
 	)
 	if err != nil {
 		return nil
 	}
 	defer rows.Close()
 
-	type matchedKey struct {
-		id        int
-		username  string
-		groupsJSON string
-	}
-	var matched *matchedKey
+	var matched *models.APIKey
+	var groupsJSON, permsJSON, cidrsJSON string
+	migrate := false
 
 	candidatesChecked := 0
 	for rows.Next() {
-		var id int
-		var keyHash, username, groupsJSON, permsJSON string
-		var expiresAt *time.Time
+		var k models.APIKey
+		var keyHash string
 
-		if err := rows.Scan(&id, &keyHash, &username, &groupsJSON, &permsJSON, &expiresAt); err != nil {
+		if err := rows.Scan(&k.ID, &keyHash, &k.Username, &groupsJSON, &permsJSON, &k.ExpiresAt, &cidrsJSON, &k.RateLimit); err != nil {
 			continue
 		}
 
 		// Check expiration
-		if expiresAt != nil && time.Now().After(*expiresAt) {
+		if k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt) {
+			continue
+		}
+
+		if !isBcryptHash(keyHash) {
+			if subtle.ConstantTimeCompare([]byte(keyHash), []byte(digest)) == 1 {
+				matched = &k
+				break
+			}
 			continue
 		}
 
 		// Limit bcrypt work to prevent abuse via prefix collisions
 		candidatesChecked++
 		if candidatesChecked > 3 {
-			log.Printf("API key lookup exceeded max candidates for prefix %s", keyPrefix)
+			log.Printf("API key lookup exceeded max candidates for prefix %s", apiKey[:8])
 			return nil
 		}
 
@@ -91,7 +224,8 @@ func GetAPIKeyUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 			continue
 		}
 
-		matched = &matchedKey{id: id, username: username, groupsJSON: groupsJSON}
+		matched = &k
+		migrate = true
 		break
 	}
 	rows.Close()
@@ -105,23 +239,138 @@ func GetAPIKeyUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 		return nil
 	}
 
-	// Update last used outside of row iteration to avoid deadlock with SetMaxOpenConns(1)
-	if _, err := app.DB.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now(), matched.id); err != nil {
-		log.Printf("Error updating API key last_used_at: %v", err)
+	// Rewrite outside of row iteration to avoid deadlock with SetMaxOpenConns(1)
+	if migrate {
+		if _, err := app.DB.Exec("UPDATE api_keys SET key_hash = ? WHERE id = ?", digest, matched.ID); err != nil {
+			log.Printf("Error migrating API key %d to SHA-256: %v", matched.ID, err)
+		}
 	}
 
-	var groups []string
-	if err := json.Unmarshal([]byte(matched.groupsJSON), &groups); err != nil {
+	if err := json.Unmarshal([]byte(groupsJSON), &matched.Groups); err != nil {
 		log.Printf("Error parsing groups JSON: %v", err)
-		groups = []string{}
+		matched.Groups = []string{}
 	}
+	if err := json.Unmarshal([]byte(permsJSON), &matched.Permissions); err != nil {
+		log.Printf("Error parsing permissions JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(cidrsJSON), &matched.AllowedCIDRs); err != nil {
+		log.Printf("Error parsing allowed CIDRs JSON: %v", err)
+	}
+	return matched
+}
 
-	user := &models.AuthenticatedUser{
-		Username:    matched.username,
-		DisplayName: matched.username,
-		Groups:      groups,
-		Source:      "apikey",
+// touchAPIKey records that a key was used. The column is written at most
+// once per apiKeyTouchInterval so frequent polling does not write every time.
+func touchAPIKey(app *server.App, keyID int) {
+	now := time.Now()
+	app.APIKeyCacheMu.Lock()
+	if last, ok := app.APIKeyTouched[keyID]; ok && now.Sub(last) < apiKeyTouchInterval {
+		app.APIKeyCacheMu.Unlock()
+		return
+	}
+	if app.APIKeyTouched == nil || len(app.APIKeyTouched) >= apiKeyCacheSize {
+		app.APIKeyTouched = make(map[int]time.Time)
+	}
+	app.APIKeyTouched[keyID] = now
+	app.APIKeyCacheMu.Unlock()
+
+	if _, err := app.DB.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", now, keyID); err != nil {
+		log.Printf("Error updating API key last_used_at: %v", err)
+	}
+}
+
+// ForgetAPIKey drops a key from the cache of verified keys. Call it whenever
+// a key is deleted or its settings change.
+func ForgetAPIKey(app *server.App, keyID int) {
+	app.APIKeyCacheMu.Lock()
+	defer app.APIKeyCacheMu.Unlock()
+	for digest, cached := range app.APIKeyCache {
+		if cached.Key.ID == keyID {
+			delete(app.APIKeyCache, digest)
+		}
+	}
+}
+
+// GenerateAPIKey returns a new API key, the lookup ID stored as its prefix,
+// and the digest stored in place of the key.
+func GenerateAPIKey() (key, lookupID, digest string, err error) {
+	idBytes := make([]byte, apiKeyIDBytes)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	lookupID = apiKeyFormatPrefix + hex.EncodeToString(idBytes)
+	key = lookupID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, lookupID, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the digest stored for an API key. Keys carry 256 bits of
+// randomness, so a fast unsalted hash is enough to keep them from being
+// recovered from the database.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyLookupID returns the part of a key stored as its prefix: the key ID
+// of dg_ keys, or the first 8 characters of keys from before that format.
+func APIKeyLookupID(key string) string {
+	if n := len(apiKeyFormatPrefix) + 2*apiKeyIDBytes; strings.HasPrefix(key, apiKeyFormatPrefix) && len(key) > n && key[n] == '_' {
+		return key[:n]
+	}
+	if len(key) < 8 {
+		return key
+	}
+	return key[:8]
+}
+
+// isBcryptHash reports whether a stored key hash predates SHA-256 digests.
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2")
+}
+
+// ipAllowed reports whether ip is inside one of the allowlisted networks.
+// Entries that fail to parse match nothing.
+func ipAllowed(ip string, cidrs []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, c := range cidrs {
+		if _, network, err := net.ParseCIDR(c); err == nil && network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// takeAPIKeyRequest counts a request against a key's per-minute limit. It
+// returns zero if the request is allowed, or how long until the window resets.
+func takeAPIKeyRequest(app *server.App, keyID, limit int) time.Duration {
+	app.APIKeyWindowsMu.Lock()
+	defer app.APIKeyWindowsMu.Unlock()
+
+	now := time.Now()
+	if app.APIKeyWindows == nil {
+		app.APIKeyWindows = make(map[int]*server.APIKeyWindow)
+	}
+	window, ok := app.APIKeyWindows[keyID]
+	if !ok || now.After(window.ResetAt) {
+		// Drop finished windows so deleted keys do not accumulate
+		for id, w := range app.APIKeyWindows {
+			if now.After(w.ResetAt) {
+				delete(app.APIKeyWindows, id)
+			}
+		}
+		window = &server.APIKeyWindow{ResetAt: now.Add(apiKeyRateWindow)}
+		app.APIKeyWindows[keyID] = window
+	}
+	if window.Count >= limit {
+		return window.ResetAt.Sub(now)
 	}
-	user.IsAdmin = CheckIsAdmin(app, user.Groups)
-	return user
+	window.Count++
+	return 0
 }
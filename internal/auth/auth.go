@@ -16,8 +16,13 @@ const userContextKey contextKey = "user"
 
 // GetAuthenticatedUser resolves the current user from the request using all
 // configured authentication methods, tried in order: API key, proxy headers,
-// then session cookie.
+// then session cookie. Groups from external sources are mapped.
 func GetAuthenticatedUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
+	return ResolveUser(app, getRequestUser(app, r))
+}
+
+// getRequestUser finds the user of a request before group mapping.
+func getRequestUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 	app.SysConfigMu.RLock()
 	proxyAuthEnabled := app.SystemConfig.ProxyAuthEnabled
 	localAuthEnabled := app.SystemConfig.LocalAuthEnabled
@@ -49,6 +54,28 @@ func GetAuthenticatedUser(app *server.App, r *http.Request) *models.Authenticate
 	return nil
 }
 
+// GetCredentialUser resolves the user from an API key or session cookie only,
+// ignoring proxy headers. Forward-auth requests carry the headers of the
+// client being checked, so identity headers in them cannot be trusted. API
+// keys need the apps:access scope.
+func GetCredentialUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
+	if user := GetAPIKeyUser(app, r); user != nil {
+		if !HasScope(user, ScopeAppsAccess) {
+			return nil
+		}
+		return ResolveUser(app, user)
+	}
+
+	app.SysConfigMu.RLock()
+	sessionAuth := app.SystemConfig.LocalAuthEnabled || app.SystemConfig.LDAPAuthEnabled || app.SystemConfig.OIDCAuthEnabled ||
+		app.AuthConfig.Mode == models.AuthModeLocal || app.AuthConfig.Mode == models.AuthModeHybrid
+	app.SysConfigMu.RUnlock()
+	if sessionAuth {
+		return ResolveUser(app, GetLocalUser(app, r))
+	}
+	return nil
+}
+
 // CheckIsAdmin returns true if the given group list contains a configured admin group.
 // Comparison is case-insensitive.
 func CheckIsAdmin(app *server.App, groups []string) bool {
@@ -77,8 +104,42 @@ func CheckIsAdmin(app *server.App, groups []string) bool {
 }
 
 // RequireAuth is middleware that ensures the request has an authenticated user.
-// If not, it redirects to /login (local/hybrid mode) or returns 401.
+// If not, it redirects to /login (local/hybrid mode) or returns 401. API keys
+// are rejected: the routes it guards act on a person's own account.
 func RequireAuth(app *server.App, next http.HandlerFunc) http.HandlerFunc {
+	return requireUser(app, false, next)
+}
+
+// RequireAdmin is middleware that ensures the request has an authenticated admin user.
+// API keys additionally need the admin scope.
+func RequireAdmin(app *server.App, next http.HandlerFunc) http.HandlerFunc {
+	return RequireAdminScope(app, ScopeAdmin, next)
+}
+
+// RequireAdminScope is like RequireAdmin, but lets API keys in with scope
+// instead of the admin scope.
+func RequireAdminScope(app *server.App, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return requireUser(app, true, func(w http.ResponseWriter, r *http.Request) {
+		user := GetUserFromContext(r)
+		if user == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !user.IsAdmin {
+			http.Error(w, "Forbidden: Admin access required", http.StatusForbidden)
+			return
+		}
+		if !HasScope(user, scope) {
+			denyAPIKeyScope(w, scope)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// requireUser stores the authenticated user in the request context, or
+// redirects to /login (local/hybrid mode) or returns 401 without one.
+func requireUser(app *server.App, allowAPIKey bool, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := GetAuthenticatedUser(app, r)
 		if user == nil {
@@ -93,28 +154,16 @@ func RequireAuth(app *server.App, next http.HandlerFunc) http.HandlerFunc {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if user.Source == "apikey" && !allowAPIKey {
+			http.Error(w, "Forbidden: not available with an API key", http.StatusForbidden)
+			return
+		}
 		// Store user in context
 		ctx := context.WithValue(r.Context(), userContextKey, user)
 		next(w, r.WithContext(ctx))
 	}
 }
 
-// RequireAdmin is middleware that ensures the request has an authenticated admin user.
-func RequireAdmin(app *server.App, next http.HandlerFunc) http.HandlerFunc {
-	return RequireAuth(app, func(w http.ResponseWriter, r *http.Request) {
-		user := GetUserFromContext(r)
-		if user == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		if !user.IsAdmin {
-			http.Error(w, "Forbidden: Admin access required", http.StatusForbidden)
-			return
-		}
-		next(w, r)
-	})
-}
-
 // GetUserFromContext extracts the authenticated user stored in the request context.
 func GetUserFromContext(r *http.Request) *models.AuthenticatedUser {
 	if user, ok := r.Context().Value(userContextKey).(*models.AuthenticatedUser); ok {
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// claimStep is one segment of a claim path: an object key, an array index,
+// or a wildcard matching every member of an object or array.
+type claimStep struct {
+	key      string
+	index    int // >= 0 for an array index
+	wildcard bool
+}
+
+// parseClaimPaths parses a groups claim expression: one or more
+// comma-separated paths in dotted ("realm_access.roles",
+// "resource_access.*.roles") or JSONPath ("$.resource_access['my-app'].roles")
+// notation.
+func parseClaimPaths(expr string) ([][]claimStep, error) {
+	var paths [][]claimStep
+	for _, part := range splitClaimExpr(expr) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		path, err := parseClaimPath(part)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", part, err)
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("empty claim expression")
+	}
+	return paths, nil
+}
+
+// splitClaimExpr splits expr at commas that are not inside brackets.
+func splitClaimExpr(expr string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			if depth > 0 {
+				quote = c
+			}
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, expr[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+// parseClaimPath parses a single dotted or JSONPath claim path.
+func parseClaimPath(s string) ([]claimStep, error) {
+	if strings.HasPrefix(s, "$") {
+		s = s[1:]
+		if s == "" {
+			return nil, errors.New("path selects the whole token")
+		}
+		if s[0] != '.' && s[0] != '[' {
+			return nil, errors.New(`expected "." or "[" after "$"`)
+		}
+	} else {
+		s = "." + s
+	}
+
+	var steps []claimStep
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			key := s[:end]
+			if key == "" {
+				return nil, errors.New("empty path segment")
+			}
+			if strings.Contains(key, "]") {
+				return nil, errors.New(`unexpected "]"`)
+			}
+			steps = append(steps, claimStep{key: key, index: -1, wildcard: key == "*"})
+			s = s[end:]
+		case '[':
+			if len(s) > 1 && (s[1] == '\'' || s[1] == '"') {
+				// A quoted key may itself contain "." or "]"
+				q := strings.IndexByte(s[2:], s[1])
+				if q < 0 || len(s) < q+4 || s[q+3] != ']' {
+					return nil, errors.New("unterminated quoted key")
+				}
+				steps = append(steps, claimStep{key: s[2 : q+2], index: -1})
+				s = s[q+4:]
+				continue
+			}
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, errors.New(`missing "]"`)
+			}
+			inner := s[1:end]
+			if inner == "*" {
+				steps = append(steps, claimStep{index: -1, wildcard: true})
+			} else if n, err := strconv.Atoi(inner); err == nil && n >= 0 {
+				steps = append(steps, claimStep{index: n})
+			} else {
+				return nil, fmt.Errorf("invalid selector [%s]", inner)
+			}
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", s[0])
+		}
+	}
+	return steps, nil
+}
+
+// ValidateGroupsClaim checks that a groups claim expression can be parsed.
+func ValidateGroupsClaim(expr string) error {
+	_, err := parseClaimPaths(expr)
+	return err
+}
+
+// groupsFromClaims returns the group names selected by a groups claim
+// expression, without duplicates. Each path may select a string or an array
+// of strings; anything else is ignored. A plain expression that names a
+// top-level claim is used as is, so namespaced claims such as
+// "https://example.com/roles" need no quoting.
+func groupsFromClaims(claims map[string]interface{}, expr string) []string {
+	var values []interface{}
+	if v, ok := claims[expr]; ok {
+		values = []interface{}{v}
+	} else {
+		paths, err := parseClaimPaths(expr)
+		if err != nil {
+			return nil
+		}
+		for _, path := range paths {
+			values = append(values, selectClaim(claims, path)...)
+		}
+	}
+
+	var groups []string
+	add := func(v interface{}) {
+		if s, ok := v.(string); ok && s != "" && !containsString(groups, s) {
+			groups = append(groups, s)
+		}
+	}
+	for _, v := range values {
+		if list, ok := v.([]interface{}); ok {
+			for _, item := range list {
+				add(item)
+			}
+		} else {
+			add(v)
+		}
+	}
+	return groups
+}
+
+// selectClaim returns the values path selects in v.
+func selectClaim(v interface{}, path []claimStep) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+	step, rest := path[0], path[1:]
+	var out []interface{}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		if step.wildcard {
+			// Sorted so that the resulting group order is stable
+			keys := make([]string, 0, len(node))
+			for k := range node {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				out = append(out, selectClaim(node[k], rest)...)
+			}
+		} else if child, ok := node[step.key]; ok && step.index < 0 {
+			out = selectClaim(child, rest)
+		}
+	case []interface{}:
+		if step.wildcard {
+			for _, child := range node {
+				out = append(out, selectClaim(child, rest)...)
+			}
+		} else if step.index >= 0 && step.index < len(node) {
+			out = selectClaim(node[step.index], rest)
+		}
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGroupsFromClaims(t *testing.T) {
+	var claims map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"groups": ["users", "admins"],
+		"role": "editor",
+		"https://example.com/roles": ["staff"],
+		"realm_access": {"roles": ["offline_access", "users"]},
+		"resource_access": {
+			"dashgate": {"roles": ["dash-admin"]},
+			"my.app": {"roles": ["viewer"]}
+		},
+		"memberships": [{"name": "ops"}, {"name": "dev"}]
+	}`), &claims)
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"groups", []string{"users", "admins"}},
+		{"role", []string{"editor"}},
+		{"https://example.com/roles", []string{"staff"}},
+		{"realm_access.roles", []string{"offline_access", "users"}},
+		{"resource_access.dashgate.roles", []string{"dash-admin"}},
+		{"$.resource_access['my.app'].roles", []string{"viewer"}},
+		{`$["resource_access"]["dashgate"]["roles"][0]`, []string{"dash-admin"}},
+		{"resource_access.*.roles", []string{"dash-admin", "viewer"}},
+		{"memberships[*].name", []string{"ops", "dev"}},
+		{"realm_access.roles, resource_access.dashgate.roles", []string{"offline_access", "users", "dash-admin"}},
+		{"realm_access", nil},
+		{"missing.claim", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if got := groupsFromClaims(claims, tt.expr); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "$", "a..b", "a[", "a[x]", "$['unterminated]", "a.b]"} {
+		if err := ValidateGroupsClaim(expr); err == nil {
+			t.Errorf("ValidateGroupsClaim(%q) accepted an invalid expression", expr)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"dashgate/internal/models"
+	"dashgate/internal/pattern"
+	"dashgate/internal/server"
+)
+
+// Group mapping actions.
+const (
+	GroupActionRename = "rename" // replace the group with the target
+	GroupActionAdd    = "add"    // keep the group and add the target
+	GroupActionDrop   = "drop"   // remove the group
+)
+
+// ExternalGroupSources are the auth sources whose groups come from outside
+// DashGate and go through group mapping.
+var ExternalGroupSources = []string{"authelia", "ldap", "oidc"}
+
+// IsExternalGroupSource reports whether source is an auth source whose
+// groups are mapped.
+func IsExternalGroupSource(source string) bool {
+	return containsString(ExternalGroupSources, source)
+}
+
+// ValidateGroupMappingRule checks the source, action and pattern of a rule.
+func ValidateGroupMappingRule(rule models.GroupMappingRule) error {
+	if rule.Source != "" && !IsExternalGroupSource(rule.Source) {
+		return fmt.Errorf("unknown source %q", rule.Source)
+	}
+	if strings.TrimSpace(rule.Match) == "" {
+		return fmt.Errorf("a match pattern is required")
+	}
+	if _, err := pattern.Compile(rule.Match); err != nil {
+		return fmt.Errorf("invalid match pattern: %v", err)
+	}
+	switch rule.Action {
+	case GroupActionRename, GroupActionAdd:
+		if strings.TrimSpace(rule.Target) == "" {
+			return fmt.Errorf("%s rules need a target group", rule.Action)
+		}
+	case GroupActionDrop:
+	default:
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+	return nil
+}
+
+// GroupMappingStep records what happened to one external group.
+type GroupMappingStep struct {
+	Group  string   `json:"group"`
+	RuleID int      `json:"ruleId,omitempty"` // 0 if no rule matched
+	Action string   `json:"action"`           // a rule action, "keep" or "drop-unmapped"
+	Result []string `json:"result"`
+}
+
+// MapGroups applies the enabled rules for source to groups, then adds the
+// source's default groups. Groups no rule matches are kept unless the source
+// drops unmapped groups. It also returns what happened to each group.
+func MapGroups(rules []models.GroupMappingRule, settings models.GroupSourceSettings, source string, groups []string) ([]string, []GroupMappingStep) {
+	mapped := []string{}
+	add := func(g string) {
+		if g = strings.TrimSpace(g); g != "" && !containsString(mapped, g) {
+			mapped = append(mapped, g)
+		}
+	}
+
+	steps := make([]GroupMappingStep, 0, len(groups))
+	for _, g := range groups {
+		step := GroupMappingStep{Group: g, Action: "keep", Result: []string{g}}
+		if settings.DropUnmapped {
+			step.Action, step.Result = "drop-unmapped", []string{}
+		}
+		for _, rule := range rules {
+			if !rule.Enabled || (rule.Source != "" && rule.Source != source) {
+				continue
+			}
+			re, err := pattern.Compile(rule.Match)
+			if err != nil {
+				continue
+			}
+			m := re.FindStringSubmatchIndex(g)
+			if m == nil {
+				continue
+			}
+			target := rule.Target
+			if pattern.IsRegex(rule.Match) {
+				target = string(re.ExpandString(nil, rule.Target, g, m))
+			}
+			step.RuleID, step.Action = rule.ID, rule.Action
+			switch rule.Action {
+			case GroupActionRename:
+				step.Result = []string{target}
+			case GroupActionAdd:
+				step.Result = []string{g, target}
+			default:
+				step.Result = []string{}
+			}
+			break
+		}
+		for _, r := range step.Result {
+			add(r)
+		}
+		steps = append(steps, step)
+	}
+
+	for _, g := range settings.DefaultGroups {
+		add(g)
+	}
+	return mapped, steps
+}
+
+// groupMappingFor returns a snapshot of the rules and the settings of source.
+func groupMappingFor(app *server.App, source string) ([]models.GroupMappingRule, models.GroupSourceSettings) {
+	app.GroupMappingMu.RLock()
+	defer app.GroupMappingMu.RUnlock()
+	settings, ok := app.GroupSourceSettings[source]
+	if !ok {
+		settings = models.GroupSourceSettings{Source: source}
+	}
+	return append([]models.GroupMappingRule(nil), app.GroupMappingRules...), settings
+}
+
+// MapSourceGroups maps the groups of a user from source with the configured
+// rules. Groups of local users and API keys are returned unchanged.
+func MapSourceGroups(app *server.App, source string, groups []string) []string {
+	if !IsExternalGroupSource(source) {
+		return groups
+	}
+	rules, settings := groupMappingFor(app, source)
+	mapped, _ := MapGroups(rules, settings, source, groups)
+	return mapped
+}
+
+// ResolveUser finishes a user read from an auth source: it maps groups from
+// external sources and decides admin access from the mapped groups. Every
+// request user passes through here, so the stored or received groups are
+// always the external ones and rule changes apply immediately.
+func ResolveUser(app *server.App, user *models.AuthenticatedUser) *models.AuthenticatedUser {
+	if user == nil {
+		return nil
+	}
+	user.Groups = MapSourceGroups(app, user.Source, user.Groups)
+	user.IsAdmin = CheckIsAdmin(app, user.Groups)
+	return user
+}
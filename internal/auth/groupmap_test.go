@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	"dashgate/internal/models"
+)
+
+func TestMapGroups(t *testing.T) {
+	rules := []models.GroupMappingRule{
+		{ID: 1, Enabled: true, Source: "ldap", Match: "domain admins", Action: GroupActionRename, Target: "admin"},
+		{ID: 2, Enabled: true, Match: `re:app-(\w+)-users`, Action: GroupActionRename, Target: "$1"},
+		{ID: 3, Enabled: true, Match: "staff*", Action: GroupActionAdd, Target: "users"},
+		{ID: 4, Enabled: true, Match: "offline_access", Action: GroupActionDrop},
+		{ID: 5, Enabled: false, Match: "guests", Action: GroupActionDrop},
+		{ID: 6, Enabled: true, Match: "*", Action: GroupActionDrop, Source: "oidc"},
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		settings models.GroupSourceSettings
+		groups   []string
+		want     []string
+	}{
+		{"rename for the rule's source", "ldap", models.GroupSourceSettings{}, []string{"Domain Admins"}, []string{"admin"}},
+		{"rule of another source", "authelia", models.GroupSourceSettings{}, []string{"domain admins"}, []string{"domain admins"}},
+		{"regex with capture", "authelia", models.GroupSourceSettings{}, []string{"app-grafana-users"}, []string{"grafana"}},
+		{"add keeps the group", "authelia", models.GroupSourceSettings{}, []string{"staff-berlin"}, []string{"staff-berlin", "users"}},
+		{"drop and disabled rule", "authelia", models.GroupSourceSettings{}, []string{"offline_access", "guests"}, []string{"guests"}},
+		{"first matching rule wins", "oidc", models.GroupSourceSettings{}, []string{"offline_access", "app-wiki-users", "other"}, []string{"wiki"}},
+		{"drop unmapped and default groups", "authelia", models.GroupSourceSettings{DropUnmapped: true, DefaultGroups: []string{"family", "users"}},
+			[]string{"staff", "random"}, []string{"staff", "users", "family"}},
+		{"no groups", "ldap", models.GroupSourceSettings{DefaultGroups: []string{"family"}}, nil, []string{"family"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, steps := MapGroups(rules, tt.settings, tt.source, tt.groups)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if len(steps) != len(tt.groups) {
+				t.Errorf("%d steps for %d groups", len(steps), len(tt.groups))
+			}
+		})
+	}
+
+	for _, rule := range []models.GroupMappingRule{
+		{Match: "x", Action: "rename"},
+		{Match: "", Action: "drop"},
+		{Match: "re:(", Action: "drop"},
+		{Match: "x", Action: "merge", Target: "y"},
+		{Match: "x", Action: "drop", Source: "local"},
+	} {
+		if err := ValidateGroupMappingRule(rule); err == nil {
+			t.Errorf("ValidateGroupMappingRule(%+v) accepted an invalid rule", rule)
+		}
+	}
+}
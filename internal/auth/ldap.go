@@ -2,9 +2,12 @@ package auth
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"net/url"
 	"strings"
 	"time"
 
@@ -14,100 +17,510 @@ import (
 	"github.com/go-ldap/ldap/v3"
 )
 
+// Nested group resolution modes for LDAP.
+const (
+	LDAPNestedInChain   = "in_chain"  // Active Directory LDAP_MATCHING_RULE_IN_CHAIN
+	LDAPNestedRecursive = "recursive" // follow member/uniqueMember of each group
+)
+
+// ldapMatchingRuleInChain is the Active Directory matching rule OID that
+// evaluates group membership transitively on the server.
+const ldapMatchingRuleInChain = "1.2.840.113556.1.4.1941"
+
+// ldapMaxNestingDepth bounds recursive group resolution so that membership
+// cycles and very deep hierarchies cannot stall a login.
+const ldapMaxNestingDepth = 10
+
+// IsLDAPNestedGroupsMode reports whether mode is a valid nested group
+// setting ("" disables nested groups).
+func IsLDAPNestedGroupsMode(mode string) bool {
+	return mode == "" || mode == LDAPNestedInChain || mode == LDAPNestedRecursive
+}
+
 // AuthenticateLDAP performs LDAP bind authentication for the given username and
 // password. It searches for the user using a service account, extracts group
-// membership, then verifies the password by binding as the user.
+// membership, then verifies the password by binding as the user. The groups
+// are returned as found in the directory; ResolveUser maps them.
 func AuthenticateLDAP(app *server.App, username, password string) (*models.AuthenticatedUser, error) {
 	if password == "" {
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
-	if app.LDAPAuth == nil {
+	app.SysConfigMu.RLock()
+	cfg := app.LDAPAuth
+	app.SysConfigMu.RUnlock()
+	if cfg == nil {
+		return nil, fmt.Errorf("LDAP not configured")
+	}
+
+	var entry *ldap.Entry
+	var groups []string
+	err := withLDAPConn(app, cfg, func(l *ldap.Conn) error {
+		var err error
+		if entry, err = findLDAPUser(l, cfg, username); err != nil {
+			return err
+		}
+
+		// Groups are read with the service account, which usually has wider
+		// read access than the user.
+		if groups, err = ldapUserGroups(l, cfg, entry); err != nil {
+			log.Printf("LDAP groups of %s are incomplete: %v", entry.DN, err)
+		}
+
+		// Bind as user to verify password, then switch the connection back
+		// to the service account for the next login
+		bindErr := l.Bind(entry.DN, password)
+		if err := bindLDAPService(l, cfg); err != nil {
+			return err
+		}
+		if bindErr != nil {
+			return errLDAPInvalidCredentials
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user := ldapEntryUser(cfg, entry, username)
+	user.Groups = groups
+	return user, nil
+}
+
+// ldapSyncPageSize is the page size for listing all users; Active Directory
+// returns at most 1000 entries per search without paging.
+const ldapSyncPageSize = 500
+
+// ListLDAPUsers returns every user matched by the user filter (with "*" as
+// the username) and their groups as a login would resolve them. It fails if
+// the groups of a user cannot be read completely, so that a directory sync
+// never stores partial memberships.
+func ListLDAPUsers(app *server.App) ([]models.AuthenticatedUser, error) {
+	app.SysConfigMu.RLock()
+	cfg := app.LDAPAuth
+	app.SysConfigMu.RUnlock()
+	if cfg == nil {
 		return nil, fmt.Errorf("LDAP not configured")
 	}
 
-	// Connect to LDAP server
+	filter := strings.ReplaceAll(cfg.UserFilter, "%s", "*")
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+
+	var users []models.AuthenticatedUser
+	err := withLDAPConn(app, cfg, func(l *ldap.Conn) error {
+		sr, err := l.SearchWithPaging(ldap.NewSearchRequest(
+			cfg.BaseDN,
+			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			filter,
+			[]string{"dn", cfg.UserAttr, cfg.EmailAttr, cfg.DisplayAttr, cfg.GroupAttr},
+			nil,
+		), ldapSyncPageSize)
+		if err != nil {
+			return fmt.Errorf("user search failed: %w", err)
+		}
+		for _, entry := range sr.Entries {
+			user := ldapEntryUser(cfg, entry, "")
+			if user.Username == "" {
+				continue
+			}
+			if user.Groups, err = ldapUserGroups(l, cfg, entry); err != nil {
+				return fmt.Errorf("groups of %s: %w", entry.DN, err)
+			}
+			users = append(users, *user)
+		}
+		return nil
+	})
+	return users, err
+}
+
+// ldapEntryUser converts a user entry to a user without groups. The
+// directory's username attribute is canonical, so that logins as
+// DOMAIN\user or user@domain map to the same DashGate user; login is used
+// only if the entry lacks it.
+func ldapEntryUser(cfg *models.LDAPAuthConfig, entry *ldap.Entry, login string) *models.AuthenticatedUser {
+	name := entry.GetEqualFoldAttributeValue(cfg.UserAttr)
+	if name == "" {
+		name = login
+	}
+	displayName := entry.GetEqualFoldAttributeValue(cfg.DisplayAttr)
+	if displayName == "" {
+		displayName = name
+	}
+	return &models.AuthenticatedUser{
+		Username:    name,
+		DisplayName: displayName,
+		Email:       entry.GetEqualFoldAttributeValue(cfg.EmailAttr),
+		Source:      "ldap",
+	}
+}
+
+// LDAPTLSConfig builds the TLS settings for ldaps:// and StartTLS
+// connections: the CA bundle is trusted in addition to the system roots, and
+// the client certificate is presented if the server asks for one.
+func LDAPTLSConfig(cfg *models.LDAPAuthConfig) (*tls.Config, error) {
+	u, err := url.Parse(cfg.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.SkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if strings.TrimSpace(cfg.CACert) != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(cfg.CACert)) {
+			return nil, fmt.Errorf("the CA bundle contains no PEM certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if strings.TrimSpace(cfg.ClientCert) != "" {
+		cert, err := tls.X509KeyPair([]byte(cfg.ClientCert), []byte(cfg.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate or key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// dialLDAP opens a connection with connectLDAP and binds it as the service
+// account.
+func dialLDAP(cfg *models.LDAPAuthConfig) (*ldap.Conn, error) {
+	l, err := connectLDAP(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := bindLDAPService(l, cfg); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// connectLDAP connects to the configured server (over TLS for ldaps:// URLs)
+// and upgrades the connection with StartTLS if configured.
+func connectLDAP(cfg *models.LDAPAuthConfig) (*ldap.Conn, error) {
+	tlsConfig, err := LDAPTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SkipVerify {
+		log.Printf("WARNING: LDAP TLS verification is disabled (SkipVerify=true). This allows man-in-the-middle attacks.")
+	}
+
 	dialer := &net.Dialer{Timeout: 10 * time.Second}
-	l, err := ldap.DialURL(app.LDAPAuth.Server, ldap.DialWithDialer(dialer))
+	l, err := ldap.DialURL(cfg.Server, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(tlsConfig))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to LDAP: %w", err)
 	}
-	defer l.Close()
 
 	l.SetTimeout(10 * time.Second)
 
-	// StartTLS if configured
-	if app.LDAPAuth.StartTLS {
-		tlsConfig := &tls.Config{InsecureSkipVerify: app.LDAPAuth.SkipVerify}
-		if app.LDAPAuth.SkipVerify {
-			log.Printf("WARNING: LDAP TLS verification is disabled (SkipVerify=true). This allows man-in-the-middle attacks.")
-		}
+	// StartTLS if configured; ldaps:// connections are encrypted already
+	if cfg.StartTLS && !strings.HasPrefix(strings.ToLower(cfg.Server), "ldaps://") {
 		if err := l.StartTLS(tlsConfig); err != nil {
+			l.Close()
 			return nil, fmt.Errorf("failed to start TLS: %w", err)
 		}
 	}
+	return l, nil
+}
 
-	// Bind with service account to search for user
-	if app.LDAPAuth.BindDN != "" {
-		if err := l.Bind(app.LDAPAuth.BindDN, app.LDAPAuth.BindPassword); err != nil {
-			return nil, fmt.Errorf("service account bind failed: %w", err)
+// bindLDAPService binds a connection as the service account, or anonymously
+// if no bind DN is configured.
+func bindLDAPService(l *ldap.Conn, cfg *models.LDAPAuthConfig) error {
+	if cfg.BindDN == "" {
+		if err := l.UnauthenticatedBind(""); err != nil {
+			return fmt.Errorf("anonymous bind failed: %w", err)
 		}
+		return nil
+	}
+	if err := l.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+		return fmt.Errorf("service account bind failed: %w", err)
+	}
+	return nil
+}
+
+// ldapUserFilter builds the user search filter for a login name. A
+// down-level logon name (DOMAIN\user) is reduced to the user part, and a
+// name containing "@" also matches userPrincipalName, so Active Directory
+// users can sign in with their UPN whatever the configured filter is.
+func ldapUserFilter(cfg *models.LDAPAuthConfig, login string) string {
+	if i := strings.LastIndex(login, `\`); i >= 0 {
+		login = login[i+1:]
 	}
+	escaped := ldap.EscapeFilter(login)
+	filter := strings.ReplaceAll(cfg.UserFilter, "%s", escaped)
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+	if strings.Contains(login, "@") {
+		filter = "(|" + filter + "(userPrincipalName=" + escaped + "))"
+	}
+	return filter
+}
 
-	// Search for user
-	userFilter := strings.Replace(app.LDAPAuth.UserFilter, "%s", ldap.EscapeFilter(username), -1)
+// findLDAPUser looks up the single directory entry for a login name.
+func findLDAPUser(l *ldap.Conn, cfg *models.LDAPAuthConfig, login string) (*ldap.Entry, error) {
 	searchRequest := ldap.NewSearchRequest(
-		app.LDAPAuth.BaseDN,
-		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 1, 0, false,
-		userFilter,
-		[]string{"dn", app.LDAPAuth.UserAttr, app.LDAPAuth.EmailAttr, app.LDAPAuth.DisplayAttr, app.LDAPAuth.GroupAttr},
+		cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		ldapUserFilter(cfg, login),
+		[]string{"dn", cfg.UserAttr, cfg.EmailAttr, cfg.DisplayAttr, cfg.GroupAttr},
 		nil,
 	)
 
 	sr, err := l.Search(searchRequest)
-	if err != nil {
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
 		return nil, fmt.Errorf("user search failed: %w", err)
 	}
+	if sr == nil || len(sr.Entries) != 1 {
+		return nil, errLDAPUserNotFound
+	}
+	return sr.Entries[0], nil
+}
 
-	if len(sr.Entries) != 1 {
-		return nil, fmt.Errorf("user not found or multiple matches")
+// ldapUserGroups collects the groups of a user entry from its group
+// attribute (memberOf), the group filter and, if enabled, nested groups.
+// If searches fail, the groups found so far are returned with the errors.
+func ldapUserGroups(l *ldap.Conn, cfg *models.LDAPAuthConfig, entry *ldap.Entry) ([]string, error) {
+	var errs []error
+	var direct []string
+	if cfg.GroupAttr != "" {
+		direct = append(direct, entry.GetEqualFoldAttributeValues(cfg.GroupAttr)...)
 	}
 
-	userDN := sr.Entries[0].DN
-	email := sr.Entries[0].GetAttributeValue(app.LDAPAuth.EmailAttr)
-	displayName := sr.Entries[0].GetAttributeValue(app.LDAPAuth.DisplayAttr)
-	if displayName == "" {
-		displayName = username
-	}
-
-	// Get groups from user entry
-	groups := sr.Entries[0].GetAttributeValues(app.LDAPAuth.GroupAttr)
-	// Extract CN from group DNs
-	var groupNames []string
-	for _, g := range groups {
-		if strings.HasPrefix(strings.ToLower(g), "cn=") {
-			parts := strings.Split(g, ",")
-			if len(parts) > 0 {
-				cn := strings.TrimPrefix(strings.ToLower(parts[0]), "cn=")
-				groupNames = append(groupNames, cn)
+	// Group search, e.g. (&(objectClass=posixGroup)(memberUid=%s)) or
+	// (&(objectClass=groupOfNames)(member=%d))
+	if cfg.GroupFilter != "" {
+		name := entry.GetEqualFoldAttributeValue(cfg.UserAttr)
+		filter := strings.NewReplacer("%s", ldap.EscapeFilter(name), "%d", ldap.EscapeFilter(entry.DN)).Replace(cfg.GroupFilter)
+		dns, err := searchLDAPGroupDNs(l, cfg.BaseDN, filter)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("group search failed: %w", err))
+		}
+		direct = append(direct, dns...)
+	}
+
+	all := direct
+	switch cfg.NestedGroups {
+	case LDAPNestedInChain:
+		filter := "(member:" + ldapMatchingRuleInChain + ":=" + ldap.EscapeFilter(entry.DN) + ")"
+		dns, err := searchLDAPGroupDNs(l, cfg.BaseDN, filter)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("nested group search failed: %w", err))
+		}
+		all = append(all, dns...)
+	case LDAPNestedRecursive:
+		parents, err := ldapParentGroups(l, cfg.BaseDN, direct)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		all = append(all, parents...)
+	}
+
+	groups := []string{}
+	seen := make(map[string]bool)
+	for _, g := range all {
+		name := ldapGroupName(g)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			groups = append(groups, name)
+		}
+	}
+	return groups, errors.Join(errs...)
+}
+
+// ldapParentGroups walks up the group hierarchy from the given group DNs,
+// returning the DNs of all groups that contain them directly or indirectly
+// and the first search error.
+func ldapParentGroups(l *ldap.Conn, baseDN string, groupDNs []string) ([]string, error) {
+	var firstErr error
+	visited := make(map[string]bool)
+	level := []string{}
+	for _, dn := range groupDNs {
+		if key := normalizeDN(dn); key != "" && !visited[key] {
+			visited[key] = true
+			level = append(level, dn)
+		}
+	}
+
+	var parents []string
+	for depth := 0; depth < ldapMaxNestingDepth && len(level) > 0; depth++ {
+		var next []string
+		for _, dn := range level {
+			escaped := ldap.EscapeFilter(dn)
+			found, err := searchLDAPGroupDNs(l, baseDN, "(|(member="+escaped+")(uniqueMember="+escaped+"))")
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("parent group search for %s failed: %w", dn, err)
+				}
+				continue
+			}
+			for _, p := range found {
+				if key := normalizeDN(p); !visited[key] {
+					visited[key] = true
+					parents = append(parents, p)
+					next = append(next, p)
+				}
 			}
-		} else {
-			groupNames = append(groupNames, g)
 		}
+		level = next
 	}
+	return parents, firstErr
+}
 
-	// Bind as user to verify password
-	if err := l.Bind(userDN, password); err != nil {
-		return nil, fmt.Errorf("invalid credentials")
+// searchLDAPGroupDNs returns the DNs of the entries below baseDN matching filter.
+func searchLDAPGroupDNs(l *ldap.Conn, baseDN, filter string) ([]string, error) {
+	sr, err := l.Search(ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter,
+		[]string{"dn"},
+		nil,
+	))
+	if err != nil {
+		return nil, err
 	}
+	dns := make([]string, 0, len(sr.Entries))
+	for _, e := range sr.Entries {
+		dns = append(dns, e.DN)
+	}
+	return dns, nil
+}
 
-	user := &models.AuthenticatedUser{
-		Username:    username,
-		DisplayName: displayName,
-		Email:       email,
-		Groups:      groupNames,
-		Source:      "ldap",
+// ldapGroupName returns the name of a group given by DN: the value of its
+// first RDN, unescaped and lowercased (e.g. "CN=Domain Admins,CN=Users,..."
+// becomes "domain admins"). Values that are not DNs are returned unchanged.
+func ldapGroupName(group string) string {
+	group = strings.TrimSpace(group)
+	if !strings.Contains(group, "=") {
+		return group
 	}
-	user.IsAdmin = CheckIsAdmin(app, user.Groups)
-	return user, nil
+	dn, err := ldap.ParseDN(group)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return group
+	}
+	return strings.ToLower(dn.RDNs[0].Attributes[0].Value)
+}
+
+// normalizeDN returns a canonical form of a DN for comparisons, or "" if it
+// cannot be parsed.
+func normalizeDN(s string) string {
+	dn, err := ldap.ParseDN(s)
+	if err != nil {
+		return ""
+	}
+	parts := make([]string, 0, len(dn.RDNs))
+	for _, rdn := range dn.RDNs {
+		attrs := make([]string, 0, len(rdn.Attributes))
+		for _, a := range rdn.Attributes {
+			attrs = append(attrs, strings.ToLower(a.Type)+"="+strings.ToLower(a.Value))
+		}
+		parts = append(parts, strings.Join(attrs, "+"))
+	}
+	return strings.Join(parts, ",")
+}
+
+// LDAPCheckStep is one stage of an LDAP settings check.
+type LDAPCheckStep struct {
+	Name       string `json:"name"` // "connect", "bind", "search" or "groups"
+	OK         bool   `json:"ok"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// LDAPCheckUser is the sample user found by an LDAP settings check.
+type LDAPCheckUser struct {
+	DN          string              `json:"dn"`
+	Username    string              `json:"username"`
+	DisplayName string              `json:"displayName"`
+	Email       string              `json:"email"`
+	Attributes  map[string][]string `json:"attributes"`
+	Groups      []string            `json:"groups"` // as read from the directory, before group mapping
+}
+
+// LDAPCheckResult reports the outcome of CheckLDAPSettings.
+type LDAPCheckResult struct {
+	OK    bool            `json:"ok"`
+	Steps []LDAPCheckStep `json:"steps"`
+	User  *LDAPCheckUser  `json:"user,omitempty"`
+}
+
+// CheckLDAPSettings tries cfg on a new connection without saving it: it
+// connects, binds as the service account and, if username is set, looks the
+// user up and resolves their groups the way a login would. Without a
+// username it only checks that the base DN exists. The user's password is
+// not checked.
+func CheckLDAPSettings(cfg *models.LDAPAuthConfig, username string) *LDAPCheckResult {
+	result := &LDAPCheckResult{}
+	step := func(name string, start time.Time, detail string, err error) bool {
+		s := LDAPCheckStep{Name: name, OK: err == nil, Detail: detail, DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		result.Steps = append(result.Steps, s)
+		return err == nil
+	}
+
+	start := time.Now()
+	l, err := connectLDAP(cfg)
+	detail := "unencrypted"
+	if err == nil {
+		if state, ok := l.TLSConnectionState(); ok {
+			detail = tls.VersionName(state.Version)
+		}
+	}
+	if !step("connect", start, detail, err) {
+		return result
+	}
+	defer l.Close()
+
+	start = time.Now()
+	detail = "anonymous"
+	if cfg.BindDN != "" {
+		detail = cfg.BindDN
+	}
+	if !step("bind", start, detail, bindLDAPService(l, cfg)) {
+		return result
+	}
+
+	start = time.Now()
+	if username == "" {
+		_, err := l.Search(ldap.NewSearchRequest(cfg.BaseDN, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+			"(objectClass=*)", []string{"dn"}, nil))
+		if err != nil {
+			err = fmt.Errorf("base DN lookup failed: %w", err)
+		}
+		result.OK = step("search", start, cfg.BaseDN, err)
+		return result
+	}
+	entry, err := findLDAPUser(l, cfg, username)
+	if !step("search", start, ldapUserFilter(cfg, username), err) {
+		return result
+	}
+
+	user := &LDAPCheckUser{
+		DN:          entry.DN,
+		Username:    entry.GetEqualFoldAttributeValue(cfg.UserAttr),
+		DisplayName: entry.GetEqualFoldAttributeValue(cfg.DisplayAttr),
+		Email:       entry.GetEqualFoldAttributeValue(cfg.EmailAttr),
+		Attributes:  make(map[string][]string),
+	}
+	for _, a := range entry.Attributes {
+		user.Attributes[a.Name] = a.Values
+	}
+	result.User = user
+
+	start = time.Now()
+	user.Groups, err = ldapUserGroups(l, cfg, entry)
+	result.OK = step("groups", start, fmt.Sprintf("%d groups", len(user.Groups)), err)
+	return result
 }
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"dashgate/internal/ldaptest"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+func TestAuthenticateLDAP(t *testing.T) {
+	dir := ldaptest.NewServer()
+	defer dir.Close()
+
+	const (
+		alice = "uid=alice,ou=people,dc=example,dc=com"
+		bob   = "CN=Bob Smith,OU=Staff,DC=example,DC=com"
+		devs  = "cn=Developers,ou=groups,dc=example,dc=com"
+		eng   = "cn=Engineering,ou=groups,dc=example,dc=com"
+		sales = `cn=Sales\, EMEA,ou=groups,dc=example,dc=com`
+	)
+	dir.AddEntry("cn=service,dc=example,dc=com", nil)
+	dir.SetPassword("cn=service,dc=example,dc=com", "service-secret")
+	dir.AddEntry(alice, map[string][]string{
+		"uid": {"alice"}, "mail": {"alice@example.com"}, "displayName": {"Alice"}, "memberOf": {devs},
+	})
+	dir.SetPassword(alice, "alice-secret")
+	dir.AddEntry(bob, map[string][]string{
+		"sAMAccountName": {"bob"}, "userPrincipalName": {"bob@corp.example.com"}, "memberOf": {sales},
+	})
+	dir.SetPassword(bob, "bob-secret")
+	dir.AddEntry(devs, map[string][]string{"objectClass": {"groupOfNames"}, "member": {alice}})
+	dir.AddEntry(sales, map[string][]string{"objectClass": {"groupOfNames"}, "member": {alice, bob}})
+	dir.AddEntry(eng, map[string][]string{"objectClass": {"groupOfNames"}, "member": {devs}})
+	dir.AddEntry("cn=All Staff,ou=groups,dc=example,dc=com", map[string][]string{"objectClass": {"groupOfNames"}, "member": {eng, sales}})
+	// A membership cycle must not loop forever
+	dir.AddEntry("cn=loop-a,ou=groups,dc=example,dc=com", map[string][]string{"member": {eng, "cn=loop-b,ou=groups,dc=example,dc=com"}})
+	dir.AddEntry("cn=loop-b,ou=groups,dc=example,dc=com", map[string][]string{"member": {"cn=loop-a,ou=groups,dc=example,dc=com"}})
+	dir.AddEntry("cn=media,ou=groups,dc=example,dc=com", map[string][]string{"objectClass": {"posixGroup"}, "memberUid": {"alice"}})
+
+	base := models.LDAPAuthConfig{
+		Server: dir.URL, BindDN: "cn=service,dc=example,dc=com", BindPassword: "service-secret", BaseDN: "dc=example,dc=com",
+		UserFilter: "(uid=%s)", UserAttr: "uid", EmailAttr: "mail", DisplayAttr: "displayName", GroupAttr: "memberOf",
+	}
+	ad := base
+	ad.UserFilter, ad.UserAttr = "(sAMAccountName=%s)", "sAMAccountName"
+	ad.NestedGroups = LDAPNestedInChain
+
+	with := func(cfg models.LDAPAuthConfig, filter, nested string) models.LDAPAuthConfig {
+		cfg.GroupFilter, cfg.NestedGroups = filter, nested
+		return cfg
+	}
+	allAlice := []string{"all staff", "developers", "engineering", "loop-a", "loop-b", "sales, emea"}
+
+	tests := []struct {
+		name     string
+		cfg      models.LDAPAuthConfig
+		login    string
+		password string
+		wantUser string
+		want     []string
+		wantErr  bool
+	}{
+		{"memberOf only", base, "alice", "alice-secret", "alice", []string{"developers"}, false},
+		{"posix group filter", with(base, "(&(objectClass=posixGroup)(memberUid=%s))", ""), "alice", "alice-secret", "alice", []string{"developers", "media"}, false},
+		{"groupOfNames filter", with(base, "(&(objectClass=groupOfNames)(member=%d))", ""), "alice", "alice-secret", "alice", []string{"developers", "sales, emea"}, false},
+		{"recursive nesting", with(base, "(member=%d)", LDAPNestedRecursive), "alice", "alice-secret", "alice", allAlice, false},
+		{"in-chain nesting", with(base, "", LDAPNestedInChain), "alice", "alice-secret", "alice", allAlice, false},
+		{"UPN login", ad, "bob@corp.example.com", "bob-secret", "bob", []string{"all staff", "sales, emea"}, false},
+		{"down-level logon name", ad, `CORP\bob`, "bob-secret", "bob", []string{"all staff", "sales, emea"}, false},
+		{"wrong password", base, "alice", "wrong", "", nil, true},
+		{"unknown user", base, "mallory", "alice-secret", "", nil, true},
+		{"filter injection", base, "*", "alice-secret", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := server.New()
+			cfg := tt.cfg
+			app.LDAPAuth = &cfg
+
+			user, err := AuthenticateLDAP(app, tt.login, tt.password)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", user)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AuthenticateLDAP: %v", err)
+			}
+			sort.Strings(user.Groups)
+			if user.Username != tt.wantUser || !reflect.DeepEqual(user.Groups, tt.want) {
+				t.Errorf("got user %q groups %q, want %q %q", user.Username, user.Groups, tt.wantUser, tt.want)
+			}
+		})
+	}
+}
+
+func TestLDAPConnectionPool(t *testing.T) {
+	dir := ldaptest.NewServer()
+	defer dir.Close()
+	dir.AddEntry("uid=alice,dc=example,dc=com", map[string][]string{"uid": {"alice"}})
+	dir.SetPassword("uid=alice,dc=example,dc=com", "alice-secret")
+	dir.SetPassword("cn=service,dc=example,dc=com", "service-secret")
+
+	app := server.New()
+	app.LDAPAuth = &models.LDAPAuthConfig{
+		Server: dir.URL, BindDN: "cn=service,dc=example,dc=com", BindPassword: "service-secret", BaseDN: "dc=example,dc=com",
+		UserFilter: "(uid=%s)", UserAttr: "uid",
+	}
+	login := func(password string) error {
+		_, err := AuthenticateLDAP(app, "alice", password)
+		return err
+	}
+
+	for _, password := range []string{"alice-secret", "wrong", "alice-secret"} {
+		login(password)
+	}
+	if n := dir.Connections(); n != 1 {
+		t.Errorf("three logins opened %d connections, want 1", n)
+	}
+
+	// An idle connection closed by the server is replaced transparently
+	dir.CloseConnections()
+	if err := login("alice-secret"); err != nil {
+		t.Errorf("login after the server dropped the connection: %v", err)
+	}
+
+	// New settings get a new pool
+	cfg := *app.LDAPAuth
+	app.LDAPAuth = &cfg
+	if err := login("alice-secret"); err != nil || dir.Connections() != 3 {
+		t.Errorf("login with new settings: %v, %d connections", err, dir.Connections())
+	}
+}
+
+func TestCheckLDAPSettingsTLS(t *testing.T) {
+	dir := ldaptest.NewUnstartedServer()
+	dir.RequireClientCert = true
+	dir.StartTLS()
+	defer dir.Close()
+	dir.AddEntry("dc=example,dc=com", nil)
+	dir.AddEntry("uid=alice,dc=example,dc=com", map[string][]string{"uid": {"alice"}, "memberOf": {"cn=staff,dc=example,dc=com"}})
+	certPEM, keyPEM := dir.IssueClientCert("dashgate")
+
+	cfg := models.LDAPAuthConfig{Server: dir.URL, BaseDN: "dc=example,dc=com", UserFilter: "(uid=%s)", UserAttr: "uid", GroupAttr: "memberOf"}
+	tests := []struct {
+		name     string
+		ca       string
+		cert     string
+		username string
+		want     bool
+	}{
+		{"unknown CA", "", certPEM, "", false},
+		{"no client certificate", dir.CertificatePEM(), "", "", false},
+		{"CA bundle and client certificate", dir.CertificatePEM(), certPEM, "", true},
+		{"sample user", dir.CertificatePEM(), certPEM, "alice", true},
+		{"unknown sample user", dir.CertificatePEM(), certPEM, "bob", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cfg
+			c.CACert, c.ClientCert, c.ClientKey = tt.ca, tt.cert, keyPEM
+			result := CheckLDAPSettings(&c, tt.username)
+			if result.OK != tt.want {
+				t.Fatalf("OK = %v, want %v: %+v", result.OK, tt.want, result.Steps)
+			}
+			if tt.username != "" && tt.want && (result.User == nil || !reflect.DeepEqual(result.User.Groups, []string{"staff"})) {
+				t.Errorf("sample user: %+v", result.User)
+			}
+		})
+	}
+
+	if _, err := LDAPTLSConfig(&models.LDAPAuthConfig{Server: dir.URL, CACert: "not a certificate"}); err == nil {
+		t.Error("LDAPTLSConfig accepted an invalid CA bundle")
+	}
+}
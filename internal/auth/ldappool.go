@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapPoolSize is the maximum number of open service account connections.
+const ldapPoolSize = 4
+
+// ldapPoolWait is how long a login waits for a free connection.
+const ldapPoolWait = 10 * time.Second
+
+// Errors after which a pooled connection is still bound as the service
+// account and can be reused.
+var (
+	errLDAPInvalidCredentials = errors.New("invalid credentials")
+	errLDAPUserNotFound       = errors.New("user not found or multiple matches")
+)
+
+// ldapPoolFor returns the pool for cfg, replacing the pool of older settings.
+func ldapPoolFor(app *server.App, cfg *models.LDAPAuthConfig) *server.LDAPPool {
+	app.LDAPPoolMu.Lock()
+	defer app.LDAPPoolMu.Unlock()
+	if app.LDAPPool == nil || app.LDAPPool.Config != cfg {
+		if app.LDAPPool != nil {
+			app.LDAPPool.CloseIdle()
+		}
+		app.LDAPPool = server.NewLDAPPool(cfg, ldapPoolSize)
+	}
+	return app.LDAPPool
+}
+
+// CloseLDAPPool closes the idle connections of the current pool, so that
+// connections opened with old settings do not linger after a change.
+func CloseLDAPPool(app *server.App) {
+	app.LDAPPoolMu.Lock()
+	defer app.LDAPPoolMu.Unlock()
+	if app.LDAPPool != nil {
+		app.LDAPPool.CloseIdle()
+		app.LDAPPool = nil
+	}
+}
+
+// withLDAPConn runs fn on a service account connection from the pool. fn
+// must leave the connection bound as the service account unless it returns
+// an error. Connections are returned to the pool after success or one of the
+// errors above and closed otherwise. If a reused connection turns out to be
+// closed (e.g. the server dropped it while idle), fn is retried once on a new
+// connection.
+func withLDAPConn(app *server.App, cfg *models.LDAPAuthConfig, fn func(l *ldap.Conn) error) error {
+	pool := ldapPoolFor(app, cfg)
+
+	select {
+	case pool.Slots <- struct{}{}:
+	case <-time.After(ldapPoolWait):
+		return fmt.Errorf("no LDAP connection available")
+	}
+	defer func() { <-pool.Slots }()
+
+	for attempt := 0; ; attempt++ {
+		var l *ldap.Conn
+		reused := false
+		select {
+		case l = <-pool.Idle:
+			reused = !l.IsClosing()
+			if !reused {
+				l.Close()
+				l = nil
+			}
+		default:
+		}
+		if l == nil {
+			var err error
+			if l, err = dialLDAP(cfg); err != nil {
+				return err
+			}
+		}
+
+		err := fn(l)
+		if err == nil || errors.Is(err, errLDAPInvalidCredentials) || errors.Is(err, errLDAPUserNotFound) {
+			releaseLDAPConn(app, pool, l)
+			return err
+		}
+		broken := l.IsClosing()
+		l.Close()
+		if !reused || attempt > 0 || !broken {
+			return err
+		}
+	}
+}
+
+// releaseLDAPConn puts a connection back into its pool, or closes it if the
+// settings changed meanwhile or the pool is full.
+func releaseLDAPConn(app *server.App, pool *server.LDAPPool, l *ldap.Conn) {
+	app.LDAPPoolMu.Lock()
+	current := app.LDAPPool == pool
+	app.LDAPPoolMu.Unlock()
+	if !current || l.IsClosing() {
+		l.Close()
+		return
+	}
+	select {
+	case pool.Idle <- l:
+	default:
+		l.Close()
+	}
+}
@@ -1,16 +1,19 @@
 package auth
 
 import (
+	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
 	"dashgate/internal/models"
 	"dashgate/internal/server"
 )
 
 // GetLocalUser authenticates the user via a session cookie stored in the
-// local SQLite database. Returns nil if no valid session is found.
+// local SQLite database. Returns nil if no valid session is found. The user
+// still has to go through ResolveUser.
 func GetLocalUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 	if app.DB == nil {
 		return nil
@@ -21,15 +24,44 @@ func GetLocalUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 		return nil
 	}
 
+	var sessionID, userID int
+	var createdAt time.Time
+	var lastSeen sql.NullTime
 	var username, email, displayName, groupsJSON, passwordHash string
+	var oidcProvider, oidcSubject, oidcRefreshToken string
 	err = app.DB.QueryRow(
-		"SELECT u.id, u.username, u.email, u.display_name, u.groups, u.password_hash FROM sessions s JOIN users u ON s.user_id = u.id WHERE s.token = ? AND s.expires_at > datetime('now')",
-		cookie.Value,
-	).Scan(new(int), &username, &email, &displayName, &groupsJSON, &passwordHash)
+		`SELECT s.id, s.created_at, s.last_seen_at, COALESCE(s.oidc_provider, ''), COALESCE(s.oidc_sub, ''), COALESCE(s.oidc_refresh_token, ''),
+			u.id, u.username, COALESCE(u.email, ''), COALESCE(u.display_name, ''), u.groups, u.password_hash
+		FROM sessions s JOIN users u ON s.user_id = u.id
+		WHERE s.token = ? AND s.expires_at > ? AND COALESCE(u.disabled, 0) = 0`,
+		cookie.Value, time.Now(),
+	).Scan(&sessionID, &createdAt, &lastSeen, &oidcProvider, &oidcSubject, &oidcRefreshToken,
+		&userID, &username, &email, &displayName, &groupsJSON, &passwordHash)
 	if err != nil {
 		return nil
 	}
 
+	// Enforce the idle timeout and slide the expiry forward
+	ok, renewed := touchSession(app, sessionID, createdAt, lastSeen)
+	if !ok {
+		return nil
+	}
+
+	// OIDC group membership is refreshed from the provider on each renewal
+	if renewed && oidcProvider != "" && oidcRefreshToken != "" {
+		oidcRefreshToken = DecryptSessionToken(app, oidcRefreshToken)
+	}
+	if renewed && oidcProvider != "" && oidcRefreshToken != "" {
+		groups, ok := refreshOIDCSession(app, sessionID, userID, oidcProvider, oidcSubject, oidcRefreshToken)
+		if !ok {
+			return nil
+		}
+		if groups != nil {
+			data, _ := json.Marshal(groups)
+			groupsJSON = string(data)
+		}
+	}
+
 	// Handle NULL values
 	if email == "" {
 		email = ""
@@ -62,6 +94,5 @@ func GetLocalUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 		Groups:      groups,
 		Source:      source,
 	}
-	user.IsAdmin = CheckIsAdmin(app, user.Groups)
 	return user
 }
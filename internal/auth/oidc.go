@@ -3,18 +3,58 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"dashgate/internal/encryption"
+	"dashgate/internal/models"
 	"dashgate/internal/server"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
 )
 
+// backChannelLogoutEvent is the event a back-channel logout token must carry.
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// OIDCProviders returns the providers users can sign in with, in login
+// button order, or nil if OIDC sign-in is disabled.
+func OIDCProviders(app *server.App) []models.OIDCProvider {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	if !app.SystemConfig.OIDCAuthEnabled {
+		return nil
+	}
+	providers := make([]models.OIDCProvider, 0, len(app.OIDCClients))
+	for _, c := range app.OIDCClients {
+		providers = append(providers, c.Config)
+	}
+	return providers
+}
+
+// oidcClient returns the initialized provider with the given ID, or the first
+// provider if id is empty. It returns nil if there is no such provider or OIDC
+// sign-in is disabled.
+func oidcClient(app *server.App, id string) *server.OIDCClient {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	if !app.SystemConfig.OIDCAuthEnabled {
+		return nil
+	}
+	for _, c := range app.OIDCClients {
+		if id == "" || c.Config.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
 // isValidRedirect checks that a redirect URL is a safe relative path.
 // It must start with "/", must not start with "//", and must not contain "://".
 func isValidRedirect(url string) bool {
@@ -34,16 +74,19 @@ func isValidRedirect(url string) bool {
 	return true
 }
 
-// OIDCAuthHandler initiates the OIDC authorization code flow by generating a
-// state parameter and redirecting the user to the OIDC provider.
+// OIDCAuthHandler initiates the OIDC authorization code flow with the provider
+// named by the "provider" query parameter (the first provider if omitted) by
+// generating a state parameter, nonce and PKCE verifier and redirecting the
+// user to the provider.
 func OIDCAuthHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		app.SysConfigMu.RLock()
-		oidcEnabled := app.SystemConfig.OIDCAuthEnabled
-		oauth2Config := app.OAuth2Config
-		app.SysConfigMu.RUnlock()
-
-		if !oidcEnabled || oauth2Config == nil {
+		providerID := r.URL.Query().Get("provider")
+		client := oidcClient(app, providerID)
+		if client == nil {
+			if providerID != "" && len(OIDCProviders(app)) > 0 {
+				http.Error(w, "Unknown OIDC provider", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "OIDC not configured", http.StatusServiceUnavailable)
 			return
 		}
@@ -57,6 +100,16 @@ func OIDCAuthHandler(app *server.App) http.HandlerFunc {
 		}
 		state := base64.URLEncoding.EncodeToString(stateBytes)
 
+		// The nonce ties the ID token and the PKCE verifier ties the code to this login
+		nonceBytes := make([]byte, 16)
+		if _, err := rand.Read(nonceBytes); err != nil {
+			log.Printf("Failed to generate OIDC nonce: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		nonce := base64.RawURLEncoding.EncodeToString(nonceBytes)
+		codeVerifier := oauth2.GenerateVerifier()
+
 		// Store state with redirect URL
 		redirectURL := r.URL.Query().Get("redirect")
 		if !isValidRedirect(redirectURL) {
@@ -64,8 +117,8 @@ func OIDCAuthHandler(app *server.App) http.HandlerFunc {
 		}
 
 		if app.DB != nil {
-			if _, err := app.DB.Exec("INSERT INTO oidc_states (state, redirect_url, created_at) VALUES (?, ?, ?)",
-				state, redirectURL, time.Now()); err != nil {
+			if _, err := app.DB.Exec("INSERT INTO oidc_states (state, redirect_url, nonce, code_verifier, provider_id, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+				state, redirectURL, nonce, codeVerifier, client.Config.ID, time.Now()); err != nil {
 				log.Printf("Failed to store OIDC state: %v", err)
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
 				return
@@ -77,44 +130,48 @@ func OIDCAuthHandler(app *server.App) http.HandlerFunc {
 		}
 
 		// Redirect to OIDC provider
-		authURL := oauth2Config.AuthCodeURL(state)
+		authURL := client.OAuth2.AuthCodeURL(state, oauth2.S256ChallengeOption(codeVerifier), oidc.Nonce(nonce))
 		http.Redirect(w, r, authURL, http.StatusFound)
 	}
 }
 
-// OIDCCallbackHandler handles the OIDC provider callback, exchanging the
-// authorization code for tokens, verifying the ID token, extracting user
-// claims, and creating a local session.
+// OIDCCallbackHandler handles the OIDC provider callback at
+// /auth/oidc/callback/<provider ID>, exchanging the authorization code for
+// tokens, verifying the ID token, extracting user claims, and creating a
+// local session. The bare /auth/oidc/callback path serves providers whose
+// redirect URL was registered before providers had their own callback.
 func OIDCCallbackHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		app.SysConfigMu.RLock()
-		oidcEnabled := app.SystemConfig.OIDCAuthEnabled
-		oauth2Config := app.OAuth2Config
-		oidcProvider := app.OIDCProvider
-		app.SysConfigMu.RUnlock()
-
-		if !oidcEnabled || oauth2Config == nil || oidcProvider == nil {
-			http.Error(w, "OIDC not configured", http.StatusServiceUnavailable)
+		if app.DB == nil {
+			http.Error(w, "OIDC authentication unavailable", http.StatusServiceUnavailable)
 			return
 		}
 
-		// Verify state
+		// Verify state; it must have been issued for the provider calling back
 		state := r.URL.Query().Get("state")
-		var redirectURL string
-		if app.DB == nil {
-			http.Error(w, "OIDC authentication unavailable", http.StatusServiceUnavailable)
+		var redirectURL, nonce, codeVerifier, providerID string
+		err := app.DB.QueryRow("SELECT redirect_url, COALESCE(nonce, ''), COALESCE(code_verifier, ''), COALESCE(provider_id, '') FROM oidc_states WHERE state = ?", state).
+			Scan(&redirectURL, &nonce, &codeVerifier, &providerID)
+		if err != nil || nonce == "" || codeVerifier == "" {
+			http.Error(w, "Invalid state", http.StatusBadRequest)
 			return
 		}
-		err := app.DB.QueryRow("SELECT redirect_url FROM oidc_states WHERE state = ?", state).Scan(&redirectURL)
-		if err != nil {
+		app.DB.Exec("DELETE FROM oidc_states WHERE state = ?", state)
+		if pathID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/auth/oidc/callback"), "/"); pathID != "" && pathID != providerID {
 			http.Error(w, "Invalid state", http.StatusBadRequest)
 			return
 		}
-		app.DB.Exec("DELETE FROM oidc_states WHERE state = ?", state)
 		if !isValidRedirect(redirectURL) {
 			redirectURL = "/"
 		}
 
+		client := oidcClient(app, providerID)
+		if client == nil {
+			http.Error(w, "OIDC not configured", http.StatusServiceUnavailable)
+			return
+		}
+		provider := client.Config
+
 		// Check for error from provider
 		if errMsg := r.URL.Query().Get("error"); errMsg != "" {
 			errDesc := r.URL.Query().Get("error_description")
@@ -126,7 +183,7 @@ func OIDCCallbackHandler(app *server.App) http.HandlerFunc {
 		// Exchange code for token
 		code := r.URL.Query().Get("code")
 		ctx := context.Background()
-		token, err := oauth2Config.Exchange(ctx, code)
+		token, err := client.OAuth2.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
 		if err != nil {
 			log.Printf("OIDC token exchange failed: %v", err)
 			http.Error(w, "Token exchange failed", http.StatusInternalServerError)
@@ -134,7 +191,7 @@ func OIDCCallbackHandler(app *server.App) http.HandlerFunc {
 		}
 
 		// Verify ID token
-		verifier := oidcProvider.Verifier(&oidc.Config{ClientID: oauth2Config.ClientID})
+		verifier := client.Provider.Verifier(&oidc.Config{ClientID: client.OAuth2.ClientID})
 		rawIDToken, ok := token.Extra("id_token").(string)
 		if !ok {
 			http.Error(w, "No ID token in response", http.StatusInternalServerError)
@@ -147,41 +204,34 @@ func OIDCCallbackHandler(app *server.App) http.HandlerFunc {
 			http.Error(w, "Token verification failed", http.StatusUnauthorized)
 			return
 		}
+		if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+			log.Printf("OIDC token verification failed: nonce mismatch")
+			http.Error(w, "Token verification failed", http.StatusUnauthorized)
+			return
+		}
 
-		// Extract claims
+		// Extract claims; the userinfo endpoint fills in what the ID token leaves out
+		var idClaims map[string]interface{}
+		if err := idToken.Claims(&idClaims); err != nil {
+			log.Printf("Failed to parse OIDC claims: %v", err)
+			http.Error(w, "Failed to parse claims", http.StatusInternalServerError)
+			return
+		}
+		userInfo := fetchUserInfo(ctx, client, token, idToken.Subject)
 		var claims struct {
-			Subject          string   `json:"sub"`
-			Email            string   `json:"email"`
-			Name             string   `json:"name"`
-			PreferredUsername string  `json:"preferred_username"`
-			Groups           []string `json:"groups"`
+			Subject           string      `json:"sub"`
+			Email             string      `json:"email"`
+			EmailVerified     interface{} `json:"email_verified"`
+			Name              string      `json:"name"`
+			PreferredUsername string      `json:"preferred_username"`
+			SessionID         string      `json:"sid"`
 		}
-		if err := idToken.Claims(&claims); err != nil {
+		if err := decodeClaims(mergeClaims(idClaims, userInfo), &claims); err != nil {
 			log.Printf("Failed to parse OIDC claims: %v", err)
 			http.Error(w, "Failed to parse claims", http.StatusInternalServerError)
 			return
 		}
-
-		// Also try to get groups from custom claim
-		var rawClaims map[string]interface{}
-		if err := idToken.Claims(&rawClaims); err != nil {
-			log.Printf("Failed to parse raw OIDC claims: %v", err)
-		}
-		app.SysConfigMu.RLock()
-		groupsClaimName := app.SystemConfig.OIDCGroupsClaim
-		app.SysConfigMu.RUnlock()
-		if groupsClaim, ok := rawClaims[groupsClaimName]; ok {
-			switch g := groupsClaim.(type) {
-			case []interface{}:
-				for _, v := range g {
-					if s, ok := v.(string); ok {
-						claims.Groups = append(claims.Groups, s)
-					}
-				}
-			case []string:
-				claims.Groups = g
-			}
-		}
+		groups := oidcGroups(provider, idClaims, userInfo)
 
 		// Determine username
 		username := claims.PreferredUsername
@@ -197,24 +247,54 @@ func OIDCCallbackHandler(app *server.App) http.HandlerFunc {
 			displayName = username
 		}
 
+		if len(provider.AllowedDomains) > 0 && !emailDomainAllowed(claims.Email, claims.EmailVerified, provider.AllowedDomains) {
+			log.Printf("OIDC login of %q via %q refused: email %q is not in an allowed domain", username, provider.ID, claims.Email)
+			http.Error(w, "Your account is not allowed to sign in with this provider", http.StatusForbidden)
+			return
+		}
+
+		// A username belongs to the provider that first signed it in, so another
+		// provider cannot take over the account by asserting the same name.
+		// Local and LDAP accounts are never taken over by an OIDC login.
+		var ownerProvider, passwordHash string
+		app.DB.QueryRow("SELECT COALESCE(oidc_provider, ''), password_hash FROM users WHERE username = ?", username).Scan(&ownerProvider, &passwordHash)
+		if passwordHash != "" && passwordHash != "OIDC_USER" {
+			log.Printf("OIDC login of %q via %q refused: the username belongs to a local or LDAP account", username, provider.ID)
+			http.Error(w, "This account signs in with a password", http.StatusForbidden)
+			return
+		}
+		if ownerProvider != "" && ownerProvider != provider.ID {
+			log.Printf("OIDC login of %q via %q refused: the account belongs to provider %q", username, provider.ID, ownerProvider)
+			http.Error(w, "This account signs in with a different provider", http.StatusForbidden)
+			return
+		}
+
 		// Create or update user in database using upsert to avoid race conditions
 		var userID int
-		groupsJSON, _ := json.Marshal(claims.Groups)
-		_, err = app.DB.Exec(
-			`INSERT INTO users (username, email, password_hash, display_name, groups)
-			 VALUES (?, ?, 'OIDC_USER', ?, ?)
+		groupsJSON, _ := json.Marshal(groups)
+		res, err := app.DB.Exec(
+			`INSERT INTO users (username, email, password_hash, display_name, groups, oidc_provider)
+			 VALUES (?, ?, 'OIDC_USER', ?, ?, ?)
 			 ON CONFLICT(username) DO UPDATE SET
 			   email = excluded.email,
 			   display_name = excluded.display_name,
 			   groups = excluded.groups,
-			   updated_at = ?`,
-			username, claims.Email, displayName, string(groupsJSON), time.Now(),
+			   oidc_provider = excluded.oidc_provider,
+			   updated_at = ?
+			 WHERE users.password_hash = 'OIDC_USER' AND COALESCE(users.oidc_provider, '') IN ('', excluded.oidc_provider)`,
+			username, claims.Email, displayName, string(groupsJSON), provider.ID, time.Now(),
 		)
 		if err != nil {
 			log.Printf("Failed to upsert OIDC user: %v", err)
 			http.Error(w, "Failed to create user", http.StatusInternalServerError)
 			return
 		}
+		// The account was created by another login method since the check above
+		if n, _ := res.RowsAffected(); n == 0 {
+			log.Printf("OIDC login of %q via %q refused: the account belongs to another login method", username, provider.ID)
+			http.Error(w, "This account signs in with a different method", http.StatusForbidden)
+			return
+		}
 		err = app.DB.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&userID)
 		if err != nil {
 			log.Printf("Failed to retrieve OIDC user ID: %v", err)
@@ -222,8 +302,10 @@ func OIDCCallbackHandler(app *server.App) http.HandlerFunc {
 			return
 		}
 
-		// Invalidate any existing sessions for this user to prevent session fixation
-		app.DB.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+		// Replace the session the browser arrived with to prevent session fixation
+		if cookie, err := r.Cookie(app.AuthConfig.CookieName); err == nil {
+			app.DB.Exec("DELETE FROM sessions WHERE token = ?", cookie.Value)
+		}
 
 		// Create session
 		sessionToken, err := GenerateSessionToken()
@@ -233,10 +315,12 @@ func OIDCCallbackHandler(app *server.App) http.HandlerFunc {
 			return
 		}
 
-		expiresAt := time.Now().Add(time.Duration(app.AuthConfig.SessionDuration) * 24 * time.Hour)
+		now := time.Now()
 		_, err = app.DB.Exec(
-			"INSERT INTO sessions (user_id, token, expires_at) VALUES (?, ?, ?)",
-			userID, sessionToken, expiresAt,
+			`INSERT INTO sessions (user_id, token, expires_at, ip_address, user_agent, created_at, last_seen_at, oidc_provider, oidc_sid, oidc_sub, oidc_id_token, oidc_refresh_token)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, sessionToken, NewSessionExpiry(app), ClientIP(app, r), SessionUserAgent(r), now, now,
+			provider.ID, claims.SessionID, idToken.Subject, encryptSessionToken(app, rawIDToken), encryptSessionToken(app, token.RefreshToken),
 		)
 		if err != nil {
 			log.Printf("Error creating session: %v", err)
@@ -249,7 +333,8 @@ func OIDCCallbackHandler(app *server.App) http.HandlerFunc {
 			Name:     app.AuthConfig.CookieName,
 			Value:    sessionToken,
 			Path:     "/",
-			Expires:  expiresAt,
+			Domain:   app.AuthConfig.CookieDomain,
+			Expires:  SessionCookieExpiry(app),
 			HttpOnly: true,
 			Secure:   app.AuthConfig.CookieSecure,
 			SameSite: http.SameSiteLaxMode,
@@ -258,3 +343,271 @@ func OIDCCallbackHandler(app *server.App) http.HandlerFunc {
 		http.Redirect(w, r, redirectURL, http.StatusFound)
 	}
 }
+
+// emailDomainAllowed reports whether email is in one of domains and the
+// provider has not marked it unverified.
+func emailDomainAllowed(email string, verified interface{}, domains []string) bool {
+	if v, ok := verified.(bool); ok && !v {
+		return false
+	}
+	if v, ok := verified.(string); ok && v != "true" {
+		return false
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, d := range domains {
+		if strings.EqualFold(strings.TrimPrefix(d, "@"), domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchUserInfo returns the claims from the provider's userinfo endpoint, or
+// nil if it has none or the request fails. Claims for a different subject
+// than the ID token's are discarded.
+func fetchUserInfo(ctx context.Context, client *server.OIDCClient, token *oauth2.Token, subject string) map[string]interface{} {
+	if client.Provider.UserInfoEndpoint() == "" || token.AccessToken == "" {
+		return nil
+	}
+	info, err := client.Provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+	if err != nil {
+		log.Printf("OIDC userinfo request to %q failed: %v", client.Config.ID, err)
+		return nil
+	}
+	if info.Subject != subject {
+		log.Printf("OIDC userinfo of %q ignored: subject %q does not match the ID token", client.Config.ID, info.Subject)
+		return nil
+	}
+	var claims map[string]interface{}
+	if err := info.Claims(&claims); err != nil {
+		log.Printf("Failed to parse OIDC userinfo claims: %v", err)
+		return nil
+	}
+	return claims
+}
+
+// mergeClaims combines ID token and userinfo claims. The signed ID token wins
+// where both carry a claim.
+func mergeClaims(idClaims, userInfo map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(idClaims)+len(userInfo))
+	for k, v := range userInfo {
+		merged[k] = v
+	}
+	for k, v := range idClaims {
+		merged[k] = v
+	}
+	return merged
+}
+
+// decodeClaims decodes a claim set into the struct v.
+func decodeClaims(claims map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// oidcGroups returns the groups a provider's claim sets grant: those selected
+// by its groups claim expression in any of the sets, plus its default groups.
+func oidcGroups(provider models.OIDCProvider, claimSets ...map[string]interface{}) []string {
+	groups := []string{}
+	for _, claims := range claimSets {
+		if claims == nil {
+			continue
+		}
+		for _, g := range groupsFromClaims(claims, provider.GroupsClaim) {
+			if !containsString(groups, g) {
+				groups = append(groups, g)
+			}
+		}
+	}
+	for _, g := range provider.DefaultGroups {
+		if !containsString(groups, g) {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// encryptSessionToken encrypts an OIDC token for the sessions table, so that
+// a leaked database or backup does not hand out refresh tokens. A token that
+// cannot be encrypted is not stored.
+func encryptSessionToken(app *server.App, token string) string {
+	encrypted, err := encryption.Encrypt(app.EncryptionKey, token)
+	if err != nil {
+		log.Printf("Error encrypting OIDC token: %v", err)
+		return ""
+	}
+	return encrypted
+}
+
+// DecryptSessionToken decrypts an OIDC token stored in the sessions table.
+// Tokens stored before they were encrypted are returned as they are.
+func DecryptSessionToken(app *server.App, stored string) string {
+	token, err := encryption.Decrypt(app.EncryptionKey, stored)
+	if err != nil {
+		log.Printf("Error decrypting OIDC token: %v", err)
+		return ""
+	}
+	return token
+}
+
+// refreshOIDCSession redeems the refresh token of an OIDC session and updates
+// the groups of its user from the new ID token and userinfo claims. It returns
+// the new groups, or nil if they could not be determined. It reports false if
+// the provider rejected the refresh token, in which case the session has been
+// deleted.
+func refreshOIDCSession(app *server.App, sessionID, userID int, providerID, subject, refreshToken string) ([]string, bool) {
+	client := oidcClient(app, providerID)
+	if client == nil {
+		return nil, true
+	}
+
+	// Concurrent requests of a session must not redeem the same token twice,
+	// since providers that rotate refresh tokens revoke the session on reuse
+	app.OIDCRefreshMu.Lock()
+	if app.OIDCRefreshing == nil {
+		app.OIDCRefreshing = make(map[int]bool)
+	}
+	busy := app.OIDCRefreshing[sessionID]
+	app.OIDCRefreshing[sessionID] = true
+	app.OIDCRefreshMu.Unlock()
+	if busy {
+		return nil, true
+	}
+	defer func() {
+		app.OIDCRefreshMu.Lock()
+		delete(app.OIDCRefreshing, sessionID)
+		app.OIDCRefreshMu.Unlock()
+	}()
+	var current string
+	if err := app.DB.QueryRow("SELECT COALESCE(oidc_refresh_token, '') FROM sessions WHERE id = ?", sessionID).Scan(&current); err != nil ||
+		DecryptSessionToken(app, current) != refreshToken {
+		return nil, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	token, err := client.OAuth2.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+			log.Printf("OIDC session of %q ended: provider %q rejected the refresh token", subject, providerID)
+			if _, err := app.DB.Exec("DELETE FROM sessions WHERE id = ?", sessionID); err != nil {
+				log.Printf("Error deleting OIDC session: %v", err)
+			}
+			return nil, false
+		}
+		log.Printf("OIDC token refresh with %q failed: %v", providerID, err)
+		return nil, true
+	}
+
+	var idClaims map[string]interface{}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken != "" {
+		idToken, err := client.Provider.Verifier(&oidc.Config{ClientID: client.OAuth2.ClientID}).Verify(ctx, rawIDToken)
+		if err == nil && idToken.Subject != subject {
+			err = errors.New("subject changed")
+		}
+		if err != nil {
+			log.Printf("OIDC refreshed ID token from %q rejected: %v", providerID, err)
+			return nil, true
+		}
+		if err := idToken.Claims(&idClaims); err != nil {
+			log.Printf("Failed to parse refreshed OIDC claims: %v", err)
+		}
+	}
+	userInfo := fetchUserInfo(ctx, client, token, subject)
+
+	if _, err := app.DB.Exec("UPDATE sessions SET oidc_refresh_token = ?, oidc_id_token = COALESCE(NULLIF(?, ''), oidc_id_token) WHERE id = ?",
+		encryptSessionToken(app, token.RefreshToken), encryptSessionToken(app, rawIDToken), sessionID); err != nil {
+		log.Printf("Error storing refreshed OIDC tokens: %v", err)
+	}
+	// Without a new ID token, userinfo that lacks the groups claim cannot be
+	// told apart from a provider that only puts groups in ID tokens
+	if idClaims == nil && len(groupsFromClaims(userInfo, client.Config.GroupsClaim)) == 0 {
+		return nil, true
+	}
+
+	groups := oidcGroups(client.Config, idClaims, userInfo)
+	groupsJSON, _ := json.Marshal(groups)
+	if _, err := app.DB.Exec("UPDATE users SET groups = ?, updated_at = ? WHERE id = ?", string(groupsJSON), time.Now(), userID); err != nil {
+		log.Printf("Error updating OIDC user groups: %v", err)
+	}
+	return groups, true
+}
+
+// OIDCEndSessionEndpoint returns the RP-initiated logout endpoint of a
+// provider and the client ID DashGate uses there. The endpoint is "" if the
+// provider is not configured or does not advertise one.
+func OIDCEndSessionEndpoint(app *server.App, providerID string) (endpoint, clientID string) {
+	client := oidcClient(app, providerID)
+	if client == nil {
+		return "", ""
+	}
+
+	var metadata struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	if err := client.Provider.Claims(&metadata); err != nil {
+		return "", ""
+	}
+	return metadata.EndSessionEndpoint, client.OAuth2.ClientID
+}
+
+// OIDCLogout identifies the provider session ended by a back-channel logout
+// token. At least one of Subject and SessionID is set.
+type OIDCLogout struct {
+	Provider  string
+	Subject   string
+	SessionID string
+}
+
+// VerifyOIDCLogoutToken checks the signature, issuer, audience and expiry of a
+// back-channel logout token and that it is a logout token rather than an ID
+// token: it must carry the back-channel logout event, a sub or sid claim, and
+// no nonce. providerID names the provider that sent it; "" means the first.
+func VerifyOIDCLogoutToken(ctx context.Context, app *server.App, providerID, rawToken string) (*OIDCLogout, error) {
+	client := oidcClient(app, providerID)
+	if client == nil {
+		return nil, errors.New("OIDC provider not configured")
+	}
+
+	token, err := client.Provider.Verifier(&oidc.Config{ClientID: client.OAuth2.ClientID}).Verify(ctx, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims struct {
+		SessionID string                     `json:"sid"`
+		Events    map[string]json.RawMessage `json:"events"`
+	}
+	if err := token.Claims(&claims); err != nil {
+		return nil, err
+	}
+	if _, ok := claims.Events[backChannelLogoutEvent]; !ok {
+		return nil, errors.New("logout token lacks the back-channel logout event")
+	}
+	if token.Nonce != "" {
+		return nil, errors.New("logout token must not contain a nonce")
+	}
+	if token.Subject == "" && claims.SessionID == "" {
+		return nil, errors.New("logout token has neither sub nor sid")
+	}
+	return &OIDCLogout{Provider: client.Config.ID, Subject: token.Subject, SessionID: claims.SessionID}, nil
+}
@@ -14,8 +14,6 @@ import (
 // configured trusted proxy IP or CIDR range.
 func IsRequestFromTrustedProxy(app *server.App, r *http.Request) bool {
 	app.SysConfigMu.RLock()
-	nets := app.TrustedProxyNets
-	ips := app.TrustedProxyIPs
 	hasTrusted := app.SystemConfig.TrustedProxies != ""
 	app.SysConfigMu.RUnlock()
 
@@ -24,35 +22,100 @@ func IsRequestFromTrustedProxy(app *server.App, r *http.Request) bool {
 		return false
 	}
 
-	remoteIP := r.RemoteAddr
-	if host, _, err := net.SplitHostPort(remoteIP); err == nil {
-		remoteIP = host
-	}
+	remoteIP := remoteAddrIP(r)
 	parsedRemoteIP := net.ParseIP(remoteIP)
 	if parsedRemoteIP == nil {
 		log.Printf("Warning: could not parse remote IP: %s", remoteIP)
 		return false
 	}
 
+	if isTrustedProxyIP(app, parsedRemoteIP) {
+		return true
+	}
+
+	log.Printf("Proxy auth headers rejected from untrusted IP: %s", remoteIP)
+	return false
+}
+
+// isTrustedProxyIP reports whether ip is one of the configured trusted proxies.
+func isTrustedProxyIP(app *server.App, ip net.IP) bool {
+	app.SysConfigMu.RLock()
+	nets := app.TrustedProxyNets
+	ips := app.TrustedProxyIPs
+	app.SysConfigMu.RUnlock()
+
 	for _, cidr := range nets {
-		if cidr.Contains(parsedRemoteIP) {
+		if cidr.Contains(ip) {
 			return true
 		}
 	}
-
-	for _, ip := range ips {
-		if ip.Equal(parsedRemoteIP) {
+	for _, trusted := range ips {
+		if trusted.Equal(ip) {
 			return true
 		}
 	}
-
-	log.Printf("Proxy auth headers rejected from untrusted IP: %s", remoteIP)
 	return false
 }
 
+func remoteAddrIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// ClientIP returns the IP address of the client that sent the request. When
+// the request comes from a trusted proxy, X-Forwarded-For is walked from the
+// right, skipping further trusted proxies, so the first untrusted hop is
+// used; otherwise the headers are ignored because any client can set them.
+func ClientIP(app *server.App, r *http.Request) string {
+	remoteIP := remoteAddrIP(r)
+	parsed := net.ParseIP(remoteIP)
+	if parsed == nil || !isTrustedProxyIP(app, parsed) {
+		return remoteIP
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	if len(hops) == 0 {
+		if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+			return realIP.String()
+		}
+		return remoteIP
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// Unparseable hop: stop trusting the chain here
+			return remoteIP
+		}
+		if i == 0 || !isTrustedProxyIP(app, ip) {
+			return ip.String()
+		}
+	}
+	return remoteIP
+}
+
+// SessionUserAgent returns the request's User-Agent header, truncated for storage.
+func SessionUserAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > 512 {
+		ua = ua[:512]
+	}
+	return ua
+}
+
 // GetAutheliaUser extracts user information from proxy authentication headers
 // (Remote-User, Remote-Groups, Remote-Name, Remote-Email) after verifying the
-// request comes from a trusted proxy.
+// request comes from a trusted proxy. The user still has to go through
+// ResolveUser.
 func GetAutheliaUser(app *server.App, r *http.Request) *models.AuthenticatedUser {
 	username := r.Header.Get("Remote-User")
 	if username == "" {
@@ -87,6 +150,5 @@ func GetAutheliaUser(app *server.App, r *http.Request) *models.AuthenticatedUser
 		Groups:      groups,
 		Source:      "authelia",
 	}
-	user.IsAdmin = CheckIsAdmin(app, user.Groups)
 	return user
 }
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"dashgate/internal/server"
+)
+
+func TestClientIP(t *testing.T) {
+	app := server.New()
+	_, proxyNet, _ := net.ParseCIDR("10.0.0.0/8")
+	app.TrustedProxyNets = []*net.IPNet{proxyNet}
+	app.TrustedProxyIPs = []net.IP{net.ParseIP("192.0.2.10")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		realIP     string
+		want       string
+	}{
+		{"direct client", "203.0.113.5:1234", "", "", "203.0.113.5"},
+		{"headers from untrusted client are ignored", "203.0.113.5:1234", "198.51.100.1", "198.51.100.2", "203.0.113.5"},
+		{"trusted proxy", "10.1.2.3:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed hop left of the real client", "10.1.2.3:1234", "6.6.6.6, 198.51.100.1", "", "198.51.100.1"},
+		{"chain of trusted proxies", "192.0.2.10:1234", "198.51.100.1, 10.0.0.7", "", "198.51.100.1"},
+		{"only trusted hops", "10.1.2.3:1234", "10.0.0.7", "", "10.0.0.7"},
+		{"X-Real-IP fallback", "10.1.2.3:1234", "", "198.51.100.3", "198.51.100.3"},
+		{"garbage hop", "10.1.2.3:1234", "not-an-ip", "", "10.1.2.3"},
+		{"IPv6 client", "10.1.2.3:1234", "2001:db8::1", "", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := ClientIP(app, r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
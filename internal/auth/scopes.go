@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// API key scopes. A key can only use endpoints covered by its scopes;
+// ScopeAdmin covers everything. Session users are not restricted by scopes.
+const (
+	ScopeDashboardRead = "dashboard:read"
+	ScopeHealthRead    = "health:read"
+	ScopeAppsAccess    = "apps:access" // pass forward-auth (/api/auth/verify)
+	ScopeAppsWrite     = "apps:write"
+	ScopeAdmin         = "admin"
+)
+
+// APIKeyScopes lists the valid scopes in display order.
+var APIKeyScopes = []string{ScopeDashboardRead, ScopeHealthRead, ScopeAppsAccess, ScopeAppsWrite, ScopeAdmin}
+
+// DefaultAPIKeyScopes are given to new keys created without scopes.
+var DefaultAPIKeyScopes = []string{ScopeDashboardRead, ScopeHealthRead}
+
+// legacyPermissions maps the permissions stored before scopes existed.
+var legacyPermissions = map[string][]string{
+	"read":  {ScopeDashboardRead, ScopeHealthRead},
+	"write": {ScopeAppsWrite},
+}
+
+// expandScopes resolves legacy permission names and returns the known scopes
+// in APIKeyScopes order, along with any names it did not recognize.
+func expandScopes(permissions []string) ([]string, []string) {
+	want := make(map[string]bool)
+	var unknown []string
+	for _, p := range permissions {
+		if legacy, ok := legacyPermissions[p]; ok {
+			for _, s := range legacy {
+				want[s] = true
+			}
+			continue
+		}
+		known := false
+		for _, s := range APIKeyScopes {
+			if p == s {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknown = append(unknown, p)
+			continue
+		}
+		want[p] = true
+	}
+
+	scopes := []string{}
+	for _, s := range APIKeyScopes {
+		if want[s] {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, unknown
+}
+
+// ParseScopes returns the scopes of a stored key, ignoring unknown names.
+func ParseScopes(permissions []string) []string {
+	scopes, _ := expandScopes(permissions)
+	return scopes
+}
+
+// NormalizeScopes validates the scopes requested for a new key. An empty list
+// gives DefaultAPIKeyScopes.
+func NormalizeScopes(permissions []string) ([]string, error) {
+	if len(permissions) == 0 {
+		return append([]string(nil), DefaultAPIKeyScopes...), nil
+	}
+	scopes, unknown := expandScopes(permissions)
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown scope %q", unknown[0])
+	}
+	return scopes, nil
+}
+
+// HasScope reports whether user may use an endpoint that needs scope. Only
+// API key users are limited by scopes.
+func HasScope(user *models.AuthenticatedUser, scope string) bool {
+	if user == nil || user.Source != "apikey" {
+		return true
+	}
+	for _, s := range user.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// denyAPIKeyScope rejects a key that lacks the scope for an endpoint.
+func denyAPIKeyScope(w http.ResponseWriter, scope string) {
+	http.Error(w, fmt.Sprintf("Forbidden: API key lacks the %q scope", scope), http.StatusForbidden)
+}
+
+// RequireScope rejects requests authenticated with an API key that lacks
+// scope. Other requests pass through; the wrapped handler still decides
+// whether they are authenticated.
+func RequireScope(app *server.App, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user := GetAPIKeyUser(app, r); user != nil && !HasScope(user, scope) {
+			denyAPIKeyScope(w, scope)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// BrowserOnly rejects requests authenticated with an API key, for pages and
+// endpoints that only make sense for a signed-in browser.
+func BrowserOnly(app *server.App, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if GetAPIKeyUser(app, r) != nil {
+			http.Error(w, "Forbidden: not available with an API key", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
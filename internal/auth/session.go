@@ -2,7 +2,12 @@ package auth
 
 import (
 	"crypto/rand"
+	"database/sql"
 	"encoding/hex"
+	"log"
+	"time"
+
+	"dashgate/internal/server"
 )
 
 // GenerateSessionToken creates a cryptographically random 32-byte session
@@ -14,3 +19,94 @@ func GenerateSessionToken() (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+// Session lifetime defaults, used when the system config leaves them unset.
+const (
+	DefaultSessionRenewInterval = 5 * time.Minute
+	DefaultSessionMaxDays       = 30
+
+	// maxCookieLifetime is the longest expiry browsers honour for a cookie.
+	maxCookieLifetime = 400 * 24 * time.Hour
+)
+
+// sessionPolicy is the session lifetime configuration in effect.
+type sessionPolicy struct {
+	window   time.Duration // sliding expiry after the last renewal
+	idle     time.Duration // 0 = no idle timeout
+	renew    time.Duration // minimum time between renewals
+	lifetime time.Duration // absolute maximum since sign-in, 0 = unlimited
+}
+
+func currentSessionPolicy(app *server.App) sessionPolicy {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+
+	p := sessionPolicy{
+		window:   time.Duration(app.AuthConfig.SessionDuration) * 24 * time.Hour,
+		idle:     time.Duration(app.SystemConfig.SessionIdleMinutes) * time.Minute,
+		renew:    time.Duration(app.SystemConfig.SessionRenewMinutes) * time.Minute,
+		lifetime: time.Duration(app.SystemConfig.SessionMaxDays) * 24 * time.Hour,
+	}
+	if p.renew <= 0 {
+		p.renew = DefaultSessionRenewInterval
+	}
+	return p
+}
+
+// expiry returns when a session started at createdAt expires if it is
+// renewed at now: one window from now, but never past the absolute lifetime.
+func (p sessionPolicy) expiry(createdAt, now time.Time) time.Time {
+	expires := now.Add(p.window)
+	if p.lifetime > 0 {
+		if limit := createdAt.Add(p.lifetime); expires.After(limit) {
+			expires = limit
+		}
+	}
+	return expires
+}
+
+// NewSessionExpiry returns the initial expires_at for a session created now.
+func NewSessionExpiry(app *server.App) time.Time {
+	now := time.Now()
+	return currentSessionPolicy(app).expiry(now, now)
+}
+
+// SessionCookieExpiry returns the Expires value for a new session cookie. The
+// cookie outlives the sliding expiry so renewals don't need to re-set it; the
+// server-side expires_at decides whether the session is still valid.
+func SessionCookieExpiry(app *server.App) time.Time {
+	p := currentSessionPolicy(app)
+	if p.lifetime > 0 && p.lifetime < maxCookieLifetime {
+		return time.Now().Add(p.lifetime)
+	}
+	return time.Now().Add(maxCookieLifetime)
+}
+
+// touchSession applies the idle timeout and sliding renewal to a session that
+// was just used. It reports ok = false (and deletes the session) if the
+// session has been idle too long, and renewed = true if its expiry was
+// extended. Renewals are written at most once per renew interval.
+func touchSession(app *server.App, sessionID int, createdAt time.Time, lastSeen sql.NullTime) (ok, renewed bool) {
+	p := currentSessionPolicy(app)
+	now := time.Now()
+
+	lastActive := createdAt
+	if lastSeen.Valid {
+		lastActive = lastSeen.Time
+	}
+	if p.idle > 0 && now.Sub(lastActive) > p.idle {
+		if _, err := app.DB.Exec("DELETE FROM sessions WHERE id = ?", sessionID); err != nil {
+			log.Printf("Error deleting idle session: %v", err)
+		}
+		return false, false
+	}
+
+	if lastSeen.Valid && now.Sub(lastSeen.Time) < p.renew {
+		return true, false
+	}
+	if _, err := app.DB.Exec("UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE id = ?", now, p.expiry(createdAt, now), sessionID); err != nil {
+		log.Printf("Error renewing session: %v", err)
+		return true, false
+	}
+	return true, true
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 Appendix B test vectors for HMAC-SHA1.
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		if got := hotp(key, uint64(tt.unix/totpPeriod), 8); got != tt.want {
+			t.Errorf("hotp at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+	currentStep := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		code     string
+		at       time.Time
+		lastStep int64
+		wantOK   bool
+	}{
+		{"current step", code, now, 0, true},
+		{"previous step within skew", code, now.Add(totpPeriod * time.Second), 0, true},
+		{"outside skew", code, now.Add(3 * totpPeriod * time.Second), 0, false},
+		{"replayed step", code, now, currentStep, false},
+		{"wrong code", "000000", now, 0, false},
+		{"wrong length", "12345", now, 0, false},
+		{"spaces ignored", code[:3] + " " + code[3:], now, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(secret, tt.code, tt.at, tt.lastStep)
+			if ok != tt.wantOK {
+				t.Fatalf("ValidateTOTP ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step != currentStep {
+				t.Errorf("step = %d, want %d", step, currentStep)
+			}
+		})
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("JBSWY3DPEHPK3PXP", "alice")
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/DashGate:alice" {
+		t.Errorf("unexpected URI %q", uri)
+	}
+	if u.Query().Get("secret") != "JBSWY3DPEHPK3PXP" || u.Query().Get("issuer") != "DashGate" {
+		t.Errorf("unexpected query %q", u.RawQuery)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+	seen := make(map[string]bool)
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Errorf("unexpected code format %q", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate code %q", c)
+		}
+		seen[c] = true
+	}
+
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) {
+		t.Error("HashRecoveryCode should ignore case, dashes and surrounding spaces")
+	}
+}
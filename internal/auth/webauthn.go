@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// PasskeyRPName is the relying party name shown by browsers and authenticators.
+const PasskeyRPName = "DashGate"
+
+// ErrPasskeysUnavailable is returned when no usable external URL is configured,
+// because the relying party ID has to match the host users browse to.
+var ErrPasskeysUnavailable = fmt.Errorf("passkeys require an external URL to be configured")
+
+// NewWebAuthn returns a relying party for the given external URL. The RP ID is
+// the URL's host name and the only accepted origin is scheme://host[:port].
+func NewWebAuthn(externalURL string) (*webauthn.WebAuthn, error) {
+	if strings.TrimSpace(externalURL) == "" {
+		return nil, ErrPasskeysUnavailable
+	}
+	u, err := url.Parse(strings.TrimSpace(externalURL))
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("%w: invalid external URL %q", ErrPasskeysUnavailable, externalURL)
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: PasskeyRPName,
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+	})
+}
+
+// GenerateWebAuthnHandle returns a random user handle. Handles are opaque
+// (never the username or database ID) so authenticators do not leak them.
+func GenerateWebAuthnHandle() (string, error) {
+	handle := make([]byte, 32)
+	if _, err := rand.Read(handle); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(handle), nil
+}
+
+// PasskeyUser adapts a DashGate user and their stored credentials to the
+// webauthn.User interface.
+type PasskeyUser struct {
+	ID          int
+	Handle      []byte
+	Username    string
+	DisplayName string
+	Credentials []webauthn.Credential
+}
+
+func (u *PasskeyUser) WebAuthnID() []byte                         { return u.Handle }
+func (u *PasskeyUser) WebAuthnName() string                       { return u.Username }
+func (u *PasskeyUser) WebAuthnCredentials() []webauthn.Credential { return u.Credentials }
+
+func (u *PasskeyUser) WebAuthnDisplayName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Username
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"dashgate/internal/server"
+)
+
+// Defaults for API key housekeeping, used until set in system config.
+const (
+	DefaultAPIKeyUsageDays = 30
+	DefaultAPIKeyStaleDays = 90
+)
+
+// InitAPIKeyTables adds the allowlist, rate limit and rotation columns to
+// api_keys and creates the api_key_usage table.
+func InitAPIKeyTables(app *server.App) error {
+	columns := []struct{ name, def string }{
+		{"allowed_cidrs", "TEXT DEFAULT '[]'"},
+		{"rate_limit", "INTEGER DEFAULT 0"},
+		{"replaced_by", "INTEGER"},
+	}
+	for _, c := range columns {
+		if _, err := app.DB.Exec("ALTER TABLE api_keys ADD COLUMN " + c.name + " " + c.def); err != nil {
+			if !strings.Contains(err.Error(), "duplicate column") {
+				return err
+			}
+		}
+	}
+
+	_, err := app.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS api_key_usage (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			key_id INTEGER NOT NULL,
+			used_at DATETIME NOT NULL,
+			method TEXT NOT NULL,
+			path TEXT NOT NULL,
+			ip TEXT DEFAULT '',
+			status INTEGER NOT NULL,
+			FOREIGN KEY (key_id) REFERENCES api_keys(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_api_key_usage_key ON api_key_usage(key_id, used_at);
+		CREATE INDEX IF NOT EXISTS idx_api_key_usage_used_at ON api_key_usage(used_at);
+	`)
+	return err
+}
+
+// APIKeyUsage is one request made with an API key.
+type APIKeyUsage struct {
+	UsedAt time.Time `json:"usedAt"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	IP     string    `json:"ip"`
+	Status int       `json:"status"`
+}
+
+// LogAPIKeyUsage records a request made with an API key.
+func LogAPIKeyUsage(app *server.App, keyID int, method, path, ip string, status int) {
+	if _, err := app.DB.Exec(
+		"INSERT INTO api_key_usage (key_id, used_at, method, path, ip, status) VALUES (?, ?, ?, ?, ?, ?)",
+		keyID, time.Now(), method, path, ip, status,
+	); err != nil {
+		log.Printf("Error logging API key usage: %v", err)
+	}
+}
+
+// ListAPIKeyUsage returns the most recent requests made with a key, newest first.
+func ListAPIKeyUsage(app *server.App, keyID, limit int) ([]APIKeyUsage, error) {
+	rows, err := app.DB.Query(
+		"SELECT used_at, method, path, COALESCE(ip, ''), status FROM api_key_usage WHERE key_id = ? ORDER BY used_at DESC, id DESC LIMIT ?",
+		keyID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []APIKeyUsage{}
+	for rows.Next() {
+		var u APIKeyUsage
+		if err := rows.Scan(&u.UsedAt, &u.Method, &u.Path, &u.IP, &u.Status); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// CleanupAPIKeyUsage deletes usage records older than the configured retention.
+func CleanupAPIKeyUsage(app *server.App) {
+	app.SysConfigMu.RLock()
+	days := app.SystemConfig.APIKeyUsageDays
+	app.SysConfigMu.RUnlock()
+	if days <= 0 {
+		days = DefaultAPIKeyUsageDays
+	}
+	cutoff := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	if _, err := app.DB.Exec("DELETE FROM api_key_usage WHERE used_at < ?", cutoff); err != nil {
+		log.Printf("Error cleaning up API key usage: %v", err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"dashgate/internal/auth"
+	"dashgate/internal/mailer"
 	"dashgate/internal/models"
 	"dashgate/internal/server"
 
@@ -31,6 +32,33 @@ func InitAuthConfigDefaults(app *server.App) {
 	app.AuthConfig.CookieSecure = true
 	app.AuthConfig.Mode = models.AuthModeAuthelia
 
+	// Sliding sessions with an absolute limit, until set in system config
+	app.SystemConfig.SessionRenewMinutes = int(auth.DefaultSessionRenewInterval / time.Minute)
+	app.SystemConfig.SessionMaxDays = auth.DefaultSessionMaxDays
+
+	// Per-account lockout, until set in system config
+	app.SystemConfig.LockoutThreshold = DefaultLockoutThreshold
+	app.SystemConfig.LockoutMinutes = DefaultLockoutMinutes
+
+	// API key usage retention and stale flag, until set in system config
+	app.SystemConfig.APIKeyUsageDays = DefaultAPIKeyUsageDays
+	app.SystemConfig.APIKeyStaleDays = DefaultAPIKeyStaleDays
+
+	// Password reset links and outgoing email, until set in system config
+	app.SystemConfig.PasswordResetMinutes = DefaultPasswordResetMinutes
+	app.SystemConfig.SMTPPort = 587
+	app.SystemConfig.SMTPSecurity = mailer.SecurityStartTLS
+
+	// Directory sync schedule, until set in system config
+	app.SystemConfig.DirectorySyncInterval = DefaultDirectorySyncMinutes
+	app.SystemConfig.DirectorySyncRemoved = DefaultDirectorySyncRemoved
+
+	// Match icons for discovered apps unless disabled in system config
+	app.SystemConfig.IconAutoMatch = true
+
+	// Public base URL (used as the passkey relying party), until set in system config
+	app.SystemConfig.ExternalURL = strings.TrimRight(os.Getenv("EXTERNAL_URL"), "/")
+
 	// Override with env vars if present
 	if mode := os.Getenv("AUTH_MODE"); mode != "" {
 		switch mode {
@@ -50,6 +78,8 @@ func InitAuthConfigDefaults(app *server.App) {
 	if os.Getenv("COOKIE_SECURE") == "false" {
 		app.AuthConfig.CookieSecure = false
 	}
+
+	app.AuthConfig.CookieDomain = os.Getenv("COOKIE_DOMAIN")
 }
 
 // InitDatabase opens the SQLite database, creates the schema, loads system config,
@@ -161,6 +191,7 @@ func InitDatabase(app *server.App) error {
 		category TEXT DEFAULT '',
 		groups TEXT DEFAULT '[]',
 		hidden INTEGER DEFAULT 0,
+		hidden_set INTEGER DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -184,18 +215,85 @@ func InitDatabase(app *server.App) error {
 			log.Printf("Migration warning (url_override): %v", err)
 		}
 	}
+	if _, err := app.DB.Exec("ALTER TABLE discovered_app_overrides ADD COLUMN hidden_set INTEGER DEFAULT 0"); err != nil {
+		if !strings.Contains(err.Error(), "duplicate column") {
+			log.Printf("Migration warning (hidden_set): %v", err)
+		}
+	}
 	if _, err := app.DB.Exec("ALTER TABLE user_preferences ADD COLUMN username TEXT NOT NULL DEFAULT ''"); err != nil {
 		if !strings.Contains(err.Error(), "duplicate column") {
 			log.Printf("Migration warning (username): %v", err)
 		}
 	}
 	app.DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_user_preferences_username ON user_preferences(username) WHERE username != ''")
+	for _, col := range []string{"nonce", "code_verifier", "provider_id"} {
+		if _, err := app.DB.Exec("ALTER TABLE oidc_states ADD COLUMN " + col + " TEXT DEFAULT ''"); err != nil {
+			if !strings.Contains(err.Error(), "duplicate column") {
+				log.Printf("Migration warning (%s): %v", col, err)
+			}
+		}
+	}
 
 	// Create audit log table
 	if err := InitAuditTable(app); err != nil {
 		return fmt.Errorf("failed to create audit_log table: %w", err)
 	}
 
+	// Create discovery rules table
+	if err := InitDiscoveryRulesTable(app); err != nil {
+		return fmt.Errorf("failed to create discovery_rules table: %w", err)
+	}
+
+	// Create group mapping tables
+	if err := InitGroupMappingTables(app); err != nil {
+		return fmt.Errorf("failed to create group mapping tables: %w", err)
+	}
+
+	// Create TOTP two-factor tables
+	if err := InitTOTPTables(app); err != nil {
+		return fmt.Errorf("failed to create TOTP tables: %w", err)
+	}
+
+	// Create passkey (WebAuthn) tables
+	if err := InitWebAuthnTables(app); err != nil {
+		return fmt.Errorf("failed to create WebAuthn tables: %w", err)
+	}
+
+	// Create per-account login failure tracking
+	if err := InitLoginFailuresTable(app); err != nil {
+		return fmt.Errorf("failed to create login_failures table: %w", err)
+	}
+
+	// Create one-time password reset tokens
+	if err := InitPasswordResetTable(app); err != nil {
+		return fmt.Errorf("failed to create password_reset_tokens table: %w", err)
+	}
+
+	// Create onboarding invitations
+	if err := InitInvitationsTable(app); err != nil {
+		return fmt.Errorf("failed to create invitations table: %w", err)
+	}
+
+	// Add API key allowlists, rate limits, rotation and usage log
+	if err := InitAPIKeyTables(app); err != nil {
+		return fmt.Errorf("failed to migrate api_keys table: %w", err)
+	}
+
+	// Add client details to sessions
+	if err := InitSessionColumns(app); err != nil {
+		return fmt.Errorf("failed to migrate sessions table: %w", err)
+	}
+
+	// Add the disabled flag set by the directory sync
+	if err := InitUserDisabledColumn(app); err != nil {
+		return fmt.Errorf("failed to migrate users table: %w", err)
+	}
+
+	// Create OIDC providers, migrating a single configured provider
+	if err := InitOIDCProvidersTable(app); err != nil {
+		return fmt.Errorf("failed to create oidc_providers table: %w", err)
+	}
+
 	log.Printf("Database initialized at %s", dbPath)
 
 	// Initialize encryption key before loading config so sensitive values
@@ -238,6 +336,16 @@ func InitDatabase(app *server.App) error {
 		log.Printf("Warning: failed to load discovered overrides: %v", err)
 	}
 
+	// Load discovery rules cache
+	if err := LoadDiscoveryRules(app); err != nil {
+		log.Printf("Warning: failed to load discovery rules: %v", err)
+	}
+
+	// Load group mapping cache
+	if err := LoadGroupMappings(app); err != nil {
+		log.Printf("Warning: failed to load group mappings: %v", err)
+	}
+
 	return nil
 }
 
@@ -264,7 +372,8 @@ func StartSessionCleanupLoop(app *server.App, ctx context.Context) {
 	}()
 }
 
-// CleanupExpiredSessions deletes sessions that have passed their expiry time.
+// CleanupExpiredSessions deletes sessions that have passed their expiry time
+// or have been idle longer than the configured idle timeout.
 func CleanupExpiredSessions(app *server.App) {
 	if app.DB == nil {
 		return
@@ -277,6 +386,25 @@ func CleanupExpiredSessions(app *server.App) {
 	if rows, _ := result.RowsAffected(); rows > 0 {
 		log.Printf("Cleaned up %d expired sessions", rows)
 	}
+
+	app.SysConfigMu.RLock()
+	idle := time.Duration(app.SystemConfig.SessionIdleMinutes) * time.Minute
+	app.SysConfigMu.RUnlock()
+	if idle > 0 {
+		result, err := app.DB.Exec("DELETE FROM sessions WHERE COALESCE(last_seen_at, created_at) < ?", time.Now().Add(-idle))
+		if err != nil {
+			log.Printf("Error cleaning up idle sessions: %v", err)
+		} else if rows, _ := result.RowsAffected(); rows > 0 {
+			log.Printf("Cleaned up %d idle sessions", rows)
+		}
+	}
+
+	CleanupExpiredLoginChallenges(app)
+	CleanupLoginFailures(app)
+	CleanupPasswordResetTokens(app)
+	CleanupInvitations(app)
+	CleanupAPIKeyUsage(app)
+	CleanupExpiredWebAuthnCeremonies(app)
 }
 
 // NeedsSetup returns true if the application requires initial setup
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// Defaults for the directory sync, used until set in system config.
+const (
+	DefaultDirectorySyncMinutes = 60
+	DefaultDirectorySyncRemoved = DirectorySyncDisable
+)
+
+// What the directory sync does with LDAP users that are no longer in the
+// directory.
+const (
+	DirectorySyncDisable = "disable" // keep the user (and their settings) but block sign-in
+	DirectorySyncDelete  = "delete"
+)
+
+// InitUserDisabledColumn adds the flag the directory sync sets on users that
+// were removed from the directory.
+func InitUserDisabledColumn(app *server.App) error {
+	if _, err := app.DB.Exec("ALTER TABLE users ADD COLUMN disabled INTEGER DEFAULT 0"); err != nil {
+		if !strings.Contains(err.Error(), "duplicate column") {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncedUser is an LDAP user row as seen by ApplyDirectorySync.
+type syncedUser struct {
+	id          int
+	email       string
+	displayName string
+	groups      []string
+	disabled    bool
+}
+
+// ApplyDirectorySync makes the LDAP users in the users table match the users
+// found in the directory: missing users are added, changed ones updated and
+// disabled ones re-enabled. LDAP users no longer in the directory are
+// disabled or deleted according to removed, and their sessions end. Local and
+// OIDC accounts are never changed; a directory user whose username or email
+// is taken by one is skipped. The counts are added to result once the
+// changes are committed.
+func ApplyDirectorySync(app *server.App, users []models.AuthenticatedUser, removed string, result *models.DirectorySyncResult) error {
+	existing := make(map[string]*syncedUser)
+	rows, err := app.DB.Query(
+		`SELECT id, username, COALESCE(email, ''), COALESCE(display_name, ''), COALESCE(groups, '[]'), COALESCE(disabled, 0)
+		 FROM users WHERE password_hash = 'LDAP_USER'`,
+	)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var u syncedUser
+		var username, groupsJSON string
+		if err := rows.Scan(&u.id, &username, &u.email, &u.displayName, &groupsJSON, &u.disabled); err != nil {
+			rows.Close()
+			return err
+		}
+		json.Unmarshal([]byte(groupsJSON), &u.groups)
+		existing[strings.ToLower(username)] = &u
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// An empty result is far more likely a broken filter or base DN than an
+	// empty directory, so nobody is removed
+	if len(users) == 0 && len(existing) > 0 {
+		return fmt.Errorf("the directory returned no users; not removing %d LDAP users", len(existing))
+	}
+
+	r := *result
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	for _, u := range users {
+		key := strings.ToLower(u.Username)
+		if u.Username == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if u.Groups == nil {
+			u.Groups = []string{}
+		}
+		groupsJSON, _ := json.Marshal(u.Groups)
+
+		old, ok := existing[key]
+		if !ok {
+			_, err := tx.Exec(
+				"INSERT INTO users (username, email, password_hash, display_name, groups, created_at, updated_at) VALUES (?, NULLIF(?, ''), 'LDAP_USER', ?, ?, ?, ?)",
+				u.Username, u.Email, u.DisplayName, string(groupsJSON), now, now,
+			)
+			if err != nil {
+				r.Skipped = append(r.Skipped, fmt.Sprintf("%s: %s", u.Username, conflictReason(err)))
+				continue
+			}
+			r.Added++
+			continue
+		}
+
+		if !old.disabled && old.email == u.Email && old.displayName == u.DisplayName && sameGroups(old.groups, u.Groups) {
+			continue
+		}
+		_, err := tx.Exec(
+			"UPDATE users SET email = NULLIF(?, ''), display_name = ?, groups = ?, disabled = 0, updated_at = ? WHERE id = ?",
+			u.Email, u.DisplayName, string(groupsJSON), now, old.id,
+		)
+		if err != nil {
+			r.Skipped = append(r.Skipped, fmt.Sprintf("%s: %s", u.Username, conflictReason(err)))
+			continue
+		}
+		if old.disabled {
+			r.Enabled++
+		} else {
+			r.Updated++
+		}
+	}
+
+	for key, old := range existing {
+		if seen[key] || (old.disabled && removed != DirectorySyncDelete) {
+			continue
+		}
+		res, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", old.id)
+		if err != nil {
+			return err
+		}
+		ended, _ := res.RowsAffected()
+		r.SessionsEnded += int(ended)
+
+		if removed == DirectorySyncDelete {
+			if _, err := tx.Exec("DELETE FROM users WHERE id = ?", old.id); err != nil {
+				return err
+			}
+			r.Deleted++
+		} else {
+			if _, err := tx.Exec("UPDATE users SET disabled = 1, updated_at = ? WHERE id = ?", now, old.id); err != nil {
+				return err
+			}
+			r.Disabled++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*result = r
+	return nil
+}
+
+// conflictReason describes why a directory user could not be stored.
+func conflictReason(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "users.username"):
+		return "username is taken by a local or OIDC account"
+	case strings.Contains(msg, "users.email"):
+		return "email address is used by another account"
+	}
+	log.Printf("Directory sync: error storing user: %v", err)
+	return "database error"
+}
+
+// sameGroups reports whether a and b hold the same groups in any order.
+func sameGroups(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"dashgate/internal/models"
+	"dashgate/internal/pattern"
+	"dashgate/internal/server"
+)
+
+// InitDiscoveryRulesTable creates the discovery_rules table if it does not exist.
+func InitDiscoveryRulesTable(app *server.App) error {
+	_, err := app.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS discovery_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL DEFAULT '',
+			position INTEGER NOT NULL DEFAULT 0,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			match_source TEXT DEFAULT '',
+			match_host TEXT DEFAULT '',
+			match_label TEXT DEFAULT '',
+			match_upstream TEXT DEFAULT '',
+			category TEXT DEFAULT '',
+			groups TEXT DEFAULT '[]',
+			icon TEXT DEFAULT '',
+			name_template TEXT DEFAULT '',
+			hidden INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_discovery_rules_position ON discovery_rules(position);
+	`)
+	return err
+}
+
+// LoadDiscoveryRules reads all discovery rules from the database, ordered by
+// position, and populates app.DiscoveryRules.
+func LoadDiscoveryRules(app *server.App) error {
+	rows, err := app.DB.Query("SELECT id, name, position, enabled, match_source, match_host, match_label, match_upstream, category, groups, icon, name_template, hidden FROM discovery_rules ORDER BY position, id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var rules []models.DiscoveryRule
+	for rows.Next() {
+		var rule models.DiscoveryRule
+		var groupsJSON string
+		var enabledInt, hiddenInt int
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.Position, &enabledInt, &rule.MatchSource, &rule.MatchHost, &rule.MatchLabel, &rule.MatchUpstream, &rule.Category, &groupsJSON, &rule.Icon, &rule.NameTemplate, &hiddenInt); err != nil {
+			log.Printf("Error scanning discovery rule: %v", err)
+			continue
+		}
+		rule.Enabled = enabledInt == 1
+		rule.Hidden = hiddenInt == 1
+		if err := json.Unmarshal([]byte(groupsJSON), &rule.Groups); err != nil {
+			rule.Groups = []string{}
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating discovery rules rows: %w", err)
+	}
+
+	app.DiscoveryRulesMu.Lock()
+	app.DiscoveryRules = rules
+	app.DiscoveryRulesMu.Unlock()
+	pattern.ClearCache()
+
+	log.Printf("Loaded %d discovery rules", len(rules))
+	return nil
+}
+
+// SaveDiscoveryRule inserts a new rule (ID == 0) or updates an existing one,
+// then refreshes the in-memory cache.
+func SaveDiscoveryRule(app *server.App, rule *models.DiscoveryRule) error {
+	if rule.Groups == nil {
+		rule.Groups = []string{}
+	}
+	groupsJSON, err := json.Marshal(rule.Groups)
+	if err != nil {
+		return fmt.Errorf("failed to marshal groups: %w", err)
+	}
+
+	enabledInt := 0
+	if rule.Enabled {
+		enabledInt = 1
+	}
+	hiddenInt := 0
+	if rule.Hidden {
+		hiddenInt = 1
+	}
+
+	if rule.ID == 0 {
+		result, err := app.DB.Exec(`INSERT INTO discovery_rules (name, position, enabled, match_source, match_host, match_label, match_upstream, category, groups, icon, name_template, hidden)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			rule.Name, rule.Position, enabledInt, rule.MatchSource, rule.MatchHost, rule.MatchLabel, rule.MatchUpstream, rule.Category, string(groupsJSON), rule.Icon, rule.NameTemplate, hiddenInt)
+		if err != nil {
+			return fmt.Errorf("failed to create discovery rule: %w", err)
+		}
+		id, _ := result.LastInsertId()
+		rule.ID = int(id)
+	} else {
+		result, err := app.DB.Exec(`UPDATE discovery_rules SET
+				name = ?, position = ?, enabled = ?, match_source = ?, match_host = ?, match_label = ?, match_upstream = ?,
+				category = ?, groups = ?, icon = ?, name_template = ?, hidden = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?`,
+			rule.Name, rule.Position, enabledInt, rule.MatchSource, rule.MatchHost, rule.MatchLabel, rule.MatchUpstream, rule.Category, string(groupsJSON), rule.Icon, rule.NameTemplate, hiddenInt, rule.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update discovery rule: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("discovery rule %d not found", rule.ID)
+		}
+	}
+
+	return LoadDiscoveryRules(app)
+}
+
+// DeleteDiscoveryRule removes a discovery rule by ID and refreshes the cache.
+func DeleteDiscoveryRule(app *server.App, id int) error {
+	if _, err := app.DB.Exec("DELETE FROM discovery_rules WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete discovery rule: %w", err)
+	}
+	return LoadDiscoveryRules(app)
+}
+
+// ReorderDiscoveryRules assigns positions to rules following the order of ids.
+// Rules not listed keep their relative order after the listed ones.
+func ReorderDiscoveryRules(app *server.App, ids []int) error {
+	order := make(map[int]int, len(ids))
+	for i, id := range ids {
+		order[id] = i
+	}
+
+	rules := GetDiscoveryRules(app)
+	sort.SliceStable(rules, func(i, j int) bool {
+		pi, oki := order[rules[i].ID]
+		pj, okj := order[rules[j].ID]
+		if oki && okj {
+			return pi < pj
+		}
+		return oki && !okj
+	})
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	for i, rule := range rules {
+		if _, err := tx.Exec("UPDATE discovery_rules SET position = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", i, rule.ID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to reorder discovery rules: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return LoadDiscoveryRules(app)
+}
+
+// GetDiscoveryRules returns a deep copy of all discovery rules in evaluation order.
+func GetDiscoveryRules(app *server.App) []models.DiscoveryRule {
+	app.DiscoveryRulesMu.RLock()
+	defer app.DiscoveryRulesMu.RUnlock()
+	result := make([]models.DiscoveryRule, len(app.DiscoveryRules))
+	for i, rule := range app.DiscoveryRules {
+		rule.Groups = append([]string{}, rule.Groups...)
+		result[i] = rule
+	}
+	return result
+}
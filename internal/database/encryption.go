@@ -1,24 +1,20 @@
 package database
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
-	"encoding/base64"
 	"encoding/hex"
-	"fmt"
 	"io"
 	"log"
 	"os"
-	"strings"
 
+	"dashgate/internal/encryption"
 	"dashgate/internal/server"
 )
 
 const (
 	// encPrefix is prepended to encrypted values so we can distinguish them
 	// from legacy plaintext values stored before encryption was enabled.
-	encPrefix = "enc:"
+	encPrefix = encryption.Prefix
 
 	// encryptionKeyDBKey is the key used to store the auto-generated
 	// encryption key in the encryption_keys table.
@@ -28,10 +24,12 @@ const (
 // sensitiveKeys lists the system_config keys whose values must be encrypted at rest.
 var sensitiveKeys = map[string]bool{
 	"ldap_bind_password": true,
+	"ldap_client_key":    true,
 	"oidc_client_secret": true,
 	"npm_password":       true,
 	"traefik_password":   true,
 	"caddy_password":     true,
+	"smtp_password":      true,
 }
 
 // IsSensitiveKey returns true if the given system_config key holds a secret
@@ -110,94 +108,13 @@ func InitEncryptionKey(app *server.App) {
 	app.EncryptionKey = newKey
 }
 
-// EncryptValue encrypts plaintext using AES-256-GCM and returns a string
-// with the "enc:" prefix followed by base64-encoded (nonce + ciphertext).
-//
-// If the key is nil or empty the plaintext is returned unchanged (graceful
-// degradation when encryption is not configured).
+// EncryptValue encrypts plaintext with encryption.Encrypt.
 func EncryptValue(key []byte, plaintext string) (string, error) {
-	if len(key) == 0 {
-		return plaintext, nil
-	}
-
-	// Don't encrypt empty strings
-	if plaintext == "" {
-		return plaintext, nil
-	}
-
-	// Already encrypted — return as-is
-	if strings.HasPrefix(plaintext, encPrefix) {
-		return plaintext, nil
-	}
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", fmt.Errorf("failed to generate nonce: %w", err)
-	}
-
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	encoded := base64.StdEncoding.EncodeToString(ciphertext)
-
-	return encPrefix + encoded, nil
+	return encryption.Encrypt(key, plaintext)
 }
 
-// DecryptValue decrypts a value that was encrypted by EncryptValue.
-//
-// If the value does not carry the "enc:" prefix it is assumed to be a legacy
-// plaintext value and returned unchanged (backwards compatibility).
-//
-// If the key is nil or empty the value is returned unchanged.
+// DecryptValue decrypts a value that was encrypted by EncryptValue, with
+// encryption.Decrypt.
 func DecryptValue(key []byte, ciphertext string) (string, error) {
-	if len(key) == 0 {
-		return ciphertext, nil
-	}
-
-	// Not encrypted — return plaintext as-is (backward compatibility)
-	if !strings.HasPrefix(ciphertext, encPrefix) {
-		return ciphertext, nil
-	}
-
-	// Empty after prefix should not happen, but handle gracefully
-	encoded := strings.TrimPrefix(ciphertext, encPrefix)
-	if encoded == "" {
-		return "", nil
-	}
-
-	data, err := base64.StdEncoding.DecodeString(encoded)
-	if err != nil {
-		return "", fmt.Errorf("failed to base64 decode: %w", err)
-	}
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	nonceSize := gcm.NonceSize()
-	if len(data) < nonceSize {
-		return "", fmt.Errorf("ciphertext too short")
-	}
-
-	nonce, sealed := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to decrypt: %w", err)
-	}
-
-	return string(plaintext), nil
+	return encryption.Decrypt(key, ciphertext)
 }
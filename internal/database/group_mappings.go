@@ -0,0 +1,174 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"dashgate/internal/models"
+	"dashgate/internal/pattern"
+	"dashgate/internal/server"
+)
+
+// InitGroupMappingTables creates the tables holding group mapping rules and
+// the per-source group settings.
+func InitGroupMappingTables(app *server.App) error {
+	_, err := app.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS group_mapping_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			position INTEGER NOT NULL DEFAULT 0,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			source TEXT DEFAULT '',
+			match TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS group_mapping_sources (
+			source TEXT PRIMARY KEY,
+			default_groups TEXT DEFAULT '[]',
+			drop_unmapped INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	return err
+}
+
+// LoadGroupMappings reads the group mapping rules, ordered by position, and
+// the per-source settings into app.GroupMappingRules and
+// app.GroupSourceSettings.
+func LoadGroupMappings(app *server.App) error {
+	rows, err := app.DB.Query("SELECT id, position, enabled, source, match, action, target FROM group_mapping_rules ORDER BY position, id")
+	if err != nil {
+		return err
+	}
+	var rules []models.GroupMappingRule
+	for rows.Next() {
+		var rule models.GroupMappingRule
+		var enabledInt int
+		if err := rows.Scan(&rule.ID, &rule.Position, &enabledInt, &rule.Source, &rule.Match, &rule.Action, &rule.Target); err != nil {
+			log.Printf("Error scanning group mapping rule: %v", err)
+			continue
+		}
+		rule.Enabled = enabledInt == 1
+		rules = append(rules, rule)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating group mapping rules rows: %w", err)
+	}
+
+	rows, err = app.DB.Query("SELECT source, default_groups, drop_unmapped FROM group_mapping_sources")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	settings := make(map[string]models.GroupSourceSettings)
+	for rows.Next() {
+		var s models.GroupSourceSettings
+		var groupsJSON string
+		var dropInt int
+		if err := rows.Scan(&s.Source, &groupsJSON, &dropInt); err != nil {
+			log.Printf("Error scanning group source settings: %v", err)
+			continue
+		}
+		s.DropUnmapped = dropInt == 1
+		if err := json.Unmarshal([]byte(groupsJSON), &s.DefaultGroups); err != nil || s.DefaultGroups == nil {
+			s.DefaultGroups = []string{}
+		}
+		settings[s.Source] = s
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating group source settings rows: %w", err)
+	}
+
+	app.GroupMappingMu.Lock()
+	app.GroupMappingRules = rules
+	app.GroupSourceSettings = settings
+	app.GroupMappingMu.Unlock()
+	pattern.ClearCache()
+	return nil
+}
+
+// GetGroupMappingRules returns a copy of the group mapping rules in
+// evaluation order.
+func GetGroupMappingRules(app *server.App) []models.GroupMappingRule {
+	app.GroupMappingMu.RLock()
+	defer app.GroupMappingMu.RUnlock()
+	return append([]models.GroupMappingRule{}, app.GroupMappingRules...)
+}
+
+// GetGroupSourceSettings returns the settings of each of sources, with
+// defaults for sources that have never been configured.
+func GetGroupSourceSettings(app *server.App, sources []string) []models.GroupSourceSettings {
+	app.GroupMappingMu.RLock()
+	defer app.GroupMappingMu.RUnlock()
+	result := make([]models.GroupSourceSettings, 0, len(sources))
+	for _, source := range sources {
+		s, ok := app.GroupSourceSettings[source]
+		if !ok {
+			s = models.GroupSourceSettings{Source: source}
+		}
+		s.DefaultGroups = append([]string{}, s.DefaultGroups...)
+		result = append(result, s)
+	}
+	return result
+}
+
+// SaveGroupMappingRule inserts a new rule (ID == 0) or updates an existing
+// one, then refreshes the in-memory cache.
+func SaveGroupMappingRule(app *server.App, rule *models.GroupMappingRule) error {
+	enabledInt := 0
+	if rule.Enabled {
+		enabledInt = 1
+	}
+
+	if rule.ID == 0 {
+		result, err := app.DB.Exec("INSERT INTO group_mapping_rules (position, enabled, source, match, action, target) VALUES (?, ?, ?, ?, ?, ?)",
+			rule.Position, enabledInt, rule.Source, rule.Match, rule.Action, rule.Target)
+		if err != nil {
+			return fmt.Errorf("failed to create group mapping rule: %w", err)
+		}
+		id, _ := result.LastInsertId()
+		rule.ID = int(id)
+	} else {
+		result, err := app.DB.Exec(`UPDATE group_mapping_rules SET position = ?, enabled = ?, source = ?, match = ?, action = ?, target = ?,
+				updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			rule.Position, enabledInt, rule.Source, rule.Match, rule.Action, rule.Target, rule.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update group mapping rule: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("group mapping rule %d not found", rule.ID)
+		}
+	}
+
+	return LoadGroupMappings(app)
+}
+
+// DeleteGroupMappingRule removes a rule by ID and refreshes the cache.
+func DeleteGroupMappingRule(app *server.App, id int) error {
+	if _, err := app.DB.Exec("DELETE FROM group_mapping_rules WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete group mapping rule: %w", err)
+	}
+	return LoadGroupMappings(app)
+}
+
+// SaveGroupSourceSettings stores the settings of one source and refreshes the cache.
+func SaveGroupSourceSettings(app *server.App, s models.GroupSourceSettings) error {
+	if s.DefaultGroups == nil {
+		s.DefaultGroups = []string{}
+	}
+	groupsJSON, _ := json.Marshal(s.DefaultGroups)
+	dropInt := 0
+	if s.DropUnmapped {
+		dropInt = 1
+	}
+	if _, err := app.DB.Exec(`INSERT INTO group_mapping_sources (source, default_groups, drop_unmapped) VALUES (?, ?, ?)
+		ON CONFLICT(source) DO UPDATE SET default_groups = excluded.default_groups, drop_unmapped = excluded.drop_unmapped, updated_at = CURRENT_TIMESTAMP`,
+		s.Source, string(groupsJSON), dropInt); err != nil {
+		return fmt.Errorf("failed to save group source settings: %w", err)
+	}
+	return LoadGroupMappings(app)
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// ErrInvitationInvalid is returned for unknown, revoked, used up or expired invitations.
+var ErrInvitationInvalid = errors.New("invitation is invalid or has expired")
+
+// ErrUsernameTaken is returned when a sign-up picks a username or email that is already in use.
+var ErrUsernameTaken = errors.New("username or email already exists")
+
+// InitInvitationsTable creates the invitations table.
+func InitInvitationsTable(app *server.App) error {
+	_, err := app.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS invitations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token_hash TEXT UNIQUE NOT NULL,
+			note TEXT DEFAULT '',
+			groups TEXT DEFAULT '[]',
+			max_uses INTEGER NOT NULL DEFAULT 1,
+			uses INTEGER NOT NULL DEFAULT 0,
+			require_totp INTEGER NOT NULL DEFAULT 0,
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);
+	`)
+	return err
+}
+
+// hashInvitationToken returns the stored form of an invitation token.
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateInvitation stores a new invitation and returns its token. Only the
+// token's hash is stored, so the link can't be shown again later.
+func CreateInvitation(app *server.App, inv *models.Invitation) (string, error) {
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	if inv.Groups == nil {
+		inv.Groups = []string{}
+	}
+	groupsJSON, _ := json.Marshal(inv.Groups)
+	inv.CreatedAt = time.Now()
+
+	result, err := app.DB.Exec(`
+		INSERT INTO invitations (token_hash, note, groups, max_uses, require_totp, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		hashInvitationToken(token), inv.Note, string(groupsJSON), inv.MaxUses, inv.RequireTOTP, inv.CreatedBy, inv.CreatedAt, inv.ExpiresAt,
+	)
+	if err != nil {
+		return "", err
+	}
+	id, _ := result.LastInsertId()
+	inv.ID = int(id)
+	return token, nil
+}
+
+const invitationColumns = "id, note, groups, max_uses, uses, require_totp, COALESCE(created_by, ''), created_at, expires_at"
+
+func scanInvitation(row interface{ Scan(...interface{}) error }) (*models.Invitation, error) {
+	var inv models.Invitation
+	var groupsJSON string
+	if err := row.Scan(&inv.ID, &inv.Note, &groupsJSON, &inv.MaxUses, &inv.Uses, &inv.RequireTOTP, &inv.CreatedBy, &inv.CreatedAt, &inv.ExpiresAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(groupsJSON), &inv.Groups)
+	if inv.Groups == nil {
+		inv.Groups = []string{}
+	}
+	return &inv, nil
+}
+
+// ListInvitations returns all invitations, newest first, including expired
+// and used up ones until they are cleaned up.
+func ListInvitations(app *server.App) ([]models.Invitation, error) {
+	rows, err := app.DB.Query("SELECT " + invitationColumns + " FROM invitations ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+// GetInvitation returns the invitation for a token if it can still be redeemed.
+func GetInvitation(app *server.App, token string) (*models.Invitation, error) {
+	if token == "" {
+		return nil, ErrInvitationInvalid
+	}
+	inv, err := scanInvitation(app.DB.QueryRow(
+		"SELECT "+invitationColumns+" FROM invitations WHERE token_hash = ? AND expires_at > ? AND (max_uses = 0 OR uses < max_uses)",
+		hashInvitationToken(token), time.Now(),
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvitationInvalid
+	}
+	return inv, err
+}
+
+// DeleteInvitation revokes an invitation. Accounts already created with it
+// are not affected. It returns false if the invitation does not exist.
+func DeleteInvitation(app *server.App, id int) (bool, error) {
+	result, err := app.DB.Exec("DELETE FROM invitations WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// RedeemInvitation uses up one sign-up of an invitation and creates a local
+// user with the invitation's groups in the same transaction, so a failed
+// sign-up does not count against the invitation. It returns the new user's ID
+// and the invitation.
+func RedeemInvitation(app *server.App, token, username, email, displayName, passwordHash string) (int, *models.Invitation, error) {
+	inv, err := GetInvitation(app, token)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	// Claim a use first so concurrent sign-ups cannot exceed max_uses
+	result, err := tx.Exec(
+		"UPDATE invitations SET uses = uses + 1 WHERE id = ? AND expires_at > ? AND (max_uses = 0 OR uses < max_uses)",
+		inv.ID, time.Now(),
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows != 1 {
+		return 0, nil, ErrInvitationInvalid
+	}
+
+	var emailValue interface{}
+	if email != "" {
+		emailValue = email
+	}
+	groupsJSON, _ := json.Marshal(inv.Groups)
+	result, err = tx.Exec(
+		"INSERT INTO users (username, email, password_hash, display_name, groups, totp_required) VALUES (?, ?, ?, ?, ?, ?)",
+		username, emailValue, passwordHash, displayName, string(groupsJSON), inv.RequireTOTP,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return 0, nil, ErrUsernameTaken
+		}
+		return 0, nil, err
+	}
+	id, _ := result.LastInsertId()
+	inv.Uses++
+	return int(id), inv, tx.Commit()
+}
+
+// CleanupInvitations deletes invitations that expired more than a week ago,
+// leaving recent ones visible to admins.
+func CleanupInvitations(app *server.App) {
+	if _, err := app.DB.Exec("DELETE FROM invitations WHERE expires_at < ?", time.Now().Add(-7*24*time.Hour)); err != nil {
+		log.Printf("Error cleaning up invitations: %v", err)
+	}
+}
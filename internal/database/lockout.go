@@ -0,0 +1,208 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// Defaults for the per-account lockout, used until set in system config.
+const (
+	DefaultLockoutThreshold = 10
+	DefaultLockoutMinutes   = 15
+)
+
+// loginFailureWindow is how long failed attempts count against a username.
+const loginFailureWindow = time.Hour
+
+// Failed attempts beyond freeLoginFailures must wait progressively longer
+// (1s, 2s, 4s, ... up to maxLoginDelay) before the next attempt is accepted.
+const (
+	freeLoginFailures = 3
+	maxLoginDelay     = time.Minute
+)
+
+// loginFailuresMu serializes read-modify-write updates of the failure counters
+// so concurrent attempts against one username are all counted.
+var loginFailuresMu sync.Mutex
+
+// InitLoginFailuresTable creates the login_failures table.
+func InitLoginFailuresTable(app *server.App) error {
+	_, err := app.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS login_failures (
+			username TEXT PRIMARY KEY,
+			failures INTEGER NOT NULL DEFAULT 0,
+			last_failure_at DATETIME NOT NULL,
+			last_ip TEXT DEFAULT '',
+			locked_until DATETIME
+		);
+	`)
+	return err
+}
+
+func normalizeLoginName(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// loginDelay returns how long to wait after the given number of failures.
+func loginDelay(failures int) time.Duration {
+	if failures < freeLoginFailures {
+		return 0
+	}
+	shift := failures - freeLoginFailures
+	if shift > 6 {
+		return maxLoginDelay
+	}
+	if d := time.Second << shift; d < maxLoginDelay {
+		return d
+	}
+	return maxLoginDelay
+}
+
+func getLoginFailures(app *server.App, username string) (*models.LoginFailures, error) {
+	f := &models.LoginFailures{Username: username}
+	var lockedUntil sql.NullTime
+	err := app.DB.QueryRow(
+		"SELECT failures, last_failure_at, COALESCE(last_ip, ''), locked_until FROM login_failures WHERE username = ?",
+		username,
+	).Scan(&f.Failures, &f.LastFailureAt, &f.LastIP, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		f.LockedUntil = &lockedUntil.Time
+	}
+	return f, nil
+}
+
+// loginFailuresExpired reports whether a failure record no longer applies:
+// the lockout has ended, or the last failure is outside the counting window.
+func loginFailuresExpired(f *models.LoginFailures, now time.Time) bool {
+	if f.LockedUntil != nil {
+		return !now.Before(*f.LockedUntil)
+	}
+	return now.Sub(f.LastFailureAt) > loginFailureWindow
+}
+
+// LoginRetryAfter returns how long the client must wait before another
+// sign-in attempt for username is accepted, or 0 if it may try now.
+func LoginRetryAfter(app *server.App, username string) time.Duration {
+	f, err := getLoginFailures(app, normalizeLoginName(username))
+	if err != nil {
+		log.Printf("Error checking login failures: %v", err)
+		return 0
+	}
+	now := time.Now()
+	if f == nil || loginFailuresExpired(f, now) {
+		return 0
+	}
+	if f.LockedUntil != nil {
+		return f.LockedUntil.Sub(now)
+	}
+	if wait := f.LastFailureAt.Add(loginDelay(f.Failures)).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// RecordLoginFailure counts a failed sign-in for username and reports whether
+// this failure locked the account.
+func RecordLoginFailure(app *server.App, username, ip string) (bool, error) {
+	username = normalizeLoginName(username)
+
+	app.SysConfigMu.RLock()
+	threshold := app.SystemConfig.LockoutThreshold
+	lockout := time.Duration(app.SystemConfig.LockoutMinutes) * time.Minute
+	app.SysConfigMu.RUnlock()
+
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+
+	f, err := getLoginFailures(app, username)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	failures := 1
+	if f != nil && !loginFailuresExpired(f, now) {
+		failures = f.Failures + 1
+	}
+
+	var lockedUntil interface{}
+	locked := threshold > 0 && lockout > 0 && failures >= threshold
+	if locked {
+		lockedUntil = now.Add(lockout)
+	}
+
+	_, err = app.DB.Exec(
+		"INSERT OR REPLACE INTO login_failures (username, failures, last_failure_at, last_ip, locked_until) VALUES (?, ?, ?, ?, ?)",
+		username, failures, now, ip, lockedUntil,
+	)
+	return locked, err
+}
+
+// ResetLoginFailures clears the failure count after a successful sign-in.
+func ResetLoginFailures(app *server.App, username string) {
+	if _, err := app.DB.Exec("DELETE FROM login_failures WHERE username = ?", normalizeLoginName(username)); err != nil {
+		log.Printf("Error resetting login failures: %v", err)
+	}
+}
+
+// UnlockAccount removes the lockout and failure count of username.
+func UnlockAccount(app *server.App, username string) (bool, error) {
+	result, err := app.DB.Exec("DELETE FROM login_failures WHERE username = ?", normalizeLoginName(username))
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// ListLoginFailures returns the usernames that are locked or have recent
+// failed attempts, locked accounts first.
+func ListLoginFailures(app *server.App) ([]models.LoginFailures, error) {
+	rows, err := app.DB.Query(`
+		SELECT username, failures, last_failure_at, COALESCE(last_ip, ''), locked_until
+		FROM login_failures ORDER BY locked_until IS NULL, last_failure_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	list := []models.LoginFailures{}
+	for rows.Next() {
+		var f models.LoginFailures
+		var lockedUntil sql.NullTime
+		if err := rows.Scan(&f.Username, &f.Failures, &f.LastFailureAt, &f.LastIP, &lockedUntil); err != nil {
+			return nil, err
+		}
+		if lockedUntil.Valid {
+			f.LockedUntil = &lockedUntil.Time
+		}
+		if !loginFailuresExpired(&f, now) {
+			list = append(list, f)
+		}
+	}
+	return list, rows.Err()
+}
+
+// CleanupLoginFailures deletes failure records that no longer apply.
+func CleanupLoginFailures(app *server.App) {
+	now := time.Now()
+	_, err := app.DB.Exec(
+		"DELETE FROM login_failures WHERE (locked_until IS NOT NULL AND locked_until < ?) OR (locked_until IS NULL AND last_failure_at < ?)",
+		now, now.Add(-loginFailureWindow),
+	)
+	if err != nil {
+		log.Printf("Error cleaning up login failures: %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// legacyOIDCKeys are the system_config keys of the single OIDC provider
+// supported before providers got their own table.
+var legacyOIDCKeys = []string{"oidc_issuer", "oidc_client_id", "oidc_client_secret", "oidc_redirect_url", "oidc_scopes", "oidc_groups_claim"}
+
+// InitOIDCProvidersTable creates the oidc_providers table, records which
+// provider each OIDC user and session belongs to, and moves a provider
+// configured in system_config into the table as provider "default".
+func InitOIDCProvidersTable(app *server.App) error {
+	_, err := app.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS oidc_providers (
+			id TEXT PRIMARY KEY,
+			display_name TEXT NOT NULL DEFAULT '',
+			icon TEXT DEFAULT '',
+			position INTEGER NOT NULL DEFAULT 0,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			issuer TEXT NOT NULL,
+			client_id TEXT NOT NULL,
+			client_secret TEXT DEFAULT '',
+			redirect_url TEXT DEFAULT '',
+			scopes TEXT DEFAULT '',
+			groups_claim TEXT DEFAULT '',
+			allowed_domains TEXT DEFAULT '[]',
+			default_groups TEXT DEFAULT '[]',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"users", "sessions"} {
+		if _, err := app.DB.Exec("ALTER TABLE " + table + " ADD COLUMN oidc_provider TEXT DEFAULT ''"); err != nil {
+			if !strings.Contains(err.Error(), "duplicate column") {
+				return err
+			}
+		}
+	}
+
+	var count int
+	if err := app.DB.QueryRow("SELECT COUNT(*) FROM oidc_providers").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	legacy := make(map[string]string)
+	rows, err := app.DB.Query("SELECT key, value FROM system_config WHERE key IN (?, ?, ?, ?, ?, ?)",
+		legacyOIDCKeys[0], legacyOIDCKeys[1], legacyOIDCKeys[2], legacyOIDCKeys[3], legacyOIDCKeys[4], legacyOIDCKeys[5])
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err == nil {
+			legacy[key] = value
+		}
+	}
+	rows.Close()
+	if legacy["oidc_issuer"] == "" || legacy["oidc_client_id"] == "" {
+		return nil
+	}
+
+	// The secret is copied as stored; it was encrypted with the same key
+	if _, err := app.DB.Exec(`INSERT INTO oidc_providers (id, display_name, issuer, client_id, client_secret, redirect_url, scopes, groups_claim)
+		VALUES ('default', 'SSO', ?, ?, ?, ?, ?, ?)`,
+		legacy["oidc_issuer"], legacy["oidc_client_id"], legacy["oidc_client_secret"], legacy["oidc_redirect_url"],
+		legacy["oidc_scopes"], legacy["oidc_groups_claim"]); err != nil {
+		return fmt.Errorf("failed to migrate OIDC provider: %w", err)
+	}
+	for _, key := range legacyOIDCKeys {
+		app.DB.Exec("DELETE FROM system_config WHERE key = ?", key)
+	}
+	log.Printf("MIGRATION: moved the configured OIDC provider to the provider list as %q", "default")
+	return nil
+}
+
+// ListOIDCProviders returns all configured providers in login button order,
+// with their client secrets decrypted.
+func ListOIDCProviders(app *server.App) ([]models.OIDCProvider, error) {
+	rows, err := app.DB.Query(`SELECT id, display_name, icon, position, enabled, issuer, client_id, client_secret,
+		redirect_url, scopes, groups_claim, allowed_domains, default_groups FROM oidc_providers ORDER BY position, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	providers := []models.OIDCProvider{}
+	for rows.Next() {
+		var p models.OIDCProvider
+		var enabledInt int
+		var domainsJSON, groupsJSON string
+		if err := rows.Scan(&p.ID, &p.DisplayName, &p.Icon, &p.Position, &enabledInt, &p.Issuer, &p.ClientID, &p.ClientSecret,
+			&p.RedirectURL, &p.Scopes, &p.GroupsClaim, &domainsJSON, &groupsJSON); err != nil {
+			return nil, err
+		}
+		p.Enabled = enabledInt == 1
+		if secret, err := DecryptValue(app.EncryptionKey, p.ClientSecret); err != nil {
+			log.Printf("WARNING: failed to decrypt client secret of OIDC provider %q: %v", p.ID, err)
+		} else {
+			p.ClientSecret = secret
+		}
+		p.HasSecret = p.ClientSecret != ""
+		if err := json.Unmarshal([]byte(domainsJSON), &p.AllowedDomains); err != nil || p.AllowedDomains == nil {
+			p.AllowedDomains = []string{}
+		}
+		if err := json.Unmarshal([]byte(groupsJSON), &p.DefaultGroups); err != nil || p.DefaultGroups == nil {
+			p.DefaultGroups = []string{}
+		}
+		providers = append(providers, p)
+	}
+	return providers, rows.Err()
+}
+
+// GetOIDCProvider returns one provider by ID, or sql.ErrNoRows.
+func GetOIDCProvider(app *server.App, id string) (*models.OIDCProvider, error) {
+	providers, err := ListOIDCProviders(app)
+	if err != nil {
+		return nil, err
+	}
+	for i := range providers {
+		if providers[i].ID == id {
+			return &providers[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// SaveOIDCProvider inserts or replaces a provider. The client secret is
+// encrypted at rest.
+func SaveOIDCProvider(app *server.App, p *models.OIDCProvider) error {
+	if p.AllowedDomains == nil {
+		p.AllowedDomains = []string{}
+	}
+	if p.DefaultGroups == nil {
+		p.DefaultGroups = []string{}
+	}
+	domainsJSON, _ := json.Marshal(p.AllowedDomains)
+	groupsJSON, _ := json.Marshal(p.DefaultGroups)
+
+	secret := p.ClientSecret
+	if secret != "" {
+		encrypted, err := EncryptValue(app.EncryptionKey, secret)
+		if err != nil {
+			log.Printf("WARNING: failed to encrypt client secret of OIDC provider %q, storing in plaintext: %v", p.ID, err)
+		} else {
+			secret = encrypted
+		}
+	}
+	enabledInt := 0
+	if p.Enabled {
+		enabledInt = 1
+	}
+
+	_, err := app.DB.Exec(`INSERT INTO oidc_providers (id, display_name, icon, position, enabled, issuer, client_id, client_secret,
+			redirect_url, scopes, groups_claim, allowed_domains, default_groups)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			display_name = excluded.display_name, icon = excluded.icon, position = excluded.position, enabled = excluded.enabled,
+			issuer = excluded.issuer, client_id = excluded.client_id, client_secret = excluded.client_secret,
+			redirect_url = excluded.redirect_url, scopes = excluded.scopes, groups_claim = excluded.groups_claim,
+			allowed_domains = excluded.allowed_domains, default_groups = excluded.default_groups, updated_at = CURRENT_TIMESTAMP`,
+		p.ID, p.DisplayName, p.Icon, p.Position, enabledInt, p.Issuer, p.ClientID, secret,
+		p.RedirectURL, p.Scopes, p.GroupsClaim, string(domainsJSON), string(groupsJSON))
+	if err != nil {
+		return fmt.Errorf("failed to save OIDC provider: %w", err)
+	}
+	p.HasSecret = p.ClientSecret != ""
+	return nil
+}
+
+// DeleteOIDCProvider removes a provider and ends the sessions signed in with it.
+func DeleteOIDCProvider(app *server.App, id string) error {
+	result, err := app.DB.Exec("DELETE FROM oidc_providers WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete OIDC provider: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := app.DB.Exec("DELETE FROM sessions WHERE oidc_provider = ?", id); err != nil {
+		log.Printf("Error deleting sessions of OIDC provider %q: %v", id, err)
+	}
+	return nil
+}
+
+// InitOIDCProviders loads the discovery documents of all enabled providers
+// and replaces app.OIDCClients. Providers that cannot be reached are left out
+// until the next reload. This function performs network I/O and must NOT be
+// called while holding SysConfigMu.
+func InitOIDCProviders(app *server.App) {
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.OIDCAuthEnabled
+	externalURL := app.SystemConfig.ExternalURL
+	app.SysConfigMu.RUnlock()
+
+	var clients []*server.OIDCClient
+	if enabled {
+		providers, err := ListOIDCProviders(app)
+		if err != nil {
+			log.Printf("Failed to load OIDC providers: %v", err)
+		}
+		for _, p := range providers {
+			if !p.Enabled {
+				continue
+			}
+			if client := newOIDCClient(p, externalURL); client != nil {
+				clients = append(clients, client)
+			}
+		}
+	}
+
+	app.SysConfigMu.Lock()
+	app.OIDCClients = clients
+	app.SysConfigMu.Unlock()
+}
+
+// newOIDCClient fetches the discovery document of a provider and builds its
+// OAuth2 configuration.
+func newOIDCClient(p models.OIDCProvider, externalURL string) *server.OIDCClient {
+	if p.RedirectURL == "" {
+		if externalURL == "" {
+			log.Printf("OIDC provider %q skipped: set its redirect URL or the external URL", p.ID)
+			return nil
+		}
+		p.RedirectURL = externalURL + "/auth/oidc/callback/" + p.ID
+	}
+	if p.GroupsClaim == "" {
+		p.GroupsClaim = "groups"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, p.Issuer)
+	if err != nil {
+		log.Printf("Failed to initialize OIDC provider %q: %v", p.ID, err)
+		return nil
+	}
+
+	scopeList := []string{oidc.ScopeOpenID, "profile", "email"}
+	if p.Scopes != "" {
+		scopeList = strings.Fields(p.Scopes)
+	}
+
+	log.Printf("OIDC auth configured: %s (%s)", p.ID, p.Issuer)
+	return &server.OIDCClient{
+		Config:   p,
+		Provider: provider,
+		OAuth2: &oauth2.Config{
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopeList,
+		},
+	}
+}
@@ -12,7 +12,7 @@ import (
 // LoadDiscoveredOverrides reads all discovered app overrides from the database
 // and populates app.DiscoveredOverrides.
 func LoadDiscoveredOverrides(app *server.App) error {
-	rows, err := app.DB.Query("SELECT id, url, source, name_override, url_override, icon_override, description_override, category, groups, hidden FROM discovered_app_overrides")
+	rows, err := app.DB.Query("SELECT id, url, source, name_override, url_override, icon_override, description_override, category, groups, hidden, hidden_set FROM discovered_app_overrides")
 	if err != nil {
 		return err
 	}
@@ -22,12 +22,13 @@ func LoadDiscoveredOverrides(app *server.App) error {
 	for rows.Next() {
 		var o models.DiscoveredAppOverride
 		var groupsJSON string
-		var hiddenInt int
-		if err := rows.Scan(&o.ID, &o.URL, &o.Source, &o.NameOverride, &o.URLOverride, &o.IconOverride, &o.DescriptionOverride, &o.Category, &groupsJSON, &hiddenInt); err != nil {
+		var hiddenInt, hiddenSetInt int
+		if err := rows.Scan(&o.ID, &o.URL, &o.Source, &o.NameOverride, &o.URLOverride, &o.IconOverride, &o.DescriptionOverride, &o.Category, &groupsJSON, &hiddenInt, &hiddenSetInt); err != nil {
 			log.Printf("Error scanning discovered override: %v", err)
 			continue
 		}
 		o.Hidden = hiddenInt == 1
+		o.HiddenSet = hiddenSetInt == 1
 		if err := json.Unmarshal([]byte(groupsJSON), &o.Groups); err != nil {
 			o.Groups = []string{}
 		}
@@ -58,9 +59,13 @@ func SaveDiscoveredOverride(app *server.App, o *models.DiscoveredAppOverride) er
 	if o.Hidden {
 		hiddenInt = 1
 	}
+	hiddenSetInt := 0
+	if o.HiddenSet {
+		hiddenSetInt = 1
+	}
 
-	_, err = app.DB.Exec(`INSERT INTO discovered_app_overrides (url, source, name_override, url_override, icon_override, description_override, category, groups, hidden, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	_, err = app.DB.Exec(`INSERT INTO discovered_app_overrides (url, source, name_override, url_override, icon_override, description_override, category, groups, hidden, hidden_set, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 		ON CONFLICT(url) DO UPDATE SET
 			source=excluded.source,
 			name_override=excluded.name_override,
@@ -70,8 +75,9 @@ func SaveDiscoveredOverride(app *server.App, o *models.DiscoveredAppOverride) er
 			category=excluded.category,
 			groups=excluded.groups,
 			hidden=excluded.hidden,
+			hidden_set=excluded.hidden_set,
 			updated_at=CURRENT_TIMESTAMP`,
-		o.URL, o.Source, o.NameOverride, o.URLOverride, o.IconOverride, o.DescriptionOverride, o.Category, string(groupsJSON), hiddenInt)
+		o.URL, o.Source, o.NameOverride, o.URLOverride, o.IconOverride, o.DescriptionOverride, o.Category, string(groupsJSON), hiddenInt, hiddenSetInt)
 	if err != nil {
 		return fmt.Errorf("failed to save discovered override: %w", err)
 	}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/server"
+)
+
+// DefaultPasswordResetMinutes is how long a reset link is valid until set in system config.
+const DefaultPasswordResetMinutes = 60
+
+// ErrResetTokenInvalid is returned for unknown, used or expired reset tokens.
+var ErrResetTokenInvalid = errors.New("password reset link is invalid or has expired")
+
+// InitPasswordResetTable creates the password_reset_tokens table.
+func InitPasswordResetTable(app *server.App) error {
+	_, err := app.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS password_reset_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			created_by TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user ON password_reset_tokens(user_id);
+	`)
+	return err
+}
+
+// hashResetToken returns the stored form of a password reset token.
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreatePasswordResetToken issues a one-time reset token for a user, replacing
+// earlier unused tokens of the same kind. createdBy is the admin who created
+// it, or empty for a self-service request; a self-service request never
+// discards a link an admin issued. Only the token's hash is stored.
+func CreatePasswordResetToken(app *server.App, userID int, createdBy string, ttl time.Duration) (string, time.Time, error) {
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"DELETE FROM password_reset_tokens WHERE user_id = ? AND used_at IS NULL AND (COALESCE(created_by, '') = '') = ?",
+		userID, createdBy == "",
+	); err != nil {
+		return "", time.Time{}, err
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO password_reset_tokens (user_id, token_hash, created_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		userID, hashResetToken(token), createdBy, now, expiresAt,
+	); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, tx.Commit()
+}
+
+// GetPasswordResetUser returns the user a valid reset token belongs to.
+func GetPasswordResetUser(app *server.App, token string) (int, string, error) {
+	if token == "" {
+		return 0, "", ErrResetTokenInvalid
+	}
+	var userID int
+	var username string
+	err := app.DB.QueryRow(`
+		SELECT u.id, u.username FROM password_reset_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND t.used_at IS NULL AND t.expires_at > ?`,
+		hashResetToken(token), time.Now(),
+	).Scan(&userID, &username)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrResetTokenInvalid
+	}
+	return userID, username, err
+}
+
+// ResetPasswordWithToken redeems a reset token: it sets the new password hash,
+// marks the token used, discards the user's other reset tokens and signs out
+// all of their sessions. It returns the user's ID and username.
+func ResetPasswordWithToken(app *server.App, token, passwordHash string) (int, string, error) {
+	userID, username, err := GetPasswordResetUser(app, token)
+	if err != nil {
+		return 0, "", err
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	// Claim the token first so concurrent redemptions cannot both succeed
+	result, err := tx.Exec(
+		"UPDATE password_reset_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?",
+		now, hashResetToken(token), now,
+	)
+	if err != nil {
+		return 0, "", err
+	}
+	if rows, _ := result.RowsAffected(); rows != 1 {
+		return 0, "", ErrResetTokenInvalid
+	}
+
+	if _, err := tx.Exec("UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?", passwordHash, now, userID); err != nil {
+		return 0, "", err
+	}
+	if _, err := tx.Exec("DELETE FROM password_reset_tokens WHERE user_id = ? AND used_at IS NULL", userID); err != nil {
+		return 0, "", err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return 0, "", err
+	}
+	return userID, username, tx.Commit()
+}
+
+// CleanupPasswordResetTokens deletes reset tokens that can no longer be used.
+func CleanupPasswordResetTokens(app *server.App) {
+	if _, err := app.DB.Exec("DELETE FROM password_reset_tokens WHERE expires_at < ? OR used_at IS NOT NULL", time.Now()); err != nil {
+		log.Printf("Error cleaning up password reset tokens: %v", err)
+	}
+}
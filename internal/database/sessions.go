@@ -0,0 +1,159 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// InitSessionColumns adds the client details shown on the account page to the
+// sessions table.
+func InitSessionColumns(app *server.App) error {
+	columns := []struct{ name, def string }{
+		{"ip_address", "TEXT DEFAULT ''"},
+		{"user_agent", "TEXT DEFAULT ''"},
+		{"last_seen_at", "DATETIME"},
+		// OIDC sessions: the provider's session ID and subject for back-channel
+		// logout, the ID token sent as id_token_hint on logout, and the refresh
+		// token used to update the user's groups when the session is renewed
+		{"oidc_sid", "TEXT DEFAULT ''"},
+		{"oidc_sub", "TEXT DEFAULT ''"},
+		{"oidc_id_token", "TEXT DEFAULT ''"},
+		{"oidc_refresh_token", "TEXT DEFAULT ''"},
+	}
+	for _, c := range columns {
+		if _, err := app.DB.Exec("ALTER TABLE sessions ADD COLUMN " + c.name + " " + c.def); err != nil {
+			if !strings.Contains(err.Error(), "duplicate column") {
+				return err
+			}
+		}
+	}
+	_, err := app.DB.Exec("CREATE INDEX IF NOT EXISTS idx_sessions_oidc_sub ON sessions(oidc_sub) WHERE oidc_sub != ''")
+	return err
+}
+
+// CreateSession stores a new session for userID along with the client's IP
+// address and user agent.
+func CreateSession(app *server.App, userID int, token string, expiresAt time.Time, ipAddress, userAgent string) error {
+	now := time.Now()
+	_, err := app.DB.Exec(
+		"INSERT INTO sessions (user_id, token, expires_at, ip_address, user_agent, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		userID, token, expiresAt, ipAddress, userAgent, now, now,
+	)
+	return err
+}
+
+// ListUserSessions returns the unexpired sessions of a user, most recently
+// active first. The session matching currentToken is flagged as current.
+func ListUserSessions(app *server.App, userID int, currentToken string) ([]models.UserSession, error) {
+	rows, err := app.DB.Query(`
+		SELECT id, token, COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at, last_seen_at, expires_at
+		FROM sessions WHERE user_id = ? AND expires_at > ?
+		ORDER BY COALESCE(last_seen_at, created_at) DESC`,
+		userID, time.Now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.UserSession{}
+	for rows.Next() {
+		var s models.UserSession
+		var token string
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&s.ID, &token, &s.IPAddress, &s.UserAgent, &s.CreatedAt, &lastSeen, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if lastSeen.Valid {
+			s.LastSeenAt = &lastSeen.Time
+		}
+		s.Current = currentToken != "" && token == currentToken
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// ListActiveSessions returns the unexpired sessions of all users (or of one
+// user if userID > 0) with their owners, most recently active first.
+func ListActiveSessions(app *server.App, userID int, currentToken string) ([]models.UserSession, error) {
+	query := `
+		SELECT s.id, s.token, COALESCE(s.ip_address, ''), COALESCE(s.user_agent, ''), s.created_at, s.last_seen_at, s.expires_at,
+			u.id, u.username, COALESCE(u.display_name, ''), u.password_hash
+		FROM sessions s JOIN users u ON s.user_id = u.id
+		WHERE s.expires_at > ?`
+	args := []interface{}{time.Now()}
+	if userID > 0 {
+		query += " AND s.user_id = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY COALESCE(s.last_seen_at, s.created_at) DESC"
+
+	rows, err := app.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.UserSession{}
+	for rows.Next() {
+		var s models.UserSession
+		var token, passwordHash string
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&s.ID, &token, &s.IPAddress, &s.UserAgent, &s.CreatedAt, &lastSeen, &s.ExpiresAt,
+			&s.UserID, &s.Username, &s.DisplayName, &passwordHash); err != nil {
+			return nil, err
+		}
+		if lastSeen.Valid {
+			s.LastSeenAt = &lastSeen.Time
+		}
+		switch passwordHash {
+		case "LDAP_USER":
+			s.Source = "ldap"
+		case "OIDC_USER":
+			s.Source = "oidc"
+		default:
+			s.Source = "local"
+		}
+		s.Current = currentToken != "" && token == currentToken
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// GetSessionOwner returns the user ID and username a session belongs to.
+func GetSessionOwner(app *server.App, sessionID int) (int, string, error) {
+	var userID int
+	var username string
+	err := app.DB.QueryRow(
+		"SELECT u.id, u.username FROM sessions s JOIN users u ON s.user_id = u.id WHERE s.id = ?",
+		sessionID,
+	).Scan(&userID, &username)
+	return userID, username, err
+}
+
+// DeleteUserSession revokes one session, provided it belongs to userID.
+func DeleteUserSession(app *server.App, userID, sessionID int) (bool, error) {
+	result, err := app.DB.Exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// InvalidateOtherUserSessions deletes all sessions of a user except the one
+// identified by keepToken and returns how many were removed.
+func InvalidateOtherUserSessions(app *server.App, userID int, keepToken string) (int64, error) {
+	result, err := app.DB.Exec("DELETE FROM sessions WHERE user_id = ? AND token != ?", userID, keepToken)
+	if err != nil {
+		log.Printf("Failed to invalidate other sessions for user %d: %v", userID, err)
+		return 0, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows, nil
+}
@@ -1,7 +1,6 @@
 package database
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"net"
@@ -10,11 +9,9 @@ import (
 	"strings"
 	"time"
 
+	"dashgate/internal/auth"
 	"dashgate/internal/models"
 	"dashgate/internal/server"
-
-	"github.com/coreos/go-oidc/v3/oidc"
-	"golang.org/x/oauth2"
 )
 
 // LoadSystemConfig reads all key-value pairs from the system_config table
@@ -53,6 +50,34 @@ func LoadSystemConfig(app *server.App) error {
 			if d, err := strconv.Atoi(value); err == nil {
 				app.SystemConfig.SessionDays = d
 			}
+		case "session_idle_minutes":
+			if d, err := strconv.Atoi(value); err == nil && d >= 0 {
+				app.SystemConfig.SessionIdleMinutes = d
+			}
+		case "session_renew_minutes":
+			if d, err := strconv.Atoi(value); err == nil && d > 0 {
+				app.SystemConfig.SessionRenewMinutes = d
+			}
+		case "session_max_days":
+			if d, err := strconv.Atoi(value); err == nil && d >= 0 {
+				app.SystemConfig.SessionMaxDays = d
+			}
+		case "lockout_threshold":
+			if d, err := strconv.Atoi(value); err == nil && d >= 0 {
+				app.SystemConfig.LockoutThreshold = d
+			}
+		case "lockout_minutes":
+			if d, err := strconv.Atoi(value); err == nil && d >= 0 {
+				app.SystemConfig.LockoutMinutes = d
+			}
+		case "api_key_usage_days":
+			if d, err := strconv.Atoi(value); err == nil && d > 0 {
+				app.SystemConfig.APIKeyUsageDays = d
+			}
+		case "api_key_stale_days":
+			if d, err := strconv.Atoi(value); err == nil && d > 0 {
+				app.SystemConfig.APIKeyStaleDays = d
+			}
 		case "cookie_secure":
 			app.SystemConfig.CookieSecure = value == "true"
 		case "setup_completed":
@@ -61,6 +86,32 @@ func LoadSystemConfig(app *server.App) error {
 			app.SystemConfig.AdminGroup = value
 		case "trusted_proxies":
 			app.SystemConfig.TrustedProxies = value
+		case "external_url":
+			app.SystemConfig.ExternalURL = value
+		case "require_admin_2fa":
+			app.SystemConfig.RequireAdmin2FA = value == "true"
+		case "password_reset_minutes":
+			if d, err := strconv.Atoi(value); err == nil && d > 0 {
+				app.SystemConfig.PasswordResetMinutes = d
+			}
+		case "password_reset_email":
+			app.SystemConfig.PasswordResetEmail = value == "true"
+
+		// Email settings
+		case "smtp_host":
+			app.SystemConfig.SMTPHost = value
+		case "smtp_port":
+			if p, err := strconv.Atoi(value); err == nil && p > 0 {
+				app.SystemConfig.SMTPPort = p
+			}
+		case "smtp_username":
+			app.SystemConfig.SMTPUsername = value
+		case "smtp_password":
+			app.SystemConfig.SMTPPassword = value
+		case "smtp_from":
+			app.SystemConfig.SMTPFrom = value
+		case "smtp_security":
+			app.SystemConfig.SMTPSecurity = value
 
 		// Auth providers enabled
 		case "proxy_auth_enabled":
@@ -95,24 +146,30 @@ func LoadSystemConfig(app *server.App) error {
 			app.SystemConfig.LDAPDisplayAttr = value
 		case "ldap_group_attr":
 			app.SystemConfig.LDAPGroupAttr = value
+		case "ldap_nested_groups":
+			app.SystemConfig.LDAPNestedGroups = value
 		case "ldap_start_tls":
 			app.SystemConfig.LDAPStartTLS = value == "true"
 		case "ldap_skip_verify":
 			app.SystemConfig.LDAPSkipVerify = value == "true"
-
-		// OIDC settings
-		case "oidc_issuer":
-			app.SystemConfig.OIDCIssuer = value
-		case "oidc_client_id":
-			app.SystemConfig.OIDCClientID = value
-		case "oidc_client_secret":
-			app.SystemConfig.OIDCClientSecret = value
-		case "oidc_redirect_url":
-			app.SystemConfig.OIDCRedirectURL = value
-		case "oidc_scopes":
-			app.SystemConfig.OIDCScopes = value
-		case "oidc_groups_claim":
-			app.SystemConfig.OIDCGroupsClaim = value
+		case "ldap_ca_cert":
+			app.SystemConfig.LDAPCACert = value
+		case "ldap_client_cert":
+			app.SystemConfig.LDAPClientCert = value
+		case "ldap_client_key":
+			app.SystemConfig.LDAPClientKey = value
+
+		// Directory sync
+		case "directory_sync_source":
+			app.SystemConfig.DirectorySyncSource = value
+		case "directory_sync_interval":
+			if d, err := strconv.Atoi(value); err == nil && d > 0 {
+				app.SystemConfig.DirectorySyncInterval = d
+			}
+		case "directory_sync_removed":
+			if value == DirectorySyncDisable || value == DirectorySyncDelete {
+				app.SystemConfig.DirectorySyncRemoved = value
+			}
 
 		// Discovery settings
 		case "docker_discovery_enabled":
@@ -147,6 +204,50 @@ func LoadSystemConfig(app *server.App) error {
 			app.SystemConfig.CaddyUsername = value
 		case "caddy_password":
 			app.SystemConfig.CaddyPassword = value
+		case "docker_discovery_interval":
+			if v, err := strconv.Atoi(value); err == nil {
+				app.SystemConfig.DockerDiscoveryInterval = v
+			}
+		case "docker_discovery_jitter":
+			if v, err := strconv.Atoi(value); err == nil {
+				app.SystemConfig.DockerDiscoveryJitter = v
+			}
+		case "traefik_discovery_interval":
+			if v, err := strconv.Atoi(value); err == nil {
+				app.SystemConfig.TraefikDiscoveryInterval = v
+			}
+		case "traefik_discovery_jitter":
+			if v, err := strconv.Atoi(value); err == nil {
+				app.SystemConfig.TraefikDiscoveryJitter = v
+			}
+		case "nginx_discovery_interval":
+			if v, err := strconv.Atoi(value); err == nil {
+				app.SystemConfig.NginxDiscoveryInterval = v
+			}
+		case "nginx_discovery_jitter":
+			if v, err := strconv.Atoi(value); err == nil {
+				app.SystemConfig.NginxDiscoveryJitter = v
+			}
+		case "npm_discovery_interval":
+			if v, err := strconv.Atoi(value); err == nil {
+				app.SystemConfig.NPMDiscoveryInterval = v
+			}
+		case "npm_discovery_jitter":
+			if v, err := strconv.Atoi(value); err == nil {
+				app.SystemConfig.NPMDiscoveryJitter = v
+			}
+		case "caddy_discovery_interval":
+			if v, err := strconv.Atoi(value); err == nil {
+				app.SystemConfig.CaddyDiscoveryInterval = v
+			}
+		case "caddy_discovery_jitter":
+			if v, err := strconv.Atoi(value); err == nil {
+				app.SystemConfig.CaddyDiscoveryJitter = v
+			}
+		case "icon_auto_match":
+			app.SystemConfig.IconAutoMatch = value == "true"
+		case "icon_favicon_fallback":
+			app.SystemConfig.IconFaviconFallback = value == "true"
 		}
 	}
 
@@ -170,11 +271,30 @@ func SaveSystemConfig(app *server.App) error {
 	app.SysConfigMu.RLock()
 	configs := map[string]string{
 		// General settings
-		"session_days":    strconv.Itoa(app.SystemConfig.SessionDays),
-		"cookie_secure":   strconv.FormatBool(app.SystemConfig.CookieSecure),
-		"setup_completed": strconv.FormatBool(app.SystemConfig.SetupCompleted),
-		"admin_group":     app.SystemConfig.AdminGroup,
-		"trusted_proxies": app.SystemConfig.TrustedProxies,
+		"session_days":           strconv.Itoa(app.SystemConfig.SessionDays),
+		"session_idle_minutes":   strconv.Itoa(app.SystemConfig.SessionIdleMinutes),
+		"session_renew_minutes":  strconv.Itoa(app.SystemConfig.SessionRenewMinutes),
+		"session_max_days":       strconv.Itoa(app.SystemConfig.SessionMaxDays),
+		"lockout_threshold":      strconv.Itoa(app.SystemConfig.LockoutThreshold),
+		"lockout_minutes":        strconv.Itoa(app.SystemConfig.LockoutMinutes),
+		"api_key_usage_days":     strconv.Itoa(app.SystemConfig.APIKeyUsageDays),
+		"api_key_stale_days":     strconv.Itoa(app.SystemConfig.APIKeyStaleDays),
+		"cookie_secure":          strconv.FormatBool(app.SystemConfig.CookieSecure),
+		"setup_completed":        strconv.FormatBool(app.SystemConfig.SetupCompleted),
+		"admin_group":            app.SystemConfig.AdminGroup,
+		"trusted_proxies":        app.SystemConfig.TrustedProxies,
+		"external_url":           app.SystemConfig.ExternalURL,
+		"require_admin_2fa":      strconv.FormatBool(app.SystemConfig.RequireAdmin2FA),
+		"password_reset_minutes": strconv.Itoa(app.SystemConfig.PasswordResetMinutes),
+		"password_reset_email":   strconv.FormatBool(app.SystemConfig.PasswordResetEmail),
+
+		// Email settings
+		"smtp_host":     app.SystemConfig.SMTPHost,
+		"smtp_port":     strconv.Itoa(app.SystemConfig.SMTPPort),
+		"smtp_username": app.SystemConfig.SMTPUsername,
+		"smtp_password": app.SystemConfig.SMTPPassword,
+		"smtp_from":     app.SystemConfig.SMTPFrom,
+		"smtp_security": app.SystemConfig.SMTPSecurity,
 
 		// Auth providers enabled
 		"proxy_auth_enabled": strconv.FormatBool(app.SystemConfig.ProxyAuthEnabled),
@@ -194,34 +314,47 @@ func SaveSystemConfig(app *server.App) error {
 		"ldap_email_attr":    app.SystemConfig.LDAPEmailAttr,
 		"ldap_display_attr":  app.SystemConfig.LDAPDisplayAttr,
 		"ldap_group_attr":    app.SystemConfig.LDAPGroupAttr,
+		"ldap_nested_groups": app.SystemConfig.LDAPNestedGroups,
 		"ldap_start_tls":     strconv.FormatBool(app.SystemConfig.LDAPStartTLS),
 		"ldap_skip_verify":   strconv.FormatBool(app.SystemConfig.LDAPSkipVerify),
+		"ldap_ca_cert":       app.SystemConfig.LDAPCACert,
+		"ldap_client_cert":   app.SystemConfig.LDAPClientCert,
+		"ldap_client_key":    app.SystemConfig.LDAPClientKey,
 
-		// OIDC settings
-		"oidc_issuer":        app.SystemConfig.OIDCIssuer,
-		"oidc_client_id":     app.SystemConfig.OIDCClientID,
-		"oidc_client_secret": app.SystemConfig.OIDCClientSecret,
-		"oidc_redirect_url":  app.SystemConfig.OIDCRedirectURL,
-		"oidc_scopes":        app.SystemConfig.OIDCScopes,
-		"oidc_groups_claim":  app.SystemConfig.OIDCGroupsClaim,
+		// Directory sync
+		"directory_sync_source":   app.SystemConfig.DirectorySyncSource,
+		"directory_sync_interval": strconv.Itoa(app.SystemConfig.DirectorySyncInterval),
+		"directory_sync_removed":  app.SystemConfig.DirectorySyncRemoved,
 
 		// Discovery settings
-		"docker_discovery_enabled":  strconv.FormatBool(app.SystemConfig.DockerDiscoveryEnabled),
-		"docker_socket_path":        app.SystemConfig.DockerSocketPath,
-		"traefik_discovery_enabled": strconv.FormatBool(app.SystemConfig.TraefikDiscoveryEnabled),
-		"traefik_url":               app.SystemConfig.TraefikURL,
-		"traefik_username":          app.SystemConfig.TraefikUsername,
-		"traefik_password":          app.SystemConfig.TraefikPassword,
-		"nginx_discovery_enabled":   strconv.FormatBool(app.SystemConfig.NginxDiscoveryEnabled),
-		"nginx_config_path":         app.SystemConfig.NginxConfigPath,
-		"npm_discovery_enabled":     strconv.FormatBool(app.SystemConfig.NPMDiscoveryEnabled),
-		"npm_url":                   app.SystemConfig.NPMUrl,
-		"npm_email":                 app.SystemConfig.NPMEmail,
-		"npm_password":              app.SystemConfig.NPMPassword,
-		"caddy_discovery_enabled":   strconv.FormatBool(app.SystemConfig.CaddyDiscoveryEnabled),
-		"caddy_admin_url":           app.SystemConfig.CaddyAdminURL,
-		"caddy_username":            app.SystemConfig.CaddyUsername,
-		"caddy_password":            app.SystemConfig.CaddyPassword,
+		"docker_discovery_enabled":   strconv.FormatBool(app.SystemConfig.DockerDiscoveryEnabled),
+		"docker_socket_path":         app.SystemConfig.DockerSocketPath,
+		"traefik_discovery_enabled":  strconv.FormatBool(app.SystemConfig.TraefikDiscoveryEnabled),
+		"traefik_url":                app.SystemConfig.TraefikURL,
+		"traefik_username":           app.SystemConfig.TraefikUsername,
+		"traefik_password":           app.SystemConfig.TraefikPassword,
+		"nginx_discovery_enabled":    strconv.FormatBool(app.SystemConfig.NginxDiscoveryEnabled),
+		"nginx_config_path":          app.SystemConfig.NginxConfigPath,
+		"npm_discovery_enabled":      strconv.FormatBool(app.SystemConfig.NPMDiscoveryEnabled),
+		"npm_url":                    app.SystemConfig.NPMUrl,
+		"npm_email":                  app.SystemConfig.NPMEmail,
+		"npm_password":               app.SystemConfig.NPMPassword,
+		"caddy_discovery_enabled":    strconv.FormatBool(app.SystemConfig.CaddyDiscoveryEnabled),
+		"caddy_admin_url":            app.SystemConfig.CaddyAdminURL,
+		"caddy_username":             app.SystemConfig.CaddyUsername,
+		"caddy_password":             app.SystemConfig.CaddyPassword,
+		"docker_discovery_interval":  strconv.Itoa(app.SystemConfig.DockerDiscoveryInterval),
+		"docker_discovery_jitter":    strconv.Itoa(app.SystemConfig.DockerDiscoveryJitter),
+		"traefik_discovery_interval": strconv.Itoa(app.SystemConfig.TraefikDiscoveryInterval),
+		"traefik_discovery_jitter":   strconv.Itoa(app.SystemConfig.TraefikDiscoveryJitter),
+		"nginx_discovery_interval":   strconv.Itoa(app.SystemConfig.NginxDiscoveryInterval),
+		"nginx_discovery_jitter":     strconv.Itoa(app.SystemConfig.NginxDiscoveryJitter),
+		"npm_discovery_interval":     strconv.Itoa(app.SystemConfig.NPMDiscoveryInterval),
+		"npm_discovery_jitter":       strconv.Itoa(app.SystemConfig.NPMDiscoveryJitter),
+		"caddy_discovery_interval":   strconv.Itoa(app.SystemConfig.CaddyDiscoveryInterval),
+		"caddy_discovery_jitter":     strconv.Itoa(app.SystemConfig.CaddyDiscoveryJitter),
+		"icon_auto_match":            strconv.FormatBool(app.SystemConfig.IconAutoMatch),
+		"icon_favicon_fallback":      strconv.FormatBool(app.SystemConfig.IconFaviconFallback),
 	}
 	app.SysConfigMu.RUnlock()
 
@@ -264,11 +397,11 @@ func SaveSystemConfig(app *server.App) error {
 }
 
 // ApplySystemConfig takes the current app.SystemConfig values and applies them
-// to the runtime auth configuration, LDAP config, and OIDC provider.
+// to the runtime auth configuration, LDAP config, and OIDC providers.
 func ApplySystemConfig(app *server.App) {
 	app.SysConfigMu.Lock()
-	// NOTE: Do NOT defer Unlock here. The OIDC branch manually unlocks
-	// before performing network I/O to avoid blocking all config reads.
+	// NOTE: Do NOT defer Unlock here. The lock is released before the OIDC
+	// providers are initialized, which performs network I/O.
 
 	// Apply session settings
 	if app.SystemConfig.SessionDays > 0 {
@@ -314,96 +447,54 @@ func ApplySystemConfig(app *server.App) {
 
 	// Initialize LDAP if enabled
 	if app.SystemConfig.LDAPAuthEnabled && app.SystemConfig.LDAPServer != "" {
-		app.LDAPAuth = &models.LDAPAuthConfig{
-			Server:       app.SystemConfig.LDAPServer,
-			BindDN:       app.SystemConfig.LDAPBindDN,
-			BindPassword: app.SystemConfig.LDAPBindPassword,
-			BaseDN:       app.SystemConfig.LDAPBaseDN,
-			UserFilter:   app.SystemConfig.LDAPUserFilter,
-			GroupFilter:  app.SystemConfig.LDAPGroupFilter,
-			UserAttr:     app.SystemConfig.LDAPUserAttr,
-			EmailAttr:    app.SystemConfig.LDAPEmailAttr,
-			DisplayAttr:  app.SystemConfig.LDAPDisplayAttr,
-			GroupAttr:    app.SystemConfig.LDAPGroupAttr,
-			StartTLS:     app.SystemConfig.LDAPStartTLS,
-			SkipVerify:   app.SystemConfig.LDAPSkipVerify,
-		}
-		// Set defaults if not specified
-		if app.LDAPAuth.UserFilter == "" {
-			app.LDAPAuth.UserFilter = "(uid=%s)"
-		}
-		if app.LDAPAuth.UserAttr == "" {
-			app.LDAPAuth.UserAttr = "uid"
-		}
-		if app.LDAPAuth.EmailAttr == "" {
-			app.LDAPAuth.EmailAttr = "mail"
-		}
-		if app.LDAPAuth.DisplayAttr == "" {
-			app.LDAPAuth.DisplayAttr = "displayName"
-		}
-		if app.LDAPAuth.GroupAttr == "" {
-			app.LDAPAuth.GroupAttr = "memberOf"
-		}
+		app.LDAPAuth = LDAPAuthConfigFrom(app.SystemConfig)
 		log.Printf("LDAP auth configured: %s", app.LDAPAuth.Server)
 	} else {
 		app.LDAPAuth = nil
 	}
+	auth.CloseLDAPPool(app)
 
-	// Initialize OIDC if enabled - copy values and release lock before network I/O
-	oidcEnabled := app.SystemConfig.OIDCAuthEnabled
-	oidcIssuer := app.SystemConfig.OIDCIssuer
-	oidcClientID := app.SystemConfig.OIDCClientID
-	oidcClientSecret := app.SystemConfig.OIDCClientSecret
-	oidcRedirectURL := app.SystemConfig.OIDCRedirectURL
-	oidcScopes := app.SystemConfig.OIDCScopes
-	oidcGroupsClaim := app.SystemConfig.OIDCGroupsClaim
-
-	if oidcEnabled && oidcIssuer != "" && oidcClientID != "" {
-		// Release lock before network call to avoid blocking all config reads
-		app.SysConfigMu.Unlock()
-		InitOIDCProvider(app, oidcIssuer, oidcClientID, oidcClientSecret, oidcRedirectURL, oidcScopes, oidcGroupsClaim)
-	} else {
-		app.OIDCProvider = nil
-		app.OAuth2Config = nil
-		app.SysConfigMu.Unlock()
-	}
+	// Release lock before loading OIDC discovery documents to avoid
+	// blocking all config reads
+	app.SysConfigMu.Unlock()
+	InitOIDCProviders(app)
 }
 
-// InitOIDCProvider initializes the OIDC provider and OAuth2 config.
-// This function performs network I/O and must NOT be called while holding SysConfigMu.
-func InitOIDCProvider(app *server.App, issuer, clientID, clientSecret, redirectURL, scopes, groupsClaim string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	provider, err := oidc.NewProvider(ctx, issuer)
-	if err != nil {
-		log.Printf("Failed to initialize OIDC provider: %v", err)
-		return
+// LDAPAuthConfigFrom builds the runtime LDAP settings from the system
+// config, filling in defaults for empty attributes and filters.
+func LDAPAuthConfigFrom(sc models.SystemConfig) *models.LDAPAuthConfig {
+	cfg := &models.LDAPAuthConfig{
+		Server:       sc.LDAPServer,
+		BindDN:       sc.LDAPBindDN,
+		BindPassword: sc.LDAPBindPassword,
+		BaseDN:       sc.LDAPBaseDN,
+		UserFilter:   sc.LDAPUserFilter,
+		GroupFilter:  sc.LDAPGroupFilter,
+		UserAttr:     sc.LDAPUserAttr,
+		EmailAttr:    sc.LDAPEmailAttr,
+		DisplayAttr:  sc.LDAPDisplayAttr,
+		GroupAttr:    sc.LDAPGroupAttr,
+		NestedGroups: sc.LDAPNestedGroups,
+		StartTLS:     sc.LDAPStartTLS,
+		SkipVerify:   sc.LDAPSkipVerify,
+		CACert:       sc.LDAPCACert,
+		ClientCert:   sc.LDAPClientCert,
+		ClientKey:    sc.LDAPClientKey,
 	}
-
-	scopeList := []string{oidc.ScopeOpenID, "profile", "email"}
-	if scopes != "" {
-		scopeList = strings.Split(scopes, " ")
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
 	}
-
-	oauthConfig := &oauth2.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURL:  redirectURL,
-		Endpoint:     provider.Endpoint(),
-		Scopes:       scopeList,
+	if cfg.UserAttr == "" {
+		cfg.UserAttr = "uid"
 	}
-
-	if groupsClaim == "" {
-		groupsClaim = "groups"
+	if cfg.EmailAttr == "" {
+		cfg.EmailAttr = "mail"
 	}
-
-	// Store results under the lock
-	app.SysConfigMu.Lock()
-	app.OIDCProvider = provider
-	app.OAuth2Config = oauthConfig
-	app.SystemConfig.OIDCGroupsClaim = groupsClaim
-	app.SysConfigMu.Unlock()
-
-	log.Printf("OIDC auth configured: %s", issuer)
+	if cfg.DisplayAttr == "" {
+		cfg.DisplayAttr = "displayName"
+	}
+	if cfg.GroupAttr == "" {
+		cfg.GroupAttr = "memberOf"
+	}
+	return cfg
 }
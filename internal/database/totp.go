@@ -0,0 +1,257 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// LoginChallengeTTL is how long a user has to complete the second login step.
+const LoginChallengeTTL = 5 * time.Minute
+
+// maxChallengeAttempts is the number of wrong codes accepted per challenge
+// before it is discarded and the user has to enter their password again.
+const maxChallengeAttempts = 5
+
+// ErrChallengeInvalid is returned for unknown, expired or exhausted login challenges.
+var ErrChallengeInvalid = fmt.Errorf("login challenge invalid or expired")
+
+// InitTOTPTables creates the user_totp and login_challenges tables and adds
+// the per-user totp_required flag.
+func InitTOTPTables(app *server.App) error {
+	_, err := app.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS user_totp (
+			user_id INTEGER PRIMARY KEY,
+			secret TEXT NOT NULL,
+			enabled INTEGER DEFAULT 0,
+			recovery_codes TEXT DEFAULT '[]',
+			last_step INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			enabled_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS login_challenges (
+			token_hash TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			attempts INTEGER DEFAULT 0,
+			expires_at DATETIME NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_login_challenges_expires_at ON login_challenges(expires_at);
+	`)
+	if err != nil {
+		return err
+	}
+
+	if _, err := app.DB.Exec("ALTER TABLE users ADD COLUMN totp_required INTEGER DEFAULT 0"); err != nil {
+		if !strings.Contains(err.Error(), "duplicate column") {
+			log.Printf("Migration warning (totp_required): %v", err)
+		}
+	}
+	return nil
+}
+
+// GetUserTOTP returns the TOTP enrollment for a user, or nil if the user has
+// never started enrollment.
+func GetUserTOTP(app *server.App, userID int) (*models.UserTOTP, error) {
+	var t models.UserTOTP
+	var secret, codesJSON string
+	err := app.DB.QueryRow(
+		"SELECT user_id, secret, enabled, COALESCE(recovery_codes, '[]'), last_step FROM user_totp WHERE user_id = ?",
+		userID,
+	).Scan(&t.UserID, &secret, &t.Enabled, &codesJSON, &t.LastStep)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t.Secret, err = DecryptValue(app.EncryptionKey, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	json.Unmarshal([]byte(codesJSON), &t.RecoveryCodes)
+	return &t, nil
+}
+
+// SavePendingTOTP stores a new, not yet confirmed secret for a user,
+// replacing any earlier pending enrollment.
+func SavePendingTOTP(app *server.App, userID int, secret string) error {
+	encrypted, err := EncryptValue(app.EncryptionKey, secret)
+	if err != nil {
+		return err
+	}
+	_, err = app.DB.Exec(
+		`INSERT INTO user_totp (user_id, secret, enabled, recovery_codes, last_step, created_at)
+		 VALUES (?, ?, 0, '[]', 0, ?)
+		 ON CONFLICT(user_id) DO UPDATE SET
+		   secret = excluded.secret,
+		   enabled = 0,
+		   recovery_codes = '[]',
+		   last_step = 0,
+		   created_at = excluded.created_at,
+		   enabled_at = NULL`,
+		userID, encrypted, time.Now(),
+	)
+	return err
+}
+
+// EnableTOTP activates a pending enrollment once the user proved possession
+// of the secret with a code from time step step.
+func EnableTOTP(app *server.App, userID int, step int64, recoveryHashes []string) error {
+	codesJSON, _ := json.Marshal(recoveryHashes)
+	result, err := app.DB.Exec(
+		"UPDATE user_totp SET enabled = 1, last_step = ?, recovery_codes = ?, enabled_at = ? WHERE user_id = ? AND enabled = 0",
+		step, string(codesJSON), time.Now(), userID,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("no pending TOTP enrollment")
+	}
+	return nil
+}
+
+// DisableTOTP removes a user's TOTP enrollment.
+func DisableTOTP(app *server.App, userID int) error {
+	_, err := app.DB.Exec("DELETE FROM user_totp WHERE user_id = ?", userID)
+	return err
+}
+
+// ConsumeTOTPStep records step as the last used time step. It returns false
+// if an equal or later step was already used, which means the code was replayed.
+func ConsumeTOTPStep(app *server.App, userID int, step int64) bool {
+	result, err := app.DB.Exec("UPDATE user_totp SET last_step = ? WHERE user_id = ? AND last_step < ?", step, userID, step)
+	if err != nil {
+		log.Printf("Error updating TOTP step for user %d: %v", userID, err)
+		return false
+	}
+	rows, _ := result.RowsAffected()
+	return rows == 1
+}
+
+// SetRecoveryCodes replaces the stored recovery code hashes for a user.
+func SetRecoveryCodes(app *server.App, userID int, hashes []string) error {
+	codesJSON, _ := json.Marshal(hashes)
+	_, err := app.DB.Exec("UPDATE user_totp SET recovery_codes = ? WHERE user_id = ?", string(codesJSON), userID)
+	return err
+}
+
+// UseRecoveryCode checks code against the user's unused recovery codes and
+// removes it on a match.
+func UseRecoveryCode(app *server.App, userID int, code string) bool {
+	t, err := GetUserTOTP(app, userID)
+	if err != nil || t == nil || !t.Enabled {
+		return false
+	}
+
+	hash := auth.HashRecoveryCode(code)
+	remaining := make([]string, 0, len(t.RecoveryCodes))
+	found := false
+	for _, h := range t.RecoveryCodes {
+		if !found && h == hash {
+			found = true
+			continue
+		}
+		remaining = append(remaining, h)
+	}
+	if !found {
+		return false
+	}
+
+	// Only succeed if the stored list is unchanged, so a code cannot be used twice concurrently
+	oldJSON, _ := json.Marshal(t.RecoveryCodes)
+	newJSON, _ := json.Marshal(remaining)
+	result, err := app.DB.Exec(
+		"UPDATE user_totp SET recovery_codes = ? WHERE user_id = ? AND recovery_codes = ?",
+		string(newJSON), userID, string(oldJSON),
+	)
+	if err != nil {
+		log.Printf("Error consuming recovery code for user %d: %v", userID, err)
+		return false
+	}
+	rows, _ := result.RowsAffected()
+	return rows == 1
+}
+
+// SetUserTOTPRequired sets the per-user flag that forces TOTP enrollment.
+func SetUserTOTPRequired(app *server.App, userID int, required bool) (bool, error) {
+	result, err := app.DB.Exec("UPDATE users SET totp_required = ?, updated_at = ? WHERE id = ?", required, time.Now(), userID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// hashChallengeToken returns the stored form of a login challenge token.
+func hashChallengeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateLoginChallenge starts the second login step for a user whose password
+// was verified. The returned token is handed to the client; only its hash is stored.
+func CreateLoginChallenge(app *server.App, userID int) (string, error) {
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = app.DB.Exec(
+		"INSERT INTO login_challenges (token_hash, user_id, expires_at) VALUES (?, ?, ?)",
+		hashChallengeToken(token), userID, time.Now().Add(LoginChallengeTTL),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetLoginChallenge returns the user ID for a valid, unexpired challenge.
+func GetLoginChallenge(app *server.App, token string) (int, error) {
+	if token == "" {
+		return 0, ErrChallengeInvalid
+	}
+	var userID int
+	err := app.DB.QueryRow(
+		"SELECT user_id FROM login_challenges WHERE token_hash = ? AND expires_at > ? AND attempts < ?",
+		hashChallengeToken(token), time.Now(), maxChallengeAttempts,
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrChallengeInvalid
+	}
+	return userID, err
+}
+
+// FailLoginChallenge counts a wrong code against a challenge.
+func FailLoginChallenge(app *server.App, token string) {
+	if _, err := app.DB.Exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = ?", hashChallengeToken(token)); err != nil {
+		log.Printf("Error recording failed login challenge: %v", err)
+	}
+}
+
+// DeleteLoginChallenge removes a completed challenge.
+func DeleteLoginChallenge(app *server.App, token string) {
+	if _, err := app.DB.Exec("DELETE FROM login_challenges WHERE token_hash = ?", hashChallengeToken(token)); err != nil {
+		log.Printf("Error deleting login challenge: %v", err)
+	}
+}
+
+// CleanupExpiredLoginChallenges deletes challenges that can no longer be completed.
+func CleanupExpiredLoginChallenges(app *server.App) {
+	if _, err := app.DB.Exec("DELETE FROM login_challenges WHERE expires_at < ? OR attempts >= ?", time.Now(), maxChallengeAttempts); err != nil {
+		log.Printf("Error cleaning up login challenges: %v", err)
+	}
+}
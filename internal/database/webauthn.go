@@ -0,0 +1,214 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// WebAuthnCeremonyTTL is how long a started passkey registration or login
+// may take before it has to be restarted.
+const WebAuthnCeremonyTTL = 5 * time.Minute
+
+// ErrCeremonyInvalid is returned for unknown, expired or already used passkey ceremonies.
+var ErrCeremonyInvalid = fmt.Errorf("passkey ceremony invalid or expired")
+
+// InitWebAuthnTables creates the passkey credential and ceremony tables and
+// adds the per-user WebAuthn handle.
+func InitWebAuthnTables(app *server.App) error {
+	_, err := app.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS webauthn_credentials (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			credential_id TEXT UNIQUE NOT NULL,
+			name TEXT NOT NULL DEFAULT '',
+			credential TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_used_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+		CREATE TABLE IF NOT EXISTS webauthn_sessions (
+			token_hash TEXT PRIMARY KEY,
+			user_id INTEGER,
+			data TEXT NOT NULL,
+			expires_at DATETIME NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_webauthn_sessions_expires_at ON webauthn_sessions(expires_at);
+	`)
+	if err != nil {
+		return err
+	}
+
+	if _, err := app.DB.Exec("ALTER TABLE users ADD COLUMN webauthn_handle TEXT"); err != nil {
+		if !strings.Contains(err.Error(), "duplicate column") {
+			log.Printf("Migration warning (webauthn_handle): %v", err)
+		}
+	}
+	app.DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_webauthn_handle ON users(webauthn_handle) WHERE webauthn_handle IS NOT NULL")
+	return nil
+}
+
+// GetWebAuthnHandle returns the user's WebAuthn handle, creating one on first use.
+func GetWebAuthnHandle(app *server.App, userID int) (string, error) {
+	var handle sql.NullString
+	if err := app.DB.QueryRow("SELECT webauthn_handle FROM users WHERE id = ?", userID).Scan(&handle); err != nil {
+		return "", err
+	}
+	if handle.Valid && handle.String != "" {
+		return handle.String, nil
+	}
+
+	newHandle, err := auth.GenerateWebAuthnHandle()
+	if err != nil {
+		return "", err
+	}
+	if _, err := app.DB.Exec("UPDATE users SET webauthn_handle = ? WHERE id = ? AND webauthn_handle IS NULL", newHandle, userID); err != nil {
+		return "", err
+	}
+	// Re-read in case a concurrent request assigned a handle first
+	if err := app.DB.QueryRow("SELECT webauthn_handle FROM users WHERE id = ?", userID).Scan(&handle); err != nil {
+		return "", err
+	}
+	return handle.String, nil
+}
+
+// GetUserIDByWebAuthnHandle resolves the user handle returned by an authenticator.
+func GetUserIDByWebAuthnHandle(app *server.App, handle string) (int, error) {
+	var userID int
+	err := app.DB.QueryRow("SELECT id FROM users WHERE webauthn_handle = ?", handle).Scan(&userID)
+	return userID, err
+}
+
+// ListWebAuthnCredentials returns all passkeys registered by a user.
+func ListWebAuthnCredentials(app *server.App, userID int) ([]models.WebAuthnCredential, error) {
+	rows, err := app.DB.Query(
+		"SELECT id, user_id, credential_id, name, credential, created_at, last_used_at FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	creds := []models.WebAuthnCredential{}
+	for rows.Next() {
+		var c models.WebAuthnCredential
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&c.ID, &c.UserID, &c.CredentialID, &c.Name, &c.Data, &c.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			c.LastUsedAt = &lastUsed.Time
+		}
+		creds = append(creds, c)
+	}
+	return creds, rows.Err()
+}
+
+// AddWebAuthnCredential stores a newly registered passkey.
+func AddWebAuthnCredential(app *server.App, userID int, credentialID, name, data string) error {
+	_, err := app.DB.Exec(
+		"INSERT INTO webauthn_credentials (user_id, credential_id, name, credential, created_at) VALUES (?, ?, ?, ?, ?)",
+		userID, credentialID, name, data, time.Now(),
+	)
+	return err
+}
+
+// UpdateWebAuthnCredentialUse stores the credential record after a successful
+// login (the sign counter changes) and records when it was used.
+func UpdateWebAuthnCredentialUse(app *server.App, credentialID, data string) error {
+	_, err := app.DB.Exec(
+		"UPDATE webauthn_credentials SET credential = ?, last_used_at = ? WHERE credential_id = ?",
+		data, time.Now(), credentialID,
+	)
+	return err
+}
+
+// RenameWebAuthnCredential changes the label of one of a user's passkeys.
+func RenameWebAuthnCredential(app *server.App, userID, id int, name string) (bool, error) {
+	result, err := app.DB.Exec("UPDATE webauthn_credentials SET name = ? WHERE id = ? AND user_id = ?", name, id, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// DeleteWebAuthnCredential removes one of a user's passkeys.
+func DeleteWebAuthnCredential(app *server.App, userID, id int) (bool, error) {
+	result, err := app.DB.Exec("DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// SaveWebAuthnCeremony stores the server side state of a started registration
+// (userID set) or login (userID 0) and returns the token the client must send
+// back to finish it. Only the token hash is stored.
+func SaveWebAuthnCeremony(app *server.App, userID int, data string) (string, error) {
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	var uid interface{}
+	if userID > 0 {
+		uid = userID
+	}
+	_, err = app.DB.Exec(
+		"INSERT INTO webauthn_sessions (token_hash, user_id, data, expires_at) VALUES (?, ?, ?, ?)",
+		hashChallengeToken(token), uid, data, time.Now().Add(WebAuthnCeremonyTTL),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// TakeWebAuthnCeremony returns and deletes a ceremony, so each one can only be
+// finished once. The returned userID is 0 for login ceremonies.
+func TakeWebAuthnCeremony(app *server.App, token string) (int, string, error) {
+	if token == "" {
+		return 0, "", ErrCeremonyInvalid
+	}
+	hash := hashChallengeToken(token)
+
+	var userID sql.NullInt64
+	var data string
+	err := app.DB.QueryRow(
+		"SELECT user_id, data FROM webauthn_sessions WHERE token_hash = ? AND expires_at > ?",
+		hash, time.Now(),
+	).Scan(&userID, &data)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrCeremonyInvalid
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	result, err := app.DB.Exec("DELETE FROM webauthn_sessions WHERE token_hash = ?", hash)
+	if err != nil {
+		return 0, "", err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return 0, "", ErrCeremonyInvalid
+	}
+	return int(userID.Int64), data, nil
+}
+
+// CleanupExpiredWebAuthnCeremonies deletes passkey ceremonies that were never finished.
+func CleanupExpiredWebAuthnCeremonies(app *server.App) {
+	if _, err := app.DB.Exec("DELETE FROM webauthn_sessions WHERE expires_at < ?", time.Now()); err != nil {
+		log.Printf("Error cleaning up passkey ceremonies: %v", err)
+	}
+}
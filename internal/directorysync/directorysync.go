@@ -0,0 +1,202 @@
+// Package directorysync keeps the LDAP users in the users table in step with
+// the directory, so that admins can give them app access before their first
+// login and users removed from the directory lose access without waiting for
+// their sessions to expire.
+package directorysync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/lldap"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// Directory sync sources.
+const (
+	SourceLDAP  = "ldap"  // LDAP search with the LDAP login settings
+	SourceLLDAP = "lldap" // LLDAP GraphQL API (LLDAP_URL)
+)
+
+// IsSource reports whether source is a valid directory sync setting ("" is off).
+func IsSource(source string) bool {
+	return source == "" || source == SourceLDAP || source == SourceLLDAP
+}
+
+// Run syncs the users of the configured source now and records the result.
+// Runs changing users, failed runs and runs started by an admin (actor, from
+// ip) are written to the audit log.
+func Run(app *server.App, actor, ip string) *models.DirectorySyncResult {
+	app.DirectorySyncRunMu.Lock()
+	defer app.DirectorySyncRunMu.Unlock()
+
+	app.SysConfigMu.RLock()
+	source := app.SystemConfig.DirectorySyncSource
+	removed := app.SystemConfig.DirectorySyncRemoved
+	app.SysConfigMu.RUnlock()
+
+	setRunning(app, true)
+	result := &models.DirectorySyncResult{Source: source, StartedAt: time.Now()}
+	users, err := fetchUsers(app, source)
+	if err == nil {
+		result.Users = len(users)
+		err = database.ApplyDirectorySync(app, users, removed, result)
+	}
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	app.DirectorySyncMu.Lock()
+	app.DirectorySyncRunning = false
+	app.DirectorySyncLast = result
+	app.DirectorySyncMu.Unlock()
+
+	if err != nil {
+		log.Printf("Directory sync (%s) failed: %v", source, err)
+		database.LogAudit(app, actor, "directory_sync_failed", fmt.Sprintf("Directory sync from %s failed: %v", source, err), ip)
+		return result
+	}
+	summary := Summary(result)
+	log.Printf("Directory sync (%s): %s", source, summary)
+	changed := result.Added+result.Updated+result.Enabled+result.Disabled+result.Deleted+len(result.Skipped) > 0
+	if changed || actor != "" {
+		database.LogAudit(app, actor, "directory_sync", fmt.Sprintf("Directory sync from %s: %s", source, summary), ip)
+	}
+	return result
+}
+
+// Summary describes the counts of a sync run in one line.
+func Summary(r *models.DirectorySyncResult) string {
+	s := fmt.Sprintf("%d users in directory, %d added, %d updated, %d re-enabled, %d disabled, %d deleted, %d sessions ended",
+		r.Users, r.Added, r.Updated, r.Enabled, r.Disabled, r.Deleted, r.SessionsEnded)
+	if len(r.Skipped) > 0 {
+		s += fmt.Sprintf(", %d skipped (%s)", len(r.Skipped), strings.Join(r.Skipped, "; "))
+	}
+	return s
+}
+
+// Status returns whether a sync is running and the result of the last run.
+func Status(app *server.App) (bool, *models.DirectorySyncResult) {
+	app.DirectorySyncMu.RLock()
+	defer app.DirectorySyncMu.RUnlock()
+	return app.DirectorySyncRunning, app.DirectorySyncLast
+}
+
+func setRunning(app *server.App, running bool) {
+	app.DirectorySyncMu.Lock()
+	app.DirectorySyncRunning = running
+	app.DirectorySyncMu.Unlock()
+}
+
+// fetchUsers lists the users of source with their groups, named the way an
+// LDAP login stores them.
+func fetchUsers(app *server.App, source string) ([]models.AuthenticatedUser, error) {
+	switch source {
+	case SourceLDAP:
+		return auth.ListLDAPUsers(app)
+	case SourceLLDAP:
+		if app.LLDAPConfig == nil {
+			return nil, fmt.Errorf("LLDAP not configured")
+		}
+		lldapUsers, err := lldap.ListUsers(app)
+		if err != nil {
+			return nil, err
+		}
+		users := make([]models.AuthenticatedUser, 0, len(lldapUsers))
+		for _, u := range lldapUsers {
+			displayName := u.DisplayName
+			if displayName == "" {
+				displayName = u.ID
+			}
+			// LDAP logins name groups by their lowercased cn, which LLDAP
+			// sets to the group's display name
+			groups := make([]string, len(u.Groups))
+			for i, g := range u.Groups {
+				groups[i] = strings.ToLower(g)
+			}
+			users = append(users, models.AuthenticatedUser{
+				Username:    u.ID,
+				DisplayName: displayName,
+				Email:       u.Email,
+				Groups:      groups,
+				Source:      "ldap",
+			})
+		}
+		return users, nil
+	case "":
+		return nil, fmt.Errorf("directory sync is off")
+	}
+	return nil, fmt.Errorf("unknown directory sync source %q", source)
+}
+
+// Reschedule wakes the sync loop to pick up new settings. It never blocks.
+func Reschedule(app *server.App) {
+	select {
+	case app.DirectorySyncReschedule <- struct{}{}:
+	default:
+	}
+}
+
+// StartSyncLoop starts a background goroutine that runs the directory sync
+// every DirectorySyncInterval minutes while a source is set, and right away
+// when a source is first set. The goroutine stops when the context is
+// cancelled.
+func StartSyncLoop(app *server.App, ctx context.Context) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Directory sync recovered from panic: %v", r)
+			}
+		}()
+		for {
+			var timer *time.Timer
+			var due <-chan time.Time
+			if delay, ok := nextRun(app); ok {
+				timer = time.NewTimer(delay)
+				due = timer.C
+			}
+			select {
+			case <-ctx.Done():
+				if timer != nil {
+					timer.Stop()
+				}
+				log.Println("Directory sync stopped")
+				return
+			case <-app.DirectorySyncReschedule:
+				if timer != nil {
+					timer.Stop()
+				}
+			case <-due:
+				Run(app, "", "")
+			}
+		}
+	}()
+}
+
+// nextRun returns how long until the next scheduled sync, or false if the
+// sync is off.
+func nextRun(app *server.App) (time.Duration, bool) {
+	app.SysConfigMu.RLock()
+	source := app.SystemConfig.DirectorySyncSource
+	interval := time.Duration(app.SystemConfig.DirectorySyncInterval) * time.Minute
+	app.SysConfigMu.RUnlock()
+	if source == "" {
+		return 0, false
+	}
+	if interval <= 0 {
+		interval = database.DefaultDirectorySyncMinutes * time.Minute
+	}
+
+	_, last := Status(app)
+	if last == nil {
+		return 0, true
+	}
+	return max(time.Until(last.StartedAt.Add(interval)), 0), true
+}
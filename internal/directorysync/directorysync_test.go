@@ -0,0 +1,166 @@
+package directorysync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"dashgate/internal/database"
+	"dashgate/internal/ldaptest"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+func newTestApp(t *testing.T) *server.App {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("AUTH_MODE", "local")
+
+	app := server.New()
+	database.InitAuthConfigDefaults(app)
+	if err := database.InitDatabase(app); err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	t.Cleanup(func() { app.DB.Close() })
+	return app
+}
+
+// storedUsers lists the users table as "name:groups", with "!" after the
+// name of disabled users.
+func storedUsers(t *testing.T, app *server.App) []string {
+	t.Helper()
+	rows, err := app.DB.Query("SELECT username, groups, COALESCE(disabled, 0) FROM users ORDER BY username")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var users []string
+	for rows.Next() {
+		var name, groupsJSON string
+		var disabled bool
+		rows.Scan(&name, &groupsJSON, &disabled)
+		var groups []string
+		json.Unmarshal([]byte(groupsJSON), &groups)
+		sort.Strings(groups)
+		if disabled {
+			name += "!"
+		}
+		users = append(users, name+":"+strings.Join(groups, ","))
+	}
+	return users
+}
+
+func TestRunLDAP(t *testing.T) {
+	dir := ldaptest.NewServer()
+	defer dir.Close()
+	const (
+		alice = "uid=alice,ou=people,dc=example,dc=com"
+		bob   = "uid=bob,ou=people,dc=example,dc=com"
+		carol = "uid=carol,ou=people,dc=example,dc=com"
+		staff = "cn=Staff,ou=groups,dc=example,dc=com"
+	)
+	dir.SetPassword("cn=service,dc=example,dc=com", "service-secret")
+	dir.AddEntry(alice, map[string][]string{"uid": {"alice"}, "mail": {"alice@example.com"}, "cn": {"Alice"}, "memberOf": {staff}})
+	dir.AddEntry(bob, map[string][]string{"uid": {"bob"}})
+	dir.AddEntry(carol, map[string][]string{"uid": {"carol"}})
+
+	app := newTestApp(t)
+	app.LDAPAuth = &models.LDAPAuthConfig{
+		Server: dir.URL, BindDN: "cn=service,dc=example,dc=com", BindPassword: "service-secret", BaseDN: "dc=example,dc=com",
+		UserFilter: "(uid=%s)", UserAttr: "uid", EmailAttr: "mail", DisplayAttr: "cn", GroupAttr: "memberOf",
+	}
+	app.SystemConfig.DirectorySyncSource = SourceLDAP
+	// A local account is never taken over by a directory user of the same name
+	app.DB.Exec("INSERT INTO users (username, password_hash, groups) VALUES ('carol', 'hash', '[\"local\"]')")
+
+	type counts struct{ users, added, updated, enabled, disabled, deleted, sessionsEnded, skipped int }
+	tests := []struct {
+		name    string
+		change  func()
+		removed string
+		want    counts
+		wantErr bool
+		stored  []string
+	}{
+		{"initial sync", nil, database.DirectorySyncDisable,
+			counts{users: 3, added: 2, skipped: 1}, false, []string{"alice:staff", "bob:", "carol:local"}},
+		{"unchanged", nil, database.DirectorySyncDisable,
+			counts{users: 3, skipped: 1}, false, []string{"alice:staff", "bob:", "carol:local"}},
+		{"user removed", func() {
+			var id int
+			app.DB.QueryRow("SELECT id FROM users WHERE username = 'bob'").Scan(&id)
+			database.CreateSession(app, id, "bob-session", time.Now().Add(time.Hour), "", "")
+			dir.RemoveEntry(bob)
+		}, database.DirectorySyncDisable,
+			counts{users: 2, disabled: 1, sessionsEnded: 1, skipped: 1}, false, []string{"alice:staff", "bob!:", "carol:local"}},
+		{"user back", func() {
+			dir.AddEntry(bob, map[string][]string{"uid": {"bob"}, "memberOf": {staff}})
+		}, database.DirectorySyncDisable,
+			counts{users: 3, enabled: 1, skipped: 1}, false, []string{"alice:staff", "bob:staff", "carol:local"}},
+		{"user deleted", func() { dir.RemoveEntry(bob) }, database.DirectorySyncDelete,
+			counts{users: 2, deleted: 1, skipped: 1}, false, []string{"alice:staff", "carol:local"}},
+		{"empty directory", func() {
+			dir.RemoveEntry(alice)
+			dir.RemoveEntry(carol)
+		}, database.DirectorySyncDelete,
+			counts{}, true, []string{"alice:staff", "carol:local"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.change != nil {
+				tt.change()
+			}
+			app.SystemConfig.DirectorySyncRemoved = tt.removed
+
+			r := Run(app, "", "")
+			if (r.Error != "") != tt.wantErr {
+				t.Fatalf("error %q, want error: %v", r.Error, tt.wantErr)
+			}
+			got := counts{r.Users, r.Added, r.Updated, r.Enabled, r.Disabled, r.Deleted, r.SessionsEnded, len(r.Skipped)}
+			if got != tt.want {
+				t.Errorf("counts %+v, want %+v", got, tt.want)
+			}
+			if stored := storedUsers(t, app); !reflect.DeepEqual(stored, tt.stored) {
+				t.Errorf("stored users %q, want %q", stored, tt.stored)
+			}
+		})
+	}
+}
+
+func TestRunLLDAP(t *testing.T) {
+	lldapServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/simple/login":
+			w.Write([]byte(`{"token":"test-token"}`))
+		case "/api/graphql":
+			w.Write([]byte(`{"data":{"users":[
+				{"id":"dave","email":"dave@example.com","displayName":"Dave","groups":[{"displayName":"Media Users"}]},
+				{"id":"erin","email":"","displayName":"","groups":[]}
+			]}}`))
+		}
+	}))
+	defer lldapServer.Close()
+
+	app := newTestApp(t)
+	app.LLDAPConfig = &server.LLDAPConfigRef{URL: lldapServer.URL, Username: "admin", Password: "secret"}
+	app.SystemConfig.DirectorySyncSource = SourceLLDAP
+
+	r := Run(app, "admin", "")
+	if r.Error != "" || r.Added != 2 {
+		t.Fatalf("result %+v", r)
+	}
+	// Groups are named like LDAP logins name them, and users without an
+	// email do not collide on the unique email column
+	if stored := storedUsers(t, app); !reflect.DeepEqual(stored, []string{"dave:media users", "erin:"}) {
+		t.Errorf("stored users %q", stored)
+	}
+	if running, last := Status(app); running || last != r {
+		t.Errorf("status running=%v last=%+v", running, last)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"os"
 	"strings"
-	"time"
 
 	"dashgate/internal/models"
 	"dashgate/internal/server"
@@ -64,6 +63,7 @@ func StartCaddyDiscoveryLoop(app *server.App) {
 
 	app.CaddyDiscovery.Enabled = true
 	app.CaddyDiscovery.Stop = make(chan struct{})
+	stop := app.CaddyDiscovery.Stop
 
 	app.CaddyDiscovery.Wg.Add(1)
 	go func() {
@@ -73,17 +73,7 @@ func StartCaddyDiscoveryLoop(app *server.App) {
 				log.Printf("Caddy discovery goroutine panicked: %v", r)
 			}
 		}()
-		ticker := time.NewTicker(60 * time.Second)
-		defer ticker.Stop()
-		DiscoverCaddyApps(app) // Initial discovery
-		for {
-			select {
-			case <-app.CaddyDiscovery.Stop:
-				return
-			case <-ticker.C:
-				DiscoverCaddyApps(app)
-			}
-		}
+		discoveryLoop(app, "caddy", app.CaddyDiscovery, stop, DiscoverCaddyApps)
 	}()
 }
 
@@ -102,19 +92,18 @@ func StopCaddyDiscoveryLoop(app *server.App) {
 	app.DiscoveryMu.Lock()
 	app.CaddyDiscovery.Enabled = false
 	app.CaddyDiscovery.ClearApps()
+	app.CaddyDiscovery.ResetStatus()
 	app.DiscoveryMu.Unlock()
 }
 
 // DiscoverCaddyApps queries the Caddy admin API for server configurations
 // and updates the CaddyDiscovery manager with discovered reverse proxy routes.
-func DiscoverCaddyApps(app *server.App) {
-	app.DiscoveryMu.RLock()
-	enabled := app.CaddyDiscovery.Enabled
-	app.DiscoveryMu.RUnlock()
-	if !enabled {
-		return
-	}
+func DiscoverCaddyApps(app *server.App) error {
+	return runDiscovery(app, app.CaddyDiscovery, "Caddy", fetchCaddyApps)
+}
 
+// fetchCaddyApps reads the HTTP server config from the Caddy admin API.
+func fetchCaddyApps(app *server.App) ([]models.App, error) {
 	app.SysConfigMu.RLock()
 	caddyAdminURL := app.SystemConfig.CaddyAdminURL
 	caddyUsername := app.SystemConfig.CaddyUsername
@@ -122,18 +111,16 @@ func DiscoverCaddyApps(app *server.App) {
 	app.SysConfigMu.RUnlock()
 
 	if caddyAdminURL == "" {
-		return
+		return nil, fmt.Errorf("Caddy admin URL is not configured")
 	}
 
 	if err := urlvalidation.ValidateDiscoveryURL(caddyAdminURL); err != nil {
-		log.Printf("Caddy discovery SSRF protection: %v", err)
-		return
+		return nil, fmt.Errorf("SSRF protection: %w", err)
 	}
 
 	req, err := http.NewRequest("GET", caddyAdminURL+"/config/apps/http/servers/", nil)
 	if err != nil {
-		log.Printf("Caddy discovery error creating request: %v", err)
-		return
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
 	// Add basic auth if credentials are configured
@@ -143,27 +130,23 @@ func DiscoverCaddyApps(app *server.App) {
 
 	resp, err := app.HTTPClient.Do(req)
 	if err != nil {
-		log.Printf("Caddy discovery error: %v", err)
-		return
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized {
-		log.Printf("Caddy discovery error: authentication required or invalid credentials")
-		return
+		return nil, fmt.Errorf("authentication required or invalid credentials")
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Caddy discovery error: status %d", resp.StatusCode)
-		return
+		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
 	}
 
 	// Parse the Caddy config response using flexible structure
 	var servers map[string]json.RawMessage
 
 	if err := json.NewDecoder(io.LimitReader(resp.Body, 10*1024*1024)).Decode(&servers); err != nil { // 10MB limit
-		log.Printf("Caddy discovery decode error: %v", err)
-		return
+		return nil, fmt.Errorf("decode error: %w", err)
 	}
 
 	var apps []models.App
@@ -239,6 +222,7 @@ func DiscoverCaddyApps(app *server.App) {
 					URL:         fmt.Sprintf("%s://%s", protocol, host),
 					Description: description,
 					Status:      "online", // Caddy manages its own health
+					Upstream:    upstream,
 				}
 
 				apps = append(apps, a)
@@ -246,9 +230,7 @@ func DiscoverCaddyApps(app *server.App) {
 		}
 	}
 
-	app.CaddyDiscovery.SetApps(apps)
-
-	log.Printf("Caddy discovery found %d apps", len(apps))
+	return apps, nil
 }
 
 // FindReverseProxyUpstream recursively searches Caddy handler configuration
@@ -1,25 +1,120 @@
 package discovery
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
 	"dashgate/internal/models"
 	"dashgate/internal/server"
 )
 
+// ErrDiscoveryDisabled is returned when a run is requested for a disabled source.
+var ErrDiscoveryDisabled = errors.New("discovery is disabled")
+
+// SourceNames lists all discovery sources in display order.
+var SourceNames = []string{"docker", "traefik", "nginx", "npm", "caddy"}
+
+// sourceManager returns the manager and discover function for a source name.
+func sourceManager(app *server.App, source string) (*server.DiscoveryManager, func(*server.App) error, bool) {
+	switch source {
+	case "docker":
+		return app.DockerDiscovery, DiscoverDockerApps, true
+	case "traefik":
+		return app.TraefikDiscovery, DiscoverTraefikApps, true
+	case "nginx":
+		return app.NginxDiscovery, DiscoverNginxApps, true
+	case "npm":
+		return app.NPMDiscovery, DiscoverNPMApps, true
+	case "caddy":
+		return app.CaddyDiscovery, DiscoverCaddyApps, true
+	}
+	return nil, nil, false
+}
+
+// runDiscovery executes one discovery run for a manager and records its status.
+// On failure the previously discovered apps are kept.
+func runDiscovery(app *server.App, dm *server.DiscoveryManager, label string, fetch func(*server.App) ([]models.App, error)) error {
+	dm.RunMu.Lock()
+	defer dm.RunMu.Unlock()
+
+	app.DiscoveryMu.RLock()
+	enabled := dm.Enabled
+	app.DiscoveryMu.RUnlock()
+	if !enabled {
+		return ErrDiscoveryDisabled
+	}
+
+	start := time.Now()
+	dm.BeginRun()
+	apps, err := fetch(app)
+	dm.RecordRun(start, err)
+	if err != nil {
+		log.Printf("%s discovery error: %v", label, err)
+		return err
+	}
+
+	resolveIcons(app, apps)
+	dm.SetApps(apps)
+	log.Printf("%s discovery found %d apps", label, len(apps))
+	return nil
+}
+
+// RunDiscoveryNow synchronously runs discovery for a single source and
+// returns its updated status.
+func RunDiscoveryNow(app *server.App, source string) (models.DiscoveryStatus, error) {
+	dm, discover, ok := sourceManager(app, source)
+	if !ok {
+		return models.DiscoveryStatus{}, fmt.Errorf("unknown discovery source %q", source)
+	}
+	err := discover(app)
+	return sourceStatus(app, source, dm), err
+}
+
+// GetDiscoveryStatus returns the run status of every discovery source.
+func GetDiscoveryStatus(app *server.App) []models.DiscoveryStatus {
+	result := make([]models.DiscoveryStatus, 0, len(SourceNames))
+	for _, source := range SourceNames {
+		dm, _, _ := sourceManager(app, source)
+		result = append(result, sourceStatus(app, source, dm))
+	}
+	return result
+}
+
+// sourceStatus builds the status snapshot for one manager.
+func sourceStatus(app *server.App, source string, dm *server.DiscoveryManager) models.DiscoveryStatus {
+	status := dm.Status(source)
+	app.DiscoveryMu.RLock()
+	status.Enabled = dm.Enabled
+	app.DiscoveryMu.RUnlock()
+	return status
+}
+
 // GetAllRawDiscoveredApps collects apps from all enabled discovery sources
-// with source tags and any user-defined overrides attached.
+// with source tags, any user-defined overrides and the effective override
+// after applying discovery rules attached.
 func GetAllRawDiscoveredApps(app *server.App) []models.DiscoveredAppWithOverride {
 	var result []models.DiscoveredAppWithOverride
 
+	rules := getDiscoveryRules(app)
+
 	addApps := func(apps []models.App, source string) {
 		for _, a := range apps {
-			result = append(result, models.DiscoveredAppWithOverride{
+			d := models.DiscoveredAppWithOverride{
 				Name:        a.Name,
 				URL:         a.URL,
 				Icon:        a.Icon,
 				Description: a.Description,
 				Source:      source,
+				Upstream:    a.Upstream,
+				Labels:      a.Labels,
 				Override:    getDiscoveredOverride(app, a.URL),
-			})
+			}
+			fromRules, matched := ApplyRules(rules, d)
+			d.MatchedRules = matched
+			d.Effective = mergeOverrides(d.Override, fromRules)
+			result = append(result, d)
 		}
 	}
 
@@ -42,6 +137,13 @@ func GetAllRawDiscoveredApps(app *server.App) []models.DiscoveredAppWithOverride
 	return result
 }
 
+// getDiscoveryRules returns a snapshot of the discovery rules in evaluation order.
+func getDiscoveryRules(app *server.App) []models.DiscoveryRule {
+	app.DiscoveryRulesMu.RLock()
+	defer app.DiscoveryRulesMu.RUnlock()
+	return append([]models.DiscoveryRule{}, app.DiscoveryRules...)
+}
+
 // getDiscoveredOverride returns a copy of the override for the given URL, or nil.
 func getDiscoveredOverride(app *server.App, url string) *models.DiscoveredAppOverride {
 	app.DiscoveredOverridesMu.RLock()
@@ -3,6 +3,7 @@ package discovery
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net"
@@ -49,6 +50,7 @@ func StartDockerDiscoveryLoop(app *server.App) {
 
 	app.DockerDiscovery.Enabled = true
 	app.DockerDiscovery.Stop = make(chan struct{})
+	stop := app.DockerDiscovery.Stop
 
 	app.DockerDiscovery.Wg.Add(1)
 	go func() {
@@ -58,17 +60,7 @@ func StartDockerDiscoveryLoop(app *server.App) {
 				log.Printf("Docker discovery goroutine panicked: %v", r)
 			}
 		}()
-		ticker := time.NewTicker(60 * time.Second)
-		defer ticker.Stop()
-		DiscoverDockerApps(app) // Initial discovery
-		for {
-			select {
-			case <-app.DockerDiscovery.Stop:
-				return
-			case <-ticker.C:
-				DiscoverDockerApps(app)
-			}
-		}
+		discoveryLoop(app, "docker", app.DockerDiscovery, stop, DiscoverDockerApps)
 	}()
 }
 
@@ -87,82 +79,53 @@ func StopDockerDiscoveryLoop(app *server.App) {
 	app.DiscoveryMu.Lock()
 	app.DockerDiscovery.Enabled = false
 	app.DockerDiscovery.ClearApps()
+	app.DockerDiscovery.ResetStatus()
 	app.DiscoveryMu.Unlock()
 }
 
 // DiscoverDockerApps queries the Docker API for containers with dashgate labels
 // and updates the DockerDiscovery manager with the results.
-func DiscoverDockerApps(app *server.App) {
-	app.DiscoveryMu.RLock()
-	enabled := app.DockerDiscovery.Enabled
-	app.DiscoveryMu.RUnlock()
-	if !enabled {
-		return
-	}
+func DiscoverDockerApps(app *server.App) error {
+	return runDiscovery(app, app.DockerDiscovery, "Docker", fetchDockerApps)
+}
 
+// fetchDockerApps lists containers with dashgate labels from the Docker API.
+// Podman sockets are detected automatically and queried through the libpod API.
+func fetchDockerApps(app *server.App) ([]models.App, error) {
 	app.SysConfigMu.RLock()
 	socketPath := app.SystemConfig.DockerSocketPath
 	app.SysConfigMu.RUnlock()
 
 	if socketPath == "" {
-		socketPath = "/var/run/docker.sock"
-	}
-
-	var client *http.Client
-	var apiURL string
-
-	// Check if socket path is a TCP/HTTP URL (for Windows Docker Desktop TCP mode or remote Docker)
-	if strings.HasPrefix(socketPath, "tcp://") || strings.HasPrefix(socketPath, "http://") {
-		// Use TCP connection
-		apiURL = strings.TrimPrefix(socketPath, "tcp://")
-		if !strings.HasPrefix(apiURL, "http://") {
-			apiURL = "http://" + apiURL
-		}
-		if err := urlvalidation.ValidateDiscoveryURL(apiURL); err != nil {
-			log.Printf("Docker discovery SSRF protection: %v", err)
-			return
-		}
-		client = &http.Client{Timeout: 10 * time.Second}
-	} else if strings.HasPrefix(socketPath, "npipe://") {
-		// Windows named pipe - not supported in this build
-		log.Printf("Docker discovery: Windows named pipes (npipe://) are not supported. Please use tcp://localhost:2375 instead (enable in Docker Desktop settings).")
-		return
-	} else {
-		// Use Unix socket (Linux/macOS)
-		if _, err := os.Stat(socketPath); os.IsNotExist(err) {
-			log.Printf("Docker socket not found at %s", socketPath)
-			return
-		}
-		client = &http.Client{
-			Transport: &http.Transport{
-				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-					return net.Dial("unix", socketPath)
-				},
-			},
-			Timeout: 10 * time.Second,
-		}
-		apiURL = "http://localhost"
+		socketPath = DefaultContainerSocket()
 	}
 
-	resp, err := client.Get(apiURL + "/containers/json?all=true")
+	client, apiURL, err := containerAPIClient(socketPath)
 	if err != nil {
-		log.Printf("Docker discovery error: %v", err)
-		return
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Docker discovery error: API returned status %d", resp.StatusCode)
-		return
-	}
+	engine := DetectContainerEngine(client, apiURL, socketPath)
+	app.DiscoveryMu.Lock()
+	app.ContainerEngine = engine
+	app.DiscoveryMu.Unlock()
 
 	var containers []models.DockerContainer
-	if err := json.NewDecoder(io.LimitReader(resp.Body, 10*1024*1024)).Decode(&containers); err != nil { // 10MB limit
-		log.Printf("Docker container decode error: %v", err)
-		return
+	if engine == EnginePodman {
+		containers, err = listPodmanContainers(client, apiURL)
+		if err != nil {
+			log.Printf("Podman libpod API failed, falling back to Docker-compatible API: %v", err)
+		}
+	}
+	if containers == nil {
+		containers, err = listDockerContainers(client, apiURL)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var apps []models.App
+	seenURLs := make(map[string]int)
 	for _, c := range containers {
 		// Check if container has dashgate labels
 		if c.Labels["dashgate.enable"] != "true" {
@@ -189,6 +152,8 @@ func DiscoverDockerApps(app *server.App) {
 			URL:         url,
 			Icon:        c.Labels["dashgate.icon"],
 			Description: c.Labels["dashgate.description"],
+			Image:       c.Image,
+			Labels:      c.Labels,
 		}
 
 		// Parse groups
@@ -214,10 +179,74 @@ func DiscoverDockerApps(app *server.App) {
 			a.Status = "offline"
 		}
 
+		// Labels inherited from a Podman pod apply to every container in it;
+		// keep one app per URL, preferring a running container.
+		if idx, ok := seenURLs[url]; ok {
+			if apps[idx].Status != "online" && a.Status == "online" {
+				apps[idx] = a
+			}
+			continue
+		}
+		seenURLs[url] = len(apps)
+
 		apps = append(apps, a)
 	}
 
-	app.DockerDiscovery.SetApps(apps)
+	return apps, nil
+}
+
+// containerAPIClient returns an HTTP client and base URL for a Docker or
+// Podman API endpoint given as a Unix socket path or tcp:// / http:// URL.
+func containerAPIClient(socketPath string) (*http.Client, string, error) {
+	// Check if socket path is a TCP/HTTP URL (for Windows Docker Desktop TCP mode or remote Docker)
+	if strings.HasPrefix(socketPath, "tcp://") || strings.HasPrefix(socketPath, "http://") {
+		// Use TCP connection
+		apiURL := strings.TrimPrefix(socketPath, "tcp://")
+		if !strings.HasPrefix(apiURL, "http://") {
+			apiURL = "http://" + apiURL
+		}
+		if err := urlvalidation.ValidateDiscoveryURL(apiURL); err != nil {
+			return nil, "", fmt.Errorf("SSRF protection: %w", err)
+		}
+		return &http.Client{Timeout: 10 * time.Second}, apiURL, nil
+	}
+
+	if strings.HasPrefix(socketPath, "npipe://") {
+		// Windows named pipe - not supported in this build
+		return nil, "", fmt.Errorf("Windows named pipes (npipe://) are not supported. Please use tcp://localhost:2375 instead (enable in Docker Desktop settings)")
+	}
 
-	log.Printf("Docker discovery found %d apps", len(apps))
+	// Use Unix socket (Linux/macOS)
+	socketPath = strings.TrimPrefix(socketPath, "unix://")
+	if _, err := os.Stat(socketPath); os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("container socket not found at %s", socketPath)
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return net.Dial("unix", socketPath)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+	return client, "http://localhost", nil
+}
+
+// listDockerContainers lists all containers through the Docker-compatible API.
+func listDockerContainers(client *http.Client, apiURL string) ([]models.DockerContainer, error) {
+	resp, err := client.Get(apiURL + "/containers/json?all=true")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	var containers []models.DockerContainer
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10*1024*1024)).Decode(&containers); err != nil { // 10MB limit
+		return nil, fmt.Errorf("container decode error: %w", err)
+	}
+	return containers, nil
 }
@@ -0,0 +1,125 @@
+package discovery
+
+import (
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"dashgate/internal/icons"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// iconLookupRetry is how long a failed remote icon lookup is remembered
+// before it is attempted again.
+const iconLookupRetry = 24 * time.Hour
+
+var (
+	iconLookupFailures   = make(map[string]time.Time)
+	iconLookupFailuresMu sync.Mutex
+)
+
+// ResetIconLookupFailures forgets failed remote icon lookups so the next
+// discovery run retries them.
+func ResetIconLookupFailures() {
+	iconLookupFailuresMu.Lock()
+	iconLookupFailures = make(map[string]time.Time)
+	iconLookupFailuresMu.Unlock()
+}
+
+// iconLookupFailedRecently reports whether key failed within iconLookupRetry.
+func iconLookupFailedRecently(key string) bool {
+	iconLookupFailuresMu.Lock()
+	defer iconLookupFailuresMu.Unlock()
+	t, ok := iconLookupFailures[key]
+	return ok && time.Since(t) < iconLookupRetry
+}
+
+// markIconLookupFailed records a failed remote icon lookup.
+func markIconLookupFailed(key string) {
+	iconLookupFailuresMu.Lock()
+	iconLookupFailures[key] = time.Now()
+	iconLookupFailuresMu.Unlock()
+}
+
+// resolveIcons fills in missing icons on discovered apps. Names, hostnames
+// and container images are matched against local icons first, then against
+// the dashboard-icons index (downloading the match), and finally, if enabled,
+// the app's own favicon is fetched into the favicon cache.
+func resolveIcons(app *server.App, apps []models.App) {
+	app.SysConfigMu.RLock()
+	autoMatch := app.SystemConfig.IconAutoMatch
+	fetchFavicons := app.SystemConfig.IconFaviconFallback
+	app.SysConfigMu.RUnlock()
+
+	if (!autoMatch && !fetchFavicons) || app.IconsPath == "" {
+		return
+	}
+
+	var local map[string]string
+	var localNames []string
+	var index []string
+	indexLoaded := false
+	if autoMatch {
+		local = icons.LocalIcons(app.IconsPath)
+		for name := range local {
+			localNames = append(localNames, name)
+		}
+	}
+
+	for i := range apps {
+		a := &apps[i]
+		if a.Icon != "" {
+			continue
+		}
+
+		if autoMatch {
+			candidates := icons.Candidates(a.Name, a.URL, a.Image)
+			if m := icons.Match(candidates, localNames); m != "" {
+				a.Icon = local[m]
+				continue
+			}
+
+			if !indexLoaded {
+				indexLoaded = true
+				var err error
+				if index, err = icons.DashboardIconsIndex(app); err != nil {
+					log.Printf("Icon matching: dashboard-icons index unavailable: %v", err)
+				}
+			}
+			if m := icons.Match(candidates, index); m != "" && !iconLookupFailedRecently("dashboard-icons:"+m) {
+				filename, err := icons.DownloadDashboardIcon(app, m)
+				if err == nil {
+					a.Icon = filename
+					local[m] = filename
+					localNames = append(localNames, m)
+					continue
+				}
+				log.Printf("Icon matching: failed to download dashboard icon %s: %v", m, err)
+				markIconLookupFailed("dashboard-icons:" + m)
+			}
+		}
+
+		if fetchFavicons {
+			u, err := url.Parse(a.URL)
+			if err != nil || u.Hostname() == "" {
+				continue
+			}
+			if cached := icons.CachedFavicon(app.IconsPath, u.Hostname()); cached != "" {
+				a.Icon = cached
+				continue
+			}
+			key := "favicon:" + u.Hostname()
+			if iconLookupFailedRecently(key) {
+				continue
+			}
+			filename, err := icons.FetchFavicon(app, a.URL)
+			if err != nil {
+				markIconLookupFailed(key)
+				continue
+			}
+			a.Icon = filename
+		}
+	}
+}
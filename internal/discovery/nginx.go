@@ -8,7 +8,6 @@ import (
 	"regexp"
 	"runtime/debug"
 	"strings"
-	"time"
 
 	"dashgate/internal/models"
 	"dashgate/internal/server"
@@ -67,6 +66,7 @@ func StartNginxDiscoveryLoop(app *server.App) {
 
 	app.NginxDiscovery.Enabled = true
 	app.NginxDiscovery.Stop = make(chan struct{})
+	stop := app.NginxDiscovery.Stop
 
 	app.NginxDiscovery.Wg.Add(1)
 	go func() {
@@ -76,17 +76,7 @@ func StartNginxDiscoveryLoop(app *server.App) {
 				log.Printf("Nginx discovery goroutine panicked: %v\n%s", r, debug.Stack())
 			}
 		}()
-		ticker := time.NewTicker(60 * time.Second)
-		defer ticker.Stop()
-		DiscoverNginxApps(app) // Initial discovery
-		for {
-			select {
-			case <-app.NginxDiscovery.Stop:
-				return
-			case <-ticker.C:
-				DiscoverNginxApps(app)
-			}
-		}
+		discoveryLoop(app, "nginx", app.NginxDiscovery, stop, DiscoverNginxApps)
 	}()
 }
 
@@ -105,6 +95,7 @@ func StopNginxDiscoveryLoop(app *server.App) {
 	app.DiscoveryMu.Lock()
 	app.NginxDiscovery.Enabled = false
 	app.NginxDiscovery.ClearApps()
+	app.NginxDiscovery.ResetStatus()
 	app.DiscoveryMu.Unlock()
 }
 
@@ -256,14 +247,12 @@ func isNginxConfigFile(name string) bool {
 
 // DiscoverNginxApps parses Nginx configuration files in the configured directory
 // to discover proxied applications and updates the NginxDiscovery manager.
-func DiscoverNginxApps(app *server.App) {
-	app.DiscoveryMu.RLock()
-	enabled := app.NginxDiscovery.Enabled
-	app.DiscoveryMu.RUnlock()
-	if !enabled {
-		return
-	}
+func DiscoverNginxApps(app *server.App) error {
+	return runDiscovery(app, app.NginxDiscovery, "Nginx", fetchNginxApps)
+}
 
+// fetchNginxApps parses server blocks from the Nginx config directory.
+func fetchNginxApps(app *server.App) ([]models.App, error) {
 	app.SysConfigMu.RLock()
 	nginxConfigPath := app.SystemConfig.NginxConfigPath
 	app.SysConfigMu.RUnlock()
@@ -275,12 +264,10 @@ func DiscoverNginxApps(app *server.App) {
 	// Check if config directory exists
 	info, err := os.Stat(nginxConfigPath)
 	if err != nil {
-		log.Printf("Nginx config path error: %v", err)
-		return
+		return nil, fmt.Errorf("config path error: %w", err)
 	}
 	if !info.IsDir() {
-		log.Printf("Nginx config path is not a directory: %s", nginxConfigPath)
-		return
+		return nil, fmt.Errorf("config path is not a directory: %s", nginxConfigPath)
 	}
 
 	var apps []models.App
@@ -400,6 +387,7 @@ func DiscoverNginxApps(app *server.App) {
 					URL:         appURL,
 					Description: fmt.Sprintf("Discovered via Nginx (proxied to %s)", upstream),
 					Status:      "online",
+					Upstream:    upstream,
 				})
 				foundLocationApps = true
 			}
@@ -430,6 +418,7 @@ func DiscoverNginxApps(app *server.App) {
 					URL:         appURL,
 					Description: fmt.Sprintf("Discovered via Nginx (proxied to %s)", upstream),
 					Status:      "online",
+					Upstream:    upstream,
 				})
 			}
 		}
@@ -438,8 +427,7 @@ func DiscoverNginxApps(app *server.App) {
 	// Read all config files in the directory (not just .conf)
 	entries, err := os.ReadDir(nginxConfigPath)
 	if err != nil {
-		log.Printf("Error reading nginx config directory: %v", err)
-		return
+		return nil, fmt.Errorf("reading config directory: %w", err)
 	}
 
 	for _, entry := range entries {
@@ -451,7 +439,5 @@ func DiscoverNginxApps(app *server.App) {
 		}
 	}
 
-	app.NginxDiscovery.SetApps(apps)
-
-	log.Printf("Nginx discovery found %d apps", len(apps))
+	return apps, nil
 }
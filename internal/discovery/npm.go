@@ -68,6 +68,7 @@ func StartNPMDiscoveryLoop(app *server.App) {
 
 	app.NPMDiscovery.Enabled = true
 	app.NPMDiscovery.Stop = make(chan struct{})
+	stop := app.NPMDiscovery.Stop
 
 	app.NPMDiscovery.Wg.Add(1)
 	go func() {
@@ -77,17 +78,7 @@ func StartNPMDiscoveryLoop(app *server.App) {
 				log.Printf("NPM discovery goroutine panicked: %v", r)
 			}
 		}()
-		ticker := time.NewTicker(60 * time.Second)
-		defer ticker.Stop()
-		DiscoverNPMApps(app) // Initial discovery
-		for {
-			select {
-			case <-app.NPMDiscovery.Stop:
-				return
-			case <-ticker.C:
-				DiscoverNPMApps(app)
-			}
-		}
+		discoveryLoop(app, "npm", app.NPMDiscovery, stop, DiscoverNPMApps)
 	}()
 }
 
@@ -106,6 +97,7 @@ func StopNPMDiscoveryLoop(app *server.App) {
 	app.DiscoveryMu.Lock()
 	app.NPMDiscovery.Enabled = false
 	app.NPMDiscovery.ClearApps()
+	app.NPMDiscovery.ResetStatus()
 	// Also clear the token
 	app.NPMTokenMu.Lock()
 	app.NPMToken = ""
@@ -244,50 +236,43 @@ func npmRefreshTokenLocked(app *server.App) error {
 
 // DiscoverNPMApps queries the NPM API for proxy hosts and updates
 // the NPMDiscovery manager with the results.
-func DiscoverNPMApps(app *server.App) {
-	app.DiscoveryMu.RLock()
-	enabled := app.NPMDiscovery.Enabled
-	app.DiscoveryMu.RUnlock()
-	if !enabled {
-		return
-	}
+func DiscoverNPMApps(app *server.App) error {
+	return runDiscovery(app, app.NPMDiscovery, "NPM", fetchNPMApps)
+}
 
+// fetchNPMApps lists proxy hosts from the NPM API.
+func fetchNPMApps(app *server.App) ([]models.App, error) {
 	app.SysConfigMu.RLock()
 	npmURL := app.SystemConfig.NPMUrl
 	app.SysConfigMu.RUnlock()
 
 	if npmURL == "" {
-		return
+		return nil, fmt.Errorf("NPM URL is not configured")
 	}
 
 	if err := urlvalidation.ValidateDiscoveryURL(npmURL); err != nil {
-		log.Printf("NPM discovery SSRF protection: %v", err)
-		return
+		return nil, fmt.Errorf("SSRF protection: %w", err)
 	}
 
 	token, err := NPMGetToken(app)
 	if err != nil {
-		log.Printf("NPM discovery error (token): %v", err)
-		return
+		return nil, fmt.Errorf("token: %w", err)
 	}
 
 	req, err := http.NewRequest("GET", npmURL+"/api/nginx/proxy-hosts", nil)
 	if err != nil {
-		log.Printf("NPM discovery error (request): %v", err)
-		return
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 
 	resp, err := app.HTTPClient.Do(req)
 	if err != nil {
-		log.Printf("NPM discovery error: %v", err)
-		return
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("NPM discovery error: status %d", resp.StatusCode)
-		return
+		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
 	}
 
 	var proxyHosts []struct {
@@ -305,8 +290,7 @@ func DiscoverNPMApps(app *server.App) {
 	}
 
 	if err := json.NewDecoder(io.LimitReader(resp.Body, 10*1024*1024)).Decode(&proxyHosts); err != nil { // 10MB limit
-		log.Printf("NPM discovery decode error: %v", err)
-		return
+		return nil, fmt.Errorf("decode error: %w", err)
 	}
 
 	var apps []models.App
@@ -343,12 +327,11 @@ func DiscoverNPMApps(app *server.App) {
 			URL:         fmt.Sprintf("%s://%s", protocol, domain),
 			Description: fmt.Sprintf("Discovered via NPM (proxied to %s)", upstream),
 			Status:      status,
+			Upstream:    upstream,
 		}
 
 		apps = append(apps, a)
 	}
 
-	app.NPMDiscovery.SetApps(apps)
-
-	log.Printf("NPM discovery found %d apps", len(apps))
+	return apps, nil
 }
@@ -0,0 +1,155 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dashgate/internal/models"
+)
+
+// Container engines reported by DetectContainerEngine.
+const (
+	EngineDocker = "docker"
+	EnginePodman = "podman"
+)
+
+// libpodAPIPrefix is the versioned libpod API path. Podman 4+ serves it
+// alongside the Docker-compatible API on the same socket.
+const libpodAPIPrefix = "/v4.0.0/libpod"
+
+// DefaultContainerSocket returns the Docker socket if present, otherwise the
+// rootless ($XDG_RUNTIME_DIR/podman/podman.sock) or rootful Podman socket.
+func DefaultContainerSocket() string {
+	candidates := []string{"/var/run/docker.sock"}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, filepath.Join(runtimeDir, "podman", "podman.sock"))
+	}
+	candidates = append(candidates, "/run/podman/podman.sock")
+
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c
+		}
+	}
+	return candidates[0]
+}
+
+// DetectContainerEngine asks the API which engine is serving it. Podman
+// reports a "Podman Engine" component in /version; if the endpoint cannot be
+// queried, the socket path is used as a hint.
+func DetectContainerEngine(client *http.Client, apiURL, socketPath string) string {
+	resp, err := client.Get(apiURL + "/version")
+	if err == nil {
+		defer resp.Body.Close()
+		var version struct {
+			Components []struct {
+				Name string `json:"Name"`
+			} `json:"Components"`
+		}
+		if resp.StatusCode == http.StatusOK && json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&version) == nil {
+			for _, c := range version.Components {
+				if strings.Contains(strings.ToLower(c.Name), "podman") {
+					return EnginePodman
+				}
+			}
+			return EngineDocker
+		}
+	}
+
+	if strings.Contains(socketPath, "podman") {
+		return EnginePodman
+	}
+	return EngineDocker
+}
+
+// listPodmanContainers lists containers through the libpod API, which also
+// reports pod membership. Pod labels are merged into the labels of each
+// member container (container labels win), and pod infra containers are skipped.
+func listPodmanContainers(client *http.Client, apiURL string) ([]models.DockerContainer, error) {
+	var podmanContainers []models.PodmanContainer
+	if err := getLibpodJSON(client, apiURL+libpodAPIPrefix+"/containers/json?all=true", &podmanContainers); err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+
+	var pods []models.PodmanPod
+	if err := getLibpodJSON(client, apiURL+libpodAPIPrefix+"/pods/json", &pods); err != nil {
+		return nil, fmt.Errorf("listing pods: %w", err)
+	}
+	podLabels := make(map[string]map[string]string, len(pods))
+	for _, p := range pods {
+		podLabels[p.ID] = p.Labels
+	}
+
+	containers := make([]models.DockerContainer, 0, len(podmanContainers))
+	for _, pc := range podmanContainers {
+		if pc.IsInfra {
+			continue
+		}
+
+		labels := make(map[string]string)
+		inherited := podLabels[pc.Pod]
+		for k, v := range inherited {
+			labels[k] = v
+		}
+		for k, v := range pc.Labels {
+			labels[k] = v
+		}
+
+		// Apps enabled on the pod are named after the pod, not a member container
+		if labels["dashgate.name"] == "" && inherited["dashgate.enable"] == "true" && pc.PodName != "" {
+			labels["dashgate.name"] = pc.PodName
+		}
+
+		containers = append(containers, models.DockerContainer{
+			ID:     pc.ID,
+			Names:  pc.Names,
+			Image:  pc.Image,
+			State:  pc.State,
+			Labels: labels,
+		})
+	}
+	return containers, nil
+}
+
+// getLibpodJSON performs a GET against the libpod API and decodes the JSON body.
+func getLibpodJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10*1024*1024)).Decode(v); err != nil { // 10MB limit
+		return fmt.Errorf("decode error: %w", err)
+	}
+	return nil
+}
+
+// ProbeContainerSocket connects to a Docker or Podman endpoint and reports
+// which engine is serving it.
+func ProbeContainerSocket(socketPath string) (string, error) {
+	if socketPath == "" {
+		socketPath = DefaultContainerSocket()
+	}
+	client, apiURL, err := containerAPIClient(socketPath)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Get(apiURL + "/_ping")
+	if err != nil {
+		return "", fmt.Errorf("cannot reach container API: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("container API returned status %d", resp.StatusCode)
+	}
+	return DetectContainerEngine(client, apiURL, socketPath), nil
+}
@@ -0,0 +1,59 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListPodmanContainers(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Components": []map[string]string{{"Name": "Podman Engine"}},
+		})
+	})
+	mux.HandleFunc(libpodAPIPrefix+"/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"Id": "infra", "Names": []string{"media-infra"}, "State": "running", "Pod": "p1", "PodName": "media", "IsInfra": true},
+			{"Id": "c1", "Names": []string{"media-web"}, "Image": "docker.io/library/nginx:latest", "State": "running", "Pod": "p1", "PodName": "media",
+				"Labels": map[string]string{"dashgate.icon": "nginx"}},
+			{"Id": "c2", "Names": []string{"standalone"}, "State": "exited",
+				"Labels": map[string]string{"dashgate.enable": "true", "dashgate.url": "https://standalone.example.com"}},
+		})
+	})
+	mux.HandleFunc(libpodAPIPrefix+"/pods/json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"Id": "p1", "Name": "media", "Labels": map[string]string{"dashgate.enable": "true", "dashgate.url": "https://media.example.com", "dashgate.icon": "pod"}},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	if engine := DetectContainerEngine(srv.Client(), srv.URL, "/var/run/docker.sock"); engine != EnginePodman {
+		t.Fatalf("DetectContainerEngine() = %q, want %q", engine, EnginePodman)
+	}
+
+	containers, err := listPodmanContainers(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatalf("listPodmanContainers() error: %v", err)
+	}
+	if len(containers) != 2 {
+		t.Fatalf("got %d containers, want 2 (infra container skipped)", len(containers))
+	}
+
+	web := containers[0]
+	if web.Labels["dashgate.url"] != "https://media.example.com" {
+		t.Errorf("pod label not inherited: %v", web.Labels)
+	}
+	if web.Labels["dashgate.icon"] != "nginx" {
+		t.Errorf("container label should override pod label, got icon %q", web.Labels["dashgate.icon"])
+	}
+	if web.Labels["dashgate.name"] != "media" {
+		t.Errorf("pod-enabled app should be named after the pod, got %q", web.Labels["dashgate.name"])
+	}
+	if containers[1].Labels["dashgate.name"] != "" {
+		t.Errorf("standalone container should not get a pod name, got %q", containers[1].Labels["dashgate.name"])
+	}
+}
@@ -0,0 +1,172 @@
+package discovery
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"dashgate/internal/models"
+	"dashgate/internal/pattern"
+)
+
+// templatePlaceholderRe matches name template placeholders such as {name} or {label:com.example.key}.
+var templatePlaceholderRe = regexp.MustCompile(`\{([a-z]+)(?::([^}]+))?\}`)
+
+// hostOf returns the hostname portion of a discovered app URL.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// ValidateRule checks that a rule has at least one match criterion and that
+// all of its patterns compile.
+func ValidateRule(rule models.DiscoveryRule) error {
+	if rule.MatchSource == "" && rule.MatchHost == "" && rule.MatchLabel == "" && rule.MatchUpstream == "" {
+		return fmt.Errorf("at least one match criterion is required")
+	}
+	switch rule.MatchSource {
+	case "", "docker", "traefik", "nginx", "npm", "caddy":
+	default:
+		return fmt.Errorf("unknown source %q", rule.MatchSource)
+	}
+	for field, expr := range map[string]string{"matchHost": rule.MatchHost, "matchUpstream": rule.MatchUpstream} {
+		if expr == "" {
+			continue
+		}
+		if _, err := pattern.Compile(expr); err != nil {
+			return fmt.Errorf("invalid %s pattern: %v", field, err)
+		}
+	}
+	if rule.MatchLabel != "" {
+		key, value, hasValue := strings.Cut(rule.MatchLabel, "=")
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("matchLabel requires a label key")
+		}
+		if hasValue {
+			if _, err := pattern.Compile(value); err != nil {
+				return fmt.Errorf("invalid matchLabel pattern: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// MatchRule reports whether a discovered app satisfies every non-empty
+// criterion of the rule. Disabled rules never match.
+func MatchRule(rule models.DiscoveryRule, d models.DiscoveredAppWithOverride) bool {
+	if !rule.Enabled {
+		return false
+	}
+	if rule.MatchSource != "" && !strings.EqualFold(rule.MatchSource, d.Source) {
+		return false
+	}
+	if rule.MatchHost != "" && !pattern.Match(rule.MatchHost, hostOf(d.URL)) {
+		return false
+	}
+	if rule.MatchUpstream != "" && (d.Upstream == "" || !pattern.Match(rule.MatchUpstream, d.Upstream)) {
+		return false
+	}
+	if rule.MatchLabel != "" {
+		key, value, hasValue := strings.Cut(rule.MatchLabel, "=")
+		labelValue, ok := d.Labels[strings.TrimSpace(key)]
+		if !ok {
+			return false
+		}
+		if hasValue && !pattern.Match(value, labelValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExpandNameTemplate substitutes placeholders in a rule name template.
+// Supported placeholders: {name}, {host}, {subdomain}, {source} and {label:KEY}.
+func ExpandNameTemplate(tmpl string, d models.DiscoveredAppWithOverride) string {
+	host := hostOf(d.URL)
+	return templatePlaceholderRe.ReplaceAllStringFunc(tmpl, func(match string) string {
+		sub := templatePlaceholderRe.FindStringSubmatch(match)
+		switch sub[1] {
+		case "name":
+			return d.Name
+		case "host":
+			return host
+		case "subdomain":
+			return strings.Split(host, ".")[0]
+		case "source":
+			return d.Source
+		case "label":
+			return d.Labels[sub[2]]
+		}
+		return match
+	})
+}
+
+// ApplyRules evaluates rules in order against a discovered app. Each field is
+// taken from the first matching rule that sets it; the app is hidden if any
+// matching rule hides it. Returns nil if no rule matched.
+func ApplyRules(rules []models.DiscoveryRule, d models.DiscoveredAppWithOverride) (*models.DiscoveredAppOverride, []int) {
+	var result *models.DiscoveredAppOverride
+	var matched []int
+
+	for _, rule := range rules {
+		if !MatchRule(rule, d) {
+			continue
+		}
+		matched = append(matched, rule.ID)
+		if result == nil {
+			result = &models.DiscoveredAppOverride{URL: d.URL, Source: d.Source, Groups: []string{}}
+		}
+		if result.Category == "" {
+			result.Category = rule.Category
+		}
+		if result.IconOverride == "" {
+			result.IconOverride = rule.Icon
+		}
+		if result.NameOverride == "" && rule.NameTemplate != "" {
+			result.NameOverride = ExpandNameTemplate(rule.NameTemplate, d)
+		}
+		if len(result.Groups) == 0 && len(rule.Groups) > 0 {
+			result.Groups = append([]string{}, rule.Groups...)
+		}
+		if rule.Hidden {
+			result.Hidden = true
+		}
+	}
+
+	return result, matched
+}
+
+// mergeOverrides layers a manual override on top of rule-derived values.
+// Non-empty manual fields always take precedence. A manual override only
+// decides the hidden state when it hides the app or the admin set it
+// explicitly (HiddenSet); otherwise a hiding rule still applies.
+func mergeOverrides(manual, fromRules *models.DiscoveredAppOverride) *models.DiscoveredAppOverride {
+	if manual == nil {
+		return fromRules
+	}
+	merged := *manual
+	merged.Groups = append([]string{}, manual.Groups...)
+	if fromRules == nil {
+		return &merged
+	}
+	if merged.NameOverride == "" {
+		merged.NameOverride = fromRules.NameOverride
+	}
+	if merged.IconOverride == "" {
+		merged.IconOverride = fromRules.IconOverride
+	}
+	if merged.Category == "" {
+		merged.Category = fromRules.Category
+	}
+	if len(merged.Groups) == 0 {
+		merged.Groups = append([]string{}, fromRules.Groups...)
+	}
+	if !merged.Hidden && !merged.HiddenSet {
+		merged.Hidden = fromRules.Hidden
+	}
+	return &merged
+}
@@ -0,0 +1,145 @@
+package discovery
+
+import (
+	"reflect"
+	"testing"
+
+	"dashgate/internal/models"
+)
+
+func TestMatchRule(t *testing.T) {
+	d := models.DiscoveredAppWithOverride{
+		Name:     "Sonarr",
+		URL:      "https://sonarr.lab.example.com",
+		Source:   "docker",
+		Upstream: "sonarr:8989",
+		Labels:   map[string]string{"com.example.stack": "media"},
+	}
+
+	tests := []struct {
+		name string
+		rule models.DiscoveryRule
+		want bool
+	}{
+		{"host glob", models.DiscoveryRule{Enabled: true, MatchHost: "*.lab.example.com"}, true},
+		{"host glob case insensitive", models.DiscoveryRule{Enabled: true, MatchHost: "SONARR.*"}, true},
+		{"host glob no match", models.DiscoveryRule{Enabled: true, MatchHost: "*.prod.example.com"}, false},
+		{"host regex", models.DiscoveryRule{Enabled: true, MatchHost: `re:(sonarr|radarr)\..*`}, true},
+		{"host regex is anchored", models.DiscoveryRule{Enabled: true, MatchHost: "re:sonarr"}, false},
+		{"source", models.DiscoveryRule{Enabled: true, MatchSource: "docker"}, true},
+		{"source mismatch", models.DiscoveryRule{Enabled: true, MatchSource: "traefik"}, false},
+		{"label key", models.DiscoveryRule{Enabled: true, MatchLabel: "com.example.stack"}, true},
+		{"label value", models.DiscoveryRule{Enabled: true, MatchLabel: "com.example.stack=med*"}, true},
+		{"label value mismatch", models.DiscoveryRule{Enabled: true, MatchLabel: "com.example.stack=infra"}, false},
+		{"missing label", models.DiscoveryRule{Enabled: true, MatchLabel: "other"}, false},
+		{"upstream", models.DiscoveryRule{Enabled: true, MatchUpstream: "sonarr:*"}, true},
+		{"all criteria", models.DiscoveryRule{Enabled: true, MatchSource: "docker", MatchHost: "sonarr.*", MatchUpstream: "*:8989"}, true},
+		{"disabled", models.DiscoveryRule{Enabled: false, MatchHost: "*"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchRule(tt.rule, d); got != tt.want {
+				t.Errorf("MatchRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    models.DiscoveryRule
+		wantErr bool
+	}{
+		{"no criteria", models.DiscoveryRule{Category: "Media"}, true},
+		{"unknown source", models.DiscoveryRule{MatchSource: "kubernetes"}, true},
+		{"bad regex", models.DiscoveryRule{MatchHost: "re:(unclosed"}, true},
+		{"label without key", models.DiscoveryRule{MatchLabel: "=value"}, true},
+		{"valid", models.DiscoveryRule{MatchHost: "*.example.com", MatchLabel: "stack=media"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	d := models.DiscoveredAppWithOverride{
+		Name:   "Grafana",
+		URL:    "https://grafana.lab.example.com",
+		Source: "traefik",
+	}
+	rules := []models.DiscoveryRule{
+		{ID: 1, Enabled: true, MatchHost: "grafana.*", Category: "Monitoring", NameTemplate: "{subdomain} ({source})"},
+		{ID: 2, Enabled: true, MatchHost: "*.lab.example.com", Category: "Lab", Groups: []string{"admins"}, Icon: "lab.svg"},
+		{ID: 3, Enabled: true, MatchHost: "*.prod.example.com", Hidden: true},
+	}
+
+	result, matched := ApplyRules(rules, d)
+	if result == nil {
+		t.Fatal("ApplyRules() returned nil, want override")
+	}
+	if !reflect.DeepEqual(matched, []int{1, 2}) {
+		t.Errorf("matched = %v, want [1 2]", matched)
+	}
+	if result.Category != "Monitoring" {
+		t.Errorf("Category = %q, want first matching rule to win", result.Category)
+	}
+	if !reflect.DeepEqual(result.Groups, []string{"admins"}) || result.IconOverride != "lab.svg" {
+		t.Errorf("later rule should fill unset fields, got groups=%v icon=%q", result.Groups, result.IconOverride)
+	}
+	if result.NameOverride != "grafana (traefik)" {
+		t.Errorf("NameOverride = %q, want %q", result.NameOverride, "grafana (traefik)")
+	}
+	if result.Hidden {
+		t.Error("Hidden = true, want false")
+	}
+
+	if result, _ := ApplyRules(rules[2:], d); result != nil {
+		t.Errorf("ApplyRules() = %+v, want nil for no match", result)
+	}
+}
+
+func TestMergeOverrides(t *testing.T) {
+	fromRules := &models.DiscoveredAppOverride{Category: "Lab", Groups: []string{"admins"}, IconOverride: "lab.svg", Hidden: true}
+	manual := &models.DiscoveredAppOverride{Category: "Media"}
+
+	merged := mergeOverrides(manual, fromRules)
+	if merged.Category != "Media" {
+		t.Errorf("Category = %q, manual override should win", merged.Category)
+	}
+	if merged.IconOverride != "lab.svg" || !reflect.DeepEqual(merged.Groups, []string{"admins"}) {
+		t.Errorf("empty manual fields should fall back to rules, got icon=%q groups=%v", merged.IconOverride, merged.Groups)
+	}
+
+	hiddenTests := []struct {
+		name      string
+		manual    models.DiscoveredAppOverride
+		rulesHide bool
+		want      bool
+	}{
+		{"manual icon + hiding rule stays hidden", models.DiscoveredAppOverride{IconOverride: "sonarr.svg"}, true, true},
+		{"explicit show beats hiding rule", models.DiscoveredAppOverride{HiddenSet: true}, true, false},
+		{"manual hide without rule", models.DiscoveredAppOverride{Hidden: true}, false, true},
+		{"no hiding anywhere", models.DiscoveredAppOverride{IconOverride: "sonarr.svg"}, false, false},
+	}
+	for _, tt := range hiddenTests {
+		t.Run(tt.name, func(t *testing.T) {
+			manual := tt.manual
+			got := mergeOverrides(&manual, &models.DiscoveredAppOverride{Hidden: tt.rulesHide})
+			if got.Hidden != tt.want {
+				t.Errorf("Hidden = %v, want %v", got.Hidden, tt.want)
+			}
+		})
+	}
+
+	if got := mergeOverrides(nil, fromRules); got != fromRules {
+		t.Error("mergeOverrides(nil, rules) should return rule result")
+	}
+}
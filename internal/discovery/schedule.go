@@ -0,0 +1,100 @@
+package discovery
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"dashgate/internal/server"
+)
+
+// Discovery schedule limits, in seconds.
+const (
+	DefaultDiscoveryInterval = 60
+	MinDiscoveryInterval     = 5
+	MaxDiscoveryInterval     = 24 * 60 * 60
+)
+
+// maxDiscoveryBackoff caps the delay after repeated failures, unless the
+// configured interval is already longer.
+const maxDiscoveryBackoff = time.Hour
+
+// ValidateDiscoverySchedule checks an interval/jitter pair in seconds.
+// An interval of 0 selects the default.
+func ValidateDiscoverySchedule(interval, jitter int) error {
+	if interval != 0 && (interval < MinDiscoveryInterval || interval > MaxDiscoveryInterval) {
+		return fmt.Errorf("interval must be between %d and %d seconds", MinDiscoveryInterval, MaxDiscoveryInterval)
+	}
+	effective := interval
+	if effective == 0 {
+		effective = DefaultDiscoveryInterval
+	}
+	if jitter < 0 || jitter > effective {
+		return fmt.Errorf("jitter must be between 0 and the interval (%d seconds)", effective)
+	}
+	return nil
+}
+
+// sourceSchedule returns the configured interval and jitter for a source.
+func sourceSchedule(app *server.App, source string) (time.Duration, time.Duration) {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+
+	var interval, jitter int
+	switch source {
+	case "docker":
+		interval, jitter = app.SystemConfig.DockerDiscoveryInterval, app.SystemConfig.DockerDiscoveryJitter
+	case "traefik":
+		interval, jitter = app.SystemConfig.TraefikDiscoveryInterval, app.SystemConfig.TraefikDiscoveryJitter
+	case "nginx":
+		interval, jitter = app.SystemConfig.NginxDiscoveryInterval, app.SystemConfig.NginxDiscoveryJitter
+	case "npm":
+		interval, jitter = app.SystemConfig.NPMDiscoveryInterval, app.SystemConfig.NPMDiscoveryJitter
+	case "caddy":
+		interval, jitter = app.SystemConfig.CaddyDiscoveryInterval, app.SystemConfig.CaddyDiscoveryJitter
+	}
+	if interval <= 0 {
+		interval = DefaultDiscoveryInterval
+	}
+	if jitter < 0 {
+		jitter = 0
+	}
+	return time.Duration(interval) * time.Second, time.Duration(jitter) * time.Second
+}
+
+// nextDiscoveryDelay computes the wait before the next run: the interval,
+// doubled for each consecutive failure (capped), plus a random jitter.
+func nextDiscoveryDelay(interval, jitter time.Duration, failures int) time.Duration {
+	delay := interval
+	if failures > 0 {
+		limit := max(maxDiscoveryBackoff, interval)
+		for i := 0; i < failures && delay < limit; i++ {
+			delay *= 2
+		}
+		delay = min(delay, limit)
+	}
+	if jitter > 0 {
+		delay += rand.N(jitter)
+	}
+	return delay
+}
+
+// discoveryLoop runs discover immediately and then on the source's schedule
+// until stop is closed. Schedule changes signalled through the manager's
+// RescheduleCh take effect without restarting the loop.
+func discoveryLoop(app *server.App, source string, dm *server.DiscoveryManager, stop <-chan struct{}, discover func(*server.App) error) {
+	discover(app) // Initial discovery
+	for {
+		interval, jitter := sourceSchedule(app, source)
+		timer := time.NewTimer(nextDiscoveryDelay(interval, jitter, dm.ConsecutiveFailures()))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-dm.RescheduleCh:
+			timer.Stop()
+		case <-timer.C:
+			discover(app)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDiscoveryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{"no failures", time.Minute, 0, time.Minute},
+		{"one failure", time.Minute, 1, 2 * time.Minute},
+		{"three failures", time.Minute, 3, 8 * time.Minute},
+		{"capped at backoff limit", time.Minute, 20, maxDiscoveryBackoff},
+		{"long interval not shortened", 2 * time.Hour, 1, 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextDiscoveryDelay(tt.interval, 0, tt.failures); got != tt.want {
+				t.Errorf("nextDiscoveryDelay(%v, 0, %d) = %v, want %v", tt.interval, tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextDiscoveryDelayJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		got := nextDiscoveryDelay(time.Minute, 10*time.Second, 0)
+		if got < time.Minute || got >= time.Minute+10*time.Second {
+			t.Fatalf("delay %v outside [1m, 1m10s)", got)
+		}
+	}
+}
+
+func TestValidateDiscoverySchedule(t *testing.T) {
+	tests := []struct {
+		interval, jitter int
+		wantErr          bool
+	}{
+		{0, 0, false},
+		{0, 60, false},
+		{0, 61, true},
+		{5, 0, false},
+		{4, 0, true},
+		{MaxDiscoveryInterval + 1, 0, true},
+		{300, 30, false},
+		{300, -1, true},
+	}
+	for _, tt := range tests {
+		err := ValidateDiscoverySchedule(tt.interval, tt.jitter)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateDiscoverySchedule(%d, %d) error = %v, wantErr %v", tt.interval, tt.jitter, err, tt.wantErr)
+		}
+	}
+}
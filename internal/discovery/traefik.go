@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"os"
 	"strings"
-	"time"
 
 	"dashgate/internal/models"
 	"dashgate/internal/server"
@@ -65,6 +64,7 @@ func StartTraefikDiscoveryLoop(app *server.App) {
 
 	app.TraefikDiscovery.Enabled = true
 	app.TraefikDiscovery.Stop = make(chan struct{})
+	stop := app.TraefikDiscovery.Stop
 
 	app.TraefikDiscovery.Wg.Add(1)
 	go func() {
@@ -74,17 +74,7 @@ func StartTraefikDiscoveryLoop(app *server.App) {
 				log.Printf("Traefik discovery goroutine panicked: %v", r)
 			}
 		}()
-		ticker := time.NewTicker(60 * time.Second)
-		defer ticker.Stop()
-		DiscoverTraefikApps(app) // Initial discovery
-		for {
-			select {
-			case <-app.TraefikDiscovery.Stop:
-				return
-			case <-ticker.C:
-				DiscoverTraefikApps(app)
-			}
-		}
+		discoveryLoop(app, "traefik", app.TraefikDiscovery, stop, DiscoverTraefikApps)
 	}()
 }
 
@@ -103,19 +93,18 @@ func StopTraefikDiscoveryLoop(app *server.App) {
 	app.DiscoveryMu.Lock()
 	app.TraefikDiscovery.Enabled = false
 	app.TraefikDiscovery.ClearApps()
+	app.TraefikDiscovery.ResetStatus()
 	app.DiscoveryMu.Unlock()
 }
 
 // DiscoverTraefikApps queries the Traefik API for HTTP routers and updates
 // the TraefikDiscovery manager with the results.
-func DiscoverTraefikApps(app *server.App) {
-	app.DiscoveryMu.RLock()
-	enabled := app.TraefikDiscovery.Enabled
-	app.DiscoveryMu.RUnlock()
-	if !enabled {
-		return
-	}
+func DiscoverTraefikApps(app *server.App) error {
+	return runDiscovery(app, app.TraefikDiscovery, "Traefik", fetchTraefikApps)
+}
 
+// fetchTraefikApps lists HTTP routers from the Traefik API.
+func fetchTraefikApps(app *server.App) ([]models.App, error) {
 	app.SysConfigMu.RLock()
 	traefikURL := app.SystemConfig.TraefikURL
 	traefikUsername := app.SystemConfig.TraefikUsername
@@ -123,18 +112,16 @@ func DiscoverTraefikApps(app *server.App) {
 	app.SysConfigMu.RUnlock()
 
 	if traefikURL == "" {
-		return
+		return nil, fmt.Errorf("Traefik API URL is not configured")
 	}
 
 	if err := urlvalidation.ValidateDiscoveryURL(traefikURL); err != nil {
-		log.Printf("Traefik discovery SSRF protection: %v", err)
-		return
+		return nil, fmt.Errorf("SSRF protection: %w", err)
 	}
 
 	req, err := http.NewRequest("GET", traefikURL+"/api/http/routers", nil)
 	if err != nil {
-		log.Printf("Traefik discovery error creating request: %v", err)
-		return
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
 	// Add basic auth if credentials are configured
@@ -144,20 +131,20 @@ func DiscoverTraefikApps(app *server.App) {
 
 	resp, err := app.HTTPClient.Do(req)
 	if err != nil {
-		log.Printf("Traefik discovery error: %v", err)
-		return
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized {
-		log.Printf("Traefik discovery error: authentication required or invalid credentials")
-		return
+		return nil, fmt.Errorf("authentication required or invalid credentials")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
 	}
 
 	var routers []models.TraefikRouter
 	if err := json.NewDecoder(io.LimitReader(resp.Body, 10*1024*1024)).Decode(&routers); err != nil { // 10MB limit
-		log.Printf("Traefik router decode error: %v", err)
-		return
+		return nil, fmt.Errorf("router decode error: %w", err)
 	}
 
 	var apps []models.App
@@ -194,6 +181,7 @@ func DiscoverTraefikApps(app *server.App) {
 			Name:        name,
 			URL:         fmt.Sprintf("%s://%s", protocol, host),
 			Description: fmt.Sprintf("Discovered via Traefik (%s)", r.Provider),
+			Upstream:    r.Service,
 		}
 
 		if r.Status == "enabled" {
@@ -205,9 +193,7 @@ func DiscoverTraefikApps(app *server.App) {
 		apps = append(apps, a)
 	}
 
-	app.TraefikDiscovery.SetApps(apps)
-
-	log.Printf("Traefik discovery found %d apps", len(apps))
+	return apps, nil
 }
 
 // ExtractHost parses a Traefik Host rule and returns the first hostname.
@@ -0,0 +1,110 @@
+// Package encryption encrypts secrets stored in the database with AES-256-GCM.
+// It has no dependencies on other DashGate packages, so that every package
+// storing secrets can use it; the key is app.EncryptionKey.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Prefix is prepended to encrypted values so we can distinguish them from
+// legacy plaintext values stored before encryption was enabled.
+const Prefix = "enc:"
+
+// Encrypt encrypts plaintext using AES-256-GCM and returns a string
+// with the "enc:" prefix followed by base64-encoded (nonce + ciphertext).
+//
+// If the key is nil or empty the plaintext is returned unchanged (graceful
+// degradation when encryption is not configured).
+func Encrypt(key []byte, plaintext string) (string, error) {
+	if len(key) == 0 {
+		return plaintext, nil
+	}
+
+	// Don't encrypt empty strings
+	if plaintext == "" {
+		return plaintext, nil
+	}
+
+	// Already encrypted — return as-is
+	if strings.HasPrefix(plaintext, Prefix) {
+		return plaintext, nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	encoded := base64.StdEncoding.EncodeToString(ciphertext)
+
+	return Prefix + encoded, nil
+}
+
+// Decrypt decrypts a value that was encrypted by Encrypt.
+//
+// If the value does not carry the "enc:" prefix it is assumed to be a legacy
+// plaintext value and returned unchanged (backwards compatibility).
+//
+// If the key is nil or empty the value is returned unchanged.
+func Decrypt(key []byte, ciphertext string) (string, error) {
+	if len(key) == 0 {
+		return ciphertext, nil
+	}
+
+	// Not encrypted — return plaintext as-is (backward compatibility)
+	if !strings.HasPrefix(ciphertext, Prefix) {
+		return ciphertext, nil
+	}
+
+	// Empty after prefix should not happen, but handle gracefully
+	encoded := strings.TrimPrefix(ciphertext, Prefix)
+	if encoded == "" {
+		return "", nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to base64 decode: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, sealed := data[:nonceSize], data[nonceSize:]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return string(plaintext), nil
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// localAccountID returns the users.id of the current user if their password
+// and profile are managed by DashGate (not LDAP or OIDC).
+func localAccountID(app *server.App, r *http.Request) (int, bool) {
+	user := auth.GetUserFromContext(r)
+	if user == nil || user.Source != "local" {
+		return 0, false
+	}
+	var userID int
+	if err := app.DB.QueryRow("SELECT id FROM users WHERE username = ?", user.Username).Scan(&userID); err != nil {
+		return 0, false
+	}
+	return userID, true
+}
+
+// currentSession returns the user ID and token of the session cookie the
+// request was authenticated with.
+func currentSession(app *server.App, r *http.Request) (int, string, bool) {
+	app.SysConfigMu.RLock()
+	cookieName := app.AuthConfig.CookieName
+	app.SysConfigMu.RUnlock()
+
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return 0, "", false
+	}
+	var userID int
+	err = app.DB.QueryRow("SELECT user_id FROM sessions WHERE token = ? AND expires_at > ?", cookie.Value, time.Now()).Scan(&userID)
+	if err != nil {
+		return 0, "", false
+	}
+	return userID, cookie.Value, true
+}
+
+// UserPasswordHandler lets a local user change their own password. The current
+// password is required, and all of the user's other sessions are signed out.
+func UserPasswordHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := localAccountID(app, r)
+		if !ok {
+			http.Error(w, "Password can only be changed for local accounts", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			CurrentPassword string `json:"currentPassword"`
+			NewPassword     string `json:"newPassword"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.NewPassword) < 8 {
+			http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+			return
+		}
+
+		var currentHash string
+		if err := app.DB.QueryRow("SELECT password_hash FROM users WHERE id = ?", userID).Scan(&currentHash); err != nil {
+			log.Printf("Error loading password for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !auth.CheckPassword(req.CurrentPassword, currentHash) {
+			http.Error(w, "Current password is incorrect", http.StatusForbidden)
+			return
+		}
+
+		hashedPassword, err := auth.HashPassword(req.NewPassword)
+		if err != nil {
+			log.Printf("Error hashing password: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if _, err := app.DB.Exec("UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?", hashedPassword, time.Now(), userID); err != nil {
+			log.Printf("Error updating password: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Keep the session that made the change, sign out everywhere else
+		keepToken := ""
+		if sessionUserID, token, ok := currentSession(app, r); ok && sessionUserID == userID {
+			keepToken = token
+		}
+		revoked, _ := database.InvalidateOtherUserSessions(app, userID, keepToken)
+
+		username := auth.GetUserFromContext(r).Username
+		database.LogAudit(app, username, "password_changed", fmt.Sprintf("Changed own password, signed out %d other session(s)", revoked), r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "password_changed", "revokedSessions": revoked})
+	}
+}
+
+// UserProfileHandler returns (GET) or updates (PUT) the display name and email
+// of a local user. LDAP and OIDC profiles are managed by the directory.
+func UserProfileHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := auth.GetUserFromContext(r)
+		userID, editable := localAccountID(app, r)
+
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"username":    user.Username,
+				"displayName": user.DisplayName,
+				"email":       user.Email,
+				"source":      user.Source,
+				"editable":    editable,
+			})
+
+		case http.MethodPut:
+			if !editable {
+				http.Error(w, "Profile can only be edited for local accounts", http.StatusBadRequest)
+				return
+			}
+
+			var req struct {
+				DisplayName string `json:"displayName"`
+				Email       string `json:"email"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			req.DisplayName = strings.TrimSpace(req.DisplayName)
+			req.Email = strings.TrimSpace(req.Email)
+			if len(req.DisplayName) > 100 {
+				http.Error(w, "Display name is too long", http.StatusBadRequest)
+				return
+			}
+
+			// Store an empty email as NULL so several users can leave it blank
+			var email interface{}
+			if req.Email != "" {
+				addr, err := mail.ParseAddress(req.Email)
+				if err != nil || addr.Address != req.Email {
+					http.Error(w, "Invalid email address", http.StatusBadRequest)
+					return
+				}
+				email = req.Email
+			}
+
+			_, err := app.DB.Exec(
+				"UPDATE users SET display_name = ?, email = ?, updated_at = ? WHERE id = ?",
+				req.DisplayName, email, time.Now(), userID,
+			)
+			if err != nil {
+				if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+					http.Error(w, "Email is already in use", http.StatusConflict)
+					return
+				}
+				log.Printf("Error updating profile: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			database.LogAudit(app, user.Username, "profile_updated", fmt.Sprintf("Updated profile (display name %q, email %q)", req.DisplayName, req.Email), r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "saved"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// UserSessionsHandler lists the current user's sessions (GET) or signs out all
+// sessions except the current one (DELETE).
+func UserSessionsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, token, ok := currentSession(app, r)
+		if !ok {
+			http.Error(w, "Sessions are only available when signed in with DashGate", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			sessions, err := database.ListUserSessions(app, userID, token)
+			if err != nil {
+				log.Printf("Error listing sessions for user %d: %v", userID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			for i := range sessions {
+				sessions[i].Device = describeUserAgent(sessions[i].UserAgent)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sessions)
+
+		case http.MethodDelete:
+			revoked, err := database.InvalidateOtherUserSessions(app, userID, token)
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			database.LogAudit(app, auth.GetUserFromContext(r).Username, "sessions_revoked", fmt.Sprintf("Signed out %d other session(s)", revoked), r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"status": "revoked", "revokedSessions": revoked})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// UserSessionHandler revokes one of the current user's sessions
+// (DELETE /api/user/sessions/{id}).
+func UserSessionHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, _, ok := currentSession(app, r)
+		if !ok {
+			http.Error(w, "Sessions are only available when signed in with DashGate", http.StatusBadRequest)
+			return
+		}
+
+		sessionID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/user/sessions/"))
+		if err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+
+		deleted, err := database.DeleteUserSession(app, userID, sessionID)
+		if err != nil {
+			log.Printf("Error revoking session %d: %v", sessionID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		database.LogAudit(app, auth.GetUserFromContext(r).Username, "session_revoked", fmt.Sprintf("Signed out session id=%d", sessionID), r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+	}
+}
+
+// describeUserAgent turns a User-Agent header into a short label such as
+// "Firefox on Linux" for the sessions list.
+func describeUserAgent(ua string) string {
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := ""
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/") || strings.Contains(ua, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(ua, "curl/"):
+		browser = "curl"
+	}
+
+	platform := ""
+	switch {
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad"):
+		platform = "iOS"
+	case strings.Contains(ua, "Android"):
+		platform = "Android"
+	case strings.Contains(ua, "Windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "CrOS"):
+		platform = "ChromeOS"
+	case strings.Contains(ua, "Mac OS X") || strings.Contains(ua, "Macintosh"):
+		platform = "macOS"
+	case strings.Contains(ua, "Linux"):
+		platform = "Linux"
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+	if i := strings.IndexAny(ua, " /"); i > 0 {
+		return ua[:i]
+	}
+	return ua
+}
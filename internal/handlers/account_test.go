@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/models"
+)
+
+func TestUserPasswordChangeRevokesOtherSessions(t *testing.T) {
+	app := newTestApp(t)
+
+	hash, err := auth.HashPassword("Password123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := app.DB.Exec("INSERT INTO users (username, email, display_name, password_hash, groups) VALUES ('alice', 'alice@example.com', 'Alice', ?, '[]')", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := res.LastInsertId()
+
+	// Sign in from two browsers
+	signIn := func(userAgent string) []*http.Cookie {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		req.Header.Set("User-Agent", userAgent)
+		rec := httptest.NewRecorder()
+		if err := createLoginSession(app, rec, req, int(userID)); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Result().Cookies()
+	}
+	laptop := signIn("Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+	phone := signIn("Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/sessions", nil)
+	req.AddCookie(laptop[0])
+	w := httptest.NewRecorder()
+	auth.RequireAuth(app, UserSessionsHandler(app))(w, req)
+	var sessions []models.UserSession
+	json.NewDecoder(w.Body).Decode(&sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("sessions = %+v, want 2", sessions)
+	}
+	for _, s := range sessions {
+		if s.Current != (s.Device == "Firefox on Linux") || s.IPAddress != "192.0.2.1" {
+			t.Errorf("unexpected session %+v", s)
+		}
+	}
+
+	change := auth.RequireAuth(app, UserPasswordHandler(app))
+	if w := postJSON(t, change, "/api/user/password", map[string]string{"currentPassword": "wrong", "newPassword": "NewPassword456!"}, laptop); w.Code != http.StatusForbidden {
+		t.Errorf("wrong current password: got %d, want 403", w.Code)
+	}
+	if w := postJSON(t, change, "/api/user/password", map[string]string{"currentPassword": "Password123!", "newPassword": "short"}, laptop); w.Code != http.StatusBadRequest {
+		t.Errorf("short password: got %d, want 400", w.Code)
+	}
+	if w := postJSON(t, change, "/api/user/password", map[string]string{"currentPassword": "Password123!", "newPassword": "NewPassword456!"}, laptop); w.Code != http.StatusOK {
+		t.Fatalf("change password: %d %s", w.Code, w.Body.String())
+	}
+
+	var stored string
+	app.DB.QueryRow("SELECT password_hash FROM users WHERE id = ?", userID).Scan(&stored)
+	if !auth.CheckPassword("NewPassword456!", stored) {
+		t.Error("new password not stored")
+	}
+
+	for name, cookies := range map[string][]*http.Cookie{"laptop": laptop, "phone": phone} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookies[0])
+		signedIn := auth.GetLocalUser(app, req) != nil
+		if signedIn != (name == "laptop") {
+			t.Errorf("%s session signed in = %v after password change", name, signedIn)
+		}
+	}
+}
+
+func TestDescribeUserAgent(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15", "Safari on macOS"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"curl/8.5.0", "curl"},
+		{"HomeAssistant/2024.6", "HomeAssistant"},
+		{"", "Unknown device"},
+	}
+	for _, tt := range tests {
+		if got := describeUserAgent(tt.ua); got != tt.want {
+			t.Errorf("describeUserAgent(%q) = %q, want %q", tt.ua, got, tt.want)
+		}
+	}
+}
+
+func TestSessionLifetime(t *testing.T) {
+	app := newTestApp(t)
+	app.AuthConfig.SessionDuration = 7
+	app.SystemConfig.SessionMaxDays = 10
+	app.SystemConfig.SessionIdleMinutes = 60
+	app.SystemConfig.SessionRenewMinutes = 5
+
+	res, err := app.DB.Exec("INSERT INTO users (username, email, display_name, password_hash) VALUES ('alice', 'alice@example.com', 'Alice', 'x')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := res.LastInsertId()
+
+	now := time.Now()
+	tests := []struct {
+		name        string
+		createdAgo  time.Duration
+		lastSeenAgo time.Duration
+		valid       bool
+		wantExpiry  time.Time // zero = unchanged
+	}{
+		{"recent activity is not rewritten", time.Hour, 2 * time.Minute, true, time.Time{}},
+		{"activity slides the expiry", time.Hour, 10 * time.Minute, true, now.Add(7 * 24 * time.Hour)},
+		{"expiry is capped at the maximum lifetime", 5 * 24 * time.Hour, 10 * time.Minute, true, now.Add(5 * 24 * time.Hour)},
+		{"idle session is signed out", time.Hour, 61 * time.Minute, false, time.Time{}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := "token-" + strconv.Itoa(i)
+			initialExpiry := now.Add(time.Hour)
+			_, err := app.DB.Exec("INSERT INTO sessions (user_id, token, expires_at, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?)",
+				userID, token, initialExpiry, now.Add(-tt.createdAgo), now.Add(-tt.lastSeenAgo))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: app.AuthConfig.CookieName, Value: token})
+			if got := auth.GetLocalUser(app, req) != nil; got != tt.valid {
+				t.Fatalf("signed in = %v, want %v", got, tt.valid)
+			}
+
+			var expiresAt time.Time
+			err = app.DB.QueryRow("SELECT expires_at FROM sessions WHERE token = ?", token).Scan(&expiresAt)
+			if !tt.valid {
+				if err == nil {
+					t.Error("idle session was not deleted")
+				}
+				return
+			}
+			want := tt.wantExpiry
+			if want.IsZero() {
+				want = initialExpiry
+			}
+			if d := expiresAt.Sub(want); d < -time.Minute || d > time.Minute {
+				t.Errorf("expires_at = %v, want about %v", expiresAt, want)
+			}
+		})
+	}
+}
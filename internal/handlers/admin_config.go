@@ -5,9 +5,12 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"dashgate/internal/auth"
 	"dashgate/internal/database"
+	"dashgate/internal/directorysync"
+	"dashgate/internal/models"
 	"dashgate/internal/server"
 )
 
@@ -29,11 +32,22 @@ func getSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.Requ
 	app.SysConfigMu.RLock()
 	response := map[string]interface{}{
 		// General settings
-		"sessionDays":    app.SystemConfig.SessionDays,
-		"cookieSecure":   app.SystemConfig.CookieSecure,
-		"setupCompleted": app.SystemConfig.SetupCompleted,
-		"adminGroup":     app.SystemConfig.AdminGroup,
-		"trustedProxies": app.SystemConfig.TrustedProxies,
+		"sessionDays":         app.SystemConfig.SessionDays,
+		"sessionIdleMinutes":  app.SystemConfig.SessionIdleMinutes,
+		"sessionRenewMinutes": app.SystemConfig.SessionRenewMinutes,
+		"sessionMaxDays":      app.SystemConfig.SessionMaxDays,
+		"lockoutThreshold":    app.SystemConfig.LockoutThreshold,
+		"lockoutMinutes":      app.SystemConfig.LockoutMinutes,
+		"apiKeyUsageDays":     app.SystemConfig.APIKeyUsageDays,
+		"apiKeyStaleDays":     app.SystemConfig.APIKeyStaleDays,
+		"cookieSecure":        app.SystemConfig.CookieSecure,
+		"setupCompleted":      app.SystemConfig.SetupCompleted,
+		"adminGroup":          app.SystemConfig.AdminGroup,
+		"trustedProxies":      app.SystemConfig.TrustedProxies,
+		"externalURL":         app.SystemConfig.ExternalURL,
+
+		// Two-factor policy
+		"requireAdmin2FA": app.SystemConfig.RequireAdmin2FA,
 
 		// Auth providers enabled
 		"proxyAuthEnabled": app.SystemConfig.ProxyAuthEnabled,
@@ -43,24 +57,27 @@ func getSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.Requ
 		"apiKeyEnabled":    app.SystemConfig.APIKeyEnabled,
 
 		// LDAP settings (excluding password)
-		"ldapServer":      app.SystemConfig.LDAPServer,
-		"ldapBindDN":      app.SystemConfig.LDAPBindDN,
-		"ldapBaseDN":      app.SystemConfig.LDAPBaseDN,
-		"ldapUserFilter":  app.SystemConfig.LDAPUserFilter,
-		"ldapGroupFilter": app.SystemConfig.LDAPGroupFilter,
-		"ldapUserAttr":    app.SystemConfig.LDAPUserAttr,
-		"ldapEmailAttr":   app.SystemConfig.LDAPEmailAttr,
-		"ldapDisplayAttr": app.SystemConfig.LDAPDisplayAttr,
-		"ldapGroupAttr":   app.SystemConfig.LDAPGroupAttr,
-		"ldapStartTLS":    app.SystemConfig.LDAPStartTLS,
-		"ldapSkipVerify":  app.SystemConfig.LDAPSkipVerify,
-
-		// OIDC settings (excluding secret)
-		"oidcIssuer":      app.SystemConfig.OIDCIssuer,
-		"oidcClientID":    app.SystemConfig.OIDCClientID,
-		"oidcRedirectURL": app.SystemConfig.OIDCRedirectURL,
-		"oidcScopes":      app.SystemConfig.OIDCScopes,
-		"oidcGroupsClaim": app.SystemConfig.OIDCGroupsClaim,
+		"ldapServer":       app.SystemConfig.LDAPServer,
+		"ldapBindDN":       app.SystemConfig.LDAPBindDN,
+		"ldapBaseDN":       app.SystemConfig.LDAPBaseDN,
+		"ldapUserFilter":   app.SystemConfig.LDAPUserFilter,
+		"ldapGroupFilter":  app.SystemConfig.LDAPGroupFilter,
+		"ldapUserAttr":     app.SystemConfig.LDAPUserAttr,
+		"ldapEmailAttr":    app.SystemConfig.LDAPEmailAttr,
+		"ldapDisplayAttr":  app.SystemConfig.LDAPDisplayAttr,
+		"ldapGroupAttr":    app.SystemConfig.LDAPGroupAttr,
+		"ldapNestedGroups": app.SystemConfig.LDAPNestedGroups,
+		"ldapStartTLS":     app.SystemConfig.LDAPStartTLS,
+		"ldapSkipVerify":   app.SystemConfig.LDAPSkipVerify,
+		"ldapCACert":       app.SystemConfig.LDAPCACert,
+		"ldapClientCert":   app.SystemConfig.LDAPClientCert,
+		"ldapClientKeySet": app.SystemConfig.LDAPClientKey != "",
+
+		// Directory sync
+		"directorySyncSource":   app.SystemConfig.DirectorySyncSource,
+		"directorySyncInterval": app.SystemConfig.DirectorySyncInterval,
+		"directorySyncRemoved":  app.SystemConfig.DirectorySyncRemoved,
+		"lldapConfigured":       app.LLDAPConfig != nil,
 	}
 
 	// Set defaults
@@ -76,10 +93,27 @@ func getSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.Requ
 func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		// General settings
-		SessionDays    int    `json:"sessionDays"`
-		CookieSecure   bool   `json:"cookieSecure"`
-		AdminGroup     string `json:"adminGroup"`
-		TrustedProxies string `json:"trustedProxies"`
+		SessionDays    int     `json:"sessionDays"`
+		CookieSecure   bool    `json:"cookieSecure"`
+		AdminGroup     string  `json:"adminGroup"`
+		TrustedProxies string  `json:"trustedProxies"`
+		ExternalURL    *string `json:"externalURL"`
+
+		// Session lifetime (optional so older clients don't reset them)
+		SessionIdleMinutes  *int `json:"sessionIdleMinutes"`
+		SessionRenewMinutes *int `json:"sessionRenewMinutes"`
+		SessionMaxDays      *int `json:"sessionMaxDays"`
+
+		// Account lockout (0 threshold disables it)
+		LockoutThreshold *int `json:"lockoutThreshold"`
+		LockoutMinutes   *int `json:"lockoutMinutes"`
+
+		// API key usage retention and stale flag, in days
+		APIKeyUsageDays *int `json:"apiKeyUsageDays"`
+		APIKeyStaleDays *int `json:"apiKeyStaleDays"`
+
+		// Two-factor policy (optional so older clients don't reset it)
+		RequireAdmin2FA *bool `json:"requireAdmin2FA"`
 
 		// Auth providers
 		ProxyAuthEnabled bool `json:"proxyAuthEnabled"`
@@ -99,16 +133,17 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 		LDAPEmailAttr    string `json:"ldapEmailAttr"`
 		LDAPDisplayAttr  string `json:"ldapDisplayAttr"`
 		LDAPGroupAttr    string `json:"ldapGroupAttr"`
+		LDAPNestedGroups string `json:"ldapNestedGroups"`
 		LDAPStartTLS     bool   `json:"ldapStartTLS"`
 		LDAPSkipVerify   bool   `json:"ldapSkipVerify"`
+		LDAPCACert       string `json:"ldapCACert"`
+		LDAPClientCert   string `json:"ldapClientCert"`
+		LDAPClientKey    string `json:"ldapClientKey"`
 
-		// OIDC settings
-		OIDCIssuer       string `json:"oidcIssuer"`
-		OIDCClientID     string `json:"oidcClientID"`
-		OIDCClientSecret string `json:"oidcClientSecret"`
-		OIDCRedirectURL  string `json:"oidcRedirectURL"`
-		OIDCScopes       string `json:"oidcScopes"`
-		OIDCGroupsClaim  string `json:"oidcGroupsClaim"`
+		// Directory sync (optional so older clients don't reset it)
+		DirectorySyncSource   *string `json:"directorySyncSource"`
+		DirectorySyncInterval *int    `json:"directorySyncInterval"`
+		DirectorySyncRemoved  *string `json:"directorySyncRemoved"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -116,6 +151,93 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if req.ExternalURL != nil {
+		*req.ExternalURL = strings.TrimRight(strings.TrimSpace(*req.ExternalURL), "/")
+		if *req.ExternalURL != "" {
+			if _, err := auth.NewWebAuthn(*req.ExternalURL); err != nil {
+				http.Error(w, "External URL must be an absolute http(s) URL", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	app.SysConfigMu.RLock()
+	idleMinutes := app.SystemConfig.SessionIdleMinutes
+	renewMinutes := app.SystemConfig.SessionRenewMinutes
+	app.SysConfigMu.RUnlock()
+	if req.SessionIdleMinutes != nil {
+		idleMinutes = *req.SessionIdleMinutes
+	}
+	if req.SessionRenewMinutes != nil {
+		renewMinutes = *req.SessionRenewMinutes
+	}
+	if idleMinutes < 0 || (req.SessionMaxDays != nil && *req.SessionMaxDays < 0) {
+		http.Error(w, "Session timeouts cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if renewMinutes < 1 || renewMinutes > 1440 {
+		http.Error(w, "Session renewal interval must be between 1 and 1440 minutes", http.StatusBadRequest)
+		return
+	}
+	if idleMinutes > 0 && idleMinutes <= renewMinutes {
+		http.Error(w, "Idle timeout must be longer than the session renewal interval", http.StatusBadRequest)
+		return
+	}
+	if (req.LockoutThreshold != nil && *req.LockoutThreshold < 0) || (req.LockoutMinutes != nil && (*req.LockoutMinutes < 1 || *req.LockoutMinutes > 1440)) {
+		http.Error(w, "Lockout duration must be between 1 and 1440 minutes and the threshold cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if (req.APIKeyUsageDays != nil && (*req.APIKeyUsageDays < 1 || *req.APIKeyUsageDays > 365)) || (req.APIKeyStaleDays != nil && (*req.APIKeyStaleDays < 1 || *req.APIKeyStaleDays > 3650)) {
+		http.Error(w, "API key usage retention must be 1-365 days and the stale threshold 1-3650 days", http.StatusBadRequest)
+		return
+	}
+	if !auth.IsLDAPNestedGroupsMode(req.LDAPNestedGroups) {
+		http.Error(w, "Unknown LDAP nested group mode", http.StatusBadRequest)
+		return
+	}
+
+	if req.DirectorySyncSource != nil {
+		switch source := *req.DirectorySyncSource; {
+		case !directorysync.IsSource(source):
+			http.Error(w, "Unknown directory sync source", http.StatusBadRequest)
+			return
+		case source == directorysync.SourceLDAP && !req.LDAPAuthEnabled:
+			http.Error(w, "Directory sync from LDAP requires LDAP authentication to be enabled", http.StatusBadRequest)
+			return
+		case source == directorysync.SourceLLDAP && app.LLDAPConfig == nil:
+			http.Error(w, "Directory sync from LLDAP requires LLDAP_URL, LLDAP_ADMIN_USERNAME and LLDAP_ADMIN_PASSWORD", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.DirectorySyncInterval != nil && (*req.DirectorySyncInterval < 5 || *req.DirectorySyncInterval > 10080) {
+		http.Error(w, "Directory sync interval must be between 5 and 10080 minutes", http.StatusBadRequest)
+		return
+	}
+	if req.DirectorySyncRemoved != nil && *req.DirectorySyncRemoved != database.DirectorySyncDisable && *req.DirectorySyncRemoved != database.DirectorySyncDelete {
+		http.Error(w, "Removed directory users must be disabled or deleted", http.StatusBadRequest)
+		return
+	}
+
+	// An empty client key keeps the saved one, unless the certificate is removed
+	req.LDAPCACert = strings.TrimSpace(req.LDAPCACert)
+	req.LDAPClientCert = strings.TrimSpace(req.LDAPClientCert)
+	app.SysConfigMu.RLock()
+	clientKey := app.SystemConfig.LDAPClientKey
+	app.SysConfigMu.RUnlock()
+	if req.LDAPClientKey != "" {
+		clientKey = strings.TrimSpace(req.LDAPClientKey)
+	}
+	if req.LDAPClientCert == "" {
+		clientKey = ""
+	}
+	if req.LDAPServer != "" {
+		tlsCheck := &models.LDAPAuthConfig{Server: req.LDAPServer, CACert: req.LDAPCACert, ClientCert: req.LDAPClientCert, ClientKey: clientKey}
+		if _, err := auth.LDAPTLSConfig(tlsCheck); err != nil {
+			http.Error(w, "Invalid LDAP TLS settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Check if enabling local auth without users
 	app.SysConfigMu.RLock()
 	currentlyDisabled := !app.SystemConfig.LocalAuthEnabled
@@ -134,11 +256,34 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 	if req.SessionDays > 0 {
 		app.SystemConfig.SessionDays = req.SessionDays
 	}
+	app.SystemConfig.SessionIdleMinutes = idleMinutes
+	app.SystemConfig.SessionRenewMinutes = renewMinutes
+	if req.SessionMaxDays != nil {
+		app.SystemConfig.SessionMaxDays = *req.SessionMaxDays
+	}
+	if req.LockoutThreshold != nil {
+		app.SystemConfig.LockoutThreshold = *req.LockoutThreshold
+	}
+	if req.LockoutMinutes != nil {
+		app.SystemConfig.LockoutMinutes = *req.LockoutMinutes
+	}
+	if req.APIKeyUsageDays != nil {
+		app.SystemConfig.APIKeyUsageDays = *req.APIKeyUsageDays
+	}
+	if req.APIKeyStaleDays != nil {
+		app.SystemConfig.APIKeyStaleDays = *req.APIKeyStaleDays
+	}
 	app.SystemConfig.CookieSecure = req.CookieSecure
 	if req.AdminGroup != "" {
 		app.SystemConfig.AdminGroup = req.AdminGroup
 	}
 	app.SystemConfig.TrustedProxies = req.TrustedProxies
+	if req.ExternalURL != nil {
+		app.SystemConfig.ExternalURL = *req.ExternalURL
+	}
+	if req.RequireAdmin2FA != nil {
+		app.SystemConfig.RequireAdmin2FA = *req.RequireAdmin2FA
+	}
 
 	// Update provider flags
 	app.SystemConfig.ProxyAuthEnabled = req.ProxyAuthEnabled
@@ -160,18 +305,23 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 	app.SystemConfig.LDAPEmailAttr = req.LDAPEmailAttr
 	app.SystemConfig.LDAPDisplayAttr = req.LDAPDisplayAttr
 	app.SystemConfig.LDAPGroupAttr = req.LDAPGroupAttr
+	app.SystemConfig.LDAPNestedGroups = req.LDAPNestedGroups
 	app.SystemConfig.LDAPStartTLS = req.LDAPStartTLS
 	app.SystemConfig.LDAPSkipVerify = req.LDAPSkipVerify
+	app.SystemConfig.LDAPCACert = req.LDAPCACert
+	app.SystemConfig.LDAPClientCert = req.LDAPClientCert
+	app.SystemConfig.LDAPClientKey = clientKey
 
-	// Update OIDC settings
-	app.SystemConfig.OIDCIssuer = req.OIDCIssuer
-	app.SystemConfig.OIDCClientID = req.OIDCClientID
-	if req.OIDCClientSecret != "" {
-		app.SystemConfig.OIDCClientSecret = req.OIDCClientSecret
+	// Update directory sync settings
+	if req.DirectorySyncSource != nil {
+		app.SystemConfig.DirectorySyncSource = *req.DirectorySyncSource
+	}
+	if req.DirectorySyncInterval != nil {
+		app.SystemConfig.DirectorySyncInterval = *req.DirectorySyncInterval
+	}
+	if req.DirectorySyncRemoved != nil {
+		app.SystemConfig.DirectorySyncRemoved = *req.DirectorySyncRemoved
 	}
-	app.SystemConfig.OIDCRedirectURL = req.OIDCRedirectURL
-	app.SystemConfig.OIDCScopes = req.OIDCScopes
-	app.SystemConfig.OIDCGroupsClaim = req.OIDCGroupsClaim
 
 	app.SystemConfig.SetupCompleted = true
 	app.SysConfigMu.Unlock()
@@ -181,6 +331,7 @@ func updateSystemConfigHandler(app *server.App, w http.ResponseWriter, r *http.R
 		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
+	directorysync.Reschedule(app)
 
 	adminUser := auth.GetUserFromContext(r)
 	adminName := ""
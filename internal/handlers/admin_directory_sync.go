@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/directorysync"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// DirectorySyncStatusHandler returns whether a directory sync is running and
+// the result of the last run (null before the first run).
+func DirectorySyncStatusHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		running, last := directorysync.Status(app)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Running bool                        `json:"running"`
+			Last    *models.DirectorySyncResult `json:"last"`
+		}{running, last})
+	}
+}
+
+// DirectorySyncRunHandler runs the directory sync synchronously and returns
+// its result.
+func DirectorySyncRunHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		app.SysConfigMu.RLock()
+		enabled := app.SystemConfig.DirectorySyncSource != ""
+		app.SysConfigMu.RUnlock()
+		if !enabled {
+			http.Error(w, "Directory sync is not enabled", http.StatusConflict)
+			return
+		}
+
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+		result := directorysync.Run(app, adminName, r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
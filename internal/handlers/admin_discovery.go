@@ -3,9 +3,11 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 
 	"dashgate/internal/database"
 	"dashgate/internal/discovery"
@@ -21,17 +23,25 @@ func DockerDiscoveryHandler(app *server.App) http.HandlerFunc {
 		case http.MethodGet:
 			app.DiscoveryMu.Lock()
 			enabled := app.DockerDiscovery.Enabled
+			engine := app.ContainerEngine
 			app.DiscoveryMu.Unlock()
 
 			app.SysConfigMu.RLock()
 			socketPath := app.SystemConfig.DockerSocketPath
 			app.SysConfigMu.RUnlock()
 
+			interval, jitter := discoverySchedule(app, "docker")
+
 			status := map[string]interface{}{
-				"enabled":     enabled,
-				"socketPath":  socketPath,
-				"appCount":    len(app.DockerDiscovery.GetApps()),
-				"envOverride": app.DockerDiscoveryEnvOverride,
+				"enabled":           enabled,
+				"socketPath":        socketPath,
+				"defaultSocketPath": discovery.DefaultContainerSocket(),
+				"engine":            engine,
+				"appCount":          len(app.DockerDiscovery.GetApps()),
+				"lastError":         app.DockerDiscovery.Status("docker").LastError,
+				"envOverride":       app.DockerDiscoveryEnvOverride,
+				"interval":          interval,
+				"jitter":            jitter,
 			}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(status)
@@ -52,15 +62,24 @@ func DockerDiscoveryHandler(app *server.App) http.HandlerFunc {
 			var req struct {
 				Enabled    bool   `json:"enabled"`
 				SocketPath string `json:"socketPath"`
+				Interval   *int   `json:"interval"`
+				Jitter     *int   `json:"jitter"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, "Invalid JSON", http.StatusBadRequest)
 				return
 			}
 
+			interval, jitter, err := validateDiscoverySchedule(app, "docker", req.Interval, req.Jitter)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
 			// Update system config
 			app.SysConfigMu.Lock()
 			app.SystemConfig.DockerDiscoveryEnabled = req.Enabled
+			applyDiscoverySchedule(&app.SystemConfig, "docker", interval, jitter)
 			if req.SocketPath != "" {
 				app.SystemConfig.DockerSocketPath = req.SocketPath
 			}
@@ -79,16 +98,31 @@ func DockerDiscoveryHandler(app *server.App) http.HandlerFunc {
 			} else {
 				discovery.StopDockerDiscoveryLoop(app)
 			}
+			app.DockerDiscovery.Reschedule()
 
 			app.DiscoveryMu.Lock()
 			enabled := app.DockerDiscovery.Enabled
 			app.DiscoveryMu.Unlock()
 
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
+			response := map[string]interface{}{
 				"status":  "updated",
 				"enabled": enabled,
-			})
+			}
+
+			// Detect whether the socket is served by Docker or Podman
+			if req.Enabled {
+				app.SysConfigMu.RLock()
+				socketPath := app.SystemConfig.DockerSocketPath
+				app.SysConfigMu.RUnlock()
+				if engine, err := discovery.ProbeContainerSocket(socketPath); err != nil {
+					response["warning"] = err.Error()
+				} else {
+					response["engine"] = engine
+				}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
 
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -111,13 +145,18 @@ func TraefikDiscoveryHandler(app *server.App) http.HandlerFunc {
 			hasPassword := app.SystemConfig.TraefikPassword != ""
 			app.SysConfigMu.RUnlock()
 
+			interval, jitter := discoverySchedule(app, "traefik")
+
 			status := map[string]interface{}{
 				"enabled":     enabled,
 				"url":         traefikURL,
 				"username":    traefikUsername,
 				"hasPassword": hasPassword,
 				"appCount":    len(app.TraefikDiscovery.GetApps()),
+				"lastError":   app.TraefikDiscovery.Status("traefik").LastError,
 				"envOverride": app.TraefikDiscoveryEnvOverride,
+				"interval":    interval,
+				"jitter":      jitter,
 			}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(status)
@@ -139,6 +178,8 @@ func TraefikDiscoveryHandler(app *server.App) http.HandlerFunc {
 				URL      string `json:"url"`
 				Username string `json:"username"`
 				Password string `json:"password"`
+				Interval *int   `json:"interval"`
+				Jitter   *int   `json:"jitter"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -152,9 +193,16 @@ func TraefikDiscoveryHandler(app *server.App) http.HandlerFunc {
 				}
 			}
 
+			interval, jitter, err := validateDiscoverySchedule(app, "traefik", req.Interval, req.Jitter)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
 			// Update system config
 			app.SysConfigMu.Lock()
 			app.SystemConfig.TraefikDiscoveryEnabled = req.Enabled
+			applyDiscoverySchedule(&app.SystemConfig, "traefik", interval, jitter)
 			app.SystemConfig.TraefikURL = req.URL
 			app.SystemConfig.TraefikUsername = req.Username
 			if req.Password != "" {
@@ -175,6 +223,7 @@ func TraefikDiscoveryHandler(app *server.App) http.HandlerFunc {
 			} else {
 				discovery.StopTraefikDiscoveryLoop(app)
 			}
+			app.TraefikDiscovery.Reschedule()
 
 			app.DiscoveryMu.Lock()
 			enabled := app.TraefikDiscovery.Enabled
@@ -205,11 +254,16 @@ func NginxDiscoveryHandler(app *server.App) http.HandlerFunc {
 			configPath := app.SystemConfig.NginxConfigPath
 			app.SysConfigMu.RUnlock()
 
+			interval, jitter := discoverySchedule(app, "nginx")
+
 			status := map[string]interface{}{
 				"enabled":     enabled,
 				"configPath":  configPath,
 				"appCount":    len(app.NginxDiscovery.GetApps()),
+				"lastError":   app.NginxDiscovery.Status("nginx").LastError,
 				"envOverride": app.NginxDiscoveryEnvOverride,
+				"interval":    interval,
+				"jitter":      jitter,
 			}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(status)
@@ -228,6 +282,8 @@ func NginxDiscoveryHandler(app *server.App) http.HandlerFunc {
 			var req struct {
 				Enabled    bool   `json:"enabled"`
 				ConfigPath string `json:"configPath"`
+				Interval   *int   `json:"interval"`
+				Jitter     *int   `json:"jitter"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -241,8 +297,15 @@ func NginxDiscoveryHandler(app *server.App) http.HandlerFunc {
 				}
 			}
 
+			interval, jitter, err := validateDiscoverySchedule(app, "nginx", req.Interval, req.Jitter)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
 			app.SysConfigMu.Lock()
 			app.SystemConfig.NginxDiscoveryEnabled = req.Enabled
+			applyDiscoverySchedule(&app.SystemConfig, "nginx", interval, jitter)
 			if req.ConfigPath != "" {
 				app.SystemConfig.NginxConfigPath = req.ConfigPath
 			}
@@ -259,6 +322,7 @@ func NginxDiscoveryHandler(app *server.App) http.HandlerFunc {
 			} else {
 				discovery.StopNginxDiscoveryLoop(app)
 			}
+			app.NginxDiscovery.Reschedule()
 
 			app.DiscoveryMu.Lock()
 			enabled := app.NginxDiscovery.Enabled
@@ -290,12 +354,17 @@ func NPMDiscoveryHandler(app *server.App) http.HandlerFunc {
 			npmEmail := app.SystemConfig.NPMEmail
 			app.SysConfigMu.RUnlock()
 
+			interval, jitter := discoverySchedule(app, "npm")
+
 			status := map[string]interface{}{
 				"enabled":     enabled,
 				"url":         npmURL,
 				"email":       npmEmail,
 				"appCount":    len(app.NPMDiscovery.GetApps()),
+				"lastError":   app.NPMDiscovery.Status("npm").LastError,
 				"envOverride": app.NPMDiscoveryEnvOverride,
+				"interval":    interval,
+				"jitter":      jitter,
 			}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(status)
@@ -316,6 +385,8 @@ func NPMDiscoveryHandler(app *server.App) http.HandlerFunc {
 				URL      string `json:"url"`
 				Email    string `json:"email"`
 				Password string `json:"password"`
+				Interval *int   `json:"interval"`
+				Jitter   *int   `json:"jitter"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -329,8 +400,15 @@ func NPMDiscoveryHandler(app *server.App) http.HandlerFunc {
 				}
 			}
 
+			interval, jitter, err := validateDiscoverySchedule(app, "npm", req.Interval, req.Jitter)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
 			app.SysConfigMu.Lock()
 			app.SystemConfig.NPMDiscoveryEnabled = req.Enabled
+			applyDiscoverySchedule(&app.SystemConfig, "npm", interval, jitter)
 			app.SystemConfig.NPMUrl = req.URL
 			app.SystemConfig.NPMEmail = req.Email
 			if req.Password != "" {
@@ -350,6 +428,7 @@ func NPMDiscoveryHandler(app *server.App) http.HandlerFunc {
 			} else {
 				discovery.StopNPMDiscoveryLoop(app)
 			}
+			app.NPMDiscovery.Reschedule()
 
 			app.DiscoveryMu.Lock()
 			enabled := app.NPMDiscovery.Enabled
@@ -382,13 +461,18 @@ func CaddyDiscoveryHandler(app *server.App) http.HandlerFunc {
 			hasPassword := app.SystemConfig.CaddyPassword != ""
 			app.SysConfigMu.RUnlock()
 
+			interval, jitter := discoverySchedule(app, "caddy")
+
 			status := map[string]interface{}{
 				"enabled":     enabled,
 				"url":         caddyURL,
 				"username":    caddyUsername,
 				"hasPassword": hasPassword,
 				"appCount":    len(app.CaddyDiscovery.GetApps()),
+				"lastError":   app.CaddyDiscovery.Status("caddy").LastError,
 				"envOverride": app.CaddyDiscoveryEnvOverride,
+				"interval":    interval,
+				"jitter":      jitter,
 			}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(status)
@@ -409,6 +493,8 @@ func CaddyDiscoveryHandler(app *server.App) http.HandlerFunc {
 				URL      string `json:"url"`
 				Username string `json:"username"`
 				Password string `json:"password"`
+				Interval *int   `json:"interval"`
+				Jitter   *int   `json:"jitter"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -422,8 +508,15 @@ func CaddyDiscoveryHandler(app *server.App) http.HandlerFunc {
 				}
 			}
 
+			interval, jitter, err := validateDiscoverySchedule(app, "caddy", req.Interval, req.Jitter)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
 			app.SysConfigMu.Lock()
 			app.SystemConfig.CaddyDiscoveryEnabled = req.Enabled
+			applyDiscoverySchedule(&app.SystemConfig, "caddy", interval, jitter)
 			app.SystemConfig.CaddyAdminURL = req.URL
 			app.SystemConfig.CaddyUsername = req.Username
 			if req.Password != "" {
@@ -442,6 +535,7 @@ func CaddyDiscoveryHandler(app *server.App) http.HandlerFunc {
 			} else {
 				discovery.StopCaddyDiscoveryLoop(app)
 			}
+			app.CaddyDiscovery.Reschedule()
 
 			app.DiscoveryMu.Lock()
 			enabled := app.CaddyDiscovery.Enabled
@@ -724,3 +818,161 @@ func CaddyTestHandler(app *server.App) http.HandlerFunc {
 		})
 	}
 }
+
+// DiscoveryStatusHandler reports the run status of every discovery source.
+func DiscoveryStatusHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(discovery.GetDiscoveryStatus(app))
+	}
+}
+
+// DiscoveryRunHandler runs discovery synchronously and returns the resulting
+// status. The optional "source" query parameter limits the run to one source;
+// otherwise all enabled sources are run.
+func DiscoveryRunHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sources := discovery.SourceNames
+		if source := r.URL.Query().Get("source"); source != "" {
+			if !slices.Contains(discovery.SourceNames, source) {
+				http.Error(w, "Unknown discovery source", http.StatusBadRequest)
+				return
+			}
+			sources = []string{source}
+		}
+
+		type runResult struct {
+			models.DiscoveryStatus
+			OK bool `json:"ok"`
+		}
+
+		results := []runResult{}
+		for _, source := range sources {
+			status, err := discovery.RunDiscoveryNow(app, source)
+			if errors.Is(err, discovery.ErrDiscoveryDisabled) {
+				if len(sources) > 1 {
+					continue
+				}
+				http.Error(w, fmt.Sprintf("%s discovery is not enabled", source), http.StatusConflict)
+				return
+			}
+			results = append(results, runResult{DiscoveryStatus: status, OK: err == nil})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	}
+}
+
+// DiscoveryIconSettingsHandler manages automatic icon matching for discovered apps.
+func DiscoveryIconSettingsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.SysConfigMu.RLock()
+			settings := map[string]bool{
+				"autoMatch":       app.SystemConfig.IconAutoMatch,
+				"faviconFallback": app.SystemConfig.IconFaviconFallback,
+			}
+			app.SysConfigMu.RUnlock()
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(settings)
+
+		case http.MethodPut:
+			var req struct {
+				AutoMatch       bool `json:"autoMatch"`
+				FaviconFallback bool `json:"faviconFallback"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			app.SysConfigMu.Lock()
+			app.SystemConfig.IconAutoMatch = req.AutoMatch
+			app.SystemConfig.IconFaviconFallback = req.FaviconFallback
+			app.SysConfigMu.Unlock()
+
+			if err := database.SaveSystemConfig(app); err != nil {
+				log.Printf("Failed to save icon matching config: %v", err)
+				http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
+				return
+			}
+
+			// Give previously failed lookups another chance on the next run
+			discovery.ResetIconLookupFailures()
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":          "updated",
+				"autoMatch":       req.AutoMatch,
+				"faviconFallback": req.FaviconFallback,
+			})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// discoverySchedule returns the configured interval and jitter (seconds) for a source.
+func discoverySchedule(app *server.App, source string) (int, int) {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	interval, jitter := discoveryScheduleFields(&app.SystemConfig, source)
+	return *interval, *jitter
+}
+
+// validateDiscoverySchedule resolves an optional interval/jitter update for a
+// source against the current settings and validates the result. Nil values
+// keep the current setting. Nothing is changed; see applyDiscoverySchedule.
+func validateDiscoverySchedule(app *server.App, source string, interval, jitter *int) (int, int, error) {
+	newInterval, newJitter := discoverySchedule(app, source)
+	if interval != nil {
+		newInterval = *interval
+	}
+	if jitter != nil {
+		newJitter = *jitter
+	}
+	if interval == nil && jitter == nil {
+		return newInterval, newJitter, nil
+	}
+	if err := discovery.ValidateDiscoverySchedule(newInterval, newJitter); err != nil {
+		return 0, 0, err
+	}
+	return newInterval, newJitter, nil
+}
+
+// applyDiscoverySchedule stores a validated interval and jitter for a source.
+// The caller must hold SysConfigMu.
+func applyDiscoverySchedule(cfg *models.SystemConfig, source string, interval, jitter int) {
+	intervalField, jitterField := discoveryScheduleFields(cfg, source)
+	*intervalField, *jitterField = interval, jitter
+}
+
+// discoveryScheduleFields returns pointers to a source's interval and jitter settings.
+func discoveryScheduleFields(cfg *models.SystemConfig, source string) (*int, *int) {
+	switch source {
+	case "traefik":
+		return &cfg.TraefikDiscoveryInterval, &cfg.TraefikDiscoveryJitter
+	case "nginx":
+		return &cfg.NginxDiscoveryInterval, &cfg.NginxDiscoveryJitter
+	case "npm":
+		return &cfg.NPMDiscoveryInterval, &cfg.NPMDiscoveryJitter
+	case "caddy":
+		return &cfg.CaddyDiscoveryInterval, &cfg.CaddyDiscoveryJitter
+	default:
+		return &cfg.DockerDiscoveryInterval, &cfg.DockerDiscoveryJitter
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiscoveryScheduleRejectedUpdate(t *testing.T) {
+	app := newTestApp(t)
+	app.SystemConfig.TraefikDiscoveryInterval = 300
+	app.SystemConfig.NginxDiscoveryInterval = 300
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    map[string]interface{}
+		field   *int
+	}{
+		{"traefik with an invalid URL", TraefikDiscoveryHandler(app),
+			map[string]interface{}{"enabled": true, "url": "ftp://traefik.local", "interval": 60},
+			&app.SystemConfig.TraefikDiscoveryInterval},
+		{"nginx with a blocked config path", NginxDiscoveryHandler(app),
+			map[string]interface{}{"enabled": true, "configPath": "/proc/self/environ", "interval": 60},
+			&app.SystemConfig.NginxDiscoveryInterval},
+		{"traefik with an invalid interval", TraefikDiscoveryHandler(app),
+			map[string]interface{}{"enabled": true, "url": "http://traefik.local:8080", "interval": 1},
+			&app.SystemConfig.TraefikDiscoveryInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			json.NewEncoder(&buf).Encode(tt.body)
+			w := httptest.NewRecorder()
+			tt.handler(w, httptest.NewRequest(http.MethodPut, "/api/admin/discovery", &buf))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", w.Code, w.Body.String())
+			}
+			if *tt.field != 300 {
+				t.Errorf("interval changed to %d by a rejected update", *tt.field)
+			}
+		})
+	}
+	if app.SystemConfig.TraefikDiscoveryEnabled || app.SystemConfig.NginxDiscoveryEnabled {
+		t.Error("a rejected update enabled discovery")
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// LDAPTestHandler checks LDAP settings before they are saved. It connects
+// with the settings in the request body, binds as the service account and,
+// if a username is given, looks the user up and reports their attributes and
+// groups, before and after group mapping. An empty bind password or client
+// key uses the saved one, but the saved password is only sent to the saved
+// server and bind DN.
+func LDAPTestHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			LDAPServer       string `json:"ldapServer"`
+			LDAPBindDN       string `json:"ldapBindDN"`
+			LDAPBindPassword string `json:"ldapBindPassword"`
+			LDAPBaseDN       string `json:"ldapBaseDN"`
+			LDAPUserFilter   string `json:"ldapUserFilter"`
+			LDAPGroupFilter  string `json:"ldapGroupFilter"`
+			LDAPUserAttr     string `json:"ldapUserAttr"`
+			LDAPEmailAttr    string `json:"ldapEmailAttr"`
+			LDAPDisplayAttr  string `json:"ldapDisplayAttr"`
+			LDAPGroupAttr    string `json:"ldapGroupAttr"`
+			LDAPNestedGroups string `json:"ldapNestedGroups"`
+			LDAPStartTLS     bool   `json:"ldapStartTLS"`
+			LDAPSkipVerify   bool   `json:"ldapSkipVerify"`
+			LDAPCACert       string `json:"ldapCACert"`
+			LDAPClientCert   string `json:"ldapClientCert"`
+			LDAPClientKey    string `json:"ldapClientKey"`
+			Username         string `json:"username"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.LDAPServer == "" || req.LDAPBaseDN == "" {
+			http.Error(w, "Server URL and base DN are required", http.StatusBadRequest)
+			return
+		}
+		if !auth.IsLDAPNestedGroupsMode(req.LDAPNestedGroups) {
+			http.Error(w, "Unknown LDAP nested group mode", http.StatusBadRequest)
+			return
+		}
+
+		app.SysConfigMu.RLock()
+		sc := app.SystemConfig
+		app.SysConfigMu.RUnlock()
+
+		if req.LDAPBindPassword == "" && (req.LDAPServer != sc.LDAPServer || req.LDAPBindDN != sc.LDAPBindDN) {
+			sc.LDAPBindPassword = ""
+		} else if req.LDAPBindPassword != "" {
+			sc.LDAPBindPassword = req.LDAPBindPassword
+		}
+		if req.LDAPClientKey != "" {
+			sc.LDAPClientKey = req.LDAPClientKey
+		}
+		sc.LDAPServer = req.LDAPServer
+		sc.LDAPBindDN = req.LDAPBindDN
+		sc.LDAPBaseDN = req.LDAPBaseDN
+		sc.LDAPUserFilter = req.LDAPUserFilter
+		sc.LDAPGroupFilter = req.LDAPGroupFilter
+		sc.LDAPUserAttr = req.LDAPUserAttr
+		sc.LDAPEmailAttr = req.LDAPEmailAttr
+		sc.LDAPDisplayAttr = req.LDAPDisplayAttr
+		sc.LDAPGroupAttr = req.LDAPGroupAttr
+		sc.LDAPNestedGroups = req.LDAPNestedGroups
+		sc.LDAPStartTLS = req.LDAPStartTLS
+		sc.LDAPSkipVerify = req.LDAPSkipVerify
+		sc.LDAPCACert = strings.TrimSpace(req.LDAPCACert)
+		sc.LDAPClientCert = strings.TrimSpace(req.LDAPClientCert)
+
+		cfg := database.LDAPAuthConfigFrom(sc)
+		if _, err := auth.LDAPTLSConfig(cfg); err != nil {
+			http.Error(w, "Invalid LDAP TLS settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := auth.CheckLDAPSettings(cfg, strings.TrimSpace(req.Username))
+		response := map[string]interface{}{
+			"ok":    result.OK,
+			"steps": result.Steps,
+		}
+		if result.User != nil {
+			mapped := auth.MapSourceGroups(app, "ldap", result.User.Groups)
+			response["user"] = result.User
+			response["mappedGroups"] = mapped
+			response["isAdmin"] = auth.CheckIsAdmin(app, mapped)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
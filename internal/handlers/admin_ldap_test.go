@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"dashgate/internal/ldaptest"
+)
+
+func TestLDAPTestHandler(t *testing.T) {
+	dir := ldaptest.NewServer()
+	defer dir.Close()
+	dir.AddEntry("dc=example,dc=com", nil)
+	dir.SetPassword("cn=service,dc=example,dc=com", "service-secret")
+	dir.AddEntry("uid=alice,dc=example,dc=com", map[string][]string{
+		"uid": {"alice"}, "mail": {"alice@example.com"}, "memberOf": {"cn=admins,dc=example,dc=com"},
+	})
+
+	app := newTestApp(t)
+	app.SystemConfig.LDAPServer = dir.URL
+	app.SystemConfig.LDAPBindDN = "cn=service,dc=example,dc=com"
+	app.SystemConfig.LDAPBindPassword = "service-secret"
+	app.SystemConfig.AdminGroup = "admins"
+
+	settings := func(changes map[string]interface{}) map[string]interface{} {
+		body := map[string]interface{}{
+			"ldapServer": dir.URL, "ldapBindDN": "cn=service,dc=example,dc=com", "ldapBaseDN": "dc=example,dc=com",
+			"ldapUserFilter": "(uid=%s)", "ldapUserAttr": "uid", "ldapEmailAttr": "mail", "ldapGroupAttr": "memberOf",
+		}
+		for k, v := range changes {
+			body[k] = v
+		}
+		return body
+	}
+
+	tests := []struct {
+		name       string
+		body       map[string]interface{}
+		wantStatus int
+		wantOK     bool
+		wantAdmin  bool
+	}{
+		{"saved password", settings(nil), http.StatusOK, true, false},
+		{"sample user", settings(map[string]interface{}{"username": "alice"}), http.StatusOK, true, true},
+		{"wrong password", settings(map[string]interface{}{"ldapBindPassword": "wrong"}), http.StatusOK, false, false},
+		// The saved password is not sent when the bind DN changes
+		{"other bind DN", settings(map[string]interface{}{"ldapBindDN": "uid=alice,dc=example,dc=com"}), http.StatusOK, false, false},
+		{"invalid CA bundle", settings(map[string]interface{}{"ldapCACert": "not a certificate"}), http.StatusBadRequest, false, false},
+		{"missing base DN", settings(map[string]interface{}{"ldapBaseDN": ""}), http.StatusBadRequest, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(t, LDAPTestHandler(app), "/api/admin/ldap/test", tt.body, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp struct {
+				OK      bool `json:"ok"`
+				IsAdmin bool `json:"isAdmin"`
+				User    *struct {
+					Email  string   `json:"email"`
+					Groups []string `json:"groups"`
+				} `json:"user"`
+			}
+			json.NewDecoder(w.Body).Decode(&resp)
+			if resp.OK != tt.wantOK || resp.IsAdmin != tt.wantAdmin {
+				t.Errorf("ok=%v isAdmin=%v, want %v %v: %s", resp.OK, resp.IsAdmin, tt.wantOK, tt.wantAdmin, w.Body.String())
+			}
+			if tt.wantAdmin && (resp.User == nil || resp.User.Email != "alice@example.com") {
+				t.Errorf("sample user: %+v", resp.User)
+			}
+		})
+	}
+}
@@ -2,8 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
 
 	"dashgate/internal/auth"
 	"dashgate/internal/database"
@@ -23,6 +29,7 @@ func AdminCheckHandler(app *server.App) http.HandlerFunc {
 		response := map[string]interface{}{
 			"isAdmin":          user.IsAdmin,
 			"lldapEnabled":     app.LLDAPConfig != nil,
+			"lldapPasswords":   lldap.CanSetPasswords(app),
 			"authMode":         string(app.AuthConfig.Mode),
 			"localAuthEnabled": app.DB != nil,
 			"needsSetup":       needsSetup,
@@ -36,7 +43,8 @@ func AdminCheckHandler(app *server.App) http.HandlerFunc {
 	}
 }
 
-// AdminLLDAPUsersHandler returns a read-only list of users from the LLDAP directory.
+// AdminLLDAPUsersHandler handles GET (list) and POST (create) for users in
+// the LLDAP directory.
 func AdminLLDAPUsersHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if app.LLDAPConfig == nil {
@@ -44,23 +52,98 @@ func AdminLLDAPUsersHandler(app *server.App) http.HandlerFunc {
 			return
 		}
 
-		if r.Method != http.MethodGet {
+		switch r.Method {
+		case http.MethodGet:
+			users, err := lldap.ListUsers(app)
+			if err != nil {
+				log.Printf("LLDAP operation failed: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(users)
+		case http.MethodPost:
+			createLLDAPUser(app, w, r)
+		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// AdminLLDAPUserHandler routes operations on a single LLDAP user:
+// DELETE /api/admin/users/{id}, POST /api/admin/users/{id}/password,
+// POST /api/admin/users/{id}/groups and
+// DELETE /api/admin/users/{id}/groups/{groupId}.
+func AdminLLDAPUserHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.LLDAPConfig == nil {
+			http.Error(w, "LLDAP not configured", http.StatusServiceUnavailable)
 			return
 		}
 
-		users, err := lldap.ListUsers(app)
-		if err != nil {
-			log.Printf("LLDAP operation failed: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/admin/users/"), "/")
+		userID := parts[0]
+		if userID == "" {
+			http.Error(w, "User ID required", http.StatusBadRequest)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(users)
+
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+
+		switch {
+		case len(parts) == 1 && r.Method == http.MethodDelete:
+			if strings.EqualFold(userID, app.LLDAPConfig.Username) {
+				http.Error(w, "Cannot delete the LLDAP admin account DashGate signs in with", http.StatusBadRequest)
+				return
+			}
+			if err := lldap.DeleteUser(app, userID); err != nil {
+				lldapError(w, err)
+				return
+			}
+			database.LogAudit(app, adminName, "lldap_user_deleted", fmt.Sprintf("Deleted LLDAP user %q", userID), r.RemoteAddr)
+			lldapStatus(w, "deleted")
+		case len(parts) == 2 && parts[1] == "password" && r.Method == http.MethodPost:
+			setLLDAPPassword(app, w, r, userID, adminName)
+		case len(parts) == 2 && parts[1] == "groups" && r.Method == http.MethodPost:
+			var req struct {
+				GroupID int `json:"groupId"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GroupID <= 0 {
+				http.Error(w, "Group ID required", http.StatusBadRequest)
+				return
+			}
+			if err := lldap.AddUserToGroup(app, userID, req.GroupID); err != nil {
+				lldapError(w, err)
+				return
+			}
+			database.LogAudit(app, adminName, "lldap_group_member_added", fmt.Sprintf("Added LLDAP user %q to group id=%d", userID, req.GroupID), r.RemoteAddr)
+			lldapStatus(w, "added")
+		case len(parts) == 3 && parts[1] == "groups" && r.Method == http.MethodDelete:
+			groupID, err := strconv.Atoi(parts[2])
+			if err != nil || groupID <= 0 {
+				http.Error(w, "Invalid group ID", http.StatusBadRequest)
+				return
+			}
+			if err := lldap.RemoveUserFromGroup(app, userID, groupID); err != nil {
+				lldapError(w, err)
+				return
+			}
+			database.LogAudit(app, adminName, "lldap_group_member_removed", fmt.Sprintf("Removed LLDAP user %q from group id=%d", userID, groupID), r.RemoteAddr)
+			lldapStatus(w, "removed")
+		case len(parts) > 3 || (len(parts) > 1 && parts[1] != "password" && parts[1] != "groups"):
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
 	}
 }
 
-// AdminLLDAPGroupsHandler returns a read-only list of groups from the LLDAP directory.
+// AdminLLDAPGroupsHandler handles GET (list) and POST (create) for groups in
+// the LLDAP directory.
 func AdminLLDAPGroupsHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if app.LLDAPConfig == nil {
@@ -68,19 +151,203 @@ func AdminLLDAPGroupsHandler(app *server.App) http.HandlerFunc {
 			return
 		}
 
-		if r.Method != http.MethodGet {
+		switch r.Method {
+		case http.MethodGet:
+			groups, err := lldap.ListGroups(app)
+			if err != nil {
+				log.Printf("LLDAP operation failed: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(groups)
+		case http.MethodPost:
+			var req struct {
+				Name string `json:"name"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			req.Name = strings.TrimSpace(req.Name)
+			if req.Name == "" {
+				http.Error(w, "Group name required", http.StatusBadRequest)
+				return
+			}
+			group, err := lldap.CreateGroup(app, req.Name)
+			if err != nil {
+				lldapError(w, err)
+				return
+			}
+
+			adminUser := auth.GetUserFromContext(r)
+			adminName := ""
+			if adminUser != nil {
+				adminName = adminUser.Username
+			}
+			database.LogAudit(app, adminName, "lldap_group_created", fmt.Sprintf("Created LLDAP group %q (id=%d)", group.DisplayName, group.ID), r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(group)
+		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// AdminLLDAPGroupHandler deletes an LLDAP group: DELETE /api/admin/groups/{id}.
+func AdminLLDAPGroupHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.LLDAPConfig == nil {
+			http.Error(w, "LLDAP not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		groupID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/admin/groups/"))
+		if err != nil || groupID <= 0 {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+		if err := lldap.DeleteGroup(app, groupID); err != nil {
+			lldapError(w, err)
+			return
+		}
+
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+		database.LogAudit(app, adminName, "lldap_group_deleted", fmt.Sprintf("Deleted LLDAP group id=%d", groupID), r.RemoteAddr)
+		lldapStatus(w, "deleted")
+	}
+}
+
+// createLLDAPUser creates an LLDAP user, then sets its password and adds it
+// to groups if given. A user whose password or groups could not be set is
+// kept, and the error says so.
+func createLLDAPUser(app *server.App, w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID          string `json:"id"`
+		Email       string `json:"email"`
+		DisplayName string `json:"displayName"`
+		Password    string `json:"password"`
+		Groups      []int  `json:"groups"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.ID = strings.TrimSpace(req.ID)
+	req.Email = strings.TrimSpace(req.Email)
+	if req.ID == "" || req.Email == "" {
+		http.Error(w, "User ID and email required", http.StatusBadRequest)
+		return
+	}
+	if strings.ContainsAny(req.ID, "/,=+<>#;\\\" ") {
+		http.Error(w, "User ID contains invalid characters", http.StatusBadRequest)
+		return
+	}
+	if req.Password != "" {
+		if len(req.Password) < 8 {
+			http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+			return
+		}
+		if !lldap.CanSetPasswords(app) {
+			http.Error(w, "Setting LLDAP passwords requires LLDAP_LDAP_URL and LLDAP_BASE_DN", http.StatusNotImplemented)
 			return
 		}
+	}
+
+	if err := lldap.CreateUser(app, req.ID, req.Email, req.DisplayName); err != nil {
+		lldapError(w, err)
+		return
+	}
+
+	adminUser := auth.GetUserFromContext(r)
+	adminName := ""
+	if adminUser != nil {
+		adminName = adminUser.Username
+	}
+	database.LogAudit(app, adminName, "lldap_user_created", fmt.Sprintf("Created LLDAP user %q", req.ID), r.RemoteAddr)
 
-		groups, err := lldap.ListGroups(app)
-		if err != nil {
+	if req.Password != "" {
+		if err := lldap.SetPassword(app, req.ID, req.Password); err != nil {
 			log.Printf("LLDAP operation failed: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			http.Error(w, "User created, but setting the password failed", http.StatusBadGateway)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(groups)
+		database.LogAudit(app, adminName, "lldap_password_set", fmt.Sprintf("Set password for LLDAP user %q", req.ID), r.RemoteAddr)
+	}
+	for _, groupID := range req.Groups {
+		if err := lldap.AddUserToGroup(app, req.ID, groupID); err != nil {
+			log.Printf("LLDAP operation failed: %v", err)
+			http.Error(w, fmt.Sprintf("User created, but adding it to group id=%d failed", groupID), http.StatusBadGateway)
+			return
+		}
+		database.LogAudit(app, adminName, "lldap_group_member_added", fmt.Sprintf("Added LLDAP user %q to group id=%d", req.ID, groupID), r.RemoteAddr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "created", "id": req.ID})
+}
+
+// setLLDAPPassword sets an LLDAP user's password through LLDAP's LDAP interface.
+func setLLDAPPassword(app *server.App, w http.ResponseWriter, r *http.Request, userID, adminName string) {
+	if !lldap.CanSetPasswords(app) {
+		http.Error(w, "Setting LLDAP passwords requires LLDAP_LDAP_URL and LLDAP_BASE_DN", http.StatusNotImplemented)
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < 8 {
+		http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+		return
+	}
+
+	if err := lldap.SetPassword(app, userID, req.Password); err != nil {
+		var ldapErr *ldap.Error
+		if errors.As(err, &ldapErr) && ldapErr.ResultCode == ldap.LDAPResultNoSuchObject {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("LLDAP operation failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	database.LogAudit(app, adminName, "lldap_password_set", fmt.Sprintf("Set password for LLDAP user %q", userID), r.RemoteAddr)
+	lldapStatus(w, "updated")
+}
+
+// lldapStatus answers a successful LLDAP mutation.
+func lldapStatus(w http.ResponseWriter, status string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// lldapError answers a failed LLDAP mutation. Errors reported by LLDAP (such
+// as an existing user or unknown group) are passed on to the admin.
+func lldapError(w http.ResponseWriter, err error) {
+	var gqlErr *lldap.GraphQLError
+	if errors.As(err, &gqlErr) {
+		http.Error(w, "LLDAP: "+gqlErr.Message, http.StatusBadRequest)
+		return
 	}
+	log.Printf("LLDAP operation failed: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
 }
 
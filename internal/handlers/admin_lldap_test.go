@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"dashgate/internal/ldaptest"
+	"dashgate/internal/server"
+)
+
+func TestAdminLLDAPMutations(t *testing.T) {
+	// The LDAP interface LLDAP offers for password changes
+	dir := ldaptest.NewServer()
+	defer dir.Close()
+	dir.SetPassword("uid=admin,ou=people,dc=example,dc=com", "secret")
+	dir.AddEntry("uid=admin,ou=people,dc=example,dc=com", map[string][]string{"uid": {"admin"}})
+
+	// A fake GraphQL API that knows which users exist
+	var mu sync.Mutex
+	var mutations []string
+	users := map[string]bool{"admin": true}
+	lldapServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth/simple/login" {
+			w.Write([]byte(`{"token":"test-token"}`))
+			return
+		}
+		var req struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		name := strings.TrimSpace(req.Query[strings.Index(req.Query, "{")+1:])
+		name = name[:strings.IndexAny(name, "(")]
+
+		mu.Lock()
+		defer mu.Unlock()
+		mutations = append(mutations, name)
+		switch name {
+		case "createUser":
+			id := req.Variables["user"].(map[string]interface{})["id"].(string)
+			if users[id] {
+				w.Write([]byte(`{"data":null,"errors":[{"message":"User already exists"}]}`))
+				return
+			}
+			users[id] = true
+			dir.AddEntry("uid="+id+",ou=people,dc=example,dc=com", map[string][]string{"uid": {id}})
+			w.Write([]byte(`{"data":{"createUser":{"id":"` + id + `"}}}`))
+		case "createGroup":
+			w.Write([]byte(`{"data":{"createGroup":{"id":7,"displayName":"` + req.Variables["name"].(string) + `"}}}`))
+		default:
+			w.Write([]byte(`{"data":{"` + name + `":{"ok":true}}}`))
+		}
+	}))
+	defer lldapServer.Close()
+
+	app := newTestApp(t)
+	app.LLDAPConfig = &server.LLDAPConfigRef{
+		URL: lldapServer.URL, Username: "admin", Password: "secret", LDAPURL: dir.URL, BaseDN: "dc=example,dc=com",
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		body          interface{}
+		wantStatus    int
+		wantMutations string
+	}{
+		{"create user", http.MethodPost, "/api/admin/users",
+			map[string]interface{}{"id": "alice", "email": "alice@example.com", "password": "alice-password", "groups": []int{3}},
+			http.StatusCreated, "createUser,addUserToGroup"},
+		{"existing user", http.MethodPost, "/api/admin/users",
+			map[string]interface{}{"id": "alice", "email": "alice@example.com"}, http.StatusBadRequest, "createUser"},
+		{"invalid user ID", http.MethodPost, "/api/admin/users",
+			map[string]interface{}{"id": "a,b", "email": "ab@example.com"}, http.StatusBadRequest, ""},
+		{"short password", http.MethodPost, "/api/admin/users/alice/password",
+			map[string]string{"password": "short"}, http.StatusBadRequest, ""},
+		{"unknown user password", http.MethodPost, "/api/admin/users/nobody/password",
+			map[string]string{"password": "long-enough"}, http.StatusNotFound, ""},
+		{"remove from group", http.MethodDelete, "/api/admin/users/alice/groups/3", nil, http.StatusOK, "removeUserFromGroup"},
+		{"admin account", http.MethodDelete, "/api/admin/users/Admin", nil, http.StatusBadRequest, ""},
+		{"delete user", http.MethodDelete, "/api/admin/users/alice", nil, http.StatusOK, "deleteUser"},
+		{"create group", http.MethodPost, "/api/admin/groups", map[string]string{"name": "Media"}, http.StatusCreated, "createGroup"},
+		{"delete group", http.MethodDelete, "/api/admin/groups/7", nil, http.StatusOK, "deleteGroup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			mutations = nil
+			mu.Unlock()
+
+			var h http.HandlerFunc
+			switch tt.path {
+			case "/api/admin/users":
+				h = AdminLLDAPUsersHandler(app)
+			case "/api/admin/groups":
+				h = AdminLLDAPGroupsHandler(app)
+			default:
+				if strings.HasPrefix(tt.path, "/api/admin/groups/") {
+					h = AdminLLDAPGroupHandler(app)
+				} else {
+					h = AdminLLDAPUserHandler(app)
+				}
+			}
+			var w *httptest.ResponseRecorder
+			if tt.method == http.MethodPost {
+				w = postJSON(t, h, tt.path, tt.body, nil)
+			} else {
+				w = httptest.NewRecorder()
+				h(w, httptest.NewRequest(tt.method, tt.path, nil))
+			}
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			mu.Lock()
+			got := strings.Join(mutations, ",")
+			mu.Unlock()
+			if got != tt.wantMutations {
+				t.Errorf("mutations %q, want %q", got, tt.wantMutations)
+			}
+		})
+	}
+
+	// The password was set through the LDAP interface
+	conn, err := ldap.DialURL(dir.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.Bind("uid=alice,ou=people,dc=example,dc=com", "alice-password"); err != nil {
+		t.Errorf("bind with the new password: %v", err)
+	}
+
+	var actions []string
+	rows, err := app.DB.Query("SELECT action FROM audit_log ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var action string
+		rows.Scan(&action)
+		actions = append(actions, action)
+	}
+	want := "lldap_user_created,lldap_password_set,lldap_group_member_added,lldap_group_member_removed,lldap_user_deleted,lldap_group_created,lldap_group_deleted"
+	if got := strings.Join(actions, ","); got != want {
+		t.Errorf("audit log %q, want %q", got, want)
+	}
+}
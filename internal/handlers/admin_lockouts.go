@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// AdminLockoutsHandler lists usernames that are locked out or have recent
+// failed sign-ins (GET) or unlocks one of them (DELETE ?username=).
+func AdminLockoutsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			list, err := database.ListLoginFailures(app)
+			if err != nil {
+				log.Printf("Error listing login failures: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(list)
+
+		case http.MethodDelete:
+			username := strings.TrimSpace(r.URL.Query().Get("username"))
+			if username == "" {
+				http.Error(w, "username is required", http.StatusBadRequest)
+				return
+			}
+			unlocked, err := database.UnlockAccount(app, username)
+			if err != nil {
+				log.Printf("Error unlocking account %q: %v", username, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !unlocked {
+				http.Error(w, "No failed sign-ins recorded for this username", http.StatusNotFound)
+				return
+			}
+
+			adminUser := auth.GetUserFromContext(r)
+			adminName := ""
+			if adminUser != nil {
+				adminName = adminUser.Username
+			}
+			database.LogAudit(app, adminName, "account_unlocked", fmt.Sprintf("Unlocked account %s", username), r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "unlocked"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dashgate/internal/auth"
+)
+
+func TestLoginLockout(t *testing.T) {
+	app := newTestApp(t)
+	app.SystemConfig.LockoutThreshold = 3
+	app.SystemConfig.LockoutMinutes = 15
+
+	hash, err := auth.HashPassword("Password123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.DB.Exec("INSERT INTO users (username, email, display_name, password_hash, groups) VALUES ('alice', 'alice@example.com', 'Alice', ?, '[]')", hash); err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(username, password string) int {
+		return postJSON(t, LoginHandler(app), "/api/auth/login", map[string]string{"username": username, "password": password}, nil).Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := login("alice", "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got %d, want 401", i+1, code)
+		}
+	}
+	// Locked even with the right password, and regardless of username case
+	if code := login("Alice", "Password123!"); code != http.StatusTooManyRequests {
+		t.Fatalf("locked account: got %d, want 429", code)
+	}
+	// Other accounts are unaffected
+	if code := login("bob", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("other username: got %d, want 401", code)
+	}
+
+	w := httptest.NewRecorder()
+	AdminLockoutsHandler(app)(w, httptest.NewRequest(http.MethodDelete, "/api/admin/lockouts?username=alice", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unlock: %d %s", w.Code, w.Body.String())
+	}
+	if code := login("alice", "Password123!"); code != http.StatusOK {
+		t.Fatalf("after unlock: got %d, want 200", code)
+	}
+
+	var audited int
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action IN ('account_locked', 'account_unlocked') AND detail != ''").Scan(&audited)
+	if audited != 2 {
+		t.Errorf("got %d audit entries, want 2", audited)
+	}
+}
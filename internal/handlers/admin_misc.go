@@ -11,6 +11,7 @@ import (
 	"dashgate/internal/auth"
 	"dashgate/internal/config"
 	"dashgate/internal/database"
+	"dashgate/internal/models"
 	"dashgate/internal/server"
 )
 
@@ -183,30 +184,46 @@ func BackupHandler(app *server.App) http.HandlerFunc {
 		// Export system config (excluding secrets)
 		app.SysConfigMu.RLock()
 		backup["systemConfig"] = map[string]interface{}{
-			"sessionDays":      app.SystemConfig.SessionDays,
-			"cookieSecure":     app.SystemConfig.CookieSecure,
-			"proxyAuthEnabled": app.SystemConfig.ProxyAuthEnabled,
-			"localAuthEnabled": app.SystemConfig.LocalAuthEnabled,
-			"ldapAuthEnabled":  app.SystemConfig.LDAPAuthEnabled,
-			"oidcAuthEnabled":  app.SystemConfig.OIDCAuthEnabled,
-			"apiKeyEnabled":    app.SystemConfig.APIKeyEnabled,
-			"ldapServer":       app.SystemConfig.LDAPServer,
-			"ldapBindDN":       app.SystemConfig.LDAPBindDN,
-			"ldapBaseDN":       app.SystemConfig.LDAPBaseDN,
-			"ldapUserFilter":   app.SystemConfig.LDAPUserFilter,
-			"ldapUserAttr":     app.SystemConfig.LDAPUserAttr,
-			"ldapEmailAttr":    app.SystemConfig.LDAPEmailAttr,
-			"ldapDisplayAttr":  app.SystemConfig.LDAPDisplayAttr,
-			"ldapStartTLS":     app.SystemConfig.LDAPStartTLS,
-			"ldapSkipVerify":   app.SystemConfig.LDAPSkipVerify,
-			"oidcIssuer":       app.SystemConfig.OIDCIssuer,
-			"oidcClientID":     app.SystemConfig.OIDCClientID,
-			"oidcRedirectURL":  app.SystemConfig.OIDCRedirectURL,
-			"oidcScopes":       app.SystemConfig.OIDCScopes,
-			"oidcGroupsClaim":  app.SystemConfig.OIDCGroupsClaim,
+			"sessionDays":          app.SystemConfig.SessionDays,
+			"sessionIdleMinutes":   app.SystemConfig.SessionIdleMinutes,
+			"sessionRenewMinutes":  app.SystemConfig.SessionRenewMinutes,
+			"sessionMaxDays":       app.SystemConfig.SessionMaxDays,
+			"lockoutThreshold":     app.SystemConfig.LockoutThreshold,
+			"lockoutMinutes":       app.SystemConfig.LockoutMinutes,
+			"apiKeyUsageDays":      app.SystemConfig.APIKeyUsageDays,
+			"apiKeyStaleDays":      app.SystemConfig.APIKeyStaleDays,
+			"passwordResetMinutes": app.SystemConfig.PasswordResetMinutes,
+			"passwordResetEmail":   app.SystemConfig.PasswordResetEmail,
+			"smtpHost":             app.SystemConfig.SMTPHost,
+			"smtpPort":             app.SystemConfig.SMTPPort,
+			"smtpUsername":         app.SystemConfig.SMTPUsername,
+			"smtpFrom":             app.SystemConfig.SMTPFrom,
+			"smtpSecurity":         app.SystemConfig.SMTPSecurity,
+			"cookieSecure":         app.SystemConfig.CookieSecure,
+			"proxyAuthEnabled":     app.SystemConfig.ProxyAuthEnabled,
+			"localAuthEnabled":     app.SystemConfig.LocalAuthEnabled,
+			"ldapAuthEnabled":      app.SystemConfig.LDAPAuthEnabled,
+			"oidcAuthEnabled":      app.SystemConfig.OIDCAuthEnabled,
+			"apiKeyEnabled":        app.SystemConfig.APIKeyEnabled,
+			"ldapServer":           app.SystemConfig.LDAPServer,
+			"ldapBindDN":           app.SystemConfig.LDAPBindDN,
+			"ldapBaseDN":           app.SystemConfig.LDAPBaseDN,
+			"ldapUserFilter":       app.SystemConfig.LDAPUserFilter,
+			"ldapUserAttr":         app.SystemConfig.LDAPUserAttr,
+			"ldapEmailAttr":        app.SystemConfig.LDAPEmailAttr,
+			"ldapDisplayAttr":      app.SystemConfig.LDAPDisplayAttr,
+			"ldapStartTLS":         app.SystemConfig.LDAPStartTLS,
+			"ldapSkipVerify":       app.SystemConfig.LDAPSkipVerify,
 		}
 		app.SysConfigMu.RUnlock()
 
+		// Export OIDC providers (client secrets are never serialized)
+		if providers, err := database.ListOIDCProviders(app); err == nil {
+			backup["oidcProviders"] = providers
+		} else {
+			log.Printf("Error exporting OIDC providers during backup: %v", err)
+		}
+
 		adminUser := auth.GetUserFromContext(r)
 		adminName := ""
 		if adminUser != nil {
@@ -284,6 +301,32 @@ func RestoreHandler(app *server.App) http.HandlerFunc {
 			}
 		}
 
+		// Validate OIDC providers. Backups made before providers were a list
+		// carry a single provider in systemConfig, restored as "default".
+		var oidcProviders []models.OIDCProvider
+		if raw, ok := backup["oidcProviders"]; ok {
+			data, _ := json.Marshal(raw)
+			if err := json.Unmarshal(data, &oidcProviders); err != nil {
+				http.Error(w, "Invalid oidcProviders: expected a list of providers", http.StatusBadRequest)
+				return
+			}
+		} else if sysConfig, ok := backup["systemConfig"].(map[string]interface{}); ok {
+			if issuer, _ := sysConfig["oidcIssuer"].(string); issuer != "" {
+				p := models.OIDCProvider{ID: "default", DisplayName: "SSO", Enabled: true, Issuer: issuer}
+				p.ClientID, _ = sysConfig["oidcClientID"].(string)
+				p.RedirectURL, _ = sysConfig["oidcRedirectURL"].(string)
+				p.Scopes, _ = sysConfig["oidcScopes"].(string)
+				p.GroupsClaim, _ = sysConfig["oidcGroupsClaim"].(string)
+				oidcProviders = append(oidcProviders, p)
+			}
+		}
+		for i := range oidcProviders {
+			if err := validateOIDCProvider(&oidcProviders[i]); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid OIDC provider at index %d: %v", i, err), http.StatusBadRequest)
+				return
+			}
+		}
+
 		// Validate user records if present
 		if users, ok := backup["users"].([]interface{}); ok {
 			for i, u := range users {
@@ -304,6 +347,20 @@ func RestoreHandler(app *server.App) http.HandlerFunc {
 			"users":           0,
 			"userPreferences": 0,
 			"systemConfig":    0,
+			"oidcProviders":   0,
+		}
+
+		// Restore OIDC providers before the system config, which initializes
+		// them. Secrets are kept from an existing provider with the same ID.
+		for _, p := range oidcProviders {
+			if existing, err := database.GetOIDCProvider(app, p.ID); err == nil {
+				p.ClientSecret = existing.ClientSecret
+			}
+			if err := database.SaveOIDCProvider(app, &p); err != nil {
+				log.Printf("Error restoring OIDC provider %q: %v", p.ID, err)
+				continue
+			}
+			restored["oidcProviders"]++
 		}
 
 		// Restore system config (excluding secrets - those need to be re-entered)
@@ -312,6 +369,48 @@ func RestoreHandler(app *server.App) http.HandlerFunc {
 			if v, ok := sysConfig["sessionDays"].(float64); ok {
 				app.SystemConfig.SessionDays = int(v)
 			}
+			if v, ok := sysConfig["sessionIdleMinutes"].(float64); ok && v >= 0 {
+				app.SystemConfig.SessionIdleMinutes = int(v)
+			}
+			if v, ok := sysConfig["sessionRenewMinutes"].(float64); ok && v > 0 {
+				app.SystemConfig.SessionRenewMinutes = int(v)
+			}
+			if v, ok := sysConfig["sessionMaxDays"].(float64); ok && v >= 0 {
+				app.SystemConfig.SessionMaxDays = int(v)
+			}
+			if v, ok := sysConfig["lockoutThreshold"].(float64); ok && v >= 0 {
+				app.SystemConfig.LockoutThreshold = int(v)
+			}
+			if v, ok := sysConfig["lockoutMinutes"].(float64); ok && v > 0 {
+				app.SystemConfig.LockoutMinutes = int(v)
+			}
+			if v, ok := sysConfig["apiKeyUsageDays"].(float64); ok && v > 0 {
+				app.SystemConfig.APIKeyUsageDays = int(v)
+			}
+			if v, ok := sysConfig["apiKeyStaleDays"].(float64); ok && v > 0 {
+				app.SystemConfig.APIKeyStaleDays = int(v)
+			}
+			if v, ok := sysConfig["passwordResetMinutes"].(float64); ok && v > 0 {
+				app.SystemConfig.PasswordResetMinutes = int(v)
+			}
+			if v, ok := sysConfig["passwordResetEmail"].(bool); ok {
+				app.SystemConfig.PasswordResetEmail = v
+			}
+			if v, ok := sysConfig["smtpHost"].(string); ok {
+				app.SystemConfig.SMTPHost = v
+			}
+			if v, ok := sysConfig["smtpPort"].(float64); ok && v > 0 {
+				app.SystemConfig.SMTPPort = int(v)
+			}
+			if v, ok := sysConfig["smtpUsername"].(string); ok {
+				app.SystemConfig.SMTPUsername = v
+			}
+			if v, ok := sysConfig["smtpFrom"].(string); ok {
+				app.SystemConfig.SMTPFrom = v
+			}
+			if v, ok := sysConfig["smtpSecurity"].(string); ok {
+				app.SystemConfig.SMTPSecurity = v
+			}
 			if v, ok := sysConfig["cookieSecure"].(bool); ok {
 				app.SystemConfig.CookieSecure = v
 			}
@@ -342,15 +441,6 @@ func RestoreHandler(app *server.App) http.HandlerFunc {
 			if v, ok := sysConfig["ldapUserFilter"].(string); ok {
 				app.SystemConfig.LDAPUserFilter = v
 			}
-			if v, ok := sysConfig["oidcIssuer"].(string); ok {
-				app.SystemConfig.OIDCIssuer = v
-			}
-			if v, ok := sysConfig["oidcClientID"].(string); ok {
-				app.SystemConfig.OIDCClientID = v
-			}
-			if v, ok := sysConfig["oidcRedirectURL"].(string); ok {
-				app.SystemConfig.OIDCRedirectURL = v
-			}
 			app.SysConfigMu.Unlock()
 
 			if err := database.SaveSystemConfig(app); err != nil {
@@ -359,6 +449,9 @@ func RestoreHandler(app *server.App) http.HandlerFunc {
 				restored["systemConfig"] = 1
 			}
 		}
+		if restored["oidcProviders"] > 0 && restored["systemConfig"] == 0 {
+			database.InitOIDCProviders(app)
+		}
 
 		// Restore user preferences
 		if prefs, ok := backup["userPreferences"].([]interface{}); ok {
@@ -388,7 +481,7 @@ func RestoreHandler(app *server.App) http.HandlerFunc {
 		if adminUser != nil {
 			adminName = adminUser.Username
 		}
-		database.LogAudit(app, adminName, "backup_restored", fmt.Sprintf("Restored: users=%d, prefs=%d, config=%d", restored["users"], restored["userPreferences"], restored["systemConfig"]), r.RemoteAddr)
+		database.LogAudit(app, adminName, "backup_restored", fmt.Sprintf("Restored: users=%d, prefs=%d, config=%d, oidcProviders=%d", restored["users"], restored["userPreferences"], restored["systemConfig"], restored["oidcProviders"]), r.RemoteAddr)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// AdminSessionsHandler lists active sessions across all users (GET, optionally
+// filtered with ?user_id=) or signs out every session of one user
+// (DELETE ?user_id=).
+func AdminSessionsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := 0
+		if v := r.URL.Query().Get("user_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil || id <= 0 {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+			userID = id
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			_, token, _ := currentSession(app, r)
+			sessions, err := database.ListActiveSessions(app, userID, token)
+			if err != nil {
+				log.Printf("Error listing sessions: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			for i := range sessions {
+				sessions[i].Device = describeUserAgent(sessions[i].UserAgent)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sessions)
+
+		case http.MethodDelete:
+			if userID == 0 {
+				http.Error(w, "user_id is required", http.StatusBadRequest)
+				return
+			}
+			var username string
+			err := app.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+			if err == sql.ErrNoRows {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Printf("Error looking up user %d: %v", userID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.InvalidateUserSessions(app, userID); err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			adminUser := auth.GetUserFromContext(r)
+			adminName := ""
+			if adminUser != nil {
+				adminName = adminUser.Username
+			}
+			database.LogAudit(app, adminName, "sessions_revoked", fmt.Sprintf("Signed out all sessions of user %s", username), r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// AdminSessionHandler signs out a single session (DELETE /api/admin/sessions/{id}).
+func AdminSessionHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/admin/sessions/"))
+		if err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, username, err := database.GetSessionOwner(app, sessionID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up session %d: %v", sessionID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := database.DeleteUserSession(app, userID, sessionID); err != nil {
+			log.Printf("Error revoking session %d: %v", sessionID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+		database.LogAudit(app, adminName, "session_revoked", fmt.Sprintf("Signed out session id=%d of user %s", sessionID, username), r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+	}
+}
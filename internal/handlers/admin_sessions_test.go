@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"dashgate/internal/models"
+)
+
+func TestAdminSessionsRevoke(t *testing.T) {
+	app := newTestApp(t)
+
+	users := map[string]int{}
+	for _, u := range []struct{ name, hash string }{{"alice", "x"}, {"bob", "LDAP_USER"}} {
+		res, err := app.DB.Exec("INSERT INTO users (username, email, display_name, password_hash) VALUES (?, ?, ?, ?)", u.name, u.name+"@example.com", u.name, u.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		users[u.name] = int(id)
+	}
+	for _, name := range []string{"alice", "alice", "bob"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		if err := createLoginSession(app, httptest.NewRecorder(), req, users[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(query string) []models.UserSession {
+		t.Helper()
+		w := httptest.NewRecorder()
+		AdminSessionsHandler(app)(w, httptest.NewRequest(http.MethodGet, "/api/admin/sessions"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: %d %s", w.Code, w.Body.String())
+		}
+		var sessions []models.UserSession
+		json.NewDecoder(w.Body).Decode(&sessions)
+		return sessions
+	}
+
+	all := list("")
+	if len(all) != 3 {
+		t.Fatalf("got %d sessions, want 3", len(all))
+	}
+	for _, s := range all {
+		if want := map[string]string{"alice": "local", "bob": "ldap"}[s.Username]; s.Source != want {
+			t.Errorf("session of %s has source %q, want %q", s.Username, s.Source, want)
+		}
+	}
+
+	bobSession := list("?user_id=" + strconv.Itoa(users["bob"]))
+	if len(bobSession) != 1 {
+		t.Fatalf("bob has %d sessions, want 1", len(bobSession))
+	}
+	w := httptest.NewRecorder()
+	AdminSessionHandler(app)(w, httptest.NewRequest(http.MethodDelete, "/api/admin/sessions/"+strconv.Itoa(bobSession[0].ID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke session: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	AdminSessionsHandler(app)(w, httptest.NewRequest(http.MethodDelete, "/api/admin/sessions?user_id="+strconv.Itoa(users["alice"]), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke user sessions: %d %s", w.Code, w.Body.String())
+	}
+
+	if remaining := list(""); len(remaining) != 0 {
+		t.Errorf("%d sessions left after revoking, want 0", len(remaining))
+	}
+
+	var audited int
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action IN ('session_revoked', 'sessions_revoked')").Scan(&audited)
+	if audited != 2 {
+		t.Errorf("got %d audit entries, want 2", audited)
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/mailer"
+	"dashgate/internal/server"
+)
+
+// SMTPSettingsHandler returns (GET) or updates (PUT) the outgoing email
+// settings and the password reset options that depend on them.
+func SMTPSettingsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.SysConfigMu.RLock()
+			settings := map[string]interface{}{
+				"host":                 app.SystemConfig.SMTPHost,
+				"port":                 app.SystemConfig.SMTPPort,
+				"username":             app.SystemConfig.SMTPUsername,
+				"hasPassword":          app.SystemConfig.SMTPPassword != "",
+				"from":                 app.SystemConfig.SMTPFrom,
+				"security":             app.SystemConfig.SMTPSecurity,
+				"passwordResetEmail":   app.SystemConfig.PasswordResetEmail,
+				"passwordResetMinutes": app.SystemConfig.PasswordResetMinutes,
+				"externalURLSet":       app.SystemConfig.ExternalURL != "",
+			}
+			app.SysConfigMu.RUnlock()
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(settings)
+
+		case http.MethodPut:
+			var req struct {
+				Host                 string `json:"host"`
+				Port                 int    `json:"port"`
+				Username             string `json:"username"`
+				Password             string `json:"password"`
+				From                 string `json:"from"`
+				Security             string `json:"security"`
+				PasswordResetEmail   bool   `json:"passwordResetEmail"`
+				PasswordResetMinutes *int   `json:"passwordResetMinutes"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			req.Host = strings.TrimSpace(req.Host)
+			req.From = strings.TrimSpace(req.From)
+			if req.Security == "" {
+				req.Security = mailer.SecurityStartTLS
+			}
+
+			// An empty host turns outgoing email off
+			if req.Host != "" {
+				cfg := mailer.Config{Host: req.Host, Port: req.Port, From: req.From, Security: req.Security}
+				if err := cfg.Validate(); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if req.PasswordResetMinutes != nil && (*req.PasswordResetMinutes < 5 || *req.PasswordResetMinutes > 10080) {
+				http.Error(w, "Reset link lifetime must be between 5 minutes and 7 days", http.StatusBadRequest)
+				return
+			}
+
+			app.SysConfigMu.RLock()
+			externalURL := app.SystemConfig.ExternalURL
+			app.SysConfigMu.RUnlock()
+			if req.PasswordResetEmail && (req.Host == "" || externalURL == "") {
+				http.Error(w, "Password reset by email needs an SMTP server and the External URL to be set", http.StatusBadRequest)
+				return
+			}
+
+			app.SysConfigMu.Lock()
+			app.SystemConfig.SMTPHost = req.Host
+			if req.Port > 0 {
+				app.SystemConfig.SMTPPort = req.Port
+			}
+			app.SystemConfig.SMTPUsername = strings.TrimSpace(req.Username)
+			if req.Password != "" {
+				app.SystemConfig.SMTPPassword = req.Password
+			}
+			app.SystemConfig.SMTPFrom = req.From
+			app.SystemConfig.SMTPSecurity = req.Security
+			app.SystemConfig.PasswordResetEmail = req.PasswordResetEmail
+			if req.PasswordResetMinutes != nil {
+				app.SystemConfig.PasswordResetMinutes = *req.PasswordResetMinutes
+			}
+			app.SysConfigMu.Unlock()
+
+			if err := database.SaveSystemConfig(app); err != nil {
+				log.Printf("Error saving email settings: %v", err)
+				http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
+				return
+			}
+
+			adminUser := auth.GetUserFromContext(r)
+			adminName := ""
+			if adminUser != nil {
+				adminName = adminUser.Username
+			}
+			database.LogAudit(app, adminName, "smtp_config_updated", "Email settings updated", r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// SMTPTestHandler sends a test email with the saved settings.
+func SMTPTestHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			To string `json:"to"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.To) == "" {
+			http.Error(w, "Recipient address is required", http.StatusBadRequest)
+			return
+		}
+
+		cfg := smtpConfig(app)
+		if !cfg.Configured() {
+			http.Error(w, "Save the SMTP settings first", http.StatusBadRequest)
+			return
+		}
+
+		err := mailer.Send(cfg, strings.TrimSpace(req.To), "DashGate test email",
+			"This is a test email from DashGate. Outgoing email is configured correctly.\n")
+
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("Sending failed: %v", err),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	}
+}
@@ -65,6 +65,18 @@ func LocalUserHandler(app *server.App) http.HandlerFunc {
 			return
 		}
 
+		// One-time password reset link
+		if len(parts) > 1 && parts[1] == "reset-link" {
+			createPasswordResetLink(app, w, r, userID, user.Username)
+			return
+		}
+
+		// Two-factor requirement and reset
+		if len(parts) > 1 && parts[1] == "totp" {
+			adminUserTOTP(app, w, r, userID, user.Username)
+			return
+		}
+
 		switch r.Method {
 		case http.MethodPut:
 			updateLocalUser(app, w, r, userID, user.Username)
@@ -78,7 +90,10 @@ func LocalUserHandler(app *server.App) http.HandlerFunc {
 
 func listLocalUsers(app *server.App, w http.ResponseWriter, r *http.Request) {
 	rows, err := app.DB.Query(
-		"SELECT id, username, COALESCE(email, ''), COALESCE(display_name, username), COALESCE(groups, '[]'), created_at, updated_at FROM users ORDER BY username",
+		`SELECT u.id, u.username, COALESCE(u.email, ''), COALESCE(u.display_name, u.username), COALESCE(u.groups, '[]'),
+		        COALESCE(u.totp_required, 0), EXISTS(SELECT 1 FROM user_totp t WHERE t.user_id = u.id AND t.enabled = 1),
+		        u.password_hash, COALESCE(u.disabled, 0), u.created_at, u.updated_at
+		 FROM users u ORDER BY u.username`,
 	)
 	if err != nil {
 		log.Printf("Error listing users: %v", err)
@@ -90,12 +105,21 @@ func listLocalUsers(app *server.App, w http.ResponseWriter, r *http.Request) {
 	var users []models.LocalUser
 	for rows.Next() {
 		var u models.LocalUser
-		var groupsJSON string
-		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.DisplayName, &groupsJSON, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		var groupsJSON, passwordHash string
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.DisplayName, &groupsJSON, &u.TOTPRequired, &u.TOTPEnabled,
+			&passwordHash, &u.Disabled, &u.CreatedAt, &u.UpdatedAt); err != nil {
 			log.Printf("Error scanning user: %v", err)
 			continue
 		}
 		json.Unmarshal([]byte(groupsJSON), &u.Groups)
+		switch passwordHash {
+		case "LDAP_USER":
+			u.Source = "ldap"
+		case "OIDC_USER":
+			u.Source = "oidc"
+		default:
+			u.Source = "local"
+		}
 		users = append(users, u)
 	}
 
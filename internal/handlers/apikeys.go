@@ -1,25 +1,33 @@
 package handlers
 
 import (
-	"crypto/rand"
 	"database/sql"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"dashgate/internal/auth"
 	"dashgate/internal/database"
 	"dashgate/internal/models"
 	"dashgate/internal/server"
+)
 
-	"golang.org/x/crypto/bcrypt"
+// Limits for API key settings.
+const (
+	maxAPIKeyCIDRs       = 50
+	maxAPIKeyRateLimit   = 100000
+	defaultRotationGrace = 24
+	maxRotationGrace     = 30 * 24
+	defaultUsageLimit    = 100
+	maxUsageLimit        = 1000
 )
 
-// APIKeysHandler routes GET (list), POST (create), and DELETE operations for API keys.
+// APIKeysHandler routes GET (list), POST (create), PUT (update), and DELETE operations for API keys.
 func APIKeysHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -27,6 +35,8 @@ func APIKeysHandler(app *server.App) http.HandlerFunc {
 			listAPIKeys(app, w, r)
 		case http.MethodPost:
 			createAPIKey(app, w, r)
+		case http.MethodPut:
+			updateAPIKey(app, w, r)
 		case http.MethodDelete:
 			deleteAPIKey(app, w, r)
 		default:
@@ -37,7 +47,7 @@ func APIKeysHandler(app *server.App) http.HandlerFunc {
 
 func listAPIKeys(app *server.App, w http.ResponseWriter, r *http.Request) {
 	rows, err := app.DB.Query(
-		"SELECT id, name, key_prefix, username, groups, permissions, expires_at, last_used_at, created_at FROM api_keys ORDER BY created_at DESC",
+		"SELECT id, name, key_prefix, username, groups, permissions, expires_at, last_used_at, created_at, COALESCE(allowed_cidrs, '[]'), COALESCE(rate_limit, 0), replaced_by FROM api_keys ORDER BY created_at DESC",
 	)
 	if err != nil {
 		log.Printf("Error listing API keys: %v", err)
@@ -46,24 +56,45 @@ func listAPIKeys(app *server.App, w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	app.SysConfigMu.RLock()
+	staleDays := app.SystemConfig.APIKeyStaleDays
+	app.SysConfigMu.RUnlock()
+	staleBefore := time.Now().Add(-time.Duration(staleDays) * 24 * time.Hour)
+
 	var keys []models.APIKey
 	for rows.Next() {
 		var k models.APIKey
-		var groupsJSON, permsJSON string
+		var groupsJSON, permsJSON, cidrsJSON string
 		var expiresAt, lastUsedAt sql.NullTime
+		var replacedBy sql.NullInt64
 
-		if err := rows.Scan(&k.ID, &k.Name, &k.KeyPrefix, &k.Username, &groupsJSON, &permsJSON, &expiresAt, &lastUsedAt, &k.CreatedAt); err != nil {
+		if err := rows.Scan(&k.ID, &k.Name, &k.KeyPrefix, &k.Username, &groupsJSON, &permsJSON, &expiresAt, &lastUsedAt, &k.CreatedAt, &cidrsJSON, &k.RateLimit, &replacedBy); err != nil {
 			continue
 		}
 
 		json.Unmarshal([]byte(groupsJSON), &k.Groups)
-		json.Unmarshal([]byte(permsJSON), &k.Permissions)
+		var permissions []string
+		json.Unmarshal([]byte(permsJSON), &permissions)
+		k.Permissions = auth.ParseScopes(permissions)
 		if expiresAt.Valid {
 			k.ExpiresAt = &expiresAt.Time
 		}
 		if lastUsedAt.Valid {
 			k.LastUsedAt = &lastUsedAt.Time
 		}
+		k.AllowedCIDRs = []string{}
+		json.Unmarshal([]byte(cidrsJSON), &k.AllowedCIDRs)
+		if replacedBy.Valid {
+			id := int(replacedBy.Int64)
+			k.ReplacedBy = &id
+		}
+
+		// Flag keys nobody has used for a while so they can be expired
+		lastActive := k.CreatedAt
+		if k.LastUsedAt != nil {
+			lastActive = *k.LastUsedAt
+		}
+		k.Stale = staleDays > 0 && lastActive.Before(staleBefore)
 		keys = append(keys, k)
 	}
 
@@ -79,11 +110,13 @@ func listAPIKeys(app *server.App, w http.ResponseWriter, r *http.Request) {
 
 func createAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name        string   `json:"name"`
-		Username    string   `json:"username"`
-		Groups      []string `json:"groups"`
-		Permissions []string `json:"permissions"`
-		ExpiresIn   int      `json:"expiresIn"` // days, 0 = never
+		Name         string   `json:"name"`
+		Username     string   `json:"username"`
+		Groups       []string `json:"groups"`
+		Permissions  []string `json:"permissions"`
+		ExpiresIn    int      `json:"expiresIn"` // days, 0 = never
+		AllowedCIDRs []string `json:"allowedCidrs"`
+		RateLimit    int      `json:"rateLimit"` // requests per minute, 0 = unlimited
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -100,29 +133,33 @@ func createAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 		req.Username = "api-key"
 	}
 
-	if len(req.Permissions) == 0 {
-		req.Permissions = []string{"read"}
+	scopes, err := auth.NormalizeScopes(req.Permissions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	req.Permissions = scopes
 
-	// Generate API key
-	keyBytes := make([]byte, 32)
-	if _, err := rand.Read(keyBytes); err != nil {
-		log.Printf("Error generating random bytes for API key: %v", err)
-		http.Error(w, "Failed to generate key", http.StatusInternalServerError)
+	cidrs, err := normalizeCIDRs(req.AllowedCIDRs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.RateLimit < 0 || req.RateLimit > maxAPIKeyRateLimit {
+		http.Error(w, fmt.Sprintf("Rate limit must be between 0 (unlimited) and %d requests per minute", maxAPIKeyRateLimit), http.StatusBadRequest)
 		return
 	}
-	apiKey := base64.URLEncoding.EncodeToString(keyBytes)
-	keyPrefix := apiKey[:8]
 
-	// Hash the key
-	keyHash, err := bcrypt.GenerateFromPassword([]byte(apiKey), bcrypt.DefaultCost)
+	apiKey, keyPrefix, keyHash, err := auth.GenerateAPIKey()
 	if err != nil {
+		log.Printf("Error generating API key: %v", err)
 		http.Error(w, "Failed to generate key", http.StatusInternalServerError)
 		return
 	}
 
 	groupsJSON, _ := json.Marshal(req.Groups)
 	permsJSON, _ := json.Marshal(req.Permissions)
+	cidrsJSON, _ := json.Marshal(cidrs)
 
 	var expiresAt *time.Time
 	if req.ExpiresIn > 0 {
@@ -131,8 +168,8 @@ func createAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 	}
 
 	result, err := app.DB.Exec(
-		"INSERT INTO api_keys (name, key_hash, key_prefix, username, groups, permissions, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		req.Name, string(keyHash), keyPrefix, req.Username, string(groupsJSON), string(permsJSON), expiresAt,
+		"INSERT INTO api_keys (name, key_hash, key_prefix, username, groups, permissions, expires_at, allowed_cidrs, rate_limit) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		req.Name, keyHash, keyPrefix, req.Username, string(groupsJSON), string(permsJSON), expiresAt, string(cidrsJSON), req.RateLimit,
 	)
 	if err != nil {
 		log.Printf("Error creating API key: %v", err)
@@ -147,7 +184,7 @@ func createAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 	if adminUser != nil {
 		adminName = adminUser.Username
 	}
-	database.LogAudit(app, adminName, "api_key_created", fmt.Sprintf("Created API key %q (id=%d, prefix=%s)", req.Name, id, keyPrefix), r.RemoteAddr)
+	database.LogAudit(app, adminName, "api_key_created", fmt.Sprintf("Created API key %q (id=%d, prefix=%s, scopes=%s%s)", req.Name, id, keyPrefix, strings.Join(req.Permissions, ","), describeAPIKeyLimits(cidrs, req.RateLimit)), r.RemoteAddr)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -158,6 +195,272 @@ func createAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// normalizeCIDRs validates an address allowlist. Bare IP addresses are
+// turned into single-host networks.
+func normalizeCIDRs(entries []string) ([]string, error) {
+	cidrs := []string{}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if ip := net.ParseIP(e); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			e = (&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}).String()
+		}
+		_, network, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address or CIDR %q", e)
+		}
+		cidrs = append(cidrs, network.String())
+	}
+	if len(cidrs) > maxAPIKeyCIDRs {
+		return nil, fmt.Errorf("at most %d allowed networks per key", maxAPIKeyCIDRs)
+	}
+	return cidrs, nil
+}
+
+// describeAPIKeyLimits formats a key's allowlist and rate limit for the audit log.
+func describeAPIKeyLimits(cidrs []string, rateLimit int) string {
+	desc := ""
+	if len(cidrs) > 0 {
+		desc += ", allowed=" + strings.Join(cidrs, ",")
+	}
+	if rateLimit > 0 {
+		desc += fmt.Sprintf(", limit=%d/min", rateLimit)
+	}
+	return desc
+}
+
+// apiKeyID parses the id query parameter of an API key request.
+func apiKeyID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		http.Error(w, "ID required", http.StatusBadRequest)
+		return 0, false
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func updateAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
+	id, ok := apiKeyID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		AllowedCIDRs []string `json:"allowedCidrs"`
+		RateLimit    int      `json:"rateLimit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	cidrs, err := normalizeCIDRs(req.AllowedCIDRs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.RateLimit < 0 || req.RateLimit > maxAPIKeyRateLimit {
+		http.Error(w, fmt.Sprintf("Rate limit must be between 0 (unlimited) and %d requests per minute", maxAPIKeyRateLimit), http.StatusBadRequest)
+		return
+	}
+
+	cidrsJSON, _ := json.Marshal(cidrs)
+	result, err := app.DB.Exec("UPDATE api_keys SET allowed_cidrs = ?, rate_limit = ? WHERE id = ?", string(cidrsJSON), req.RateLimit, id)
+	if err != nil {
+		log.Printf("Error updating API key: %v", err)
+		http.Error(w, "Failed to update key", http.StatusInternalServerError)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+	auth.ForgetAPIKey(app, id)
+
+	adminUser := auth.GetUserFromContext(r)
+	adminName := ""
+	if adminUser != nil {
+		adminName = adminUser.Username
+	}
+	limits := describeAPIKeyLimits(cidrs, req.RateLimit)
+	if limits == "" {
+		limits = ", no restrictions"
+	}
+	database.LogAudit(app, adminName, "api_key_updated", fmt.Sprintf("Updated API key id=%d%s", id, limits), r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+}
+
+// APIKeyRotateHandler replaces an API key (POST ?id=) with a new one that has
+// the same settings. The old key keeps working for a grace period so clients
+// can be switched over without downtime.
+func APIKeyRotateHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, ok := apiKeyID(w, r)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			GraceHours *int `json:"graceHours"` // default 24, 0 = revoke the old key now
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		grace := defaultRotationGrace
+		if req.GraceHours != nil {
+			grace = *req.GraceHours
+		}
+		if grace < 0 || grace > maxRotationGrace {
+			http.Error(w, fmt.Sprintf("Grace period must be between 0 and %d hours", maxRotationGrace), http.StatusBadRequest)
+			return
+		}
+
+		var name, keyPrefix, username, groupsJSON, permsJSON, cidrsJSON string
+		var rateLimit int
+		var createdAt time.Time
+		var expiresAt sql.NullTime
+		var replacedBy sql.NullInt64
+		err := app.DB.QueryRow(
+			"SELECT name, key_prefix, username, groups, permissions, COALESCE(allowed_cidrs, '[]'), COALESCE(rate_limit, 0), created_at, expires_at, replaced_by FROM api_keys WHERE id = ?", id,
+		).Scan(&name, &keyPrefix, &username, &groupsJSON, &permsJSON, &cidrsJSON, &rateLimit, &createdAt, &expiresAt, &replacedBy)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Key not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading API key: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		if replacedBy.Valid {
+			http.Error(w, "Key has already been rotated", http.StatusConflict)
+			return
+		}
+		if expiresAt.Valid && now.After(expiresAt.Time) {
+			http.Error(w, "Key has expired", http.StatusBadRequest)
+			return
+		}
+
+		// The new key gets the same lifetime the old one was created with
+		var newExpiresAt *time.Time
+		if expiresAt.Valid {
+			t := now.Add(expiresAt.Time.Sub(createdAt))
+			newExpiresAt = &t
+		}
+		oldExpiresAt := now.Add(time.Duration(grace) * time.Hour)
+		if expiresAt.Valid && expiresAt.Time.Before(oldExpiresAt) {
+			oldExpiresAt = expiresAt.Time
+		}
+
+		apiKey, newPrefix, keyHash, err := auth.GenerateAPIKey()
+		if err != nil {
+			log.Printf("Error generating API key: %v", err)
+			http.Error(w, "Failed to generate key", http.StatusInternalServerError)
+			return
+		}
+
+		tx, err := app.DB.Begin()
+		if err != nil {
+			log.Printf("Error starting transaction: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec(
+			"INSERT INTO api_keys (name, key_hash, key_prefix, username, groups, permissions, expires_at, allowed_cidrs, rate_limit) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			name, keyHash, newPrefix, username, groupsJSON, permsJSON, newExpiresAt, cidrsJSON, rateLimit,
+		)
+		if err != nil {
+			log.Printf("Error creating rotated API key: %v", err)
+			http.Error(w, "Failed to rotate key", http.StatusInternalServerError)
+			return
+		}
+		newID, _ := result.LastInsertId()
+		if _, err := tx.Exec("UPDATE api_keys SET expires_at = ?, replaced_by = ? WHERE id = ?", oldExpiresAt, newID, id); err != nil {
+			log.Printf("Error expiring rotated API key: %v", err)
+			http.Error(w, "Failed to rotate key", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			log.Printf("Error committing API key rotation: %v", err)
+			http.Error(w, "Failed to rotate key", http.StatusInternalServerError)
+			return
+		}
+		auth.ForgetAPIKey(app, id)
+
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+		database.LogAudit(app, adminName, "api_key_rotated",
+			fmt.Sprintf("Rotated API key %q id=%d (prefix=%s) to id=%d (prefix=%s); old key expires %s",
+				name, id, keyPrefix, newID, newPrefix, oldExpiresAt.Format(time.RFC3339)),
+			r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":           newID,
+			"name":         name,
+			"key":          apiKey, // Only returned once!
+			"prefix":       newPrefix,
+			"oldExpiresAt": oldExpiresAt,
+		})
+	}
+}
+
+// APIKeyUsageHandler returns the recent usage history of an API key (GET ?id=).
+func APIKeyUsageHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, ok := apiKeyID(w, r)
+		if !ok {
+			return
+		}
+
+		limit := defaultUsageLimit
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+			limit = min(l, maxUsageLimit)
+		}
+
+		usage, err := database.ListAPIKeyUsage(app, id, limit)
+		if err != nil {
+			log.Printf("Error listing API key usage: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(usage)
+	}
+}
+
 func deleteAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
 	if idStr == "" {
@@ -183,6 +486,7 @@ func deleteAPIKey(app *server.App, w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Key not found", http.StatusNotFound)
 		return
 	}
+	auth.ForgetAPIKey(app, id)
 
 	adminUser := auth.GetUserFromContext(r)
 	adminName := ""
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/middleware"
+	"dashgate/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+	app := newTestApp(t)
+	app.SystemConfig.APIKeyEnabled = true
+	app.SystemConfig.AdminGroup = "admin"
+
+	createKey := func(permissions []string) string {
+		t.Helper()
+		w := postJSON(t, APIKeysHandler(app), "/api/admin/api-keys", map[string]interface{}{
+			"name": "test", "username": "robot", "groups": []string{"admin"}, "permissions": permissions,
+		}, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("create key %v: %d %s", permissions, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Key string `json:"key"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp.Key
+	}
+
+	if w := postJSON(t, APIKeysHandler(app), "/api/admin/api-keys", map[string]interface{}{
+		"name": "bad", "permissions": []string{"root"},
+	}, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown scope: got %d, want 400", w.Code)
+	}
+
+	readKey := createKey(nil)
+	appsKey := createKey([]string{auth.ScopeAppsWrite})
+	adminKey := createKey([]string{auth.ScopeAdmin})
+
+	// Keys created before scopes existed keep read-only access
+	legacyKey := "legacy-key-0123456789abcdef"
+	hash, _ := bcrypt.GenerateFromPassword([]byte(legacyKey), bcrypt.MinCost)
+	if _, err := app.DB.Exec(`INSERT INTO api_keys (name, key_hash, key_prefix, username, groups, permissions) VALUES ('old', ?, ?, 'robot', '["admin"]', '["read"]')`,
+		string(hash), legacyKey[:8]); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	routes := map[string]http.HandlerFunc{
+		"admin":   auth.RequireAdmin(app, ok),
+		"apps":    auth.RequireAdminScope(app, auth.ScopeAppsWrite, ok),
+		"account": auth.RequireAuth(app, ok),
+		"health":  auth.RequireScope(app, auth.ScopeHealthRead, ok),
+		"page":    auth.BrowserOnly(app, ok),
+	}
+
+	tests := []struct {
+		key   string
+		route string
+		want  int
+	}{
+		{readKey, "health", http.StatusOK},
+		{readKey, "apps", http.StatusForbidden},
+		{readKey, "admin", http.StatusForbidden},
+		{legacyKey, "health", http.StatusOK},
+		{legacyKey, "admin", http.StatusForbidden},
+		{appsKey, "apps", http.StatusOK},
+		{appsKey, "admin", http.StatusForbidden},
+		{appsKey, "health", http.StatusForbidden},
+		{adminKey, "admin", http.StatusOK},
+		{adminKey, "apps", http.StatusOK},
+		{adminKey, "health", http.StatusOK},
+		{adminKey, "account", http.StatusForbidden},
+		{adminKey, "page", http.StatusForbidden},
+	}
+	names := map[string]string{readKey: "default", appsKey: "apps:write", adminKey: "admin", legacyKey: "legacy read"}
+	for _, tt := range tests {
+		t.Run(names[tt.key]+" key on "+tt.route, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.key)
+			w := httptest.NewRecorder()
+			routes[tt.route](w, r)
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIKeyRestrictionsAndRotation(t *testing.T) {
+	app := newTestApp(t)
+	app.SystemConfig.APIKeyEnabled = true
+
+	if w := postJSON(t, APIKeysHandler(app), "/api/admin/api-keys", map[string]interface{}{
+		"name": "bad", "allowedCidrs": []string{"10.0.0.0/33"},
+	}, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid CIDR: got %d, want 400", w.Code)
+	}
+
+	w := postJSON(t, APIKeysHandler(app), "/api/admin/api-keys", map[string]interface{}{
+		"name": "monitor", "allowedCidrs": []string{"10.0.0.0/8", "192.168.1.5"}, "rateLimit": 2,
+	}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create key: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		ID  int    `json:"id"`
+		Key string `json:"key"`
+	}
+	json.NewDecoder(w.Body).Decode(&created)
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	health := middleware.APIKeyAuth(app)(auth.RequireScope(app, auth.ScopeHealthRead, ok))
+	call := func(key, remoteAddr string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		health.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       int
+	}{
+		{"outside allowlist", "172.16.0.1:4000", http.StatusForbidden},
+		{"inside allowed network", "10.1.2.3:4000", http.StatusOK},
+		{"single allowed address", "192.168.1.5:4000", http.StatusOK},
+		{"over rate limit", "10.1.2.3:4000", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := call(created.Key, tt.remoteAddr); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	usage, err := database.ListAPIKeyUsage(app, created.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 4 || usage[0].Status != http.StatusTooManyRequests || usage[0].IP != "10.1.2.3" || usage[0].Path != "/api/health" {
+		t.Errorf("usage history = %+v", usage)
+	}
+
+	w = postJSON(t, APIKeyRotateHandler(app), "/api/admin/api-keys/rotate?id="+strconv.Itoa(created.ID), map[string]int{"graceHours": 1}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rotate: %d %s", w.Code, w.Body.String())
+	}
+	var rotated struct {
+		ID  int    `json:"id"`
+		Key string `json:"key"`
+	}
+	json.NewDecoder(w.Body).Decode(&rotated)
+	if w := postJSON(t, APIKeyRotateHandler(app), "/api/admin/api-keys/rotate?id="+strconv.Itoa(created.ID), nil, nil); w.Code != http.StatusConflict {
+		t.Errorf("second rotation: got %d, want 409", w.Code)
+	}
+
+	// The new key keeps the allowlist; the old one is still valid during the grace period
+	if got := call(rotated.Key, "172.16.0.1:4000"); got != http.StatusForbidden {
+		t.Errorf("rotated key outside allowlist: got %d, want 403", got)
+	}
+	if got := call(rotated.Key, "10.1.2.3:4000"); got != http.StatusOK {
+		t.Errorf("rotated key: got %d, want 200", got)
+	}
+	app.APIKeyWindows = nil
+	if got := call(created.Key, "10.1.2.3:4000"); got != http.StatusOK {
+		t.Errorf("old key during grace period: got %d, want 200", got)
+	}
+
+	// Keys unused for longer than the stale threshold are flagged
+	app.DB.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now().AddDate(0, 0, -100), created.ID)
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/api-keys", nil)
+	w = httptest.NewRecorder()
+	APIKeysHandler(app)(w, r)
+	var keys []models.APIKey
+	json.NewDecoder(w.Body).Decode(&keys)
+	for _, k := range keys {
+		if want := k.ID == created.ID; k.Stale != want {
+			t.Errorf("key %d stale = %v, want %v", k.ID, k.Stale, want)
+		}
+		if k.ID == created.ID && (k.ReplacedBy == nil || *k.ReplacedBy != rotated.ID || k.ExpiresAt == nil || time.Until(*k.ExpiresAt) > time.Hour) {
+			t.Errorf("rotated key not scheduled to expire: %+v", k)
+		}
+	}
+}
+
+func TestAPIKeyVerification(t *testing.T) {
+	app := newTestApp(t)
+	app.SystemConfig.APIKeyEnabled = true
+
+	valid := func(key string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+		r.Header.Set("X-API-Key", key)
+		return auth.GetAPIKeyUser(app, r) != nil
+	}
+
+	// A key created before SHA-256 digests is verified with bcrypt once, then rewritten
+	legacyKey := "legacy-key-0123456789abcdef"
+	hash, _ := bcrypt.GenerateFromPassword([]byte(legacyKey), bcrypt.MinCost)
+	res, err := app.DB.Exec(`INSERT INTO api_keys (name, key_hash, key_prefix, username) VALUES ('old', ?, ?, 'robot')`, string(hash), legacyKey[:8])
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyID, _ := res.LastInsertId()
+	if !valid(legacyKey) {
+		t.Fatal("legacy bcrypt key rejected")
+	}
+	var stored string
+	app.DB.QueryRow("SELECT key_hash FROM api_keys WHERE id = ?", legacyID).Scan(&stored)
+	if stored != auth.HashAPIKey(legacyKey) {
+		t.Errorf("legacy key hash not migrated: %q", stored)
+	}
+
+	w := postJSON(t, APIKeysHandler(app), "/api/admin/api-keys", map[string]interface{}{"name": "ha"}, nil)
+	var created struct {
+		ID     int    `json:"id"`
+		Key    string `json:"key"`
+		Prefix string `json:"prefix"`
+	}
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Prefix != auth.APIKeyLookupID(created.Key) || len(created.Prefix) <= 8 {
+		t.Fatalf("new key %q stored with prefix %q", created.Key, created.Prefix)
+	}
+	valid(created.Key) // warm the cache
+
+	tests := []struct {
+		name string
+		key  string
+		cold bool
+		want bool
+	}{
+		{"migrated key from the database", legacyKey, true, true},
+		{"new key from the cache", created.Key, false, true},
+		{"new key from the database", created.Key, true, true},
+		{"wrong secret for a known key ID", created.Prefix + "_" + strings.Repeat("A", 43), false, false},
+		{"truncated key", created.Key[:len(created.Key)-1], false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cold {
+				app.APIKeyCache = nil
+			}
+			if got := valid(tt.key); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Deleting a key takes effect immediately even though it is cached
+	r := httptest.NewRequest(http.MethodDelete, "/api/admin/api-keys?id="+strconv.Itoa(created.ID), nil)
+	APIKeysHandler(app)(httptest.NewRecorder(), r)
+	if valid(created.Key) {
+		t.Error("deleted key still accepted from the cache")
+	}
+}
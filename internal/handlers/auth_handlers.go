@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"dashgate/internal/auth"
@@ -28,8 +34,15 @@ func LoginHandler(app *server.App) http.HandlerFunc {
 				return
 			}
 
+			// Where to go after signing in, e.g. an app protected by forward-auth
+			returnTo := loginReturnURL(app, r.URL.Query().Get("rd"))
+
 			// Check if already logged in
 			if user := auth.GetAuthenticatedUser(app, r); user != nil {
+				if returnTo != "" {
+					http.Redirect(w, r, returnTo, http.StatusFound)
+					return
+				}
 				http.Redirect(w, r, "/", http.StatusFound)
 				return
 			}
@@ -37,12 +50,14 @@ func LoginHandler(app *server.App) http.HandlerFunc {
 			// Pass auth options to template
 			app.SysConfigMu.RLock()
 			data := map[string]interface{}{
-				"OIDCEnabled": app.SystemConfig.OIDCAuthEnabled && app.OIDCProvider != nil,
 				"LDAPEnabled": app.SystemConfig.LDAPAuthEnabled && app.LDAPAuth != nil,
 				"CSPNonce":    middleware.GetCSPNonce(r),
 				"Version":     app.Version,
 			}
 			app.SysConfigMu.RUnlock()
+			data["OIDCProviders"] = auth.OIDCProviders(app)
+			data["PasskeyEnabled"] = passkeysAvailable(app)
+			data["ReturnTo"] = returnTo
 
 			w.Header().Set("Content-Type", "text/html; charset=utf-8")
 			if err := app.GetTemplates().ExecuteTemplate(w, "login.html", data); err != nil {
@@ -78,6 +93,12 @@ func LoginHandler(app *server.App) http.HandlerFunc {
 			return
 		}
 
+		// Slow down repeated failures for this username, from any address
+		if wait := database.LoginRetryAfter(app, req.Username); wait > 0 {
+			loginThrottled(w, wait)
+			return
+		}
+
 		var authUser *models.AuthenticatedUser
 		var userID int
 
@@ -106,7 +127,6 @@ func LoginHandler(app *server.App) http.HandlerFunc {
 						Groups:      groups,
 						Source:      "local",
 					}
-					authUser.IsAdmin = auth.CheckIsAdmin(app, authUser.Groups)
 				}
 			}
 		}
@@ -121,24 +141,27 @@ func LoginHandler(app *server.App) http.HandlerFunc {
 			if err == nil {
 				authUser = ldapUser
 
-				// Create or update local user record for LDAP user using upsert to avoid race conditions
+				// Create or update local user record for LDAP user using upsert to avoid race conditions.
+				// The directory's username is used, so UPN and DOMAIN\user logins share one record.
+				// A user the directory sync disabled is back in the directory, so is enabled again.
 				groupsJSON, _ := json.Marshal(authUser.Groups)
 				_, err = app.DB.Exec(
 					`INSERT INTO users (username, email, password_hash, display_name, groups)
-					 VALUES (?, ?, 'LDAP_USER', ?, ?)
+					 VALUES (?, NULLIF(?, ''), 'LDAP_USER', ?, ?)
 					 ON CONFLICT(username) DO UPDATE SET
 					   email = excluded.email,
 					   display_name = excluded.display_name,
 					   groups = excluded.groups,
+					   disabled = 0,
 					   updated_at = ?`,
-					req.Username, authUser.Email, authUser.DisplayName, string(groupsJSON), time.Now(),
+					authUser.Username, authUser.Email, authUser.DisplayName, string(groupsJSON), time.Now(),
 				)
 				if err != nil {
 					log.Printf("Failed to upsert LDAP user: %v", err)
 					http.Error(w, "Internal server error", http.StatusInternalServerError)
 					return
 				}
-				err = app.DB.QueryRow("SELECT id FROM users WHERE username = ?", req.Username).Scan(&userID)
+				err = app.DB.QueryRow("SELECT id FROM users WHERE username = ?", authUser.Username).Scan(&userID)
 				if err != nil {
 					log.Printf("Failed to retrieve LDAP user ID: %v", err)
 					http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -148,54 +171,107 @@ func LoginHandler(app *server.App) http.HandlerFunc {
 		}
 
 		if authUser == nil {
+			recordLoginFailure(app, r, req.Username)
 			http.Error(w, "Invalid username or password", http.StatusUnauthorized)
 			return
 		}
 
-		// Invalidate any existing sessions for this user to prevent session fixation
-		database.InvalidateUserSessions(app, userID)
+		// LDAP groups were stored as received; map them for the admin policy check
+		authUser = auth.ResolveUser(app, authUser)
 
-		// Create session
-		token, err := auth.GenerateSessionToken()
+		// Ask for a second factor if the user enrolled in TOTP or policy requires it
+		status, err := totpChallengeStatus(app, userID, authUser)
 		if err != nil {
-			log.Printf("Error generating session token: %v", err)
+			log.Printf("Error checking two-factor status: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		if status != "" {
+			challenge, err := database.CreateLoginChallenge(app, userID)
+			if err != nil {
+				log.Printf("Error creating login challenge: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": status, "challenge": challenge})
+			return
+		}
 
-		app.SysConfigMu.RLock()
-		sessionDuration := app.AuthConfig.SessionDuration
-		cookieName := app.AuthConfig.CookieName
-		cookieSecure := app.AuthConfig.CookieSecure
-		app.SysConfigMu.RUnlock()
+		// Only a complete sign-in clears the failure count, so a known
+		// password cannot be used to reset attempts at the second factor
+		database.ResetLoginFailures(app, req.Username)
 
-		expiresAt := time.Now().Add(time.Duration(sessionDuration) * 24 * time.Hour)
-		_, err = app.DB.Exec(
-			"INSERT INTO sessions (user_id, token, expires_at) VALUES (?, ?, ?)",
-			userID, token, expiresAt,
-		)
-		if err != nil {
+		if err := createLoginSession(app, w, r, userID); err != nil {
 			log.Printf("Error creating session: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		// Set cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     cookieName,
-			Value:    token,
-			Path:     "/",
-			Expires:  expiresAt,
-			HttpOnly: true,
-			Secure:   cookieSecure,
-			SameSite: http.SameSiteLaxMode,
-		})
-
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok", "redirect": "/"})
 	}
 }
 
+// loginThrottled rejects a sign-in attempt for an account that must wait
+// before trying again.
+func loginThrottled(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many failed sign-in attempts. Please try again later.", http.StatusTooManyRequests)
+}
+
+// recordLoginFailure counts a failed sign-in against username and audits the
+// attempt that locks the account.
+func recordLoginFailure(app *server.App, r *http.Request, username string) {
+	ip := auth.ClientIP(app, r)
+	locked, err := database.RecordLoginFailure(app, username, ip)
+	if err != nil {
+		log.Printf("Error recording login failure: %v", err)
+		return
+	}
+	if locked {
+		log.Printf("Account %q locked after repeated failed sign-ins (last from %s)", username, ip)
+		database.LogAudit(app, username, "account_locked", "Locked after too many failed sign-in attempts", ip)
+	}
+}
+
+// createLoginSession starts a new session for the user and sets the session
+// cookie. Sessions on other devices are kept; only the session the request
+// arrived with (if any) is replaced, so a planted cookie cannot be fixated.
+func createLoginSession(app *server.App, w http.ResponseWriter, r *http.Request, userID int) error {
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		return err
+	}
+
+	app.SysConfigMu.RLock()
+	cookieName := app.AuthConfig.CookieName
+	cookieSecure := app.AuthConfig.CookieSecure
+	cookieDomain := app.AuthConfig.CookieDomain
+	app.SysConfigMu.RUnlock()
+
+	expiresAt := auth.NewSessionExpiry(app)
+	if cookie, err := r.Cookie(cookieName); err == nil {
+		app.DB.Exec("DELETE FROM sessions WHERE token = ?", cookie.Value)
+	}
+	if err := database.CreateSession(app, userID, token, expiresAt, auth.ClientIP(app, r), auth.SessionUserAgent(r)); err != nil {
+		return err
+	}
+
+	// Set cookie
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   cookieDomain,
+		Expires:  auth.SessionCookieExpiry(app),
+		HttpOnly: true,
+		Secure:   cookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
 // LogoutHandler deletes the user's session and clears the cookie.
 func LogoutHandler(app *server.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -207,11 +283,21 @@ func LogoutHandler(app *server.App) http.HandlerFunc {
 		app.SysConfigMu.RLock()
 		cookieName := app.AuthConfig.CookieName
 		cookieSecure := app.AuthConfig.CookieSecure
+		cookieDomain := app.AuthConfig.CookieDomain
 		app.SysConfigMu.RUnlock()
 
 		// Get session cookie
 		cookie, err := r.Cookie(cookieName)
+		logoutURL := ""
 		if err == nil && app.DB != nil {
+			// OIDC sessions also end the session at the provider
+			var idToken, providerID string
+			app.DB.QueryRow("SELECT COALESCE(oidc_id_token, ''), COALESCE(oidc_provider, '') FROM sessions WHERE token = ?", cookie.Value).
+				Scan(&idToken, &providerID)
+			if idToken = auth.DecryptSessionToken(app, idToken); idToken != "" {
+				logoutURL = oidcLogoutURL(app, r, providerID, idToken)
+			}
+
 			// Delete session from database
 			if _, execErr := app.DB.Exec("DELETE FROM sessions WHERE token = ?", cookie.Value); execErr != nil {
 				log.Printf("Error deleting session during logout: %v", execErr)
@@ -223,14 +309,89 @@ func LogoutHandler(app *server.App) http.HandlerFunc {
 			Name:     cookieName,
 			Value:    "",
 			Path:     "/",
+			Domain:   cookieDomain,
 			MaxAge:   -1,
 			HttpOnly: true,
 			Secure:   cookieSecure,
 			SameSite: http.SameSiteLaxMode,
 		})
 
+		resp := map[string]string{"status": "ok"}
+		if logoutURL != "" {
+			resp["redirect"] = logoutURL
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// oidcLogoutURL returns the provider's end-session URL for an OIDC session,
+// which ends the session at the provider and returns to the login page, or
+// "" if the provider does not support RP-initiated logout.
+func oidcLogoutURL(app *server.App, r *http.Request, providerID, idToken string) string {
+	endpoint, clientID := auth.OIDCEndSessionEndpoint(app, providerID)
+	if endpoint == "" {
+		return ""
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		log.Printf("Invalid OIDC end_session_endpoint %q: %v", endpoint, err)
+		return ""
+	}
+
+	q := u.Query()
+	q.Set("id_token_hint", idToken)
+	q.Set("client_id", clientID)
+	q.Set("post_logout_redirect_uri", adminLinkBaseURL(app, r)+"/login")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// OIDCBackChannelLogoutHandler lets an OIDC provider end DashGate sessions
+// (POST with a logout_token to /auth/oidc/backchannel-logout/<provider ID>)
+// when the user signs out at the provider or in another application. The bare
+// path serves the first provider.
+func OIDCBackChannelLogoutHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if app.DB == nil {
+			http.Error(w, "OIDC authentication unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		providerID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/auth/oidc/backchannel-logout"), "/")
+		logout, err := auth.VerifyOIDCLogoutToken(r.Context(), app, providerID, r.PostFormValue("logout_token"))
+		if err != nil {
+			log.Printf("Rejected OIDC back-channel logout: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request"})
+			return
+		}
+
+		// A sid ends that provider session only; a bare sub ends all of the user's sessions
+		var result sql.Result
+		if logout.SessionID != "" {
+			result, err = app.DB.Exec("DELETE FROM sessions WHERE oidc_provider = ? AND oidc_sid = ? AND oidc_sub != '' AND (? = '' OR oidc_sub = ?)",
+				logout.Provider, logout.SessionID, logout.Subject, logout.Subject)
+		} else {
+			result, err = app.DB.Exec("DELETE FROM sessions WHERE oidc_provider = ? AND oidc_sub = ?", logout.Provider, logout.Subject)
+		}
+		if err != nil {
+			log.Printf("Error deleting sessions for OIDC back-channel logout: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		ended, _ := result.RowsAffected()
+		database.LogAudit(app, "", "oidc_backchannel_logout",
+			fmt.Sprintf("Provider %q ended %d session(s) for sub=%q sid=%q", logout.Provider, ended, logout.Subject, logout.SessionID),
+			auth.ClientIP(app, r))
+		w.WriteHeader(http.StatusOK)
 	}
 }
 
@@ -265,10 +426,16 @@ func AuthConfigHandler(app *server.App) http.HandlerFunc {
 		cfg := map[string]interface{}{
 			"localEnabled": app.SystemConfig.LocalAuthEnabled,
 			"ldapEnabled":  app.SystemConfig.LDAPAuthEnabled,
-			"oidcEnabled":  app.SystemConfig.OIDCAuthEnabled,
 			"proxyEnabled": app.SystemConfig.ProxyAuthEnabled,
 		}
 		app.SysConfigMu.RUnlock()
+		providers := []map[string]string{}
+		for _, p := range auth.OIDCProviders(app) {
+			providers = append(providers, map[string]string{"id": p.ID, "displayName": p.DisplayName, "icon": p.Icon})
+		}
+		cfg["oidcEnabled"] = len(providers) > 0
+		cfg["oidcProviders"] = providers
+		cfg["passwordResetEnabled"] = app.DB != nil && emailResetAvailable(app)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(cfg)
@@ -98,7 +98,7 @@ func DashboardHandler(app *server.App) http.HandlerFunc {
 			}
 		}
 
-		// Add discovered apps that have overrides (opt-in model)
+		// Add discovered apps that have overrides or matching rules (opt-in model)
 		userGroupSet := make(map[string]bool)
 		for _, g := range user.Groups {
 			userGroupSet[strings.TrimSpace(g)] = true
@@ -112,18 +112,19 @@ func DashboardHandler(app *server.App) http.HandlerFunc {
 			if configURLs[dApp.URL] {
 				continue
 			}
-			// Skip if no override (not configured = not shown)
-			if dApp.Override == nil {
+			// Skip if neither an override nor a rule applies (not configured = not shown)
+			override := dApp.Effective
+			if override == nil {
 				continue
 			}
 			// Skip if hidden
-			if dApp.Override.Hidden {
+			if override.Hidden {
 				continue
 			}
 			// Check group access (admins see all; no groups = visible to all)
-			if !user.IsAdmin && len(dApp.Override.Groups) > 0 {
+			if !user.IsAdmin && len(override.Groups) > 0 {
 				hasAccess := false
-				for _, g := range dApp.Override.Groups {
+				for _, g := range override.Groups {
 					if userGroupSet[g] {
 						hasAccess = true
 						break
@@ -136,23 +137,23 @@ func DashboardHandler(app *server.App) http.HandlerFunc {
 
 			// Apply overrides
 			name := dApp.Name
-			if dApp.Override.NameOverride != "" {
-				name = dApp.Override.NameOverride
+			if override.NameOverride != "" {
+				name = override.NameOverride
 			}
 			appURL := dApp.URL
-			if dApp.Override.URLOverride != "" {
-				appURL = dApp.Override.URLOverride
+			if override.URLOverride != "" {
+				appURL = override.URLOverride
 			}
 			icon := dApp.Icon
-			if dApp.Override.IconOverride != "" {
-				icon = dApp.Override.IconOverride
+			if override.IconOverride != "" {
+				icon = override.IconOverride
 			}
 			desc := dApp.Description
-			if dApp.Override.DescriptionOverride != "" {
-				desc = dApp.Override.DescriptionOverride
+			if override.DescriptionOverride != "" {
+				desc = override.DescriptionOverride
 			}
 
-			category := dApp.Override.Category
+			category := override.Category
 			if category == "" {
 				category = "Discovered"
 			}
@@ -162,7 +163,7 @@ func DashboardHandler(app *server.App) http.HandlerFunc {
 				URL:         appURL,
 				Icon:        icon,
 				Description: desc,
-				Groups:      dApp.Override.Groups,
+				Groups:      override.Groups,
 				Status:      health.GetHealthStatus(app, appURL),
 			}
 			discoveredByCategory[category] = append(discoveredByCategory[category], a)
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/discovery"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// DiscoveryRulesHandler manages rule-based auto-overrides for discovered apps
+// (GET list, POST create, PUT update, DELETE by id).
+func DiscoveryRulesHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(database.GetDiscoveryRules(app))
+
+		case http.MethodPost, http.MethodPut:
+			var rule models.DiscoveryRule
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if r.Method == http.MethodPost {
+				rule.ID = 0
+			} else if rule.ID == 0 {
+				http.Error(w, "Rule ID is required", http.StatusBadRequest)
+				return
+			}
+			if err := discovery.ValidateRule(rule); err != nil {
+				http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := database.SaveDiscoveryRule(app, &rule); err != nil {
+				log.Printf("Failed to save discovery rule: %v", err)
+				http.Error(w, "Failed to save rule", http.StatusInternalServerError)
+				return
+			}
+
+			action := "discovery_rule_updated"
+			if r.Method == http.MethodPost {
+				action = "discovery_rule_created"
+			}
+			database.LogAudit(app, adminName, action, fmt.Sprintf("Saved discovery rule %q (id=%d)", rule.Name, rule.ID), r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rule)
+
+		case http.MethodDelete:
+			id, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err != nil || id <= 0 {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			if err := database.DeleteDiscoveryRule(app, id); err != nil {
+				log.Printf("Failed to delete discovery rule: %v", err)
+				http.Error(w, "Failed to delete rule", http.StatusInternalServerError)
+				return
+			}
+			database.LogAudit(app, adminName, "discovery_rule_deleted", fmt.Sprintf("Deleted discovery rule id=%d", id), r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// DiscoveryRulesReorderHandler sets the evaluation order of discovery rules
+// from an ordered list of rule IDs.
+func DiscoveryRulesReorderHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			IDs []int `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.ReorderDiscoveryRules(app, req.IDs); err != nil {
+			log.Printf("Failed to reorder discovery rules: %v", err)
+			http.Error(w, "Failed to reorder rules", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(database.GetDiscoveryRules(app))
+	}
+}
+
+// DiscoveryRulesPreviewHandler shows which discovered apps each rule matches.
+// GET previews all saved rules; POST previews a single unsaved rule from the body.
+func DiscoveryRulesPreviewHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type previewMatch struct {
+			Name           string                        `json:"name"`
+			URL            string                        `json:"url"`
+			Source         string                        `json:"source"`
+			Result         *models.DiscoveredAppOverride `json:"result"`
+			ManualOverride bool                          `json:"manualOverride"`
+		}
+		type rulePreview struct {
+			Rule    models.DiscoveryRule `json:"rule"`
+			Matches []previewMatch       `json:"matches"`
+		}
+
+		var rules []models.DiscoveryRule
+		switch r.Method {
+		case http.MethodGet:
+			rules = database.GetDiscoveryRules(app)
+		case http.MethodPost:
+			var rule models.DiscoveryRule
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if err := discovery.ValidateRule(rule); err != nil {
+				http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			// Preview as if enabled so admins can test a rule before activating it
+			rule.Enabled = true
+			rules = []models.DiscoveryRule{rule}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rawApps := discovery.GetAllRawDiscoveredApps(app)
+		previews := make([]rulePreview, 0, len(rules))
+		for _, rule := range rules {
+			p := rulePreview{Rule: rule, Matches: []previewMatch{}}
+			for _, dApp := range rawApps {
+				if !discovery.MatchRule(rule, dApp) {
+					continue
+				}
+				result, _ := discovery.ApplyRules([]models.DiscoveryRule{rule}, dApp)
+				p.Matches = append(p.Matches, previewMatch{
+					Name:           dApp.Name,
+					URL:            dApp.URL,
+					Source:         dApp.Source,
+					Result:         result,
+					ManualOverride: dApp.Override != nil,
+				})
+			}
+			previews = append(previews, p)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(previews)
+	}
+}
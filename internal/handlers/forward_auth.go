@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/config"
+	"dashgate/internal/discovery"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// protectedApp is the dashboard app a forward-auth request targets.
+type protectedApp struct {
+	Name   string
+	Groups []string
+	// AdminOnlyWhenUngrouped mirrors the dashboard: catalog apps without
+	// groups are admin-only, discovered apps without groups are visible to all.
+	AdminOnlyWhenUngrouped bool
+}
+
+// forwardedTarget reconstructs the URL the client requested at the proxy from
+// X-Forwarded-Proto/Host/Uri (Traefik, Caddy) or X-Original-URL (nginx).
+func forwardedTarget(r *http.Request) (*url.URL, bool) {
+	if host := firstHeaderValue(r.Header.Get("X-Forwarded-Host")); host != "" {
+		scheme := strings.ToLower(firstHeaderValue(r.Header.Get("X-Forwarded-Proto")))
+		if scheme != "http" && scheme != "https" {
+			scheme = "https"
+		}
+		uri := r.Header.Get("X-Forwarded-Uri")
+		if !strings.HasPrefix(uri, "/") {
+			uri = "/" + uri
+		}
+		u, err := url.Parse(scheme + "://" + host + uri)
+		return u, err == nil && u.Host != ""
+	}
+	if original := r.Header.Get("X-Original-URL"); original != "" {
+		u, err := url.Parse(original)
+		return u, err == nil && u.Host != "" && (u.Scheme == "http" || u.Scheme == "https")
+	}
+	return nil, false
+}
+
+// firstHeaderValue returns the first entry of a comma-separated header added
+// to by several proxies.
+func firstHeaderValue(v string) string {
+	if i := strings.Index(v, ","); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(v)
+}
+
+// urlMatchScore reports whether target falls under appURL (same host, and
+// same port if both specify one, path at or below the app's path). The score
+// is the length of the matched path so the most specific app wins.
+func urlMatchScore(appURL string, target *url.URL) int {
+	u, err := url.Parse(appURL)
+	if err != nil || u.Host == "" {
+		return -1
+	}
+	if !strings.EqualFold(u.Hostname(), target.Hostname()) {
+		return -1
+	}
+	if u.Port() != "" && target.Port() != "" && u.Port() != target.Port() {
+		return -1
+	}
+	appPath := strings.TrimRight(u.Path, "/")
+	if appPath != "" && target.Path != appPath && !strings.HasPrefix(target.Path, appPath+"/") {
+		return -1
+	}
+	return len(appPath)
+}
+
+// findProtectedApp looks up the catalog or discovered app serving target.
+func findProtectedApp(app *server.App, target *url.URL) *protectedApp {
+	var best *protectedApp
+	bestScore := -1
+
+	app.ConfigMu.RLock()
+	categories := app.Config.Categories
+	app.ConfigMu.RUnlock()
+	for _, cat := range categories {
+		for _, a := range cat.Apps {
+			if score := urlMatchScore(a.URL, target); score > bestScore {
+				bestScore = score
+				best = &protectedApp{Name: a.Name, Groups: config.GetAppGroups(app, a), AdminOnlyWhenUngrouped: true}
+			}
+		}
+	}
+
+	for _, d := range discovery.GetAllRawDiscoveredApps(app) {
+		override := d.Effective
+		if override == nil || override.Hidden {
+			continue
+		}
+		appURL := d.URL
+		if override.URLOverride != "" {
+			appURL = override.URLOverride
+		}
+		name := d.Name
+		if override.NameOverride != "" {
+			name = override.NameOverride
+		}
+		if score := urlMatchScore(appURL, target); score > bestScore {
+			bestScore = score
+			best = &protectedApp{Name: name, Groups: override.Groups}
+		}
+	}
+	return best
+}
+
+// canAccessApp applies the dashboard's visibility rules to a forward-auth request.
+func canAccessApp(user *models.AuthenticatedUser, p *protectedApp) bool {
+	if user.IsAdmin {
+		return true
+	}
+	if p == nil {
+		return false
+	}
+	if len(p.Groups) == 0 {
+		return !p.AdminOnlyWhenUngrouped
+	}
+	for _, required := range p.Groups {
+		for _, g := range user.Groups {
+			if strings.TrimSpace(g) == required {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loginReturnURL validates a post-login return address: it must be an
+// http(s) URL on DashGate's own host or on an app DashGate knows about, so
+// the login page cannot be used as an open redirect.
+func loginReturnURL(app *server.App, rd string) string {
+	if rd == "" {
+		return ""
+	}
+	target, err := url.Parse(rd)
+	if err != nil || target.Host == "" || (target.Scheme != "http" && target.Scheme != "https") || target.User != nil {
+		return ""
+	}
+
+	app.SysConfigMu.RLock()
+	externalURL := app.SystemConfig.ExternalURL
+	app.SysConfigMu.RUnlock()
+	if externalURL != "" && urlMatchScore(externalURL, target) >= 0 {
+		return target.String()
+	}
+	if findProtectedApp(app, target) != nil {
+		return target.String()
+	}
+	return ""
+}
+
+// ForwardAuthHandler implements the forward-auth / auth_request protocol for
+// reverse proxies. It authenticates the session cookie or API key, resolves the
+// target app from the forwarded headers and answers 200 with Remote-User,
+// Remote-Groups, Remote-Name and Remote-Email headers, 401 (or a 302 to the
+// login page for browsers) when not signed in, or 403 when the user's groups do
+// not grant access or the API key lacks the apps:access scope. Targets that
+// match no known app are admin-only.
+//
+// Redirects require the external URL to be set; pass ?redirect=false for
+// nginx auth_request, which only understands 2xx/401/403.
+func ForwardAuthHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		target, ok := forwardedTarget(r)
+		if !ok {
+			http.Error(w, "Missing X-Forwarded-Host or X-Original-URL header", http.StatusBadRequest)
+			return
+		}
+
+		// A key without the scope is refused rather than treated as signed out,
+		// so it does not fall back to a session cookie sent with it
+		if key := auth.GetAPIKeyUser(app, r); key != nil && !auth.HasScope(key, auth.ScopeAppsAccess) {
+			http.Error(w, fmt.Sprintf("Forbidden: API key lacks the %q scope", auth.ScopeAppsAccess), http.StatusForbidden)
+			return
+		}
+
+		user := auth.GetCredentialUser(app, r)
+		if user == nil {
+			app.SysConfigMu.RLock()
+			externalURL := app.SystemConfig.ExternalURL
+			app.SysConfigMu.RUnlock()
+
+			browser := strings.Contains(r.Header.Get("Accept"), "text/html")
+			if externalURL != "" && browser && r.URL.Query().Get("redirect") != "false" {
+				http.Redirect(w, r, externalURL+"/login?rd="+url.QueryEscape(target.String()), http.StatusFound)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !canAccessApp(user, findProtectedApp(app, target)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Remote-User", user.Username)
+		w.Header().Set("Remote-Groups", strings.Join(user.Groups, ","))
+		w.Header().Set("Remote-Name", user.DisplayName)
+		w.Header().Set("Remote-Email", user.Email)
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/models"
+)
+
+func TestForwardAuthHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.Config = models.Config{Categories: []models.Category{{
+		Name: "Apps",
+		Apps: []models.App{
+			{Name: "Sonarr", URL: "https://sonarr.example.com", Groups: []string{"media"}},
+			{Name: "Portainer", URL: "https://tools.example.com/portainer"},
+			{Name: "Wiki", URL: "https://tools.example.com/wiki", Groups: []string{"media"}},
+		},
+	}}}
+
+	res, err := app.DB.Exec("INSERT INTO users (username, email, display_name, password_hash, groups) VALUES ('alice', 'alice@example.com', 'Alice', 'x', '[\"media\"]')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := res.LastInsertId()
+	rec := httptest.NewRecorder()
+	if err := createLoginSession(app, rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", nil), int(userID)); err != nil {
+		t.Fatal(err)
+	}
+	session := rec.Result().Cookies()[0]
+
+	tests := []struct {
+		name     string
+		query    string
+		headers  map[string]string
+		signedIn bool
+		wantCode int
+		wantLoc  string
+	}{
+		{"missing target headers", "", nil, true, http.StatusBadRequest, ""},
+		{"browser without session is redirected", "", map[string]string{"X-Forwarded-Host": "sonarr.example.com", "X-Forwarded-Uri": "/calendar", "Accept": "text/html"}, false, http.StatusFound,
+			"https://dash.example.com/login?rd=https%3A%2F%2Fsonarr.example.com%2Fcalendar"},
+		{"redirect disabled for auth_request", "?redirect=false", map[string]string{"X-Forwarded-Host": "sonarr.example.com", "Accept": "text/html"}, false, http.StatusUnauthorized, ""},
+		{"api client without session", "", map[string]string{"X-Forwarded-Host": "sonarr.example.com"}, false, http.StatusUnauthorized, ""},
+		{"group grants access", "", map[string]string{"X-Forwarded-Host": "sonarr.example.com", "X-Forwarded-Uri": "/api/queue"}, true, http.StatusOK, ""},
+		{"nginx original url", "", map[string]string{"X-Original-URL": "https://sonarr.example.com/"}, true, http.StatusOK, ""},
+		{"ungrouped catalog app is admin-only", "", map[string]string{"X-Forwarded-Host": "tools.example.com", "X-Forwarded-Uri": "/portainer/"}, true, http.StatusForbidden, ""},
+		{"longest path prefix wins", "", map[string]string{"X-Forwarded-Host": "tools.example.com", "X-Forwarded-Uri": "/wiki/page"}, true, http.StatusOK, ""},
+		{"path prefix must end at a segment", "", map[string]string{"X-Forwarded-Host": "tools.example.com", "X-Forwarded-Uri": "/wikipedia"}, true, http.StatusForbidden, ""},
+		{"unknown app is admin-only", "", map[string]string{"X-Forwarded-Host": "other.example.com"}, true, http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/auth/verify"+tt.query, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if tt.signedIn {
+				req.AddCookie(session)
+			}
+			w := httptest.NewRecorder()
+			ForwardAuthHandler(app)(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d, want %d (%s)", w.Code, tt.wantCode, strings.TrimSpace(w.Body.String()))
+			}
+			if tt.wantLoc != "" && w.Header().Get("Location") != tt.wantLoc {
+				t.Errorf("Location = %q, want %q", w.Header().Get("Location"), tt.wantLoc)
+			}
+			if w.Code == http.StatusOK {
+				if w.Header().Get("Remote-User") != "alice" || w.Header().Get("Remote-Groups") != "media" || w.Header().Get("Remote-Email") != "alice@example.com" {
+					t.Errorf("unexpected identity headers %v", w.Header())
+				}
+			}
+		})
+	}
+
+	// API keys pass forward-auth only with the apps:access scope
+	app.SystemConfig.APIKeyEnabled = true
+	createKey := func(permissions []string) string {
+		t.Helper()
+		w := postJSON(t, APIKeysHandler(app), "/api/admin/api-keys", map[string]interface{}{
+			"name": "proxy", "username": "robot", "groups": []string{"media"}, "permissions": permissions,
+		}, nil)
+		var resp struct {
+			Key string `json:"key"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if resp.Key == "" {
+			t.Fatalf("create key %v: %d %s", permissions, w.Code, w.Body.String())
+		}
+		return resp.Key
+	}
+	keyTests := []struct {
+		name        string
+		permissions []string
+		withSession bool
+		wantCode    int
+	}{
+		{"default scopes", nil, false, http.StatusForbidden},
+		{"health key with a session cookie", []string{auth.ScopeHealthRead}, true, http.StatusForbidden},
+		{"apps:access", []string{auth.ScopeAppsAccess}, false, http.StatusOK},
+	}
+	for _, tt := range keyTests {
+		t.Run("api key "+tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/auth/verify", nil)
+			req.Header.Set("X-Forwarded-Host", "sonarr.example.com")
+			req.Header.Set("X-API-Key", createKey(tt.permissions))
+			if tt.withSession {
+				req.AddCookie(session)
+			}
+			w := httptest.NewRecorder()
+			ForwardAuthHandler(app)(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d, want %d (%s)", w.Code, tt.wantCode, strings.TrimSpace(w.Body.String()))
+			}
+			if w.Code == http.StatusOK && w.Header().Get("Remote-User") != "robot" {
+				t.Errorf("Remote-User = %q, want robot", w.Header().Get("Remote-User"))
+			}
+		})
+	}
+}
+
+func TestLoginReturnURL(t *testing.T) {
+	app := newTestApp(t)
+	app.Config = models.Config{Categories: []models.Category{{
+		Name: "Apps",
+		Apps: []models.App{{Name: "Sonarr", URL: "https://sonarr.example.com"}},
+	}}}
+
+	tests := []struct {
+		rd   string
+		want string
+	}{
+		{"https://sonarr.example.com/calendar", "https://sonarr.example.com/calendar"},
+		{"https://dash.example.com/settings", "https://dash.example.com/settings"},
+		{"https://evil.example.net/", ""},
+		{"https://user@sonarr.example.com/", ""},
+		{"javascript:alert(1)", ""},
+		{"/relative", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := loginReturnURL(app, tt.rd); got != tt.want {
+			t.Errorf("loginReturnURL(%q) = %q, want %q", tt.rd, got, tt.want)
+		}
+	}
+}
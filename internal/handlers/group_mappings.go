@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// GroupMappingsHandler manages the rules that translate groups from external
+// auth sources (GET rules and source settings, POST create, PUT update,
+// DELETE by id).
+func GroupMappingsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"rules":   database.GetGroupMappingRules(app),
+				"sources": database.GetGroupSourceSettings(app, auth.ExternalGroupSources),
+			})
+
+		case http.MethodPost, http.MethodPut:
+			var rule models.GroupMappingRule
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if r.Method == http.MethodPost {
+				rule.ID = 0
+			} else if rule.ID == 0 {
+				http.Error(w, "Rule ID is required", http.StatusBadRequest)
+				return
+			}
+			rule.Match = strings.TrimSpace(rule.Match)
+			rule.Target = strings.TrimSpace(rule.Target)
+			if err := auth.ValidateGroupMappingRule(rule); err != nil {
+				http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := database.SaveGroupMappingRule(app, &rule); err != nil {
+				log.Printf("Failed to save group mapping rule: %v", err)
+				http.Error(w, "Failed to save rule", http.StatusInternalServerError)
+				return
+			}
+
+			action := "group_mapping_updated"
+			if r.Method == http.MethodPost {
+				action = "group_mapping_created"
+			}
+			database.LogAudit(app, adminName, action, fmt.Sprintf("Saved group mapping rule id=%d: %s %q -> %q", rule.ID, rule.Action, rule.Match, rule.Target), r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rule)
+
+		case http.MethodDelete:
+			id, err := strconv.Atoi(r.URL.Query().Get("id"))
+			if err != nil || id <= 0 {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			if err := database.DeleteGroupMappingRule(app, id); err != nil {
+				log.Printf("Failed to delete group mapping rule: %v", err)
+				http.Error(w, "Failed to delete rule", http.StatusInternalServerError)
+				return
+			}
+			database.LogAudit(app, adminName, "group_mapping_deleted", fmt.Sprintf("Deleted group mapping rule id=%d", id), r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// GroupMappingSourceHandler updates the default groups and the unmapped
+// group policy of one external auth source.
+func GroupMappingSourceHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req models.GroupSourceSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if !auth.IsExternalGroupSource(req.Source) {
+			http.Error(w, "Unknown source", http.StatusBadRequest)
+			return
+		}
+		var groups []string
+		for _, g := range req.DefaultGroups {
+			if g = strings.TrimSpace(g); g != "" {
+				groups = append(groups, g)
+			}
+		}
+		req.DefaultGroups = groups
+
+		if err := database.SaveGroupSourceSettings(app, req); err != nil {
+			log.Printf("Failed to save group source settings: %v", err)
+			http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+			return
+		}
+
+		adminName := ""
+		if adminUser := auth.GetUserFromContext(r); adminUser != nil {
+			adminName = adminUser.Username
+		}
+		database.LogAudit(app, adminName, "group_mapping_source_updated",
+			fmt.Sprintf("Updated %s groups: default %v, drop unmapped %v", req.Source, req.DefaultGroups, req.DropUnmapped), r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(database.GetGroupSourceSettings(app, []string{req.Source})[0])
+	}
+}
+
+// GroupMappingTestHandler shows how the saved rules map a list of groups from
+// a source, or the stored groups of an LDAP or OIDC user, and whether the
+// result grants admin access.
+func GroupMappingTestHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Source   string   `json:"source"`
+			Groups   []string `json:"groups"`
+			Username string   `json:"username"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Username != "" {
+			var passwordHash, groupsJSON string
+			err := app.DB.QueryRow("SELECT password_hash, COALESCE(groups, '[]') FROM users WHERE username = ?", req.Username).Scan(&passwordHash, &groupsJSON)
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			} else if err != nil {
+				log.Printf("Failed to load user for group mapping test: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			switch passwordHash {
+			case "LDAP_USER":
+				req.Source = "ldap"
+			case "OIDC_USER":
+				req.Source = "oidc"
+			default:
+				http.Error(w, "Local users' groups are not mapped", http.StatusBadRequest)
+				return
+			}
+			req.Groups = nil
+			json.Unmarshal([]byte(groupsJSON), &req.Groups)
+		}
+		if !auth.IsExternalGroupSource(req.Source) {
+			http.Error(w, "Unknown source", http.StatusBadRequest)
+			return
+		}
+
+		settings := database.GetGroupSourceSettings(app, []string{req.Source})[0]
+		groups, steps := auth.MapGroups(database.GetGroupMappingRules(app), settings, req.Source, req.Groups)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"source":  req.Source,
+			"input":   req.Groups,
+			"groups":  groups,
+			"steps":   steps,
+			"isAdmin": auth.CheckIsAdmin(app, groups),
+		})
+	}
+}
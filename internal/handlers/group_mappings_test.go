@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/models"
+)
+
+func TestGroupMappings(t *testing.T) {
+	app := newTestApp(t)
+	app.SystemConfig.ProxyAuthEnabled = true
+	app.SystemConfig.TrustedProxies = "192.0.2.1"
+	app.TrustedProxyIPs = []net.IP{net.ParseIP("192.0.2.1")}
+
+	proxyUser := func(groups string) *models.AuthenticatedUser {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Remote-User", "bob")
+		r.Header.Set("Remote-Groups", groups)
+		return auth.GetAuthenticatedUser(app, r)
+	}
+	if u := proxyUser("Ops Team"); u == nil || u.IsAdmin {
+		t.Fatalf("before mapping: %+v", u)
+	}
+
+	for _, rule := range []models.GroupMappingRule{
+		{Enabled: true, Source: "authelia", Match: "ops team", Action: auth.GroupActionRename, Target: "admin"},
+		{Enabled: true, Match: "re:cn=([^,]+),ou=groups,.*", Action: auth.GroupActionRename, Target: "$1"},
+	} {
+		if w := postJSON(t, GroupMappingsHandler(app), "/api/admin/group-mappings", rule, nil); w.Code != http.StatusOK {
+			t.Fatalf("create rule: %d %s", w.Code, w.Body.String())
+		}
+	}
+	if w := postJSON(t, GroupMappingsHandler(app), "/api/admin/group-mappings", models.GroupMappingRule{Match: "x", Action: "rename"}, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("rule without target: got %d, want 400", w.Code)
+	}
+
+	body, _ := json.Marshal(models.GroupSourceSettings{Source: "ldap", DefaultGroups: []string{"family"}})
+	w := httptest.NewRecorder()
+	GroupMappingSourceHandler(app)(w, httptest.NewRequest(http.MethodPut, "/api/admin/group-mappings/source", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("save source settings: %d %s", w.Code, w.Body.String())
+	}
+
+	// Mapped groups decide admin access for the next request
+	if u := proxyUser("Ops Team, media"); u == nil || !u.IsAdmin || !reflect.DeepEqual(u.Groups, []string{"admin", "media"}) {
+		t.Errorf("after mapping: %+v", u)
+	}
+
+	// The test tool maps the groups stored for an LDAP user
+	app.DB.Exec(`INSERT INTO users (username, password_hash, groups) VALUES ('carol', 'LDAP_USER', '["cn=media,ou=groups,dc=example,dc=com"]')`)
+	app.DB.Exec(`INSERT INTO users (username, password_hash, groups) VALUES ('dave', 'hash', '[]')`)
+	tests := []struct {
+		name string
+		req  map[string]interface{}
+		code int
+		want []string
+	}{
+		{"stored LDAP groups", map[string]interface{}{"username": "carol"}, http.StatusOK, []string{"media", "family"}},
+		{"groups entered by hand", map[string]interface{}{"source": "authelia", "groups": []string{"ops team"}}, http.StatusOK, []string{"admin"}},
+		{"local user", map[string]interface{}{"username": "dave"}, http.StatusBadRequest, nil},
+		{"unknown source", map[string]interface{}{"source": "local", "groups": []string{"x"}}, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(t, GroupMappingTestHandler(app), "/api/admin/group-mappings/test", tt.req, nil)
+			if w.Code != tt.code {
+				t.Fatalf("got %d, want %d (%s)", w.Code, tt.code, w.Body.String())
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Groups []string `json:"groups"`
+			}
+			json.NewDecoder(w.Body).Decode(&resp)
+			if !reflect.DeepEqual(resp.Groups, tt.want) {
+				t.Errorf("groups = %q, want %q", resp.Groups, tt.want)
+			}
+		})
+	}
+}
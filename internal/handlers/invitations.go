@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/middleware"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// Limits for new invitations.
+const (
+	defaultInvitationHours = 7 * 24
+	maxInvitationHours     = 90 * 24
+	maxInvitationUses      = 1000
+)
+
+// signupUsernameRe restricts usernames chosen on the sign-up page to
+// characters that are safe in headers, URLs and group-based app rules.
+var signupUsernameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]{0,63}$`)
+
+// invitationLink returns the sign-up page URL for an invitation token.
+func invitationLink(baseURL, token string) string {
+	return baseURL + "/signup?invite=" + url.QueryEscape(token)
+}
+
+// InvitationsHandler lists (GET) or creates (POST) invitation links for new
+// local users.
+func InvitationsHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			http.Error(w, "Local auth not enabled", http.StatusServiceUnavailable)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			invitations, err := database.ListInvitations(app)
+			if err != nil {
+				log.Printf("Error listing invitations: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(invitations)
+
+		case http.MethodPost:
+			createInvitation(app, w, r)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func createInvitation(app *server.App, w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Note           string   `json:"note"`
+		Groups         []string `json:"groups"`
+		MaxUses        int      `json:"maxUses"`
+		ExpiresInHours int      `json:"expiresInHours"`
+		RequireTOTP    bool     `json:"requireTOTP"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = defaultInvitationHours
+	}
+	if req.ExpiresInHours < 1 || req.ExpiresInHours > maxInvitationHours {
+		http.Error(w, "Invitations must expire within 1 hour to 90 days", http.StatusBadRequest)
+		return
+	}
+	if req.MaxUses < 0 || req.MaxUses > maxInvitationUses {
+		http.Error(w, fmt.Sprintf("Maximum uses must be between 0 (unlimited) and %d", maxInvitationUses), http.StatusBadRequest)
+		return
+	}
+
+	groups := []string{}
+	for _, g := range req.Groups {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+
+	adminUser := auth.GetUserFromContext(r)
+	adminName := ""
+	if adminUser != nil {
+		adminName = adminUser.Username
+	}
+
+	inv := &models.Invitation{
+		Note:        strings.TrimSpace(req.Note),
+		Groups:      groups,
+		MaxUses:     req.MaxUses,
+		RequireTOTP: req.RequireTOTP,
+		CreatedBy:   adminName,
+		ExpiresAt:   time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour),
+	}
+	token, err := database.CreateInvitation(app, inv)
+	if err != nil {
+		log.Printf("Error creating invitation: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	uses := "unlimited uses"
+	if inv.MaxUses > 0 {
+		uses = fmt.Sprintf("%d use(s)", inv.MaxUses)
+	}
+	database.LogAudit(app, adminName, "invitation_created",
+		fmt.Sprintf("Created invitation %d with groups [%s], %s, expires %s",
+			inv.ID, strings.Join(groups, ", "), uses, inv.ExpiresAt.Format(time.RFC3339)),
+		r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"invitation": inv,
+		"url":        invitationLink(adminLinkBaseURL(app, r), token),
+	})
+}
+
+// InvitationHandler revokes (DELETE) a single invitation by ID.
+func InvitationHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.DB == nil {
+			http.Error(w, "Local auth not enabled", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/admin/invitations/"))
+		if err != nil {
+			http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+			return
+		}
+
+		found, err := database.DeleteInvitation(app, id)
+		if err != nil {
+			log.Printf("Error deleting invitation: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+			return
+		}
+
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+		database.LogAudit(app, adminName, "invitation_revoked", fmt.Sprintf("Revoked invitation %d", id), r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+	}
+}
+
+// SignupPageHandler renders the sign-up page for an invitation link.
+func SignupPageHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.URL.Query().Get("invite")
+		data := map[string]interface{}{
+			"CSPNonce":    middleware.GetCSPNonce(r),
+			"Version":     app.Version,
+			"Token":       token,
+			"Valid":       false,
+			"RequireTOTP": false,
+		}
+		if app.DB != nil && localAuthActive(app) {
+			if inv, err := database.GetInvitation(app, token); err == nil {
+				data["Valid"] = true
+				data["RequireTOTP"] = inv.RequireTOTP
+			}
+		}
+
+		// Keep the token out of caches and Referer headers
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := app.GetTemplates().ExecuteTemplate(w, "signup.html", data); err != nil {
+			log.Printf("Template error: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// SignupHandler creates a local account with an invitation. The new user is
+// signed in right away, or, if they asked for two-factor authentication or
+// policy requires it, handed to the TOTP enrollment step of the login flow.
+func SignupHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if app.DB == nil || !localAuthActive(app) {
+			http.Error(w, "Local authentication is not enabled", http.StatusNotFound)
+			return
+		}
+
+		var req struct {
+			Invite      string `json:"invite"`
+			Username    string `json:"username"`
+			Password    string `json:"password"`
+			DisplayName string `json:"displayName"`
+			Email       string `json:"email"`
+			EnrollTOTP  bool   `json:"enrollTOTP"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Username = strings.TrimSpace(req.Username)
+		req.Email = strings.TrimSpace(req.Email)
+		req.DisplayName = strings.TrimSpace(req.DisplayName)
+
+		if !signupUsernameRe.MatchString(req.Username) {
+			http.Error(w, "Usernames must be 1-64 letters, digits or . _ @ - and start with a letter or digit", http.StatusBadRequest)
+			return
+		}
+		if len(req.Password) < 8 {
+			http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+			return
+		}
+		if req.Email != "" && !strings.Contains(req.Email, "@") {
+			http.Error(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+		if req.DisplayName == "" {
+			req.DisplayName = req.Username
+		}
+
+		hashedPassword, err := auth.HashPassword(req.Password)
+		if err != nil {
+			log.Printf("Error hashing password: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		userID, inv, err := database.RedeemInvitation(app, req.Invite, req.Username, req.Email, req.DisplayName, hashedPassword)
+		if errors.Is(err, database.ErrInvitationInvalid) {
+			http.Error(w, "This invitation is invalid, used up or has expired", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, database.ErrUsernameTaken) {
+			http.Error(w, "That username or email is already taken", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Error redeeming invitation: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		database.LogAudit(app, req.Username, "invitation_redeemed",
+			fmt.Sprintf("Created account %q (id=%d) with invitation %d, groups [%s]", req.Username, userID, inv.ID, strings.Join(inv.Groups, ", ")),
+			auth.ClientIP(app, r))
+
+		newUser := &models.AuthenticatedUser{
+			Username: req.Username,
+			Groups:   inv.Groups,
+			IsAdmin:  auth.CheckIsAdmin(app, inv.Groups),
+			Source:   "local",
+		}
+		status, err := totpChallengeStatus(app, userID, newUser)
+		if err != nil {
+			log.Printf("Error checking two-factor status: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if status == "" && req.EnrollTOTP {
+			status = loginStatusTOTPSetupRequired
+		}
+		if status != "" {
+			challenge, err := database.CreateLoginChallenge(app, userID)
+			if err != nil {
+				log.Printf("Error creating login challenge: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": status, "challenge": challenge})
+			return
+		}
+
+		if err := createLoginSession(app, w, r, userID); err != nil {
+			log.Printf("Error creating session: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok", "redirect": "/"})
+	}
+}
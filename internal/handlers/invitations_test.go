@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"dashgate/internal/auth"
+)
+
+func TestInvitationSignup(t *testing.T) {
+	app := newTestApp(t)
+
+	createInvite := func(body map[string]interface{}) string {
+		t.Helper()
+		w := postJSON(t, InvitationsHandler(app), "/api/admin/invitations", body, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("create invitation: %d %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			URL string `json:"url"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		u, err := url.Parse(resp.URL)
+		if err != nil || u.Path != "/signup" {
+			t.Fatalf("invitation url = %q", resp.URL)
+		}
+		return u.Query().Get("invite")
+	}
+
+	if w := postJSON(t, InvitationsHandler(app), "/api/admin/invitations", map[string]interface{}{"expiresInHours": 24 * 365}, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expiry of a year: got %d, want 400", w.Code)
+	}
+
+	twoUses := createInvite(map[string]interface{}{"groups": []string{"family", " "}, "maxUses": 2})
+	withTOTP := createInvite(map[string]interface{}{"groups": []string{"users"}, "requireTOTP": true})
+
+	signup := func(invite, username string) (int, map[string]string) {
+		w := postJSON(t, SignupHandler(app), "/api/auth/signup", map[string]string{
+			"invite": invite, "username": username, "password": "Password123!",
+		}, nil)
+		var resp map[string]string
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	tests := []struct {
+		name       string
+		invite     string
+		username   string
+		wantCode   int
+		wantStatus string
+	}{
+		{"unknown invitation", "not-an-invite", "mallory", http.StatusBadRequest, ""},
+		{"invalid username", twoUses, "bad name", http.StatusBadRequest, ""},
+		{"first use", twoUses, "alice", http.StatusOK, "ok"},
+		{"taken username does not use up the invite", twoUses, "alice", http.StatusConflict, ""},
+		{"second use", twoUses, "bob", http.StatusOK, "ok"},
+		{"used up", twoUses, "carol", http.StatusBadRequest, ""},
+		{"two-factor required", withTOTP, "dave", http.StatusOK, loginStatusTOTPSetupRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := signup(tt.invite, tt.username)
+			if code != tt.wantCode {
+				t.Fatalf("got %d, want %d", code, tt.wantCode)
+			}
+			if resp["status"] != tt.wantStatus {
+				t.Errorf("status = %q, want %q", resp["status"], tt.wantStatus)
+			}
+		})
+	}
+
+	var groups, passwordHash string
+	app.DB.QueryRow("SELECT groups, password_hash FROM users WHERE username = 'alice'").Scan(&groups, &passwordHash)
+	if groups != `["family"]` {
+		t.Errorf("alice groups = %s, want [\"family\"]", groups)
+	}
+	if !auth.CheckPassword("Password123!", passwordHash) {
+		t.Error("alice's password was not stored")
+	}
+
+	var totpRequired bool
+	app.DB.QueryRow("SELECT totp_required FROM users WHERE username = 'dave'").Scan(&totpRequired)
+	if !totpRequired {
+		t.Error("invitation requiring two-factor did not mark dave's account")
+	}
+
+	var created, redeemed int
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = 'invitation_created'").Scan(&created)
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = 'invitation_redeemed'").Scan(&redeemed)
+	if created != 2 || redeemed != 3 {
+		t.Errorf("audit log has %d invitation_created and %d invitation_redeemed entries, want 2 and 3", created, redeemed)
+	}
+}
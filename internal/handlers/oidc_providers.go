@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// oidcProviderIDPattern limits provider IDs to slugs that are safe in URLs.
+var oidcProviderIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// validateOIDCProvider checks a provider submitted by an admin and normalizes
+// its domain and group lists.
+func validateOIDCProvider(p *models.OIDCProvider) error {
+	p.ID = strings.TrimSpace(p.ID)
+	if !oidcProviderIDPattern.MatchString(p.ID) {
+		return errors.New("ID must be 1-32 lowercase letters, digits, '-' or '_'")
+	}
+	p.DisplayName = strings.TrimSpace(p.DisplayName)
+	if p.DisplayName == "" {
+		p.DisplayName = p.ID
+	}
+	if !isHTTPURL(p.Issuer) {
+		return errors.New("issuer must be an http(s) URL")
+	}
+	if strings.TrimSpace(p.ClientID) == "" {
+		return errors.New("client ID is required")
+	}
+	if p.RedirectURL != "" && !isHTTPURL(p.RedirectURL) {
+		return errors.New("redirect URL must be an http(s) URL")
+	}
+	if p.Icon != "" && !isHTTPURL(p.Icon) && (!strings.HasPrefix(p.Icon, "/") || strings.HasPrefix(p.Icon, "//")) {
+		return errors.New("icon must be an http(s) URL or a path on this server")
+	}
+	p.Scopes = strings.Join(strings.Fields(p.Scopes), " ")
+	if p.Scopes != "" && !strings.Contains(" "+p.Scopes+" ", " openid ") {
+		return errors.New(`scopes must include "openid"`)
+	}
+	p.GroupsClaim = strings.TrimSpace(p.GroupsClaim)
+	if p.GroupsClaim != "" {
+		if err := auth.ValidateGroupsClaim(p.GroupsClaim); err != nil {
+			return fmt.Errorf("invalid groups claim: %v", err)
+		}
+	}
+
+	var domains []string
+	for _, d := range p.AllowedDomains {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d == "" {
+			continue
+		}
+		if !strings.Contains(d, ".") || strings.ContainsAny(d, " /@") {
+			return fmt.Errorf("invalid email domain %q", d)
+		}
+		domains = append(domains, d)
+	}
+	p.AllowedDomains = domains
+
+	var groups []string
+	for _, g := range p.DefaultGroups {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	p.DefaultGroups = groups
+	return nil
+}
+
+// isHTTPURL reports whether s is an absolute http or https URL.
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// OIDCProvidersHandler manages the OIDC providers users can sign in with
+// (GET list, POST create, PUT update, DELETE by id). Changes take effect
+// immediately; a blank client secret on update keeps the stored one.
+func OIDCProvidersHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminUser := auth.GetUserFromContext(r)
+		adminName := ""
+		if adminUser != nil {
+			adminName = adminUser.Username
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			providers, err := database.ListOIDCProviders(app)
+			if err != nil {
+				log.Printf("Failed to list OIDC providers: %v", err)
+				http.Error(w, "Failed to list providers", http.StatusInternalServerError)
+				return
+			}
+			active := make(map[string]bool)
+			for _, p := range auth.OIDCProviders(app) {
+				active[p.ID] = true
+			}
+			type providerStatus struct {
+				models.OIDCProvider
+				Active bool `json:"active"` // discovery succeeded and users can sign in
+			}
+			list := make([]providerStatus, 0, len(providers))
+			for _, p := range providers {
+				list = append(list, providerStatus{OIDCProvider: p, Active: active[p.ID]})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(list)
+
+		case http.MethodPost, http.MethodPut:
+			var req struct {
+				models.OIDCProvider
+				ClientSecret string `json:"clientSecret"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			p := req.OIDCProvider
+			p.ClientSecret = req.ClientSecret
+			if err := validateOIDCProvider(&p); err != nil {
+				http.Error(w, "Invalid provider: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			existing, err := database.GetOIDCProvider(app, p.ID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Failed to load OIDC provider: %v", err)
+				http.Error(w, "Failed to save provider", http.StatusInternalServerError)
+				return
+			}
+			if r.Method == http.MethodPost && existing != nil {
+				http.Error(w, "A provider with this ID already exists", http.StatusConflict)
+				return
+			}
+			if r.Method == http.MethodPut {
+				if existing == nil {
+					http.Error(w, "Provider not found", http.StatusNotFound)
+					return
+				}
+				if p.ClientSecret == "" {
+					p.ClientSecret = existing.ClientSecret
+				}
+			}
+
+			if err := database.SaveOIDCProvider(app, &p); err != nil {
+				log.Printf("Failed to save OIDC provider: %v", err)
+				http.Error(w, "Failed to save provider", http.StatusInternalServerError)
+				return
+			}
+			database.InitOIDCProviders(app)
+
+			action := "oidc_provider_updated"
+			if r.Method == http.MethodPost {
+				action = "oidc_provider_created"
+			}
+			database.LogAudit(app, adminName, action, fmt.Sprintf("Saved OIDC provider %q (%s)", p.ID, p.Issuer), r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(p)
+
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if err := database.DeleteOIDCProvider(app, id); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					http.Error(w, "Provider not found", http.StatusNotFound)
+					return
+				}
+				log.Printf("Failed to delete OIDC provider: %v", err)
+				http.Error(w, "Failed to delete provider", http.StatusInternalServerError)
+				return
+			}
+			database.InitOIDCProviders(app)
+			database.LogAudit(app, adminName, "oidc_provider_deleted", fmt.Sprintf("Deleted OIDC provider %q", id), r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// fakeOIDCProvider is a minimal OpenID provider: discovery, keys, userinfo,
+// and a token endpoint that checks the PKCE verifier against the last
+// authorization request and rotates refresh tokens.
+type fakeOIDCProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu           sync.Mutex
+	challenge    string
+	claims       map[string]interface{} // ID token claims for the next code exchange
+	userInfo     map[string]interface{} // userinfo claims besides sub
+	refreshToken string                 // the refresh token currently valid
+	refreshCount int
+}
+
+func startFakeOIDC(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeOIDCProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"userinfo_endpoint":                     p.URL + "/userinfo",
+			"end_session_endpoint":                  p.URL + "/logout",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "test", "alg": "RS256", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		claims := map[string]interface{}{"sub": "user-1"}
+		for k, v := range p.userInfo {
+			claims[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(claims)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		invalidGrant := func() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		}
+		if r.PostFormValue("grant_type") == "refresh_token" {
+			if p.refreshToken == "" || r.PostFormValue("refresh_token") != p.refreshToken {
+				invalidGrant()
+				return
+			}
+			p.refreshCount++
+		} else {
+			sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+			if base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+				invalidGrant()
+				return
+			}
+		}
+		p.refreshToken = "refresh-" + strconv.Itoa(p.refreshCount)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access", "token_type": "Bearer", "expires_in": 3600,
+			"refresh_token": p.refreshToken, "id_token": p.sign(t, p.claims),
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// sign returns an RS256 JWT with the standard claims for client "dashgate"
+// plus extra.
+func (p *fakeOIDCProvider) sign(t *testing.T, extra map[string]interface{}) string {
+	t.Helper()
+	claims := map[string]interface{}{
+		"iss": p.URL, "aud": "dashgate", "sub": "user-1",
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// addOIDCProvider configures p as provider id and reloads the providers.
+func addOIDCProvider(t *testing.T, app *server.App, p *fakeOIDCProvider, provider models.OIDCProvider) {
+	t.Helper()
+	provider.Enabled = true
+	provider.Issuer = p.URL
+	provider.ClientID = "dashgate"
+	provider.ClientSecret = "secret"
+	provider.RedirectURL = "https://dash.example.com/auth/oidc/callback/" + provider.ID
+	if err := database.SaveOIDCProvider(app, &provider); err != nil {
+		t.Fatal(err)
+	}
+	database.InitOIDCProviders(app)
+}
+
+// oidcLogin runs the authorization code flow with a provider. tamper may
+// change the ID token claims or the recorded PKCE challenge before the code
+// is exchanged.
+func oidcLogin(t *testing.T, app *server.App, p *fakeOIDCProvider, providerID, sid string, tamper func(claims map[string]interface{})) *httptest.ResponseRecorder {
+	t.Helper()
+	state := oidcAuthorize(t, app, p, providerID, sid, tamper)
+	w := httptest.NewRecorder()
+	auth.OIDCCallbackHandler(app)(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/callback/"+providerID+"?code=abc&state="+url.QueryEscape(state), nil))
+	return w
+}
+
+// oidcAuthorize starts a login with a provider, prepares the ID token the
+// provider will issue and returns the state for the callback.
+func oidcAuthorize(t *testing.T, app *server.App, p *fakeOIDCProvider, providerID, sid string, tamper func(claims map[string]interface{})) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	auth.OIDCAuthHandler(app)(w, httptest.NewRequest(http.MethodGet, "/auth/oidc?provider="+providerID, nil))
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || w.Code != http.StatusFound {
+		t.Fatalf("auth redirect: %d %q", w.Code, w.Header().Get("Location"))
+	}
+	q := loc.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" {
+		t.Fatalf("authorization request lacks PKCE or nonce: %s", loc.RawQuery)
+	}
+
+	p.mu.Lock()
+	p.challenge = q.Get("code_challenge")
+	p.claims = map[string]interface{}{"nonce": q.Get("nonce"), "sid": sid, "preferred_username": "oidc-user"}
+	if tamper != nil {
+		tamper(p.claims)
+	}
+	p.mu.Unlock()
+	return q.Get("state")
+}
+
+func TestOIDCLoginAndLogout(t *testing.T) {
+	app := newTestApp(t)
+	p := startFakeOIDC(t)
+	app.SystemConfig.OIDCAuthEnabled = true
+	addOIDCProvider(t, app, p, models.OIDCProvider{ID: "default"})
+	if len(app.OIDCClients) != 1 {
+		t.Fatal("OIDC provider not initialized")
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(claims map[string]interface{})
+		want   int
+	}{
+		{"valid login", nil, http.StatusFound},
+		{"nonce from another login", func(c map[string]interface{}) { c["nonce"] = "replayed" }, http.StatusUnauthorized},
+		{"missing nonce", func(c map[string]interface{}) { delete(c, "nonce") }, http.StatusUnauthorized},
+		{"code exchanged without the PKCE verifier", func(map[string]interface{}) { p.challenge = "other" }, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := oidcLogin(t, app, p, "default", "sid-a", tt.tamper); w.Code != tt.want {
+				t.Errorf("got %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	// Logging out of an OIDC session also ends the provider session
+	w := oidcLogin(t, app, p, "default", "sid-b", nil)
+	cookies := w.Result().Cookies()
+	w = postJSON(t, LogoutHandler(app), "/api/auth/logout", nil, cookies)
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	logoutURL, _ := url.Parse(resp["redirect"])
+	if logoutURL == nil || !strings.HasPrefix(resp["redirect"], p.URL+"/logout?") || logoutURL.Query().Get("id_token_hint") == "" || strings.HasPrefix(logoutURL.Query().Get("id_token_hint"), "enc:") ||
+		logoutURL.Query().Get("post_logout_redirect_uri") != "https://dash.example.com/login" {
+		t.Errorf("logout redirect = %q", resp["redirect"])
+	}
+
+	backChannel := func(token string) int {
+		r := httptest.NewRequest(http.MethodPost, "/auth/oidc/backchannel-logout", strings.NewReader(url.Values{"logout_token": {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		OIDCBackChannelLogoutHandler(app)(w, r)
+		return w.Code
+	}
+	sessions := func(sid string) (n int) {
+		app.DB.QueryRow("SELECT COUNT(*) FROM sessions WHERE oidc_sid = ?", sid).Scan(&n)
+		return n
+	}
+
+	oidcLogin(t, app, p, "default", "sid-c", nil)
+	oidcLogin(t, app, p, "default", "sid-d", nil)
+	logoutEvent := map[string]interface{}{"http://schemas.openid.net/event/backchannel-logout": map[string]interface{}{}}
+	if code := backChannel(p.sign(t, map[string]interface{}{"sid": "sid-c", "nonce": "n", "events": logoutEvent})); code != http.StatusBadRequest {
+		t.Errorf("logout token with nonce: got %d, want 400", code)
+	}
+	if code := backChannel(p.sign(t, map[string]interface{}{"sid": "sid-c"})); code != http.StatusBadRequest {
+		t.Errorf("ID token used as logout token: got %d, want 400", code)
+	}
+	if code := backChannel(p.sign(t, map[string]interface{}{"sid": "sid-c", "events": logoutEvent})); code != http.StatusOK {
+		t.Errorf("back-channel logout: got %d, want 200", code)
+	}
+	if sessions("sid-c") != 0 || sessions("sid-d") != 1 {
+		t.Errorf("after logout of sid-c: %d sid-c and %d sid-d sessions, want 0 and 1", sessions("sid-c"), sessions("sid-d"))
+	}
+}
+
+func TestOIDCMultipleProviders(t *testing.T) {
+	app := newTestApp(t)
+	app.SystemConfig.OIDCAuthEnabled = true
+	authentik, google := startFakeOIDC(t), startFakeOIDC(t)
+	addOIDCProvider(t, app, authentik, models.OIDCProvider{ID: "authentik", DisplayName: "Authentik", Position: 0,
+		GroupsClaim: "roles", DefaultGroups: []string{"family"}})
+	addOIDCProvider(t, app, google, models.OIDCProvider{ID: "google", DisplayName: "Google", Position: 1,
+		AllowedDomains: []string{"example.com"}})
+
+	w := httptest.NewRecorder()
+	AuthConfigHandler(app)(w, httptest.NewRequest(http.MethodGet, "/api/auth/config", nil))
+	var cfg struct {
+		OIDCProviders []struct{ ID, DisplayName string } `json:"oidcProviders"`
+	}
+	json.NewDecoder(w.Body).Decode(&cfg)
+	if len(cfg.OIDCProviders) != 2 || cfg.OIDCProviders[0].ID != "authentik" || cfg.OIDCProviders[1].DisplayName != "Google" {
+		t.Fatalf("login providers = %+v", cfg.OIDCProviders)
+	}
+
+	w = httptest.NewRecorder()
+	auth.OIDCAuthHandler(app)(w, httptest.NewRequest(http.MethodGet, "/auth/oidc?provider=github", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown provider: got %d, want 404", w.Code)
+	}
+
+	// OIDC logins cannot claim local or LDAP accounts
+	app.DB.Exec("INSERT INTO users (username, password_hash, groups) VALUES ('admin', 'local-hash', '[\"admin\"]')")
+	app.DB.Exec("INSERT INTO users (username, password_hash, groups) VALUES ('ldap-user', 'LDAP_USER', '[]')")
+
+	googleUser := func(email string, verified interface{}) func(map[string]interface{}) {
+		return func(c map[string]interface{}) {
+			c["preferred_username"] = strings.Split(email, "@")[0]
+			c["email"] = email
+			c["email_verified"] = verified
+		}
+	}
+	tests := []struct {
+		name     string
+		provider *fakeOIDCProvider
+		id       string
+		tamper   func(map[string]interface{})
+		want     int
+	}{
+		{"groups from the provider's claim", authentik, "authentik", func(c map[string]interface{}) { c["roles"] = []string{"admins"} }, http.StatusFound},
+		{"allowed domain", google, "google", googleUser("alice@example.com", true), http.StatusFound},
+		{"other domain", google, "google", googleUser("mallory@evil.test", true), http.StatusForbidden},
+		{"unverified address", google, "google", googleUser("eve@example.com", false), http.StatusForbidden},
+		{"username of another provider's user", google, "google", googleUser("oidc-user@example.com", true), http.StatusForbidden},
+		{"username of a local user", google, "google", googleUser("admin@example.com", true), http.StatusForbidden},
+		{"username of an LDAP user", authentik, "authentik", func(c map[string]interface{}) { c["preferred_username"] = "ldap-user" }, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := oidcLogin(t, app, tt.provider, tt.id, "", tt.tamper); w.Code != tt.want {
+				t.Errorf("got %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	var groups, provider string
+	app.DB.QueryRow("SELECT groups, oidc_provider FROM users WHERE username = 'oidc-user'").Scan(&groups, &provider)
+	if groups != `["admins","family"]` || provider != "authentik" {
+		t.Errorf("authentik user: groups %s, provider %q", groups, provider)
+	}
+
+	var hash, adminGroups string
+	app.DB.QueryRow("SELECT password_hash, groups, COALESCE(oidc_provider, '') FROM users WHERE username = 'admin'").Scan(&hash, &adminGroups, &provider)
+	if hash != "local-hash" || adminGroups != `["admin"]` || provider != "" {
+		t.Errorf("local user changed by an OIDC login: hash %q, groups %s, provider %q", hash, adminGroups, provider)
+	}
+
+	// A login started with one provider cannot be completed at another's callback
+	state := oidcAuthorize(t, app, authentik, "authentik", "", nil)
+	w = httptest.NewRecorder()
+	auth.OIDCCallbackHandler(app)(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/callback/google?code=abc&state="+url.QueryEscape(state), nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("callback of another provider: got %d, want 400", w.Code)
+	}
+}
+
+func TestOIDCUserInfoAndRefresh(t *testing.T) {
+	app := newTestApp(t)
+	app.SystemConfig.OIDCAuthEnabled = true
+	app.SystemConfig.SessionRenewMinutes = 1
+	p := startFakeOIDC(t)
+	addOIDCProvider(t, app, p, models.OIDCProvider{ID: "keycloak", GroupsClaim: "realm_access.roles, resource_access.dashgate.roles"})
+
+	// Realm roles come from the ID token, client roles and the email only from userinfo
+	p.userInfo = map[string]interface{}{
+		"email":           "kc@example.com",
+		"resource_access": map[string]interface{}{"dashgate": map[string]interface{}{"roles": []string{"dash-admin"}}},
+	}
+	w := oidcLogin(t, app, p, "keycloak", "", func(c map[string]interface{}) {
+		c["realm_access"] = map[string]interface{}{"roles": []string{"users"}}
+	})
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: %d %s", w.Code, w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+	var email, groups string
+	app.DB.QueryRow("SELECT email, groups FROM users WHERE username = 'oidc-user'").Scan(&email, &groups)
+	if email != "kc@example.com" || groups != `["users","dash-admin"]` {
+		t.Errorf("after login: email %q, groups %s", email, groups)
+	}
+
+	currentUser := func() *models.AuthenticatedUser {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		return auth.GetLocalUser(app, r)
+	}
+	expireRenewal := func() {
+		app.DB.Exec("UPDATE sessions SET last_seen_at = ?", time.Now().Add(-2*time.Minute))
+	}
+
+	// Within the renewal interval the provider is not asked
+	if u := currentUser(); u == nil || p.refreshCount != 0 {
+		t.Fatalf("session before renewal: user %v, %d refreshes", u, p.refreshCount)
+	}
+
+	// Renewing the session redeems the refresh token and picks up new roles
+	p.claims["realm_access"] = map[string]interface{}{"roles": []string{"users", "admins"}}
+	p.userInfo["resource_access"] = map[string]interface{}{}
+	expireRenewal()
+	u := currentUser()
+	if u == nil || p.refreshCount != 1 || strings.Join(u.Groups, ",") != "users,admins" {
+		t.Fatalf("after renewal: user %+v, %d refreshes", u, p.refreshCount)
+	}
+	// Tokens are stored encrypted
+	var stored, storedIDToken string
+	app.DB.QueryRow("SELECT oidc_refresh_token, oidc_id_token FROM sessions").Scan(&stored, &storedIDToken)
+	if !strings.HasPrefix(stored, "enc:") || auth.DecryptSessionToken(app, stored) != "refresh-1" {
+		t.Errorf("rotated refresh token not stored encrypted: %q", stored)
+	}
+	if !strings.HasPrefix(storedIDToken, "enc:") {
+		t.Errorf("ID token stored in plaintext: %q", storedIDToken)
+	}
+
+	// A refresh token the provider no longer accepts ends the session
+	p.refreshToken = "revoked"
+	expireRenewal()
+	if u := currentUser(); u != nil {
+		t.Errorf("session survived a rejected refresh token: %+v", u)
+	}
+	var n int
+	app.DB.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&n)
+	if n != 0 {
+		t.Errorf("%d sessions left, want 0", n)
+	}
+}
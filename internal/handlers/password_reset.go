@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/mailer"
+	"dashgate/internal/middleware"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// smtpConfig returns the configured outgoing mail server.
+func smtpConfig(app *server.App) mailer.Config {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	return mailer.Config{
+		Host:     app.SystemConfig.SMTPHost,
+		Port:     app.SystemConfig.SMTPPort,
+		Username: app.SystemConfig.SMTPUsername,
+		Password: app.SystemConfig.SMTPPassword,
+		From:     app.SystemConfig.SMTPFrom,
+		Security: app.SystemConfig.SMTPSecurity,
+	}
+}
+
+// passwordResetTTL returns how long a new reset link stays valid.
+func passwordResetTTL(app *server.App) time.Duration {
+	app.SysConfigMu.RLock()
+	minutes := app.SystemConfig.PasswordResetMinutes
+	app.SysConfigMu.RUnlock()
+	if minutes <= 0 {
+		minutes = database.DefaultPasswordResetMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// emailResetAvailable reports whether local users may request a reset link by
+// email. Emailed links are built from the external URL, never from the Host
+// header of the request, so the setting is required.
+func emailResetAvailable(app *server.App) bool {
+	app.SysConfigMu.RLock()
+	enabled := app.SystemConfig.PasswordResetEmail && app.SystemConfig.ExternalURL != ""
+	app.SysConfigMu.RUnlock()
+	return enabled && localAuthActive(app) && smtpConfig(app).Configured()
+}
+
+// localAuthActive reports whether users can sign in with a local password.
+func localAuthActive(app *server.App) bool {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	return app.SystemConfig.LocalAuthEnabled || app.AuthConfig.Mode == models.AuthModeLocal || app.AuthConfig.Mode == models.AuthModeHybrid
+}
+
+// adminLinkBaseURL returns the base URL for links shown to an admin: the
+// external URL if set, otherwise the host of the admin's request. The admin
+// can see if the host is wrong, so the fallback is safe here but not for
+// links sent by email.
+func adminLinkBaseURL(app *server.App, r *http.Request) string {
+	app.SysConfigMu.RLock()
+	baseURL := app.SystemConfig.ExternalURL
+	app.SysConfigMu.RUnlock()
+	if baseURL != "" {
+		return baseURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// passwordResetLink returns the reset page URL for a token.
+func passwordResetLink(baseURL, token string) string {
+	return baseURL + "/reset-password?token=" + url.QueryEscape(token)
+}
+
+// sendPasswordResetEmail emails a reset link to a user.
+func sendPasswordResetEmail(app *server.App, to, name, username, link string, expiresAt time.Time, byAdmin bool) error {
+	intro := fmt.Sprintf("A password reset was requested for your DashGate account %q.", username)
+	if byAdmin {
+		intro = fmt.Sprintf("An administrator created a password reset link for your DashGate account %q.", username)
+	}
+	body := fmt.Sprintf(`Hello %s,
+
+%s
+Open this link to choose a new password:
+
+%s
+
+The link can be used once and expires at %s.
+If you did not ask for this, you can ignore this email; your password stays unchanged.
+`, name, intro, link, expiresAt.Format("2006-01-02 15:04 MST"))
+
+	return mailer.Send(smtpConfig(app), to, "Reset your DashGate password", body)
+}
+
+// createPasswordResetLink handles POST /api/admin/local-users/{id}/reset-link:
+// it creates a one-time reset link for a local user and optionally emails it.
+func createPasswordResetLink(app *server.App, w http.ResponseWriter, r *http.Request, userID int, adminName string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		SendEmail bool `json:"sendEmail"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var username, email, displayName, passwordHash string
+	err := app.DB.QueryRow(
+		"SELECT username, COALESCE(email, ''), COALESCE(display_name, username), password_hash FROM users WHERE id = ?", userID,
+	).Scan(&username, &email, &displayName, &passwordHash)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if passwordHash == "LDAP_USER" || passwordHash == "OIDC_USER" {
+		http.Error(w, "Password reset links are only available for local users", http.StatusBadRequest)
+		return
+	}
+	if req.SendEmail && (email == "" || !smtpConfig(app).Configured()) {
+		http.Error(w, "Sending the link requires an email address for the user and a configured SMTP server", http.StatusBadRequest)
+		return
+	}
+
+	token, expiresAt, err := database.CreatePasswordResetToken(app, userID, adminName, passwordResetTTL(app))
+	if err != nil {
+		log.Printf("Error creating password reset token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	link := passwordResetLink(adminLinkBaseURL(app, r), token)
+
+	resp := map[string]interface{}{"url": link, "expiresAt": expiresAt, "emailed": false}
+	detail := fmt.Sprintf("Created password reset link for user %s", username)
+	if req.SendEmail {
+		if err := sendPasswordResetEmail(app, email, displayName, username, link, expiresAt, true); err != nil {
+			log.Printf("Error sending password reset email to %s: %v", username, err)
+			resp["emailError"] = err.Error()
+		} else {
+			resp["emailed"] = true
+			detail += " and emailed it to " + email
+		}
+	}
+	database.LogAudit(app, adminName, "password_reset_link_created", detail, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ForgotPasswordHandler emails a reset link to a local user who enters their
+// username or email address. The response is the same whether or not a
+// matching account exists, and the email is sent in the background so the
+// response time does not reveal it either.
+func ForgotPasswordHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if app.DB == nil || !emailResetAvailable(app) {
+			http.Error(w, "Password reset by email is not enabled", http.StatusNotFound)
+			return
+		}
+
+		var req struct {
+			Username string `json:"username"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		identifier := strings.TrimSpace(req.Username)
+		if identifier == "" {
+			http.Error(w, "Username or email required", http.StatusBadRequest)
+			return
+		}
+
+		var userID int
+		var username, email, displayName, passwordHash string
+		err := app.DB.QueryRow(`
+			SELECT id, username, COALESCE(email, ''), COALESCE(display_name, username), password_hash
+			FROM users WHERE username = ? OR (email = ? AND email != '')
+			ORDER BY username = ? DESC LIMIT 1`,
+			identifier, identifier, identifier,
+		).Scan(&userID, &username, &email, &displayName, &passwordHash)
+		if err == nil && email != "" && passwordHash != "LDAP_USER" && passwordHash != "OIDC_USER" {
+			ip := auth.ClientIP(app, r)
+			database.LogAudit(app, username, "password_reset_requested", "Requested a password reset email", ip)
+
+			app.SysConfigMu.RLock()
+			baseURL := app.SystemConfig.ExternalURL
+			app.SysConfigMu.RUnlock()
+
+			go func() {
+				token, expiresAt, err := database.CreatePasswordResetToken(app, userID, "", passwordResetTTL(app))
+				if err != nil {
+					log.Printf("Error creating password reset token: %v", err)
+					return
+				}
+				if err := sendPasswordResetEmail(app, email, displayName, username, passwordResetLink(baseURL, token), expiresAt, false); err != nil {
+					log.Printf("Error sending password reset email to %s: %v", username, err)
+				}
+			}()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "sent"})
+	}
+}
+
+// ResetPasswordPageHandler renders the page that requests a reset email
+// (without a token) or sets a new password (with ?token=).
+func ResetPasswordPageHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.URL.Query().Get("token")
+		data := map[string]interface{}{
+			"CSPNonce":     middleware.GetCSPNonce(r),
+			"Version":      app.Version,
+			"EmailEnabled": app.DB != nil && emailResetAvailable(app),
+			"Token":        token,
+			"TokenValid":   false,
+			"Username":     "",
+		}
+		if token != "" && app.DB != nil {
+			if _, username, err := database.GetPasswordResetUser(app, token); err == nil {
+				data["TokenValid"] = true
+				data["Username"] = username
+			}
+		}
+
+		// Keep the token out of caches and Referer headers
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := app.GetTemplates().ExecuteTemplate(w, "reset_password.html", data); err != nil {
+			log.Printf("Template error: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// ResetPasswordHandler sets a new password with a reset token. The token is
+// used up, and all of the user's sessions are signed out.
+func ResetPasswordHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if app.DB == nil {
+			http.Error(w, "Database not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		var req struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Password) < 8 {
+			http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+			return
+		}
+
+		// Check the token before spending a bcrypt hash on the request
+		if _, _, err := database.GetPasswordResetUser(app, req.Token); err != nil {
+			if errors.Is(err, database.ErrResetTokenInvalid) {
+				http.Error(w, "This reset link is invalid or has expired. Please request a new one.", http.StatusBadRequest)
+				return
+			}
+			log.Printf("Error looking up password reset token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		hashedPassword, err := auth.HashPassword(req.Password)
+		if err != nil {
+			log.Printf("Error hashing password: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		_, username, err := database.ResetPasswordWithToken(app, req.Token, hashedPassword)
+		if errors.Is(err, database.ErrResetTokenInvalid) {
+			http.Error(w, "This reset link is invalid or has expired. Please request a new one.", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error resetting password: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// A new password also lifts a lockout from earlier failed attempts
+		database.ResetLoginFailures(app, username)
+		database.LogAudit(app, username, "password_reset", "Reset password with a reset link, all sessions signed out", auth.ClientIP(app, r))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok", "redirect": "/login"})
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/mailer"
+)
+
+// startFakeSMTP runs a minimal SMTP server that accepts every message and
+// delivers its raw DATA to the returned channel.
+func startFakeSMTP(t *testing.T) (string, int, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+				reply("220 localhost ESMTP")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						reply("250 localhost")
+					case cmd == "DATA":
+						reply("354 End data with <CR><LF>.<CR><LF>")
+						var data strings.Builder
+						for {
+							l, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if l == ".\r\n" {
+								break
+							}
+							data.WriteString(l)
+						}
+						messages <- data.String()
+						reply("250 OK")
+					case cmd == "QUIT":
+						reply("221 Bye")
+						return
+					default:
+						reply("250 OK")
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, messages
+}
+
+func TestPasswordResetByEmail(t *testing.T) {
+	app := newTestApp(t)
+	host, port, messages := startFakeSMTP(t)
+	app.SystemConfig.SMTPHost = host
+	app.SystemConfig.SMTPPort = port
+	app.SystemConfig.SMTPFrom = "DashGate <dashgate@example.com>"
+	app.SystemConfig.SMTPSecurity = mailer.SecurityNone
+	app.SystemConfig.PasswordResetEmail = true
+	app.SystemConfig.PasswordResetMinutes = 60
+
+	hash, err := auth.HashPassword("Password123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := app.DB.Exec("INSERT INTO users (username, email, display_name, password_hash, groups) VALUES ('alice', 'alice@example.com', 'Alice', ?, '[]')", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := res.LastInsertId()
+	if _, err := app.DB.Exec("INSERT INTO users (username, email, password_hash) VALUES ('bob', 'bob@example.com', 'LDAP_USER')"); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	if err := createLoginSession(app, rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", nil), int(userID)); err != nil {
+		t.Fatal(err)
+	}
+	session := rec.Result().Cookies()
+
+	// A link an admin issued survives self-service requests
+	adminToken, _, err := database.CreatePasswordResetToken(app, int(userID), "admin", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown and directory accounts get the same answer but no email
+	for _, name := range []string{"nobody", "bob"} {
+		if w := postJSON(t, ForgotPasswordHandler(app), "/api/auth/forgot-password", map[string]string{"username": name}, nil); w.Code != http.StatusOK {
+			t.Fatalf("forgot-password for %s: %d %s", name, w.Code, w.Body.String())
+		}
+	}
+	if w := postJSON(t, ForgotPasswordHandler(app), "/api/auth/forgot-password", map[string]string{"username": "alice@example.com"}, nil); w.Code != http.StatusOK {
+		t.Fatalf("forgot-password: %d %s", w.Code, w.Body.String())
+	}
+
+	var raw string
+	select {
+	case raw = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reset email was sent")
+	}
+	select {
+	case extra := <-messages:
+		t.Fatalf("unexpected second email: %s", extra)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	headers, body, _ := strings.Cut(raw, "\r\n\r\n")
+	if !strings.Contains(headers, "To: <alice@example.com>") {
+		t.Errorf("email headers = %q", headers)
+	}
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := regexp.MustCompile(`https://dash\.example\.com/reset-password\?token=\S+`).FindString(string(decoded))
+	if link == "" {
+		t.Fatalf("no reset link in email:\n%s", decoded)
+	}
+	u, _ := url.Parse(link)
+	token := u.Query().Get("token")
+
+	if _, _, err := database.GetPasswordResetUser(app, adminToken); err != nil {
+		t.Errorf("admin-issued link after a self-service request: %v", err)
+	}
+
+	var stored int
+	app.DB.QueryRow("SELECT COUNT(*) FROM password_reset_tokens WHERE token_hash = ?", token).Scan(&stored)
+	if stored != 0 {
+		t.Error("reset token is stored in plain text")
+	}
+
+	reset := func(token, password string) int {
+		return postJSON(t, ResetPasswordHandler(app), "/api/auth/reset-password", map[string]string{"token": token, "password": password}, nil).Code
+	}
+	if code := reset(token, "short"); code != http.StatusBadRequest {
+		t.Errorf("short password: got %d, want 400", code)
+	}
+	if code := reset("not-a-token", "NewPassword456!"); code != http.StatusBadRequest {
+		t.Errorf("unknown token: got %d, want 400", code)
+	}
+	if code := reset(token, "NewPassword456!"); code != http.StatusOK {
+		t.Fatalf("reset: got %d, want 200", code)
+	}
+	if code := reset(token, "OtherPassword789!"); code != http.StatusBadRequest {
+		t.Errorf("reused token: got %d, want 400", code)
+	}
+
+	var passwordHash string
+	app.DB.QueryRow("SELECT password_hash FROM users WHERE id = ?", userID).Scan(&passwordHash)
+	if !auth.CheckPassword("NewPassword456!", passwordHash) {
+		t.Error("new password not stored")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(session[0])
+	if auth.GetLocalUser(app, req) != nil {
+		t.Error("existing session still valid after password reset")
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"dashgate/internal/database"
 	"dashgate/internal/middleware"
+	"dashgate/internal/models"
 	"dashgate/internal/server"
 )
 
@@ -91,6 +92,32 @@ func SetupHandler(app *server.App) http.HandlerFunc {
 			return
 		}
 
+		// The OIDC provider entered in the wizard becomes the first provider
+		var oidcProvider *models.OIDCProvider
+		if req.OIDCAuthEnabled && req.OIDCIssuer != "" {
+			oidcProvider = &models.OIDCProvider{
+				ID:           "default",
+				DisplayName:  "SSO",
+				Enabled:      true,
+				Issuer:       req.OIDCIssuer,
+				ClientID:     req.OIDCClientID,
+				ClientSecret: req.OIDCClientSecret,
+				RedirectURL:  req.OIDCRedirectURL,
+				Scopes:       req.OIDCScopes,
+				GroupsClaim:  req.OIDCGroupsClaim,
+			}
+			if oidcProvider.Scopes == "" {
+				oidcProvider.Scopes = "openid profile email groups"
+			}
+			if oidcProvider.GroupsClaim == "" {
+				oidcProvider.GroupsClaim = "groups"
+			}
+			if err := validateOIDCProvider(oidcProvider); err != nil {
+				http.Error(w, "Invalid OIDC settings: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
 		// Set admin group early so CreateAdminUser can use it
 		app.SysConfigMu.Lock()
 		app.SystemConfig.AdminGroup = req.AdminGroup
@@ -168,22 +195,16 @@ func SetupHandler(app *server.App) http.HandlerFunc {
 			app.SystemConfig.LDAPSkipVerify = req.LDAPSkipVerify
 		}
 
-		// Set OIDC settings if enabled
-		if req.OIDCAuthEnabled {
-			app.SystemConfig.OIDCIssuer = req.OIDCIssuer
-			app.SystemConfig.OIDCClientID = req.OIDCClientID
-			app.SystemConfig.OIDCClientSecret = req.OIDCClientSecret
-			app.SystemConfig.OIDCRedirectURL = req.OIDCRedirectURL
-			app.SystemConfig.OIDCScopes = req.OIDCScopes
-			if app.SystemConfig.OIDCScopes == "" {
-				app.SystemConfig.OIDCScopes = "openid profile email groups"
-			}
-			app.SystemConfig.OIDCGroupsClaim = req.OIDCGroupsClaim
-			if app.SystemConfig.OIDCGroupsClaim == "" {
-				app.SystemConfig.OIDCGroupsClaim = "groups"
+		app.SysConfigMu.Unlock()
+
+		// Saved before the system config, which initializes the providers
+		if oidcProvider != nil {
+			if err := database.SaveOIDCProvider(app, oidcProvider); err != nil {
+				log.Printf("Error saving OIDC provider: %v", err)
+				http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
+				return
 			}
 		}
-		app.SysConfigMu.Unlock()
 
 		if err := database.SaveSystemConfig(app); err != nil {
 			log.Printf("Error saving system config: %v", err)
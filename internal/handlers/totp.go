@@ -0,0 +1,544 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+)
+
+// Login step statuses returned by LoginHandler when a second factor is needed.
+const (
+	loginStatusTOTPRequired      = "totp_required"
+	loginStatusTOTPSetupRequired = "totp_setup_required"
+)
+
+// totpEnrollment is returned when a user starts TOTP enrollment.
+type totpEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qrCode"`
+}
+
+// totpRequiredFor reports whether TOTP is mandatory for a user, either through
+// the per-user flag or the admin-group policy.
+func totpRequiredFor(app *server.App, userID int, user *models.AuthenticatedUser) (bool, error) {
+	var required bool
+	err := app.DB.QueryRow("SELECT COALESCE(totp_required, 0) FROM users WHERE id = ?", userID).Scan(&required)
+	if err != nil {
+		return false, err
+	}
+	if required {
+		return true, nil
+	}
+
+	app.SysConfigMu.RLock()
+	adminPolicy := app.SystemConfig.RequireAdmin2FA
+	app.SysConfigMu.RUnlock()
+	return adminPolicy && user.IsAdmin, nil
+}
+
+// totpChallengeStatus decides whether a verified password login needs a
+// second step: loginStatusTOTPRequired if the user is enrolled,
+// loginStatusTOTPSetupRequired if enrollment is mandatory but missing, or ""
+// if the password alone is sufficient.
+func totpChallengeStatus(app *server.App, userID int, user *models.AuthenticatedUser) (string, error) {
+	t, err := database.GetUserTOTP(app, userID)
+	if err != nil {
+		return "", err
+	}
+	if t != nil && t.Enabled {
+		return loginStatusTOTPRequired, nil
+	}
+
+	required, err := totpRequiredFor(app, userID, user)
+	if err != nil {
+		return "", err
+	}
+	if required {
+		return loginStatusTOTPSetupRequired, nil
+	}
+	return "", nil
+}
+
+// newTOTPEnrollment generates a secret for username and stores it as pending.
+func newTOTPEnrollment(app *server.App, userID int, username string) (*totpEnrollment, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.SavePendingTOTP(app, userID, secret); err != nil {
+		return nil, err
+	}
+	uri := auth.TOTPProvisioningURI(secret, username)
+	qr, err := auth.TOTPQRCode(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &totpEnrollment{Secret: secret, URI: uri, QRCode: qr}, nil
+}
+
+// activateTOTP verifies the first code of a pending enrollment, enables it and
+// returns freshly generated recovery codes.
+func activateTOTP(app *server.App, t *models.UserTOTP, code string) ([]string, bool, error) {
+	step, ok := auth.ValidateTOTP(t.Secret, code, time.Now(), 0)
+	if !ok {
+		return nil, false, nil
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := database.EnableTOTP(app, t.UserID, step, hashes); err != nil {
+		return nil, false, err
+	}
+	return codes, true, nil
+}
+
+// verifyTOTPCode checks a TOTP code for an enrolled user and marks its time
+// step as used.
+func verifyTOTPCode(app *server.App, t *models.UserTOTP, code string) bool {
+	step, ok := auth.ValidateTOTP(t.Secret, code, time.Now(), t.LastStep)
+	return ok && database.ConsumeTOTPStep(app, t.UserID, step)
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = auth.HashRecoveryCode(c)
+	}
+	return codes, hashes, nil
+}
+
+// LoginTOTPHandler completes a login started by LoginHandler. It accepts a
+// TOTP code or a recovery code for enrolled users, or the first code of an
+// enrollment started through LoginTOTPSetupHandler.
+func LoginTOTPHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if app.DB == nil {
+			http.Error(w, "Database not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		var req struct {
+			Challenge    string `json:"challenge"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recoveryCode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := database.GetLoginChallenge(app, req.Challenge)
+		if err != nil {
+			http.Error(w, "Login expired, please sign in again", http.StatusUnauthorized)
+			return
+		}
+
+		var username string
+		if err := app.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+			http.Error(w, "Login expired, please sign in again", http.StatusUnauthorized)
+			return
+		}
+		if wait := database.LoginRetryAfter(app, username); wait > 0 {
+			loginThrottled(w, wait)
+			return
+		}
+
+		t, err := database.GetUserTOTP(app, userID)
+		if err != nil {
+			log.Printf("Error loading TOTP for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if t == nil {
+			http.Error(w, "Two-factor setup has not been started", http.StatusBadRequest)
+			return
+		}
+
+		var recoveryCodes []string
+		ok := false
+		switch {
+		case t.Enabled && req.RecoveryCode != "":
+			ok = database.UseRecoveryCode(app, userID, req.RecoveryCode)
+			if ok {
+				database.LogAudit(app, username, "totp_recovery_code_used", fmt.Sprintf("Signed in with a recovery code (%d left)", len(t.RecoveryCodes)-1), r.RemoteAddr)
+			}
+		case t.Enabled:
+			ok = verifyTOTPCode(app, t, req.Code)
+		default:
+			recoveryCodes, ok, err = activateTOTP(app, t, req.Code)
+			if err != nil {
+				log.Printf("Error enabling TOTP for user %d: %v", userID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if ok {
+				database.LogAudit(app, username, "totp_enabled", "Enrolled in two-factor authentication during login", r.RemoteAddr)
+			}
+		}
+
+		if !ok {
+			database.FailLoginChallenge(app, req.Challenge)
+			recordLoginFailure(app, r, username)
+			http.Error(w, "Invalid verification code", http.StatusUnauthorized)
+			return
+		}
+
+		database.DeleteLoginChallenge(app, req.Challenge)
+		database.ResetLoginFailures(app, username)
+		if err := createLoginSession(app, w, r, userID); err != nil {
+			log.Printf("Error creating session: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := map[string]interface{}{"status": "ok", "redirect": "/"}
+		if recoveryCodes != nil {
+			resp["recoveryCodes"] = recoveryCodes
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// LoginTOTPSetupHandler starts mandatory TOTP enrollment for a user who
+// passed the password step but has not enrolled yet.
+func LoginTOTPSetupHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if app.DB == nil {
+			http.Error(w, "Database not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		var req struct {
+			Challenge string `json:"challenge"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := database.GetLoginChallenge(app, req.Challenge)
+		if err != nil {
+			http.Error(w, "Login expired, please sign in again", http.StatusUnauthorized)
+			return
+		}
+
+		t, err := database.GetUserTOTP(app, userID)
+		if err != nil {
+			log.Printf("Error loading TOTP for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if t != nil && t.Enabled {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		var username string
+		if err := app.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+			http.Error(w, "Login expired, please sign in again", http.StatusUnauthorized)
+			return
+		}
+
+		enrollment, err := newTOTPEnrollment(app, userID, username)
+		if err != nil {
+			log.Printf("Error starting TOTP enrollment: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(enrollment)
+	}
+}
+
+// passwordUserID returns the users row ID for users who sign in with a
+// password (local or LDAP). Other sources authenticate elsewhere and cannot
+// use TOTP.
+func passwordUserID(app *server.App, user *models.AuthenticatedUser) (int, bool) {
+	if user == nil || (user.Source != "local" && user.Source != "ldap") {
+		return 0, false
+	}
+	var userID int
+	if err := app.DB.QueryRow("SELECT id FROM users WHERE username = ?", user.Username).Scan(&userID); err != nil {
+		return 0, false
+	}
+	return userID, true
+}
+
+// UserTOTPHandler lets the current user view (GET), start (POST) or remove
+// (DELETE) their TOTP enrollment.
+func UserTOTPHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := auth.GetUserFromContext(r)
+		userID, ok := passwordUserID(app, user)
+		if !ok {
+			http.Error(w, "Two-factor authentication is only available for password logins", http.StatusBadRequest)
+			return
+		}
+
+		t, err := database.GetUserTOTP(app, userID)
+		if err != nil {
+			log.Printf("Error loading TOTP for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		enabled := t != nil && t.Enabled
+
+		switch r.Method {
+		case http.MethodGet:
+			required, err := totpRequiredFor(app, userID, user)
+			if err != nil {
+				log.Printf("Error checking TOTP policy: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			remaining := 0
+			if enabled {
+				remaining = len(t.RecoveryCodes)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"enabled":                enabled,
+				"required":               required,
+				"recoveryCodesRemaining": remaining,
+			})
+
+		case http.MethodPost:
+			if enabled {
+				http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+				return
+			}
+			enrollment, err := newTOTPEnrollment(app, userID, user.Username)
+			if err != nil {
+				log.Printf("Error starting TOTP enrollment: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(enrollment)
+
+		case http.MethodDelete:
+			if !enabled {
+				http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+				return
+			}
+			required, err := totpRequiredFor(app, userID, user)
+			if err != nil {
+				log.Printf("Error checking TOTP policy: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if required {
+				http.Error(w, "Two-factor authentication is required for your account", http.StatusForbidden)
+				return
+			}
+
+			var req struct {
+				Code string `json:"code"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if !verifyTOTPCode(app, t, req.Code) && !database.UseRecoveryCode(app, userID, req.Code) {
+				http.Error(w, "Invalid verification code", http.StatusUnauthorized)
+				return
+			}
+
+			if err := database.DisableTOTP(app, userID); err != nil {
+				log.Printf("Error disabling TOTP for user %d: %v", userID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			database.LogAudit(app, user.Username, "totp_disabled", "Disabled two-factor authentication", r.RemoteAddr)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "disabled"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// UserTOTPConfirmHandler enables a pending enrollment once the user enters a
+// valid code, and returns the recovery codes.
+func UserTOTPConfirmHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := auth.GetUserFromContext(r)
+		userID, ok := passwordUserID(app, user)
+		if !ok {
+			http.Error(w, "Two-factor authentication is only available for password logins", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		t, err := database.GetUserTOTP(app, userID)
+		if err != nil {
+			log.Printf("Error loading TOTP for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if t == nil || t.Enabled {
+			http.Error(w, "No pending two-factor enrollment", http.StatusBadRequest)
+			return
+		}
+
+		codes, ok, err := activateTOTP(app, t, req.Code)
+		if err != nil {
+			log.Printf("Error enabling TOTP for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid verification code", http.StatusUnauthorized)
+			return
+		}
+		database.LogAudit(app, user.Username, "totp_enabled", "Enabled two-factor authentication", r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "enabled", "recoveryCodes": codes})
+	}
+}
+
+// UserTOTPRecoveryCodesHandler replaces the current user's recovery codes
+// after verifying a TOTP code.
+func UserTOTPRecoveryCodesHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := auth.GetUserFromContext(r)
+		userID, ok := passwordUserID(app, user)
+		if !ok {
+			http.Error(w, "Two-factor authentication is only available for password logins", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		t, err := database.GetUserTOTP(app, userID)
+		if err != nil {
+			log.Printf("Error loading TOTP for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if t == nil || !t.Enabled {
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+			return
+		}
+		if !verifyTOTPCode(app, t, req.Code) {
+			http.Error(w, "Invalid verification code", http.StatusUnauthorized)
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			log.Printf("Error generating recovery codes: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := database.SetRecoveryCodes(app, userID, hashes); err != nil {
+			log.Printf("Error saving recovery codes: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		database.LogAudit(app, user.Username, "totp_recovery_codes_regenerated", "Regenerated two-factor recovery codes", r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"recoveryCodes": codes})
+	}
+}
+
+// adminUserTOTP lets admins require TOTP for a user (PUT) or reset a user's
+// enrollment (DELETE), e.g. after a lost device.
+func adminUserTOTP(app *server.App, w http.ResponseWriter, r *http.Request, userID int, adminName string) {
+	var username string
+	err := app.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req struct {
+			Required bool `json:"required"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if _, err := database.SetUserTOTPRequired(app, userID, req.Required); err != nil {
+			log.Printf("Error updating TOTP requirement: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		database.LogAudit(app, adminName, "totp_required_updated", fmt.Sprintf("Set two-factor requirement for user %q to %v", username, req.Required), r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "updated", "required": req.Required})
+
+	case http.MethodDelete:
+		if err := database.DisableTOTP(app, userID); err != nil {
+			log.Printf("Error resetting TOTP: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		database.LogAudit(app, adminName, "totp_reset", fmt.Sprintf("Reset two-factor authentication for user %q", username), r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "reset"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,480 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/models"
+	"dashgate/internal/server"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// maxPasskeyNameLength limits the user-chosen label of a passkey.
+const maxPasskeyNameLength = 64
+
+// passkeyFinishRequest is the body sent to finish a registration or login.
+// Credential is the PublicKeyCredential produced by the browser, serialized
+// with base64url-encoded binary fields.
+type passkeyFinishRequest struct {
+	Ceremony   string          `json:"ceremony"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// newRelyingParty builds the WebAuthn relying party from the configured external URL.
+func newRelyingParty(app *server.App) (*webauthn.WebAuthn, error) {
+	app.SysConfigMu.RLock()
+	externalURL := app.SystemConfig.ExternalURL
+	app.SysConfigMu.RUnlock()
+	return auth.NewWebAuthn(externalURL)
+}
+
+// passkeysAvailable reports whether passkey login can be offered on the login page.
+func passkeysAvailable(app *server.App) bool {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	passwordLogins := app.SystemConfig.LocalAuthEnabled || app.SystemConfig.LDAPAuthEnabled ||
+		app.AuthConfig.Mode == models.AuthModeLocal || app.AuthConfig.Mode == models.AuthModeHybrid
+	return passwordLogins && app.SystemConfig.ExternalURL != ""
+}
+
+// passkeyLoginAllowed reports whether a user with the given password_hash
+// marker may sign in with a passkey. Local users need local auth enabled and
+// LDAP users need LDAP auth enabled; OIDC users always sign in at their provider.
+func passkeyLoginAllowed(app *server.App, passwordHash string) bool {
+	app.SysConfigMu.RLock()
+	defer app.SysConfigMu.RUnlock()
+	switch passwordHash {
+	case "OIDC_USER":
+		return false
+	case "LDAP_USER":
+		return app.SystemConfig.LDAPAuthEnabled
+	default:
+		return app.SystemConfig.LocalAuthEnabled || app.AuthConfig.Mode == models.AuthModeLocal || app.AuthConfig.Mode == models.AuthModeHybrid
+	}
+}
+
+// loadPasskeyUser loads a user and their registered passkeys.
+func loadPasskeyUser(app *server.App, userID int) (*auth.PasskeyUser, error) {
+	u := &auth.PasskeyUser{ID: userID}
+	if err := app.DB.QueryRow(
+		"SELECT username, COALESCE(display_name, '') FROM users WHERE id = ?", userID,
+	).Scan(&u.Username, &u.DisplayName); err != nil {
+		return nil, err
+	}
+
+	handle, err := database.GetWebAuthnHandle(app, userID)
+	if err != nil {
+		return nil, err
+	}
+	u.Handle = []byte(handle)
+
+	stored, err := database.ListWebAuthnCredentials(app, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stored {
+		var cred webauthn.Credential
+		if err := json.Unmarshal([]byte(s.Data), &cred); err != nil {
+			log.Printf("Skipping unreadable passkey %d of user %d: %v", s.ID, userID, err)
+			continue
+		}
+		u.Credentials = append(u.Credentials, cred)
+	}
+	return u, nil
+}
+
+// saveCeremony stores WebAuthn session data and writes the options for the browser.
+func saveCeremony(app *server.App, w http.ResponseWriter, userID int, session *webauthn.SessionData, options interface{}) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		log.Printf("Error encoding passkey session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	token, err := database.SaveWebAuthnCeremony(app, userID, string(data))
+	if err != nil {
+		log.Printf("Error saving passkey session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ceremony": token,
+		"options":  options,
+	})
+}
+
+// takeCeremony decodes a finish request and loads (and consumes) its ceremony.
+func takeCeremony(app *server.App, r *http.Request) (*passkeyFinishRequest, int, *webauthn.SessionData, error) {
+	var req passkeyFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, 0, nil, err
+	}
+	userID, data, err := database.TakeWebAuthnCeremony(app, req.Ceremony)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, 0, nil, err
+	}
+	return &req, userID, &session, nil
+}
+
+// PasskeyLoginBeginHandler starts a discoverable (username-less) passkey login.
+func PasskeyLoginBeginHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if app.DB == nil {
+			http.Error(w, "Database not available", http.StatusServiceUnavailable)
+			return
+		}
+		if !passkeysAvailable(app) {
+			http.Error(w, "Passkey login is not available", http.StatusNotFound)
+			return
+		}
+
+		rp, err := newRelyingParty(app)
+		if err != nil {
+			log.Printf("Passkey login unavailable: %v", err)
+			http.Error(w, "Passkey login is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		assertion, session, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			log.Printf("Error starting passkey login: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		saveCeremony(app, w, 0, session, assertion)
+	}
+}
+
+// PasskeyLoginFinishHandler verifies a passkey assertion and creates a
+// session the same way LoginHandler does. Passkeys require user
+// verification, so they satisfy the two-factor policy on their own.
+func PasskeyLoginFinishHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if app.DB == nil {
+			http.Error(w, "Database not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		rp, err := newRelyingParty(app)
+		if err != nil {
+			http.Error(w, "Passkey login is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		req, ceremonyUserID, session, err := takeCeremony(app, r)
+		if err != nil || ceremonyUserID != 0 {
+			http.Error(w, "Passkey login expired, please try again", http.StatusBadRequest)
+			return
+		}
+
+		parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+		if err != nil {
+			http.Error(w, "Invalid passkey response", http.StatusBadRequest)
+			return
+		}
+
+		var userID int
+		var username, passwordHash string
+		findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+			id, err := database.GetUserIDByWebAuthnHandle(app, string(userHandle))
+			if err != nil {
+				return nil, fmt.Errorf("unknown user handle")
+			}
+			// Users disabled by the directory sync cannot sign in
+			if err := app.DB.QueryRow("SELECT username, password_hash FROM users WHERE id = ? AND COALESCE(disabled, 0) = 0", id).Scan(&username, &passwordHash); err != nil {
+				return nil, err
+			}
+			user, err := loadPasskeyUser(app, id)
+			if err != nil {
+				return nil, err
+			}
+			userID = id
+			return user, nil
+		}
+
+		_, credential, err := rp.ValidatePasskeyLogin(findUser, *session, parsed)
+		if err != nil {
+			if username != "" {
+				database.LogAudit(app, username, "passkey_login_failed", "Passkey verification failed", r.RemoteAddr)
+			}
+			http.Error(w, "Passkey verification failed", http.StatusUnauthorized)
+			return
+		}
+		if credential.Authenticator.CloneWarning {
+			database.LogAudit(app, username, "passkey_login_failed", "Rejected passkey with a non-increasing signature counter (possible clone)", r.RemoteAddr)
+			http.Error(w, "Passkey verification failed", http.StatusUnauthorized)
+			return
+		}
+		if !passkeyLoginAllowed(app, passwordHash) {
+			http.Error(w, "Passkey login is not available for this account", http.StatusForbidden)
+			return
+		}
+
+		credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+		if data, err := json.Marshal(credential); err == nil {
+			if err := database.UpdateWebAuthnCredentialUse(app, credentialID, string(data)); err != nil {
+				log.Printf("Error updating passkey %s: %v", credentialID, err)
+			}
+		}
+
+		if err := createLoginSession(app, w, r, userID); err != nil {
+			log.Printf("Error creating session: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		database.LogAudit(app, username, "passkey_login", "Signed in with a passkey", r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok", "redirect": "/"})
+	}
+}
+
+// UserPasskeysHandler lists the current user's passkeys (GET).
+func UserPasskeysHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := passwordUserID(app, auth.GetUserFromContext(r))
+		if !ok {
+			http.Error(w, "Passkeys are only available for password logins", http.StatusBadRequest)
+			return
+		}
+
+		creds, err := database.ListWebAuthnCredentials(app, userID)
+		if err != nil {
+			log.Printf("Error listing passkeys for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		_, rpErr := newRelyingParty(app)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"available": rpErr == nil,
+			"passkeys":  creds,
+		})
+	}
+}
+
+// UserPasskeyHandler renames (PUT) or deletes (DELETE) one of the current
+// user's passkeys at /api/user/passkeys/{id}.
+func UserPasskeyHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := auth.GetUserFromContext(r)
+		userID, ok := passwordUserID(app, user)
+		if !ok {
+			http.Error(w, "Passkeys are only available for password logins", http.StatusBadRequest)
+			return
+		}
+
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/user/passkeys/"))
+		if err != nil {
+			http.Error(w, "Invalid passkey ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			var req struct {
+				Name string `json:"name"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			name := strings.TrimSpace(req.Name)
+			if name == "" || len(name) > maxPasskeyNameLength {
+				http.Error(w, fmt.Sprintf("Name must be 1-%d characters", maxPasskeyNameLength), http.StatusBadRequest)
+				return
+			}
+			found, err := database.RenameWebAuthnCredential(app, userID, id, name)
+			if err != nil {
+				log.Printf("Error renaming passkey %d: %v", id, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Passkey not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+
+		case http.MethodDelete:
+			found, err := database.DeleteWebAuthnCredential(app, userID, id)
+			if err != nil {
+				log.Printf("Error deleting passkey %d: %v", id, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Passkey not found", http.StatusNotFound)
+				return
+			}
+			database.LogAudit(app, user.Username, "passkey_deleted", fmt.Sprintf("Removed passkey %d", id), r.RemoteAddr)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// UserPasskeyRegisterBeginHandler starts registering a new passkey for the
+// current user. Credentials are created as discoverable so they can be used
+// without entering a username.
+func UserPasskeyRegisterBeginHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := passwordUserID(app, auth.GetUserFromContext(r))
+		if !ok {
+			http.Error(w, "Passkeys are only available for password logins", http.StatusBadRequest)
+			return
+		}
+
+		rp, err := newRelyingParty(app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		user, err := loadPasskeyUser(app, userID)
+		if err != nil {
+			log.Printf("Error loading passkeys for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		creation, session, err := rp.BeginRegistration(user,
+			webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+				ResidentKey:        protocol.ResidentKeyRequirementRequired,
+				RequireResidentKey: protocol.ResidentKeyRequired(),
+				UserVerification:   protocol.VerificationRequired,
+			}),
+			webauthn.WithExclusions(webauthn.Credentials(user.Credentials).CredentialDescriptors()),
+		)
+		if err != nil {
+			log.Printf("Error starting passkey registration: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		saveCeremony(app, w, userID, session, creation)
+	}
+}
+
+// UserPasskeyRegisterFinishHandler verifies the attestation from the browser
+// and stores the new passkey.
+func UserPasskeyRegisterFinishHandler(app *server.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		authUser := auth.GetUserFromContext(r)
+		userID, ok := passwordUserID(app, authUser)
+		if !ok {
+			http.Error(w, "Passkeys are only available for password logins", http.StatusBadRequest)
+			return
+		}
+
+		rp, err := newRelyingParty(app)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		req, ceremonyUserID, session, err := takeCeremony(app, r)
+		if err != nil || ceremonyUserID != userID {
+			http.Error(w, "Passkey registration expired, please try again", http.StatusBadRequest)
+			return
+		}
+
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			name = "Passkey"
+		}
+		if len(name) > maxPasskeyNameLength {
+			http.Error(w, fmt.Sprintf("Name must be 1-%d characters", maxPasskeyNameLength), http.StatusBadRequest)
+			return
+		}
+
+		parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+		if err != nil {
+			http.Error(w, "Invalid passkey response", http.StatusBadRequest)
+			return
+		}
+
+		user, err := loadPasskeyUser(app, userID)
+		if err != nil {
+			log.Printf("Error loading passkeys for user %d: %v", userID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !bytes.Equal(user.Handle, session.UserID) {
+			http.Error(w, "Passkey registration expired, please try again", http.StatusBadRequest)
+			return
+		}
+
+		credential, err := rp.CreateCredential(user, *session, parsed)
+		if err != nil {
+			log.Printf("Passkey registration failed for %s: %v", authUser.Username, err)
+			http.Error(w, "Passkey registration failed", http.StatusBadRequest)
+			return
+		}
+
+		data, err := json.Marshal(credential)
+		if err != nil {
+			log.Printf("Error encoding passkey: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+		if err := database.AddWebAuthnCredential(app, userID, credentialID, name, string(data)); err != nil {
+			if strings.Contains(err.Error(), "UNIQUE") {
+				http.Error(w, "This passkey is already registered", http.StatusConflict)
+				return
+			}
+			log.Printf("Error saving passkey: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		database.LogAudit(app, authUser.Username, "passkey_registered", fmt.Sprintf("Registered passkey %q", name), r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "registered"})
+	}
+}
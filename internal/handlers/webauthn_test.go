@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+var b64url = base64.RawURLEncoding
+
+// softAuthenticator is a minimal software passkey: one ES256 key pair with
+// "none" attestation, always reporting user presence and verification.
+type softAuthenticator struct {
+	rpID       string
+	origin     string
+	key        *ecdsa.PrivateKey
+	credID     []byte
+	userHandle []byte
+	signCount  uint32
+}
+
+func newSoftAuthenticator(t *testing.T, rpID, origin string) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credID := make([]byte, 16)
+	rand.Read(credID)
+	return &softAuthenticator{rpID: rpID, origin: origin, key: key, credID: credID}
+}
+
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	data, _ := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": a.origin})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpHash := sha256.Sum256([]byte(a.rpID))
+	buf := append([]byte{}, rpHash[:]...)
+	buf = append(buf, flags)
+	buf = binary.BigEndian.AppendUint32(buf, a.signCount)
+	return append(buf, attested...)
+}
+
+// create answers navigator.credentials.create() for the given options.
+func (a *softAuthenticator) create(t *testing.T, challenge, userHandle string) json.RawMessage {
+	t.Helper()
+	handle, err := b64url.DecodeString(userHandle)
+	if err != nil {
+		t.Fatalf("user handle: %v", err)
+	}
+	a.userHandle = handle
+
+	coseKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credID)))
+	attested = append(attested, a.credID...)
+	attested = append(attested, coseKey...)
+
+	attObj, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(0x45, attested), // UP | UV | AT
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := json.Marshal(map[string]interface{}{
+		"id":    b64url.EncodeToString(a.credID),
+		"rawId": b64url.EncodeToString(a.credID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64url.EncodeToString(a.clientData("webauthn.create", challenge)),
+			"attestationObject": b64url.EncodeToString(attObj),
+		},
+	})
+	return resp
+}
+
+// get answers navigator.credentials.get() for a discoverable login.
+func (a *softAuthenticator) get(t *testing.T, challenge string) json.RawMessage {
+	t.Helper()
+	a.signCount++
+	authData := a.authData(0x05, nil) // UP | UV
+	clientData := a.clientData("webauthn.get", challenge)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := json.Marshal(map[string]interface{}{
+		"id":    b64url.EncodeToString(a.credID),
+		"rawId": b64url.EncodeToString(a.credID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64url.EncodeToString(clientData),
+			"authenticatorData": b64url.EncodeToString(authData),
+			"signature":         b64url.EncodeToString(sig),
+			"userHandle":        b64url.EncodeToString(a.userHandle),
+		},
+	})
+	return resp
+}
+
+type ceremonyStart struct {
+	Ceremony string `json:"ceremony"`
+	Options  struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	} `json:"options"`
+}
+
+func newTestApp(t *testing.T) *server.App {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("AUTH_MODE", "local")
+	t.Setenv("EXTERNAL_URL", "")
+
+	app := server.New()
+	database.InitAuthConfigDefaults(app)
+	if err := database.InitDatabase(app); err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	t.Cleanup(func() { app.DB.Close() })
+
+	app.SystemConfig.LocalAuthEnabled = true
+	app.SystemConfig.ExternalURL = "https://dash.example.com"
+	return app
+}
+
+func postJSON(t *testing.T, h http.HandlerFunc, path string, body interface{}, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h(w, req)
+	return w
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	app := newTestApp(t)
+
+	hash, err := auth.HashPassword("Password123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := app.DB.Exec("INSERT INTO users (username, email, display_name, password_hash, groups) VALUES ('alice', 'alice@example.com', 'Alice', ?, '[\"users\"]')", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := res.LastInsertId()
+
+	// A password session is needed to register a passkey
+	rec := httptest.NewRecorder()
+	if err := createLoginSession(app, rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", nil), int(userID)); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+
+	authenticator := newSoftAuthenticator(t, "dash.example.com", "https://dash.example.com")
+
+	w := postJSON(t, auth.RequireAuth(app, UserPasskeyRegisterBeginHandler(app)), "/api/user/passkeys/register/begin", nil, cookies)
+	if w.Code != http.StatusOK {
+		t.Fatalf("register begin: %d %s", w.Code, w.Body.String())
+	}
+	var start ceremonyStart
+	json.NewDecoder(w.Body).Decode(&start)
+
+	credential := authenticator.create(t, start.Options.PublicKey.Challenge, start.Options.PublicKey.User.ID)
+	finish := map[string]interface{}{"ceremony": start.Ceremony, "name": "Laptop", "credential": credential}
+	w = postJSON(t, auth.RequireAuth(app, UserPasskeyRegisterFinishHandler(app)), "/api/user/passkeys/register/finish", finish, cookies)
+	if w.Code != http.StatusOK {
+		t.Fatalf("register finish: %d %s", w.Code, w.Body.String())
+	}
+
+	// A ceremony can only be finished once
+	w = postJSON(t, auth.RequireAuth(app, UserPasskeyRegisterFinishHandler(app)), "/api/user/passkeys/register/finish", finish, cookies)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("replayed registration: got %d, want 400", w.Code)
+	}
+
+	creds, err := database.ListWebAuthnCredentials(app, int(userID))
+	if err != nil || len(creds) != 1 || creds[0].Name != "Laptop" {
+		t.Fatalf("stored passkeys = %+v, %v", creds, err)
+	}
+
+	login := func(t *testing.T, mutate func(json.RawMessage) json.RawMessage) *httptest.ResponseRecorder {
+		w := postJSON(t, PasskeyLoginBeginHandler(app), "/api/auth/passkey/begin", nil, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("login begin: %d %s", w.Code, w.Body.String())
+		}
+		var start ceremonyStart
+		json.NewDecoder(w.Body).Decode(&start)
+		assertion := authenticator.get(t, start.Options.PublicKey.Challenge)
+		if mutate != nil {
+			assertion = mutate(assertion)
+		}
+		return postJSON(t, PasskeyLoginFinishHandler(app), "/api/auth/passkey/finish",
+			map[string]interface{}{"ceremony": start.Ceremony, "credential": assertion}, nil)
+	}
+
+	t.Run("valid assertion creates a session", func(t *testing.T) {
+		w := login(t, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("login finish: %d %s", w.Code, w.Body.String())
+		}
+		var sessionCookie *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == app.AuthConfig.CookieName {
+				sessionCookie = c
+			}
+		}
+		if sessionCookie == nil {
+			t.Fatal("no session cookie set")
+		}
+		var sessionUser int
+		if err := app.DB.QueryRow("SELECT user_id FROM sessions WHERE token = ?", sessionCookie.Value).Scan(&sessionUser); err != nil || sessionUser != int(userID) {
+			t.Errorf("session row user = %d, %v; want %d", sessionUser, err, userID)
+		}
+	})
+
+	t.Run("tampered signature is rejected", func(t *testing.T) {
+		w := login(t, func(raw json.RawMessage) json.RawMessage {
+			var m map[string]interface{}
+			json.Unmarshal(raw, &m)
+			m["response"].(map[string]interface{})["signature"] = b64url.EncodeToString([]byte("not a signature"))
+			out, _ := json.Marshal(m)
+			return out
+		})
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("got %d, want 401", w.Code)
+		}
+	})
+
+	t.Run("replayed sign counter is rejected", func(t *testing.T) {
+		authenticator.signCount = 0
+		w := login(t, nil)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("got %d, want 401", w.Code)
+		}
+	})
+
+	t.Run("unavailable without external URL", func(t *testing.T) {
+		app.SystemConfig.ExternalURL = ""
+		defer func() { app.SystemConfig.ExternalURL = "https://dash.example.com" }()
+		w := postJSON(t, PasskeyLoginBeginHandler(app), "/api/auth/passkey/begin", nil, nil)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("got %d, want 404", w.Code)
+		}
+	})
+}
+
+func TestNewWebAuthnRelyingParty(t *testing.T) {
+	tests := []struct {
+		url    string
+		rpID   string
+		origin string
+		ok     bool
+	}{
+		{"https://dash.example.com", "dash.example.com", "https://dash.example.com", true},
+		{"https://dash.example.com:8443/base/", "dash.example.com", "https://dash.example.com:8443", true},
+		{"", "", "", false},
+		{"dash.example.com", "", "", false},
+		{"ftp://dash.example.com", "", "", false},
+	}
+	for _, tt := range tests {
+		rp, err := auth.NewWebAuthn(tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewWebAuthn(%q) error = %v, want ok=%v", tt.url, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if rp.Config.RPID != tt.rpID || len(rp.Config.RPOrigins) != 1 || rp.Config.RPOrigins[0] != tt.origin {
+			t.Errorf("NewWebAuthn(%q) = %q %v, want %q [%q]", tt.url, rp.Config.RPID, rp.Config.RPOrigins, tt.rpID, tt.origin)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package icons
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"dashgate/internal/server"
+	"dashgate/internal/urlvalidation"
+)
+
+// FaviconDir is the subdirectory of the icons path holding fetched favicons.
+// It is kept out of the icon picker, which only lists top-level files.
+const FaviconDir = "favicons"
+
+// maxFaviconPageSize limits how much of an app's HTML is scanned for icon links.
+const maxFaviconPageSize = 512 << 10
+
+// maxFaviconSize limits the size of a fetched favicon.
+const maxFaviconSize = 512 << 10
+
+var (
+	linkTagRe  = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	linkRelRe  = regexp.MustCompile(`(?is)\brel\s*=\s*["']?([^"'>]+)`)
+	linkHrefRe = regexp.MustCompile(`(?is)\bhref\s*=\s*["']?([^"'\s>]+)`)
+	hostSafeRe = regexp.MustCompile(`[^a-z0-9.-]+`)
+)
+
+// faviconExts maps sniffed content types to the extension used in the cache.
+var faviconExts = map[string]string{
+	"image/png":                ".png",
+	"image/x-icon":             ".ico",
+	"image/vnd.microsoft.icon": ".ico",
+	"image/jpeg":               ".jpg",
+	"image/webp":               ".webp",
+}
+
+// FetchFavicon downloads the apple-touch-icon or favicon advertised by the
+// app at appURL and stores it in the favicon cache. Returns the icon path
+// relative to the icons directory, e.g. "favicons/sonarr.example.com.png".
+func FetchFavicon(app *server.App, appURL string) (string, error) {
+	base, err := url.Parse(appURL)
+	if err != nil || base.Hostname() == "" {
+		return "", fmt.Errorf("invalid app URL")
+	}
+	if err := urlvalidation.ValidateDiscoveryURL(appURL); err != nil {
+		return "", err
+	}
+
+	candidates := faviconCandidates(app, base)
+	for _, iconURL := range candidates {
+		content, ext, err := fetchIconImage(app, iconURL)
+		if err != nil {
+			continue
+		}
+		filename := path.Join(FaviconDir, cacheName(base.Hostname())+ext)
+		if err := writeIconFile(app.IconsPath, filename, content); err != nil {
+			return "", err
+		}
+		return filename, nil
+	}
+	return "", ErrNotFound
+}
+
+// faviconCandidates returns icon URLs for the app, preferring apple-touch-icon
+// links from its landing page, then other icon links, then /favicon.ico.
+func faviconCandidates(app *server.App, base *url.URL) []string {
+	var touch, other []string
+
+	if resp, err := app.HTTPClient.Get(base.String()); err == nil {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxFaviconPageSize))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			for _, tag := range linkTagRe.FindAllString(string(body), -1) {
+				relMatch := linkRelRe.FindStringSubmatch(tag)
+				hrefMatch := linkHrefRe.FindStringSubmatch(tag)
+				if relMatch == nil || hrefMatch == nil {
+					continue
+				}
+				rel := strings.ToLower(relMatch[1])
+				ref, err := url.Parse(hrefMatch[1])
+				if err != nil {
+					continue
+				}
+				resolved := base.ResolveReference(ref).String()
+				switch {
+				case strings.Contains(rel, "apple-touch-icon"):
+					touch = append(touch, resolved)
+				case strings.Contains(rel, "icon"):
+					other = append(other, resolved)
+				}
+			}
+		}
+	}
+
+	fallback := base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String()
+	return append(append(touch, other...), fallback)
+}
+
+// fetchIconImage downloads an icon and checks that it really is an image.
+// SVGs are only accepted if they pass ValidateSVGContent.
+func fetchIconImage(app *server.App, iconURL string) ([]byte, string, error) {
+	u, err := url.Parse(iconURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, "", fmt.Errorf("unsupported icon URL")
+	}
+	if err := urlvalidation.ValidateDiscoveryURL(iconURL); err != nil {
+		return nil, "", err
+	}
+
+	resp, err := app.HTTPClient.Get(iconURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxFaviconSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(content) == 0 || len(content) > maxFaviconSize {
+		return nil, "", fmt.Errorf("icon size out of range")
+	}
+
+	if strings.Contains(resp.Header.Get("Content-Type"), "svg") || strings.HasSuffix(strings.ToLower(u.Path), ".svg") {
+		if !strings.Contains(strings.ToLower(string(content)), "<svg") {
+			return nil, "", fmt.Errorf("not an SVG")
+		}
+		if err := ValidateSVGContent(content); err != nil {
+			return nil, "", err
+		}
+		return content, ".svg", nil
+	}
+
+	ext, ok := faviconExts[http.DetectContentType(content)]
+	if !ok {
+		return nil, "", fmt.Errorf("not an image")
+	}
+	return content, ext, nil
+}
+
+// cacheName turns a hostname into a safe file name.
+func cacheName(host string) string {
+	name := hostSafeRe.ReplaceAllString(strings.ToLower(host), "-")
+	name = strings.Trim(name, ".-")
+	if name == "" {
+		name = "unknown"
+	}
+	return name
+}
+
+// CachedFavicon returns the cached favicon for a host relative to the icons
+// directory, or "" if none has been fetched yet.
+func CachedFavicon(iconsPath, host string) string {
+	name := cacheName(host)
+	for _, ext := range []string{".png", ".svg", ".ico", ".jpg", ".webp"} {
+		filename := path.Join(FaviconDir, name+ext)
+		if _, err := os.Stat(filepath.Join(iconsPath, filename)); err == nil {
+			return filename
+		}
+	}
+	return ""
+}
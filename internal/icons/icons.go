@@ -0,0 +1,238 @@
+package icons
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"dashgate/internal/server"
+)
+
+// dashboard-icons CDN endpoints. Variables so tests can point them at a mock server.
+var (
+	DashboardIconsIndexURL = "https://cdn.jsdelivr.net/gh/homarr-labs/dashboard-icons/tree.json"
+	DashboardIconsSVGURL   = "https://cdn.jsdelivr.net/gh/homarr-labs/dashboard-icons/svg/"
+)
+
+// ValidName matches icon names that are safe to use as file names.
+var ValidName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// Errors returned by DownloadDashboardIcon.
+var (
+	ErrInvalidName = errors.New("invalid icon name")
+	ErrNotFound    = errors.New("icon not found")
+	ErrUnsafe      = errors.New("icon failed safety validation")
+)
+
+// imageExts lists the file extensions treated as icons.
+var imageExts = []string{".svg", ".png", ".jpg", ".jpeg", ".webp", ".ico"}
+
+// Dashboard icons index cache
+var (
+	indexCache       []string
+	indexCacheTime   time.Time
+	indexFailureTime time.Time
+	indexMu          sync.Mutex
+	indexCacheTTL    = 24 * time.Hour
+	indexRetryDelay  = 10 * time.Minute
+)
+
+// ResetIndexCache drops the cached dashboard-icons index.
+func ResetIndexCache() {
+	indexMu.Lock()
+	indexCache = nil
+	indexCacheTime = time.Time{}
+	indexFailureTime = time.Time{}
+	indexMu.Unlock()
+}
+
+// DashboardIconsIndex returns the names of all SVG icons in the dashboard-icons
+// repository. The index is cached for 24 hours; after a failed fetch, callers
+// get the stale cache (or an error) for a while instead of hammering the CDN.
+func DashboardIconsIndex(app *server.App) ([]string, error) {
+	indexMu.Lock()
+	if indexCache != nil && time.Since(indexCacheTime) < indexCacheTTL {
+		cached := indexCache
+		indexMu.Unlock()
+		return cached, nil
+	}
+	if time.Since(indexFailureTime) < indexRetryDelay {
+		cached := indexCache
+		indexMu.Unlock()
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, fmt.Errorf("icon index temporarily unavailable")
+	}
+	indexMu.Unlock()
+
+	names, err := fetchIndex(app)
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if err != nil {
+		indexFailureTime = time.Now()
+		return nil, err
+	}
+	indexCache = names
+	indexCacheTime = time.Now()
+	return names, nil
+}
+
+// fetchIndex downloads and parses the dashboard-icons tree.json.
+func fetchIndex(app *server.App) ([]string, error) {
+	resp, err := app.HTTPClient.Get(DashboardIconsIndexURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetching icon index: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("icon index returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 5<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading icon index: %w", err)
+	}
+
+	var tree map[string][]string
+	if err := json.Unmarshal(body, &tree); err != nil {
+		return nil, fmt.Errorf("parsing icon index: %w", err)
+	}
+
+	svgList := tree["svg"]
+	names := make([]string, 0, len(svgList))
+	for _, entry := range svgList {
+		name := strings.TrimSuffix(entry, ".svg")
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// DownloadDashboardIcon fetches an SVG from dashboard-icons, validates it and
+// stores it in the icons directory. Returns the saved file name.
+func DownloadDashboardIcon(app *server.App, name string) (string, error) {
+	if name == "" || !ValidName.MatchString(name) {
+		return "", ErrInvalidName
+	}
+
+	resp, err := app.HTTPClient.Get(DashboardIconsSVGURL + name + ".svg")
+	if err != nil {
+		return "", fmt.Errorf("downloading icon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", ErrNotFound
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("reading icon: %w", err)
+	}
+
+	ct := resp.Header.Get("Content-Type")
+	if !strings.Contains(ct, "svg") && !strings.Contains(ct, "xml") && !strings.Contains(ct, "octet-stream") {
+		return "", fmt.Errorf("%w: unexpected content type %q", ErrUnsafe, ct)
+	}
+
+	if err := ValidateSVGContent(content); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnsafe, err)
+	}
+
+	filename := name + ".svg"
+	if err := writeIconFile(app.IconsPath, filename, content); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// writeIconFile writes content below the icons directory, refusing paths
+// that would escape it.
+func writeIconFile(iconsPath, filename string, content []byte) error {
+	dstPath := filepath.Join(iconsPath, filename)
+	cleanDst := filepath.Clean(dstPath)
+	cleanBase := filepath.Clean(iconsPath)
+	if !strings.HasPrefix(cleanDst, cleanBase+string(filepath.Separator)) {
+		return ErrInvalidName
+	}
+	if err := os.MkdirAll(filepath.Dir(cleanDst), 0755); err != nil {
+		return fmt.Errorf("creating icon directory: %w", err)
+	}
+	if err := os.WriteFile(cleanDst, content, 0644); err != nil {
+		return fmt.Errorf("saving icon: %w", err)
+	}
+	return nil
+}
+
+// LocalIcons returns the icon files in the icons directory keyed by their
+// lower-cased name without extension. SVGs win over raster formats.
+func LocalIcons(iconsPath string) map[string]string {
+	result := make(map[string]string)
+	entries, err := os.ReadDir(iconsPath)
+	if err != nil {
+		log.Printf("Error reading icons directory: %v", err)
+		return result
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if !isImageExt(ext) {
+			continue
+		}
+		stem := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+		if existing, ok := result[stem]; ok && strings.HasSuffix(existing, ".svg") {
+			continue
+		}
+		result[stem] = name
+	}
+	return result
+}
+
+// isImageExt reports whether ext (including the dot) is an icon file extension.
+func isImageExt(ext string) bool {
+	for _, e := range imageExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSVGContent checks SVG content for dangerous XSS patterns.
+func ValidateSVGContent(content []byte) error {
+	contentStr := strings.ToLower(string(content))
+	dangerousPatterns := []string{
+		"<script", "javascript:", "vbscript:", "data:text/html", "data:image/svg+xml",
+		"onerror", "onload", "onclick", "onmouseover", "onmouseout",
+		"onfocus", "onblur", "oninput", "onchange", "onsubmit",
+		"onkeydown", "onkeyup", "onkeypress", "onmousedown", "onmouseup",
+		"ondblclick", "oncontextmenu", "ondrag", "ondragend", "ondragenter",
+		"ondragleave", "ondragover", "ondragstart", "ondrop", "onscroll",
+		"onwheel", "oncopy", "oncut", "onpaste", "onanimationend",
+		"onanimationstart", "ontransitionend", "onresize", "ontoggle",
+		"onbegin", "onend", "onrepeat",
+		"<foreignobject", "<iframe", "<embed", "<object", "<handler",
+		"expression(",
+	}
+	for _, pattern := range dangerousPatterns {
+		if strings.Contains(contentStr, pattern) {
+			return fmt.Errorf("SVG contains potentially unsafe content: %s", pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package icons
+
+import (
+	"testing"
+)
+
+func TestValidateSVGContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"clean SVG", `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M0 0h24v24H0z"/></svg>`, false},
+		{"script tag", `<svg><script>alert(1)</script></svg>`, true},
+		{"javascript URL", `<svg><a href="javascript:alert(1)">x</a></svg>`, true},
+		{"onerror handler", `<svg><img onerror="alert(1)"/></svg>`, true},
+		{"onclick handler", `<svg onclick="alert(1)"><rect/></svg>`, true},
+		{"foreignObject", `<svg><foreignObject><body xmlns="http://www.w3.org/1999/xhtml"><script>alert(1)</script></body></foreignObject></svg>`, true},
+		{"expression", `<svg><rect style="width:expression(alert(1))"/></svg>`, true},
+		{"vbscript", `<svg><a href="vbscript:msgbox">x</a></svg>`, true},
+		{"data:text/html", `<svg><a href="data:text/html,<script>alert(1)</script>">x</a></svg>`, true},
+		{"case insensitive", `<svg><SCRIPT>alert(1)</SCRIPT></svg>`, true},
+		{"empty", ``, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSVGContent([]byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSVGContent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidNameRegex(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{"simple name", "sonarr", true},
+		{"with dash", "my-app", true},
+		{"with dot", "my.app", true},
+		{"with underscore", "my_app", true},
+		{"with numbers", "app123", true},
+		{"mixed case", "MyApp", true},
+		{"with slash", "path/to/icon", false},
+		{"with backslash", `path\icon`, false},
+		{"with spaces", "my app", false},
+		{"empty", "", false},
+		{"dot-dot", "..", true}, // regex allows it, but filepath.Clean handles traversal
+		{"special chars", "app<script>", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidName.MatchString(tt.input)
+			if got != tt.valid {
+				t.Errorf("ValidName.MatchString(%q) = %v, want %v", tt.input, got, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package icons
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// aliases maps common container, host and app names to their dashboard-icons name.
+var aliases = map[string]string{
+	"adguard":              "adguard-home",
+	"adguardhome":          "adguard-home",
+	"bitwarden":            "vaultwarden",
+	"hass":                 "home-assistant",
+	"homeassistant":        "home-assistant",
+	"jellyfin-server":      "jellyfin",
+	"npm":                  "nginx-proxy-manager",
+	"nginxproxymanager":    "nginx-proxy-manager",
+	"nextcloud-aio":        "nextcloud",
+	"pihole":               "pi-hole",
+	"plex-media-server":    "plex",
+	"plexmediaserver":      "plex",
+	"pms":                  "plex",
+	"portainer-ce":         "portainer",
+	"portainer-ee":         "portainer",
+	"qbittorrent-nox":      "qbittorrent",
+	"qbit":                 "qbittorrent",
+	"syncthing-relay":      "syncthing",
+	"unifi-controller":     "unifi",
+	"unifi-network":        "unifi",
+	"uptime":               "uptime-kuma",
+	"uptimekuma":           "uptime-kuma",
+	"vw":                   "vaultwarden",
+	"zigbee2mqtt-frontend": "zigbee2mqtt",
+}
+
+// genericSuffixes are stripped from candidates as a fallback ("sonarr-4k" -> "sonarr").
+var genericSuffixes = []string{"-4k", "-app", "-server", "-web", "-ui", "-frontend", "-backend", "-dev", "-prod", "-beta"}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Normalize turns a name into a dashboard-icons style slug
+// ("Home Assistant" -> "home-assistant").
+func Normalize(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer(" ", "-", "_", "-", ".", "-").Replace(s)
+	s = nonSlugChars.ReplaceAllString(s, "")
+	for strings.Contains(s, "--") {
+		s = strings.ReplaceAll(s, "--", "-")
+	}
+	return strings.Trim(s, "-")
+}
+
+// imageName extracts the repository name from a container image reference
+// ("lscr.io/linuxserver/sonarr:latest" -> "sonarr").
+func imageName(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, "/"); i >= 0 {
+		image = image[i+1:]
+	}
+	if i := strings.Index(image, ":"); i >= 0 {
+		image = image[:i]
+	}
+	return image
+}
+
+// Candidates returns normalized lookup keys for a discovered app, most
+// specific first: app name, subdomain, then the container image name.
+func Candidates(name, rawURL, image string) []string {
+	var raw []string
+	raw = append(raw, name)
+	if u, err := url.Parse(rawURL); err == nil && u.Hostname() != "" {
+		raw = append(raw, strings.Split(u.Hostname(), ".")[0])
+	}
+	if image != "" {
+		raw = append(raw, imageName(image))
+	}
+
+	seen := make(map[string]bool)
+	var result []string
+	add := func(c string) {
+		if c != "" && !seen[c] {
+			seen[c] = true
+			result = append(result, c)
+		}
+	}
+	for _, r := range raw {
+		c := Normalize(r)
+		if alias, ok := aliases[c]; ok {
+			add(alias)
+		}
+		add(c)
+	}
+	return result
+}
+
+// Match finds the best icon name in available for the given candidates.
+// It tries, in order: exact match, match ignoring dashes, match after
+// stripping generic suffixes, and finally a one-edit fuzzy match for longer
+// names. Returns "" when nothing matches.
+func Match(candidates []string, available []string) string {
+	if len(candidates) == 0 || len(available) == 0 {
+		return ""
+	}
+
+	exact := make(map[string]string, len(available))
+	compact := make(map[string]string, len(available))
+	for _, a := range available {
+		key := strings.ToLower(a)
+		exact[key] = a
+		compact[strings.ReplaceAll(key, "-", "")] = a
+	}
+
+	for _, c := range candidates {
+		if a, ok := exact[c]; ok {
+			return a
+		}
+	}
+	for _, c := range candidates {
+		if a, ok := compact[strings.ReplaceAll(c, "-", "")]; ok {
+			return a
+		}
+	}
+	for _, c := range candidates {
+		for _, suffix := range genericSuffixes {
+			if trimmed := strings.TrimSuffix(c, suffix); trimmed != c {
+				if a, ok := exact[trimmed]; ok {
+					return a
+				}
+			}
+		}
+	}
+	for _, c := range candidates {
+		if len(c) < 6 {
+			continue
+		}
+		for _, a := range available {
+			key := strings.ToLower(a)
+			if abs(len(key)-len(c)) <= 1 && levenshtein(key, c) == 1 {
+				return a
+			}
+		}
+	}
+	return ""
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
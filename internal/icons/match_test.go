@@ -0,0 +1,47 @@
+package icons
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCandidates(t *testing.T) {
+	got := Candidates("Home Assistant", "https://hass.lab.example.com", "ghcr.io/home-assistant/home-assistant:stable")
+	want := []string{"home-assistant", "hass"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Candidates() = %v, want %v", got, want)
+	}
+
+	got = Candidates("Media", "https://tv.example.com", "lscr.io/linuxserver/sonarr:latest")
+	want = []string{"media", "tv", "sonarr"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Candidates() = %v, want %v", got, want)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	available := []string{"sonarr", "radarr", "pi-hole", "home-assistant", "jellyfin", "nextcloud"}
+
+	tests := []struct {
+		name       string
+		candidates []string
+		want       string
+	}{
+		{"exact", []string{"sonarr"}, "sonarr"},
+		{"first candidate wins", []string{"radarr", "sonarr"}, "radarr"},
+		{"ignores dashes", []string{"homeassistant"}, "home-assistant"},
+		{"alias resolved by Candidates", Candidates("pihole", "", ""), "pi-hole"},
+		{"generic suffix", []string{"sonarr-4k"}, "sonarr"},
+		{"one typo", []string{"jelyfin"}, "jellyfin"},
+		{"short names are not fuzzy matched", []string{"radar"}, ""},
+		{"no match", []string{"grafana"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.candidates, available); got != tt.want {
+				t.Errorf("Match(%v) = %q, want %q", tt.candidates, got, tt.want)
+			}
+		})
+	}
+}
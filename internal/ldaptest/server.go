@@ -0,0 +1,563 @@
+// Package ldaptest provides an in-process LDAP server for tests, in the spirit
+// of net/http/httptest. It understands simple binds and searches with the
+// filter types DashGate uses, including the Active Directory
+// LDAP_MATCHING_RULE_IN_CHAIN extensible match, and the password modify
+// extended operation.
+package ldaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// matchingRuleInChain evaluates membership transitively, as Active Directory does.
+const matchingRuleInChain = "1.2.840.113556.1.4.1941"
+
+// Entry is a directory entry served by a Server.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// get returns the values of attr, matching the attribute name case-insensitively.
+func (e *Entry) get(attr string) []string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attr) {
+			return values
+		}
+	}
+	return nil
+}
+
+// Server is an LDAP server listening on a local port.
+type Server struct {
+	URL string // ldap://127.0.0.1:port, or ldaps:// after StartTLS
+
+	// RequireClientCert makes StartTLS demand a client certificate issued
+	// with IssueClientCert.
+	RequireClientCert bool
+
+	ln          net.Listener
+	mu          sync.Mutex
+	entries     []*Entry
+	passwords   map[string]string // normalized DN -> password
+	searches    int
+	connections int
+	conns       map[net.Conn]bool
+	wg          sync.WaitGroup
+
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+}
+
+// NewServer starts a server with no entries. Callers should call Close when done.
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server that is not serving yet, so that
+// options can be set before Start or StartTLS.
+func NewUnstartedServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("ldaptest: failed to listen: " + err.Error())
+	}
+	return &Server{
+		ln:        ln,
+		passwords: make(map[string]string),
+		conns:     make(map[net.Conn]bool),
+	}
+}
+
+// Start serves plain LDAP.
+func (s *Server) Start() {
+	s.URL = "ldap://" + s.ln.Addr().String()
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// StartTLS serves LDAP over TLS (ldaps://) with a self-signed certificate
+// for 127.0.0.1, available from CertificatePEM.
+func (s *Server) StartTLS() {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic("ldaptest: " + err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldaptest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic("ldaptest: " + err.Error())
+	}
+	s.caCert, _ = x509.ParseCertificate(der)
+	s.caKey = key
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+	if s.RequireClientCert {
+		pool := x509.NewCertPool()
+		pool.AddCert(s.caCert)
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	s.ln = tls.NewListener(s.ln, config)
+	s.URL = "ldaps://" + s.ln.Addr().String()
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// CertificatePEM returns the server's self-signed certificate, which is also
+// the CA of client certificates.
+func (s *Server) CertificatePEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.caCert.Raw}))
+}
+
+// IssueClientCert returns a client certificate and key, in PEM, that a TLS
+// server with RequireClientCert accepts.
+func (s *Server) IssueClientCert(commonName string) (certPEM, keyPEM string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic("ldaptest: " + err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.caCert, &key.PublicKey, s.caKey)
+	if err != nil {
+		panic("ldaptest: " + err.Error())
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// CloseConnections drops all open connections, as a server does with idle
+// clients, while continuing to accept new ones.
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Connections returns the number of connections accepted so far.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+// Close stops the server and closes all open connections.
+func (s *Server) Close() {
+	s.ln.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// AddEntry adds an entry. Attribute values are matched case-insensitively.
+func (s *Server) AddEntry(dn string, attrs map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, &Entry{DN: dn, Attributes: attrs})
+}
+
+// RemoveEntry removes the entry with the given DN, if any.
+func (s *Server) RemoveEntry(dn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := normalize(dn)
+	for i, e := range s.entries {
+		if normalize(e.DN) == key {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetPassword sets the password for simple binds as dn.
+func (s *Server) SetPassword(dn, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passwords[normalize(dn)] = password
+}
+
+// Searches returns the number of search requests served so far.
+func (s *Server) Searches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.searches
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.connections++
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	var bound string // DN of the last successful bind
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		var responses []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := s.bind(op)
+			bound = ""
+			if code == ldap.LDAPResultSuccess {
+				bound = op.Children[1].Data.String()
+			}
+			responses = append(responses, result(ldap.ApplicationBindResponse, code, ""))
+		case ldap.ApplicationExtendedRequest:
+			responses = append(responses, result(ldap.ApplicationExtendedResponse, s.extended(op, bound), ""))
+		case ldap.ApplicationSearchRequest:
+			responses = s.search(op)
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationAbandonRequest:
+			continue
+		default:
+			responses = append(responses, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform, "operation not supported"))
+		}
+
+		for _, resp := range responses {
+			envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+			envelope.AppendChild(resp)
+			if _, err := conn.Write(envelope.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind checks a simple bind request and returns the LDAP result code.
+func (s *Server) bind(op *ber.Packet) uint16 {
+	if len(op.Children) < 3 {
+		return ldap.LDAPResultProtocolError
+	}
+	name, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+	if name == "" && password == "" {
+		return ldap.LDAPResultSuccess
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if want, ok := s.passwords[normalize(name)]; ok && password != "" && want == password {
+		return ldap.LDAPResultSuccess
+	}
+	return ldap.LDAPResultInvalidCredentials
+}
+
+// passwordModifyOID is the password modify extended operation (RFC 3062).
+const passwordModifyOID = "1.3.6.1.4.1.4203.1.11.1"
+
+// extended answers a password modify request from a bound connection by
+// setting the password of the target entry (the bound DN if none is given).
+func (s *Server) extended(op *ber.Packet, bound string) uint16 {
+	if len(op.Children) < 1 || op.Children[0].Data.String() != passwordModifyOID {
+		return ldap.LDAPResultUnwillingToPerform
+	}
+	if bound == "" {
+		return ldap.LDAPResultInsufficientAccessRights
+	}
+	target, newPassword := bound, ""
+	if len(op.Children) > 1 {
+		req, err := ber.DecodePacketErr(op.Children[1].Data.Bytes())
+		if err != nil {
+			return ldap.LDAPResultProtocolError
+		}
+		for _, field := range req.Children {
+			switch field.Tag {
+			case 0:
+				target = field.Data.String()
+			case 2:
+				newPassword = field.Data.String()
+			}
+		}
+	}
+	if newPassword == "" {
+		return ldap.LDAPResultUnwillingToPerform
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lookup(target) == nil {
+		return ldap.LDAPResultNoSuchObject
+	}
+	s.passwords[normalize(target)] = newPassword
+	return ldap.LDAPResultSuccess
+}
+
+// search answers a search request with the matching entries followed by
+// the search result done message.
+func (s *Server) search(op *ber.Packet) []*ber.Packet {
+	if len(op.Children) < 8 {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, "malformed search")}
+	}
+	base := op.Children[0].Data.String()
+	scope, _ := op.Children[1].Value.(int64)
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+	var attrs []string
+	for _, a := range op.Children[7].Children {
+		attrs = append(attrs, a.Data.String())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.searches++
+
+	baseDN, err := ldap.ParseDN(base)
+	if err != nil {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInvalidDNSyntax, err.Error())}
+	}
+
+	var responses []*ber.Packet
+	code := uint16(ldap.LDAPResultSuccess)
+	for _, e := range s.entries {
+		dn, err := ldap.ParseDN(e.DN)
+		if err != nil || !inScope(baseDN, dn, int(scope)) || !s.match(e, filter) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(responses)) >= sizeLimit {
+			code = ldap.LDAPResultSizeLimitExceeded
+			break
+		}
+		responses = append(responses, encodeEntry(e, attrs))
+	}
+	return append(responses, result(ldap.ApplicationSearchResultDone, code, ""))
+}
+
+func inScope(base, dn *ldap.DN, scope int) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return base.EqualFold(dn)
+	case ldap.ScopeSingleLevel:
+		return len(dn.RDNs) == len(base.RDNs)+1 && base.AncestorOfFold(dn)
+	default:
+		return base.EqualFold(dn) || base.AncestorOfFold(dn)
+	}
+}
+
+// match evaluates a BER-encoded filter against an entry.
+func (s *Server) match(e *Entry, f *ber.Packet) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !s.match(e, c) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if s.match(e, c) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(f.Children) == 1 && !s.match(e, f.Children[0])
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch:
+		return hasValue(e.get(f.Children[0].Data.String()), f.Children[1].Data.String())
+	case ldap.FilterPresent:
+		attr := f.Data.String()
+		return strings.EqualFold(attr, "objectClass") || len(e.get(attr)) > 0
+	case ldap.FilterSubstrings:
+		for _, v := range e.get(f.Children[0].Data.String()) {
+			if matchSubstrings(strings.ToLower(v), f.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterExtensibleMatch:
+		var rule, attr, value string
+		for _, c := range f.Children {
+			switch c.Tag {
+			case ldap.MatchingRuleAssertionMatchingRule:
+				rule = c.Data.String()
+			case ldap.MatchingRuleAssertionType:
+				attr = c.Data.String()
+			case ldap.MatchingRuleAssertionMatchValue:
+				value = c.Data.String()
+			}
+		}
+		if rule == matchingRuleInChain {
+			return s.inChain(e, attr, value, map[string]bool{})
+		}
+		return hasValue(e.get(attr), value)
+	}
+	return false
+}
+
+// inChain reports whether value is reachable from e by following attr
+// through the entries it references.
+func (s *Server) inChain(e *Entry, attr, value string, visited map[string]bool) bool {
+	visited[normalize(e.DN)] = true
+	for _, v := range e.get(attr) {
+		if normalize(v) == normalize(value) {
+			return true
+		}
+		if next := s.lookup(v); next != nil && !visited[normalize(next.DN)] && s.inChain(next, attr, value, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) lookup(dn string) *Entry {
+	key := normalize(dn)
+	for _, e := range s.entries {
+		if normalize(e.DN) == key {
+			return e
+		}
+	}
+	return nil
+}
+
+func hasValue(values []string, want string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, want) || (strings.Contains(v, "=") && normalize(v) == normalize(want)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSubstrings(v string, parts []*ber.Packet) bool {
+	for _, p := range parts {
+		sub := strings.ToLower(p.Data.String())
+		switch p.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(v, sub) {
+				return false
+			}
+			v = v[len(sub):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(v, sub)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(sub):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(v, sub) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func encodeEntry(e *Entry, attrs []string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "Object Name"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range e.Attributes {
+		if !wanted(attrs, name) {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	p.AppendChild(list)
+	return p
+}
+
+func wanted(attrs []string, name string) bool {
+	if len(attrs) == 0 {
+		return true
+	}
+	for _, a := range attrs {
+		if a == "*" || strings.EqualFold(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func result(tag ber.Tag, code uint16, message string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(code), "Result Code"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	return p
+}
+
+// normalize returns a lowercase, whitespace-free form of a DN for comparisons.
+func normalize(s string) string {
+	dn, err := ldap.ParseDN(s)
+	if err != nil {
+		return strings.ToLower(s)
+	}
+	parts := make([]string, 0, len(dn.RDNs))
+	for _, rdn := range dn.RDNs {
+		for _, a := range rdn.Attributes {
+			parts = append(parts, strings.ToLower(a.Type)+"="+strings.ToLower(a.Value))
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/go-ldap/ldap/v3"
+
 	"dashgate/internal/models"
 	"dashgate/internal/server"
 )
@@ -32,6 +35,8 @@ func InitLLDAP(app *server.App) {
 		URL:      strings.TrimSuffix(url, "/"),
 		Username: username,
 		Password: password,
+		LDAPURL:  os.Getenv("LLDAP_LDAP_URL"),
+		BaseDN:   os.Getenv("LLDAP_BASE_DN"),
 	}
 
 	if err := RefreshToken(app); err != nil {
@@ -242,3 +247,122 @@ func ListGroups(app *server.App) ([]models.LLDAPGroup, error) {
 
 	return groups, nil
 }
+
+// GraphQLError is an error reported by the LLDAP GraphQL API, such as an
+// existing user or an unknown group. Its message is meant for the admin.
+type GraphQLError struct {
+	Message string
+}
+
+func (e *GraphQLError) Error() string {
+	return "GraphQL error: " + e.Message
+}
+
+// mutate runs a GraphQL mutation and decodes its data into out, if not nil.
+func mutate(app *server.App, query string, variables map[string]interface{}, out interface{}) error {
+	respBody, err := GraphQL(app, query, variables)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return &GraphQLError{Message: result.Errors[0].Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Data, out)
+}
+
+// CreateUser creates a user without a password; see SetPassword.
+func CreateUser(app *server.App, id, email, displayName string) error {
+	query := `mutation($user: CreateUserInput!) { createUser(user: $user) { id } }`
+	return mutate(app, query, map[string]interface{}{
+		"user": map[string]interface{}{"id": id, "email": email, "displayName": displayName},
+	}, nil)
+}
+
+// DeleteUser deletes a user.
+func DeleteUser(app *server.App, id string) error {
+	query := `mutation($userId: String!) { deleteUser(userId: $userId) { ok } }`
+	return mutate(app, query, map[string]interface{}{"userId": id}, nil)
+}
+
+// CreateGroup creates a group and returns it.
+func CreateGroup(app *server.App, name string) (models.LLDAPGroup, error) {
+	query := `mutation($name: String!) { createGroup(name: $name) { id displayName } }`
+	var data struct {
+		CreateGroup struct {
+			ID          int    `json:"id"`
+			DisplayName string `json:"displayName"`
+		} `json:"createGroup"`
+	}
+	if err := mutate(app, query, map[string]interface{}{"name": name}, &data); err != nil {
+		return models.LLDAPGroup{}, err
+	}
+	return models.LLDAPGroup{ID: data.CreateGroup.ID, DisplayName: data.CreateGroup.DisplayName, Users: []string{}}, nil
+}
+
+// DeleteGroup deletes a group.
+func DeleteGroup(app *server.App, groupID int) error {
+	query := `mutation($groupId: Int!) { deleteGroup(groupId: $groupId) { ok } }`
+	return mutate(app, query, map[string]interface{}{"groupId": groupID}, nil)
+}
+
+// AddUserToGroup makes a user a member of a group.
+func AddUserToGroup(app *server.App, userID string, groupID int) error {
+	query := `mutation($userId: String!, $groupId: Int!) { addUserToGroup(userId: $userId, groupId: $groupId) { ok } }`
+	return mutate(app, query, map[string]interface{}{"userId": userID, "groupId": groupID}, nil)
+}
+
+// RemoveUserFromGroup removes a user from a group.
+func RemoveUserFromGroup(app *server.App, userID string, groupID int) error {
+	query := `mutation($userId: String!, $groupId: Int!) { removeUserFromGroup(userId: $userId, groupId: $groupId) { ok } }`
+	return mutate(app, query, map[string]interface{}{"userId": userID, "groupId": groupID}, nil)
+}
+
+// CanSetPasswords reports whether LLDAP's LDAP interface is configured
+// (LLDAP_LDAP_URL and LLDAP_BASE_DN), which SetPassword needs.
+func CanSetPasswords(app *server.App) bool {
+	return app.LLDAPConfig != nil && app.LLDAPConfig.LDAPURL != "" && app.LLDAPConfig.BaseDN != ""
+}
+
+// SetPassword sets a user's password. LLDAP's GraphQL API has no password
+// mutation (passwords are registered with the OPAQUE protocol), so this uses
+// the LDAP password modify extended operation on LLDAP's LDAP interface,
+// bound as the LLDAP admin.
+func SetPassword(app *server.App, userID, password string) error {
+	if !CanSetPasswords(app) {
+		return fmt.Errorf("LLDAP_LDAP_URL and LLDAP_BASE_DN are not set")
+	}
+	l := app.LLDAPConfig
+
+	conn, err := ldap.DialURL(l.LDAPURL, ldap.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}))
+	if err != nil {
+		return fmt.Errorf("LDAP connection failed: %w", err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(10 * time.Second)
+
+	if err := conn.Bind(userDN(l, l.Username), l.Password); err != nil {
+		return fmt.Errorf("LDAP bind failed: %w", err)
+	}
+	if _, err := conn.PasswordModify(ldap.NewPasswordModifyRequest(userDN(l, userID), "", password)); err != nil {
+		return fmt.Errorf("LDAP password change failed: %w", err)
+	}
+	return nil
+}
+
+// userDN returns the DN LLDAP gives the user id.
+func userDN(l *server.LLDAPConfigRef, id string) string {
+	return "uid=" + ldap.EscapeDN(id) + ",ou=people," + l.BaseDN
+}
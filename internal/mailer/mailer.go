@@ -0,0 +1,169 @@
+// Package mailer sends plain-text notification emails through an SMTP server.
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Connection security modes.
+const (
+	SecurityStartTLS = "starttls" // plain connection upgraded with STARTTLS (port 587)
+	SecurityTLS      = "tls"      // implicit TLS (port 465)
+	SecurityNone     = "none"     // unencrypted, for relays on a trusted network
+)
+
+const (
+	dialTimeout = 10 * time.Second
+	sendTimeout = 30 * time.Second
+)
+
+// Config describes the SMTP server to send through.
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string // "DashGate <dashgate@example.com>" or a bare address
+	Security string
+}
+
+// Configured reports whether enough settings are present to send mail.
+func (c Config) Configured() bool {
+	return c.Host != "" && c.Port > 0 && c.From != ""
+}
+
+// Validate checks the settings without connecting.
+func (c Config) Validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("SMTP host is required")
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("SMTP port must be between 1 and 65535")
+	}
+	switch c.Security {
+	case SecurityStartTLS, SecurityTLS, SecurityNone:
+	default:
+		return fmt.Errorf("SMTP security must be starttls, tls or none")
+	}
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		return fmt.Errorf("invalid sender address: %v", err)
+	}
+	return nil
+}
+
+// Send delivers a plain-text message to a single recipient.
+func Send(cfg Config, to, subject, body string) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	from, _ := mail.ParseAddress(cfg.From)
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %v", err)
+	}
+	msg, err := buildMessage(from, rcpt, subject, body)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var conn net.Conn
+	if cfg.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake: %w", err)
+	}
+	defer c.Close()
+
+	if cfg.Security == SecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS: %w", err)
+		}
+	}
+
+	if cfg.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted
+		// connection to anything but localhost
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication: %w", err)
+		}
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("MAIL FROM: %w", err)
+	}
+	if err := c.Rcpt(rcpt.Address); err != nil {
+		return fmt.Errorf("RCPT TO: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("sending message: %w", err)
+	}
+	return c.Quit()
+}
+
+// buildMessage renders the headers and quoted-printable body of a message.
+func buildMessage(from, to *mail.Address, subject, body string) ([]byte, error) {
+	if strings.ContainsAny(subject, "\r\n") {
+		return nil, fmt.Errorf("subject must be a single line")
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
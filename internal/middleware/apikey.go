@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"dashgate/internal/auth"
+	"dashgate/internal/database"
+	"dashgate/internal/server"
+)
+
+// statusRecorder remembers the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// APIKeyAuth checks the API key sent with a request once, refuses keys used
+// from outside their address allowlist or over their rate limit, and records
+// each request made with a key in its usage history.
+func APIKeyAuth(app *server.App) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res := auth.AuthenticateAPIKey(app, r)
+			r = auth.WithAPIKeyResult(r, res)
+			if res == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			switch {
+			case errors.Is(res.Err, auth.ErrAPIKeyRateLimited):
+				rec.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+				http.Error(rec, "Too many requests", http.StatusTooManyRequests)
+			case res.Err != nil:
+				http.Error(rec, "Forbidden: "+res.Err.Error(), http.StatusForbidden)
+			default:
+				next.ServeHTTP(rec, r)
+			}
+			database.LogAPIKeyUsage(app, res.KeyID, r.Method, r.URL.Path, auth.ClientIP(app, r), rec.status)
+		})
+	}
+}
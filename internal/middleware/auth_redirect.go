@@ -27,6 +27,15 @@ func AutoLoginRedirect(app *server.App) func(http.Handler) http.Handler {
 				"/offline",
 				"/auth/oidc",
 				"/auth/oidc/callback",
+				"/api/auth/login",
+				"/api/auth/config",
+				"/api/auth/passkey",
+				"/api/auth/verify",
+				"/reset-password",
+				"/api/auth/forgot-password",
+				"/api/auth/reset-password",
+				"/signup",
+				"/api/auth/signup",
 			}
 
 			for _, path := range publicPaths {
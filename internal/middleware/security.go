@@ -88,8 +88,12 @@ func generateCSRFToken() (string, error) {
 func CSRFProtection(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Skip CSRF entirely for health check endpoint (called by Docker
-		// healthcheck without cookies, would needlessly generate tokens).
-		if r.URL.Path == "/health" {
+		// healthcheck without cookies, would needlessly generate tokens)
+		// for forward-auth checks, which proxies send with the method of
+		// the original request and which never change state, and for OIDC
+		// back-channel logout, which the provider calls with a signed token.
+		if r.URL.Path == "/health" || r.URL.Path == "/api/auth/verify" || r.URL.Path == "/auth/oidc/backchannel-logout" ||
+			strings.HasPrefix(r.URL.Path, "/auth/oidc/backchannel-logout/") {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -207,6 +211,10 @@ type RateLimiter struct {
 	attempts map[string]*attemptRecord
 	limit    int
 	window   time.Duration
+
+	// ClientIP extracts the client address to count attempts against. It
+	// defaults to RemoteAddr; set it to honour X-Forwarded-For from trusted proxies.
+	ClientIP func(r *http.Request) string
 }
 
 type attemptRecord struct {
@@ -261,6 +269,9 @@ func (rl *RateLimiter) LimitPath(paths []string, next http.Handler) http.Handler
 		// Only rate limit POST to specific paths
 		if r.Method == "POST" && pathSet[r.URL.Path] {
 			ip := extractIP(r)
+			if rl.ClientIP != nil {
+				ip = rl.ClientIP(r)
+			}
 
 			rl.mu.Lock()
 			record, exists := rl.attempts[ip]
@@ -13,6 +13,11 @@ type App struct {
 	Description string   `yaml:"description" json:"description"`
 	DependsOn   []string `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
 	Status      string   `json:"status"`
+
+	// Discovery metadata (never persisted to config.yaml)
+	Upstream string            `yaml:"-" json:"-"`
+	Image    string            `yaml:"-" json:"-"`
+	Labels   map[string]string `yaml:"-" json:"-"`
 }
 
 // Category groups apps in DashGate.
@@ -35,7 +40,7 @@ type TemplateData struct {
 	Version    string
 }
 
-// LLDAPUser represents a user from the LLDAP directory (read-only).
+// LLDAPUser represents a user from the LLDAP directory.
 type LLDAPUser struct {
 	ID          string   `json:"id"`
 	Email       string   `json:"email"`
@@ -43,7 +48,7 @@ type LLDAPUser struct {
 	Groups      []string `json:"groups,omitempty"`
 }
 
-// LLDAPGroup represents a group from the LLDAP directory (read-only).
+// LLDAPGroup represents a group from the LLDAP directory.
 type LLDAPGroup struct {
 	ID          int      `json:"id"`
 	DisplayName string   `json:"displayName"`
@@ -62,16 +67,75 @@ type DiscoveredAppOverride struct {
 	Category            string   `json:"category"`
 	Groups              []string `json:"groups"`
 	Hidden              bool     `json:"hidden"`
+	HiddenSet           bool     `json:"hiddenSet"` // Hidden was chosen explicitly; otherwise rules may hide the app
+}
+
+// DiscoveryRule automatically assigns override values to every discovered app
+// it matches. Rules are evaluated in ascending Position order.
+type DiscoveryRule struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+	Enabled  bool   `json:"enabled"`
+
+	// Match criteria (all non-empty criteria must match)
+	MatchSource   string `json:"matchSource"`   // "docker", "traefik", "nginx", "npm", "caddy"
+	MatchHost     string `json:"matchHost"`     // glob, or regex when prefixed with "re:"
+	MatchLabel    string `json:"matchLabel"`    // "key" or "key=value" (value may be a glob)
+	MatchUpstream string `json:"matchUpstream"` // glob, or regex when prefixed with "re:"
+
+	// Assignments
+	Category     string   `json:"category"`
+	Groups       []string `json:"groups"`
+	Icon         string   `json:"icon"`
+	NameTemplate string   `json:"nameTemplate"` // e.g. "{name} ({subdomain})"
+	Hidden       bool     `json:"hidden"`
 }
 
 // DiscoveredAppWithOverride combines a raw discovered app with its override info.
 type DiscoveredAppWithOverride struct {
-	Name        string                 `json:"name"`
-	URL         string                 `json:"url"`
-	Icon        string                 `json:"icon"`
-	Description string                 `json:"description"`
-	Source      string                 `json:"source"`
-	Override    *DiscoveredAppOverride `json:"override"`
+	Name         string                 `json:"name"`
+	URL          string                 `json:"url"`
+	Icon         string                 `json:"icon"`
+	Description  string                 `json:"description"`
+	Source       string                 `json:"source"`
+	Upstream     string                 `json:"upstream,omitempty"`
+	Labels       map[string]string      `json:"labels,omitempty"`
+	Override     *DiscoveredAppOverride `json:"override"`
+	MatchedRules []int                  `json:"matchedRules,omitempty"`
+	Effective    *DiscoveredAppOverride `json:"effective"`
+}
+
+// DiscoveryStatus reports the outcome of the most recent runs of a discovery source.
+type DiscoveryStatus struct {
+	Source              string     `json:"source"`
+	Enabled             bool       `json:"enabled"`
+	Running             bool       `json:"running"`
+	LastRun             *time.Time `json:"lastRun"`
+	LastDurationMs      int64      `json:"lastDurationMs"`
+	LastSuccess         *time.Time `json:"lastSuccess"`
+	LastError           string     `json:"lastError"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	AppCount            int        `json:"appCount"`
+}
+
+// DirectorySyncResult is the outcome of one directory sync run. Users is the
+// number of users found in the directory; Added, Updated and Enabled count
+// LDAP users created, changed and re-enabled in DashGate, and Disabled and
+// Deleted those no longer in the directory.
+type DirectorySyncResult struct {
+	Source        string    `json:"source"`
+	StartedAt     time.Time `json:"startedAt"`
+	DurationMs    int64     `json:"durationMs"`
+	Users         int       `json:"users"`
+	Added         int       `json:"added"`
+	Updated       int       `json:"updated"`
+	Enabled       int       `json:"enabled"`
+	Disabled      int       `json:"disabled"`
+	Deleted       int       `json:"deleted"`
+	SessionsEnded int       `json:"sessionsEnded"`
+	Skipped       []string  `json:"skipped,omitempty"` // users that could not be stored, with the reason
+	Error         string    `json:"error,omitempty"`
 }
 
 // AppMapping maps an app URL to allowed groups.
@@ -100,6 +164,7 @@ type AuthConfig struct {
 	SessionDuration int    // days, default 7
 	CookieName      string // default "dashgate_session"
 	CookieSecure    bool   // default true
+	CookieDomain    string // optional, e.g. ".example.com" to share the session with forward-auth protected apps
 }
 
 // LocalUser represents a user stored in the local SQLite database.
@@ -110,18 +175,107 @@ type LocalUser struct {
 	PasswordHash string    `json:"-"`
 	DisplayName  string    `json:"displayName"`
 	Groups       []string  `json:"groups"`
+	TOTPEnabled  bool      `json:"totpEnabled"`
+	TOTPRequired bool      `json:"totpRequired"`
+	Source       string    `json:"source"`             // "local", "ldap" or "oidc"
+	Disabled     bool      `json:"disabled,omitempty"` // removed from the directory
 	CreatedAt    time.Time `json:"createdAt"`
 	UpdatedAt    time.Time `json:"updatedAt"`
 }
 
+// WebAuthnCredential is a registered passkey. Data holds the serialized
+// credential record (public key, sign count, flags).
+type WebAuthnCredential struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"-"`
+	CredentialID string     `json:"-"`
+	Name         string     `json:"name"`
+	Data         string     `json:"-"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	LastUsedAt   *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// UserSession is a signed-in browser session as shown on the account page
+// and in the admin sessions list. Device is derived from UserAgent for
+// display; the owner fields are only filled in for the admin list.
+type UserSession struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"userId,omitempty"`
+	Username    string     `json:"username,omitempty"`
+	DisplayName string     `json:"displayName,omitempty"`
+	Source      string     `json:"source,omitempty"`
+	IPAddress   string     `json:"ipAddress"`
+	UserAgent   string     `json:"userAgent"`
+	Device      string     `json:"device"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastSeenAt  *time.Time `json:"lastSeenAt,omitempty"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	Current     bool       `json:"current"`
+}
+
+// LoginFailures tracks failed sign-in attempts for one username, whether or
+// not an account with that name exists.
+type LoginFailures struct {
+	Username      string     `json:"username"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	LastIP        string     `json:"lastIP"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty"`
+}
+
+// Invitation is an onboarding link that lets new users create a local account
+// with preset groups. MaxUses of 0 means unlimited sign-ups until it expires.
+type Invitation struct {
+	ID          int       `json:"id"`
+	Note        string    `json:"note"`
+	Groups      []string  `json:"groups"`
+	MaxUses     int       `json:"maxUses"`
+	Uses        int       `json:"uses"`
+	RequireTOTP bool      `json:"requireTOTP"`
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// UserTOTP holds a user's TOTP enrollment. Secret is decrypted;
+// RecoveryCodes holds hashes of the unused recovery codes.
+type UserTOTP struct {
+	UserID        int
+	Secret        string
+	Enabled       bool
+	RecoveryCodes []string
+	LastStep      int64
+}
+
 // AuthenticatedUser is the unified user struct used throughout the app.
 type AuthenticatedUser struct {
 	Username    string   `json:"username"`
 	DisplayName string   `json:"displayName"`
 	Email       string   `json:"email,omitempty"`
 	Groups      []string `json:"groups"`
-	Source      string   `json:"source"` // "proxy", "local", "ldap", "oidc", "apikey"
+	Source      string   `json:"source"` // "authelia" (proxy headers), "local", "ldap", "oidc", "apikey"
 	IsAdmin     bool     `json:"isAdmin"`
+	Scopes      []string `json:"scopes,omitempty"` // API key users only
+}
+
+// GroupMappingRule translates a group name received from an external auth
+// source before admin checks and app filtering. Rules are evaluated in
+// position order and the first matching rule decides.
+type GroupMappingRule struct {
+	ID       int    `json:"id"`
+	Position int    `json:"position"`
+	Enabled  bool   `json:"enabled"`
+	Source   string `json:"source"` // "authelia", "ldap", "oidc", or "" for every external source
+	Match    string `json:"match"`  // glob, or regex when prefixed with "re:"
+	Action   string `json:"action"` // "rename", "add" or "drop"
+	Target   string `json:"target"` // group to rename to or add; regex rules may use $1
+}
+
+// GroupSourceSettings holds the group mapping settings of one external auth source.
+type GroupSourceSettings struct {
+	Source        string   `json:"source"`
+	DefaultGroups []string `json:"defaultGroups"` // added to every user of the source
+	DropUnmapped  bool     `json:"dropUnmapped"`  // keep only groups matched by a rule
 }
 
 // SystemConfig holds all configuration stored in the database, configurable via UI.
@@ -132,6 +286,40 @@ type SystemConfig struct {
 	SetupCompleted bool   `json:"setupCompleted"`
 	AdminGroup     string `json:"adminGroup"`
 	TrustedProxies string `json:"trustedProxies"`
+	ExternalURL    string `json:"externalURL"` // public base URL, e.g. https://dash.example.com
+
+	// Session lifetime: sessions slide forward by SessionDays on activity
+	// (renewed at most every SessionRenewMinutes), end after SessionIdleMinutes
+	// without activity (0 = never) and SessionMaxDays after sign-in (0 = never)
+	SessionIdleMinutes  int `json:"sessionIdleMinutes"`
+	SessionRenewMinutes int `json:"sessionRenewMinutes"`
+	SessionMaxDays      int `json:"sessionMaxDays"`
+
+	// Account lockout: after LockoutThreshold failed logins for one username
+	// it is locked for LockoutMinutes (0 disables the lockout)
+	LockoutThreshold int `json:"lockoutThreshold"`
+	LockoutMinutes   int `json:"lockoutMinutes"`
+
+	// API key usage records are kept for APIKeyUsageDays; keys unused for
+	// APIKeyStaleDays are flagged in the admin list
+	APIKeyUsageDays int `json:"apiKeyUsageDays"`
+	APIKeyStaleDays int `json:"apiKeyStaleDays"`
+
+	// Require TOTP two-factor authentication for members of the admin group
+	RequireAdmin2FA bool `json:"requireAdmin2FA"`
+
+	// Password reset links are valid for PasswordResetMinutes; with
+	// PasswordResetEmail local users can request one by email themselves
+	PasswordResetMinutes int  `json:"passwordResetMinutes"`
+	PasswordResetEmail   bool `json:"passwordResetEmail"`
+
+	// Outgoing email (SMTPSecurity is "starttls", "tls" or "none")
+	SMTPHost     string `json:"smtpHost"`
+	SMTPPort     int    `json:"smtpPort"`
+	SMTPUsername string `json:"smtpUsername"`
+	SMTPPassword string `json:"-"`
+	SMTPFrom     string `json:"smtpFrom"`
+	SMTPSecurity string `json:"smtpSecurity"`
 
 	// Auth providers enabled
 	ProxyAuthEnabled bool `json:"proxyAuthEnabled"`
@@ -151,16 +339,18 @@ type SystemConfig struct {
 	LDAPEmailAttr    string `json:"ldapEmailAttr"`
 	LDAPDisplayAttr  string `json:"ldapDisplayAttr"`
 	LDAPGroupAttr    string `json:"ldapGroupAttr"`
+	LDAPNestedGroups string `json:"ldapNestedGroups"` // "", "in_chain" or "recursive"
 	LDAPStartTLS     bool   `json:"ldapStartTLS"`
 	LDAPSkipVerify   bool   `json:"ldapSkipVerify"`
+	LDAPCACert       string `json:"ldapCACert"`     // PEM CA bundle for ldaps:// and StartTLS
+	LDAPClientCert   string `json:"ldapClientCert"` // PEM client certificate
+	LDAPClientKey    string `json:"-"`
 
-	// OIDC settings
-	OIDCIssuer       string `json:"oidcIssuer"`
-	OIDCClientID     string `json:"oidcClientID"`
-	OIDCClientSecret string `json:"-"`
-	OIDCRedirectURL  string `json:"oidcRedirectURL"`
-	OIDCScopes       string `json:"oidcScopes"`
-	OIDCGroupsClaim  string `json:"oidcGroupsClaim"`
+	// Directory sync: source ("" = off, "ldap" or "lldap"), interval in
+	// minutes and what happens to users no longer in the directory
+	DirectorySyncSource   string `json:"directorySyncSource"`
+	DirectorySyncInterval int    `json:"directorySyncInterval"`
+	DirectorySyncRemoved  string `json:"directorySyncRemoved"` // "disable" or "delete"
 
 	// Discovery settings
 	DockerDiscoveryEnabled  bool   `json:"dockerDiscoveryEnabled"`
@@ -179,6 +369,22 @@ type SystemConfig struct {
 	CaddyAdminURL           string `json:"caddyAdminUrl"`
 	CaddyUsername           string `json:"caddyUsername"`
 	CaddyPassword           string `json:"-"`
+
+	// Discovery schedule per source, in seconds (0 = default interval, no jitter)
+	DockerDiscoveryInterval  int `json:"dockerDiscoveryInterval"`
+	DockerDiscoveryJitter    int `json:"dockerDiscoveryJitter"`
+	TraefikDiscoveryInterval int `json:"traefikDiscoveryInterval"`
+	TraefikDiscoveryJitter   int `json:"traefikDiscoveryJitter"`
+	NginxDiscoveryInterval   int `json:"nginxDiscoveryInterval"`
+	NginxDiscoveryJitter     int `json:"nginxDiscoveryJitter"`
+	NPMDiscoveryInterval     int `json:"npmDiscoveryInterval"`
+	NPMDiscoveryJitter       int `json:"npmDiscoveryJitter"`
+	CaddyDiscoveryInterval   int `json:"caddyDiscoveryInterval"`
+	CaddyDiscoveryJitter     int `json:"caddyDiscoveryJitter"`
+
+	// Discovered app icon matching
+	IconAutoMatch       bool `json:"iconAutoMatch"`
+	IconFaviconFallback bool `json:"iconFaviconFallback"`
 }
 
 // LDAPAuthConfig holds runtime LDAP authentication configuration.
@@ -193,18 +399,35 @@ type LDAPAuthConfig struct {
 	EmailAttr    string
 	DisplayAttr  string
 	GroupAttr    string
+	NestedGroups string
 	StartTLS     bool
 	SkipVerify   bool
+	CACert       string
+	ClientCert   string
+	ClientKey    string
 }
 
-// OIDCAuthConfig holds runtime OIDC authentication configuration.
-type OIDCAuthConfig struct {
-	Issuer       string
-	ClientID     string
-	ClientSecret string
-	RedirectURL  string
-	Scopes       []string
-	GroupsClaim  string
+// OIDCProvider is an OpenID Connect identity provider users can sign in with.
+// Each provider has its own login button and callback URL.
+type OIDCProvider struct {
+	ID           string `json:"id"` // slug used in /auth/oidc?provider= and the callback path
+	DisplayName  string `json:"displayName"`
+	Icon         string `json:"icon"` // image URL shown on the login button
+	Position     int    `json:"position"`
+	Enabled      bool   `json:"enabled"`
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"-"`
+	HasSecret    bool   `json:"hasSecret"`
+	RedirectURL  string `json:"redirectURL"` // defaults to <external URL>/auth/oidc/callback/<id>
+	Scopes       string `json:"scopes"`
+	GroupsClaim  string `json:"groupsClaim"`
+
+	// AllowedDomains limits sign-in to verified email addresses in these
+	// domains; empty allows everyone the provider authenticates.
+	AllowedDomains []string `json:"allowedDomains"`
+	// DefaultGroups are added to every user signing in with this provider.
+	DefaultGroups []string `json:"defaultGroups"`
 }
 
 // APIKey represents an API key stored in the database.
@@ -220,16 +443,47 @@ type APIKey struct {
 	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
 	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
 	CreatedAt   time.Time  `json:"createdAt"`
+
+	// AllowedCIDRs restricts the addresses the key may be used from; empty
+	// allows any. RateLimit is requests per minute, 0 for no limit.
+	AllowedCIDRs []string `json:"allowedCidrs"`
+	RateLimit    int      `json:"rateLimit"`
+
+	// ReplacedBy is the ID of the key this one was rotated to
+	ReplacedBy *int `json:"replacedBy,omitempty"`
+
+	// Stale is set when the key has not been used for the configured number of days
+	Stale bool `json:"stale"`
 }
 
 // DockerContainer represents a Docker container from the API.
 type DockerContainer struct {
 	ID     string            `json:"Id"`
 	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
 	State  string            `json:"State"`
 	Labels map[string]string `json:"Labels"`
 }
 
+// PodmanContainer represents a container from the libpod API.
+type PodmanContainer struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	State   string            `json:"State"`
+	Labels  map[string]string `json:"Labels"`
+	Pod     string            `json:"Pod"`
+	PodName string            `json:"PodName"`
+	IsInfra bool              `json:"IsInfra"`
+}
+
+// PodmanPod represents a pod from the libpod API.
+type PodmanPod struct {
+	ID     string            `json:"Id"`
+	Name   string            `json:"Name"`
+	Labels map[string]string `json:"Labels"`
+}
+
 // TraefikRouter represents a Traefik HTTP router.
 type TraefikRouter struct {
 	Name        string   `json:"name"`
@@ -0,0 +1,63 @@
+// Package pattern compiles the glob and "re:"-prefixed regex match patterns
+// used by discovery rules and group mapping rules. Compiled patterns are
+// cached; the rule loaders clear the cache on every reload.
+package pattern
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RegexPrefix marks a match pattern as a regular expression instead of a glob.
+const RegexPrefix = "re:"
+
+// cache holds compiled patterns keyed by their source string.
+var cache sync.Map
+
+// ClearCache drops all compiled patterns so patterns of edited or deleted
+// rules do not accumulate.
+func ClearCache() {
+	cache.Clear()
+}
+
+// IsRegex reports whether pattern is a "re:"-prefixed regular expression.
+func IsRegex(pattern string) bool {
+	return strings.HasPrefix(pattern, RegexPrefix)
+}
+
+// Compile turns a glob (* and ?) or "re:"-prefixed regex into a
+// case-insensitive regular expression. Both forms must match the whole value,
+// so "re:app" does not match "myapp2"; use "re:.*app.*" for a substring match.
+func Compile(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := cache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	var expr string
+	if IsRegex(pattern) {
+		expr = "(?i)^(?:" + strings.TrimPrefix(pattern, RegexPrefix) + ")$"
+	} else {
+		quoted := regexp.QuoteMeta(pattern)
+		quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+		quoted = strings.ReplaceAll(quoted, `\?`, ".")
+		expr = "(?i)^" + quoted + "$"
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(pattern, re)
+	return re, nil
+}
+
+// Match reports whether value matches the glob/regex pattern.
+// Invalid patterns never match.
+func Match(pattern, value string) bool {
+	re, err := Compile(pattern)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(value)
+}
@@ -0,0 +1,37 @@
+package pattern
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"*.lab.example.com", "sonarr.lab.example.com", true},
+		{"SONARR.*", "sonarr.lab.example.com", true},
+		{"sonarr:?989", "sonarr:8989", true},
+		{"*.prod.example.com", "sonarr.lab.example.com", false},
+		{"a.b", "axb", false},
+		{`re:(sonarr|radarr)\..*`, "Radarr.lab.example.com", true},
+		{"re:sonarr", "sonarr.lab.example.com", false},
+		{"re:a|b", "ab", false},
+		{"re:(unclosed", "(unclosed", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.value); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestClearCache(t *testing.T) {
+	if _, err := Compile("re:staff-.*"); err != nil {
+		t.Fatal(err)
+	}
+	ClearCache()
+	cache.Range(func(key, _ interface{}) bool {
+		t.Errorf("pattern %v still cached", key)
+		return true
+	})
+}
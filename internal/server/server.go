@@ -12,6 +12,7 @@ import (
 	"dashgate/internal/models"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-ldap/ldap/v3"
 	"golang.org/x/oauth2"
 )
 
@@ -35,8 +36,7 @@ type App struct {
 	// Auth
 	AuthConfig   models.AuthConfig
 	LDAPAuth     *models.LDAPAuthConfig
-	OIDCProvider *oidc.Provider
-	OAuth2Config *oauth2.Config
+	OIDCClients  []*OIDCClient // initialized providers in login button order
 
 	// Health
 	HealthCache map[string]string
@@ -65,10 +65,22 @@ type App struct {
 	NPMDiscoveryEnvOverride     bool
 	CaddyDiscoveryEnvOverride   bool
 
+	// Container engine detected behind the Docker socket ("docker" or "podman"), guarded by DiscoveryMu
+	ContainerEngine string
+
 	// Discovered app overrides cache
 	DiscoveredOverrides   map[string]*models.DiscoveredAppOverride
 	DiscoveredOverridesMu sync.RWMutex
 
+	// Discovery rules cache (ordered by position)
+	DiscoveryRules   []models.DiscoveryRule
+	DiscoveryRulesMu sync.RWMutex
+
+	// Group mapping rules (ordered by position) and per-source settings
+	GroupMappingRules   []models.GroupMappingRule
+	GroupSourceSettings map[string]models.GroupSourceSettings
+	GroupMappingMu      sync.RWMutex
+
 	// HTTP clients
 	HTTPClient     *http.Client // Standard TLS verification
 	InsecureClient *http.Client // For health checks only (skip TLS verify)
@@ -89,6 +101,32 @@ type App struct {
 	NPMTokenMu     sync.RWMutex
 	NPMTokenExpiry time.Time
 
+	// Per-key API rate limit windows (key ID -> requests in the current minute)
+	APIKeyWindows   map[int]*APIKeyWindow
+	APIKeyWindowsMu sync.Mutex
+
+	// Verified API keys by digest, and when each key's last use was last written
+	APIKeyCache   map[string]*CachedAPIKey
+	APIKeyTouched map[int]time.Time
+	APIKeyCacheMu sync.Mutex
+
+	// Service account connections to the LDAP server
+	LDAPPool   *LDAPPool
+	LDAPPoolMu sync.Mutex
+
+	// Directory sync: DirectorySyncRunMu serializes runs, DirectorySyncMu
+	// guards the running flag and the last result, and the loop picks up new
+	// settings when woken through DirectorySyncReschedule
+	DirectorySyncRunMu      sync.Mutex
+	DirectorySyncMu         sync.RWMutex
+	DirectorySyncRunning    bool
+	DirectorySyncLast       *models.DirectorySyncResult
+	DirectorySyncReschedule chan struct{}
+
+	// OIDC sessions whose refresh token is being redeemed
+	OIDCRefreshing map[int]bool
+	OIDCRefreshMu  sync.Mutex
+
 	// Encryption key for sensitive config values (AES-256, 32 bytes)
 	EncryptionKey []byte
 
@@ -101,11 +139,64 @@ type LLDAPConfigRef struct {
 	URL      string
 	Username string
 	Password string
+	// LDAPURL and BaseDN locate LLDAP's LDAP interface, which is needed to
+	// set passwords (LLDAP's GraphQL API cannot). Both are optional.
+	LDAPURL  string
+	BaseDN   string
 	Token    string
 	TokenMu  sync.RWMutex
 	Expiry   time.Time
 }
 
+// LDAPPool bounds and reuses the LDAP connections bound as the service
+// account. A pool belongs to one LDAPAuthConfig; when the settings change a
+// new pool is created and connections of the old one are closed on release.
+type LDAPPool struct {
+	Config *models.LDAPAuthConfig
+	Idle   chan *ldap.Conn // connections ready for reuse
+	Slots  chan struct{}   // one token per open connection
+}
+
+// NewLDAPPool creates an empty pool allowing up to size open connections.
+func NewLDAPPool(cfg *models.LDAPAuthConfig, size int) *LDAPPool {
+	return &LDAPPool{
+		Config: cfg,
+		Idle:   make(chan *ldap.Conn, size),
+		Slots:  make(chan struct{}, size),
+	}
+}
+
+// CloseIdle closes the connections waiting in the pool.
+func (p *LDAPPool) CloseIdle() {
+	for {
+		select {
+		case l := <-p.Idle:
+			l.Close()
+		default:
+			return
+		}
+	}
+}
+
+// OIDCClient is an OIDC provider whose discovery document has been loaded.
+type OIDCClient struct {
+	Config   models.OIDCProvider
+	Provider *oidc.Provider
+	OAuth2   *oauth2.Config
+}
+
+// APIKeyWindow counts the requests made with one API key in a fixed window.
+type APIKeyWindow struct {
+	Count   int
+	ResetAt time.Time
+}
+
+// CachedAPIKey is an API key whose secret has been verified.
+type CachedAPIKey struct {
+	Key        models.APIKey
+	VerifiedAt time.Time
+}
+
 // DiscoveryManager tracks a single discovery source.
 type DiscoveryManager struct {
 	Enabled bool
@@ -113,12 +204,38 @@ type DiscoveryManager struct {
 	AppsMu  sync.RWMutex
 	Stop    chan struct{}
 	Wg      sync.WaitGroup
+
+	// RescheduleCh wakes the discovery loop to recompute its next run after
+	// the interval settings changed.
+	RescheduleCh chan struct{}
+
+	// RunMu serializes discovery runs so a manual trigger never overlaps the loop.
+	RunMu sync.Mutex
+
+	// Run status (guarded by StatusMu)
+	running             bool
+	lastRun             time.Time
+	lastDuration        time.Duration
+	lastSuccess         time.Time
+	lastError           string
+	consecutiveFailures int
+	StatusMu            sync.RWMutex
 }
 
 // NewDiscoveryManager creates a new discovery manager.
 func NewDiscoveryManager() *DiscoveryManager {
 	return &DiscoveryManager{
-		Apps: []models.App{},
+		Apps:         []models.App{},
+		RescheduleCh: make(chan struct{}, 1),
+	}
+}
+
+// Reschedule asks a running discovery loop to pick up new interval settings.
+// It never blocks.
+func (dm *DiscoveryManager) Reschedule() {
+	select {
+	case dm.RescheduleCh <- struct{}{}:
+	default:
 	}
 }
 
@@ -143,6 +260,77 @@ func (dm *DiscoveryManager) ClearApps() {
 	dm.AppsMu.Unlock()
 }
 
+// BeginRun marks a discovery run as in progress.
+func (dm *DiscoveryManager) BeginRun() {
+	dm.StatusMu.Lock()
+	dm.running = true
+	dm.StatusMu.Unlock()
+}
+
+// RecordRun stores the outcome of a discovery run that started at start.
+// A nil err counts as success and resets the failure counter.
+func (dm *DiscoveryManager) RecordRun(start time.Time, err error) {
+	dm.StatusMu.Lock()
+	defer dm.StatusMu.Unlock()
+	dm.running = false
+	dm.lastRun = start
+	dm.lastDuration = time.Since(start)
+	if err != nil {
+		dm.lastError = err.Error()
+		dm.consecutiveFailures++
+		return
+	}
+	dm.lastError = ""
+	dm.lastSuccess = start
+	dm.consecutiveFailures = 0
+}
+
+// ConsecutiveFailures returns the number of failed runs since the last success.
+func (dm *DiscoveryManager) ConsecutiveFailures() int {
+	dm.StatusMu.RLock()
+	defer dm.StatusMu.RUnlock()
+	return dm.consecutiveFailures
+}
+
+// ResetStatus clears the recorded run status.
+func (dm *DiscoveryManager) ResetStatus() {
+	dm.StatusMu.Lock()
+	dm.running = false
+	dm.lastRun = time.Time{}
+	dm.lastDuration = 0
+	dm.lastSuccess = time.Time{}
+	dm.lastError = ""
+	dm.consecutiveFailures = 0
+	dm.StatusMu.Unlock()
+}
+
+// Status returns a snapshot of the run status for the given source name.
+// The caller fills in Enabled, which is guarded by App.DiscoveryMu.
+func (dm *DiscoveryManager) Status(source string) models.DiscoveryStatus {
+	dm.StatusMu.RLock()
+	status := models.DiscoveryStatus{
+		Source:              source,
+		Running:             dm.running,
+		LastDurationMs:      dm.lastDuration.Milliseconds(),
+		LastError:           dm.lastError,
+		ConsecutiveFailures: dm.consecutiveFailures,
+	}
+	if !dm.lastRun.IsZero() {
+		t := dm.lastRun
+		status.LastRun = &t
+	}
+	if !dm.lastSuccess.IsZero() {
+		t := dm.lastSuccess
+		status.LastSuccess = &t
+	}
+	dm.StatusMu.RUnlock()
+
+	dm.AppsMu.RLock()
+	status.AppCount = len(dm.Apps)
+	dm.AppsMu.RUnlock()
+	return status
+}
+
 // New creates and initializes a new App instance.
 func New() *App {
 	return &App{
@@ -154,6 +342,7 @@ func New() *App {
 		NginxDiscovery:    NewDiscoveryManager(),
 		NPMDiscovery:      NewDiscoveryManager(),
 		CaddyDiscovery:    NewDiscoveryManager(),
+		DirectorySyncReschedule: make(chan struct{}, 1),
 		HTTPClient: &http.Client{
 			Timeout: 5 * time.Second,
 		},
@@ -16,6 +16,7 @@ import (
 	"dashgate/internal/auth"
 	"dashgate/internal/config"
 	"dashgate/internal/database"
+	"dashgate/internal/directorysync"
 	"dashgate/internal/discovery"
 	"dashgate/internal/handlers"
 	"dashgate/internal/health"
@@ -127,6 +128,7 @@ func main() {
 	health.StartHealthChecker(app, bgCtx)
 	database.StartSessionCleanupLoop(app, bgCtx)
 	lldap.InitLLDAP(app)
+	directorysync.StartSyncLoop(app, bgCtx)
 	discovery.InitDockerDiscovery(app)
 	discovery.InitTraefikDiscovery(app)
 	discovery.InitNginxDiscovery(app)
@@ -141,17 +143,28 @@ func main() {
 		}
 	}
 	loginLimiter := middleware.NewRateLimiter(loginRateLimit, 15*time.Minute, bgCtx)
+	// The second login step gets its own budget so a password attempt doesn't use up code attempts
+	totpLimiter := middleware.NewRateLimiter(loginRateLimit, 15*time.Minute, bgCtx)
+	// Password reset and signup requests get their own budget so they can't lock users out of logging in
+	accountLimiter := middleware.NewRateLimiter(loginRateLimit, 15*time.Minute, bgCtx)
+	// Count attempts per client, not per reverse proxy
+	clientIP := func(r *http.Request) string { return auth.ClientIP(app, r) }
+	loginLimiter.ClientIP = clientIP
+	totpLimiter.ClientIP = clientIP
+	accountLimiter.ClientIP = clientIP
 
 	// Build the handler chain: security headers → CSRF → rate limiting → mux
 	mux := http.NewServeMux()
 
 	// Page routes
-	mux.HandleFunc("/", handlers.DashboardHandler(app))
+	mux.HandleFunc("/", auth.BrowserOnly(app, handlers.DashboardHandler(app)))
 	mux.HandleFunc("/login", handlers.LoginHandler(app))
+	mux.HandleFunc("/reset-password", handlers.ResetPasswordPageHandler(app))
+	mux.HandleFunc("/signup", handlers.SignupPageHandler(app))
 	mux.HandleFunc("/setup", handlers.SetupHandler(app))
 	mux.HandleFunc("/offline.html", handlers.OfflineHandler(app))
 	mux.HandleFunc("/health", handlers.HealthHandler(app))
-	mux.HandleFunc("/api/health", handlers.APIHealthHandler(app))
+	mux.HandleFunc("/api/health", auth.RequireScope(app, auth.ScopeHealthRead, handlers.APIHealthHandler(app)))
 	mux.HandleFunc("/manifest.json", handlers.ManifestHandler(app))
 	mux.HandleFunc("/sw.js", handlers.ServiceWorkerHandler(app))
 
@@ -212,22 +225,58 @@ func main() {
 
 	// Auth API routes
 	mux.HandleFunc("/api/auth/login", handlers.LoginHandler(app))
+	mux.HandleFunc("/api/auth/login/totp", handlers.LoginTOTPHandler(app))
+	mux.HandleFunc("/api/auth/login/totp/setup", handlers.LoginTOTPSetupHandler(app))
+	mux.HandleFunc("/api/auth/passkey/begin", handlers.PasskeyLoginBeginHandler(app))
+	mux.HandleFunc("/api/auth/passkey/finish", handlers.PasskeyLoginFinishHandler(app))
 	mux.HandleFunc("/api/auth/logout", handlers.LogoutHandler(app))
 	mux.HandleFunc("/api/auth/me", handlers.AuthMeHandler(app))
 	mux.HandleFunc("/api/auth/config", handlers.AuthConfigHandler(app))
+	mux.HandleFunc("/api/auth/verify", handlers.ForwardAuthHandler(app))
+	mux.HandleFunc("/api/auth/forgot-password", handlers.ForgotPasswordHandler(app))
+	mux.HandleFunc("/api/auth/reset-password", handlers.ResetPasswordHandler(app))
+	mux.HandleFunc("/api/auth/signup", handlers.SignupHandler(app))
 
 	// User preferences
-	mux.HandleFunc("/api/user/preferences", handlers.UserPreferencesHandler(app))
+	mux.HandleFunc("/api/user/preferences", auth.BrowserOnly(app, handlers.UserPreferencesHandler(app)))
+
+	// Two-factor authentication (current user)
+	mux.HandleFunc("/api/user/totp", auth.RequireAuth(app, handlers.UserTOTPHandler(app)))
+	mux.HandleFunc("/api/user/totp/confirm", auth.RequireAuth(app, handlers.UserTOTPConfirmHandler(app)))
+	mux.HandleFunc("/api/user/totp/recovery-codes", auth.RequireAuth(app, handlers.UserTOTPRecoveryCodesHandler(app)))
+
+	// Passkeys (WebAuthn)
+	mux.HandleFunc("/api/user/passkeys", auth.RequireAuth(app, handlers.UserPasskeysHandler(app)))
+	mux.HandleFunc("/api/user/passkeys/", auth.RequireAuth(app, handlers.UserPasskeyHandler(app)))
+	mux.HandleFunc("/api/user/passkeys/register/begin", auth.RequireAuth(app, handlers.UserPasskeyRegisterBeginHandler(app)))
+	mux.HandleFunc("/api/user/passkeys/register/finish", auth.RequireAuth(app, handlers.UserPasskeyRegisterFinishHandler(app)))
+
+	// Account self-service
+	mux.HandleFunc("/api/user/password", auth.RequireAuth(app, handlers.UserPasswordHandler(app)))
+	mux.HandleFunc("/api/user/profile", auth.RequireAuth(app, handlers.UserProfileHandler(app)))
+	mux.HandleFunc("/api/user/sessions", auth.RequireAuth(app, handlers.UserSessionsHandler(app)))
+	mux.HandleFunc("/api/user/sessions/", auth.RequireAuth(app, handlers.UserSessionHandler(app)))
 
 	// OIDC routes
 	mux.HandleFunc("/auth/oidc", auth.OIDCAuthHandler(app))
 	mux.HandleFunc("/auth/oidc/callback", auth.OIDCCallbackHandler(app))
+	mux.HandleFunc("/auth/oidc/callback/", auth.OIDCCallbackHandler(app))
+	mux.HandleFunc("/auth/oidc/backchannel-logout", handlers.OIDCBackChannelLogoutHandler(app))
+	mux.HandleFunc("/auth/oidc/backchannel-logout/", handlers.OIDCBackChannelLogoutHandler(app))
 
 	// API key management
 	mux.HandleFunc("/api/admin/api-keys", auth.RequireAdmin(app, handlers.APIKeysHandler(app)))
+	mux.HandleFunc("/api/admin/api-keys/rotate", auth.RequireAdmin(app, handlers.APIKeyRotateHandler(app)))
+	mux.HandleFunc("/api/admin/api-keys/usage", auth.RequireAdmin(app, handlers.APIKeyUsageHandler(app)))
 
 	// System config
 	mux.HandleFunc("/api/admin/system-config", auth.RequireAdmin(app, handlers.SystemConfigHandler(app)))
+	mux.HandleFunc("/api/admin/oidc-providers", auth.RequireAdmin(app, handlers.OIDCProvidersHandler(app)))
+	mux.HandleFunc("/api/admin/ldap/test", auth.RequireAdmin(app, handlers.LDAPTestHandler(app)))
+	mux.HandleFunc("/api/admin/directory-sync", auth.RequireAdmin(app, handlers.DirectorySyncStatusHandler(app)))
+	mux.HandleFunc("/api/admin/directory-sync/run", auth.RequireAdmin(app, handlers.DirectorySyncRunHandler(app)))
+	mux.HandleFunc("/api/admin/smtp", auth.RequireAdmin(app, handlers.SMTPSettingsHandler(app)))
+	mux.HandleFunc("/api/admin/smtp/test", auth.RequireAdmin(app, handlers.SMTPTestHandler(app)))
 
 	// Audit log
 	mux.HandleFunc("/api/admin/audit-log", auth.RequireAdmin(app, handlers.AuditLogHandler(app)))
@@ -235,30 +284,48 @@ func main() {
 	// Admin API routes
 	mux.HandleFunc("/api/admin/check", auth.RequireAdmin(app, handlers.AdminCheckHandler(app)))
 	mux.HandleFunc("/api/admin/users", auth.RequireAdmin(app, handlers.AdminLLDAPUsersHandler(app)))
+	mux.HandleFunc("/api/admin/users/", auth.RequireAdmin(app, handlers.AdminLLDAPUserHandler(app)))
 	mux.HandleFunc("/api/admin/groups", auth.RequireAdmin(app, handlers.AdminLLDAPGroupsHandler(app)))
-	mux.HandleFunc("/api/admin/apps", auth.RequireAdmin(app, handlers.AdminAppsHandler(app)))
-	mux.HandleFunc("/api/admin/apps/mapping", auth.RequireAdmin(app, handlers.AdminAppMappingHandler(app)))
+	mux.HandleFunc("/api/admin/groups/", auth.RequireAdmin(app, handlers.AdminLLDAPGroupHandler(app)))
+	mux.HandleFunc("/api/admin/apps", auth.RequireAdminScope(app, auth.ScopeAppsWrite, handlers.AdminAppsHandler(app)))
+	mux.HandleFunc("/api/admin/apps/mapping", auth.RequireAdminScope(app, auth.ScopeAppsWrite, handlers.AdminAppMappingHandler(app)))
 
 	// Local user management
 	mux.HandleFunc("/api/admin/local-users", auth.RequireAdmin(app, handlers.LocalUsersHandler(app)))
 	mux.HandleFunc("/api/admin/local-users/", auth.RequireAdmin(app, handlers.LocalUserHandler(app)))
+	mux.HandleFunc("/api/admin/invitations", auth.RequireAdmin(app, handlers.InvitationsHandler(app)))
+	mux.HandleFunc("/api/admin/invitations/", auth.RequireAdmin(app, handlers.InvitationHandler(app)))
+
+	// Session management
+	mux.HandleFunc("/api/admin/sessions", auth.RequireAdmin(app, handlers.AdminSessionsHandler(app)))
+	mux.HandleFunc("/api/admin/sessions/", auth.RequireAdmin(app, handlers.AdminSessionHandler(app)))
+	mux.HandleFunc("/api/admin/lockouts", auth.RequireAdmin(app, handlers.AdminLockoutsHandler(app)))
 
 	// App configuration CRUD
-	mux.HandleFunc("/api/admin/config/apps", auth.RequireAdmin(app, handlers.AdminConfigAppsHandler(app)))
-	mux.HandleFunc("/api/admin/config/categories", auth.RequireAdmin(app, handlers.AdminCategoriesHandler(app)))
-	mux.HandleFunc("/api/admin/config/icons", auth.RequireAdmin(app, handlers.AdminIconsHandler(app)))
-	mux.HandleFunc("/api/admin/config/icons/upload", auth.RequireAdmin(app, handlers.AdminIconUploadHandler(app)))
-	mux.HandleFunc("/api/admin/config/icons/dashboard-icons", auth.RequireAdmin(app, handlers.AdminDashboardIconsHandler(app)))
-	mux.HandleFunc("/api/admin/config/icons/download", auth.RequireAdmin(app, handlers.AdminIconDownloadHandler(app)))
+	mux.HandleFunc("/api/admin/config/apps", auth.RequireAdminScope(app, auth.ScopeAppsWrite, handlers.AdminConfigAppsHandler(app)))
+	mux.HandleFunc("/api/admin/config/categories", auth.RequireAdminScope(app, auth.ScopeAppsWrite, handlers.AdminCategoriesHandler(app)))
+	mux.HandleFunc("/api/admin/config/icons", auth.RequireAdminScope(app, auth.ScopeAppsWrite, handlers.AdminIconsHandler(app)))
+	mux.HandleFunc("/api/admin/config/icons/upload", auth.RequireAdminScope(app, auth.ScopeAppsWrite, handlers.AdminIconUploadHandler(app)))
+	mux.HandleFunc("/api/admin/config/icons/dashboard-icons", auth.RequireAdminScope(app, auth.ScopeAppsWrite, handlers.AdminDashboardIconsHandler(app)))
+	mux.HandleFunc("/api/admin/config/icons/download", auth.RequireAdminScope(app, auth.ScopeAppsWrite, handlers.AdminIconDownloadHandler(app)))
 
 	// Dependencies API
-	mux.HandleFunc("/api/dependencies", handlers.DependenciesHandler(app))
+	mux.HandleFunc("/api/dependencies", auth.RequireScope(app, auth.ScopeDashboardRead, handlers.DependenciesHandler(app)))
 
 	// Discovered apps
-	mux.HandleFunc("/api/discovered-apps", handlers.DiscoveredAppsHandler(app))
+	mux.HandleFunc("/api/discovered-apps", auth.RequireScope(app, auth.ScopeDashboardRead, handlers.DiscoveredAppsHandler(app)))
 	mux.HandleFunc("/api/admin/discovered-apps", auth.RequireAdmin(app, handlers.AdminDiscoveredAppsHandler(app)))
+	mux.HandleFunc("/api/admin/discovery-rules", auth.RequireAdmin(app, handlers.DiscoveryRulesHandler(app)))
+	mux.HandleFunc("/api/admin/discovery-rules/order", auth.RequireAdmin(app, handlers.DiscoveryRulesReorderHandler(app)))
+	mux.HandleFunc("/api/admin/discovery-rules/preview", auth.RequireAdmin(app, handlers.DiscoveryRulesPreviewHandler(app)))
+	mux.HandleFunc("/api/admin/group-mappings", auth.RequireAdmin(app, handlers.GroupMappingsHandler(app)))
+	mux.HandleFunc("/api/admin/group-mappings/source", auth.RequireAdmin(app, handlers.GroupMappingSourceHandler(app)))
+	mux.HandleFunc("/api/admin/group-mappings/test", auth.RequireAdmin(app, handlers.GroupMappingTestHandler(app)))
 
 	// Discovery management
+	mux.HandleFunc("/api/admin/discovery/status", auth.RequireAdmin(app, handlers.DiscoveryStatusHandler(app)))
+	mux.HandleFunc("/api/admin/discovery/run", auth.RequireAdmin(app, handlers.DiscoveryRunHandler(app)))
+	mux.HandleFunc("/api/admin/discovery/icons", auth.RequireAdmin(app, handlers.DiscoveryIconSettingsHandler(app)))
 	mux.HandleFunc("/api/admin/docker-discovery", auth.RequireAdmin(app, handlers.DockerDiscoveryHandler(app)))
 	mux.HandleFunc("/api/admin/traefik-discovery", auth.RequireAdmin(app, handlers.TraefikDiscoveryHandler(app)))
 	mux.HandleFunc("/api/admin/nginx-discovery", auth.RequireAdmin(app, handlers.NginxDiscoveryHandler(app)))
@@ -274,12 +341,15 @@ func main() {
 	mux.HandleFunc("/api/admin/backup", auth.RequireAdmin(app, handlers.BackupHandler(app)))
 	mux.HandleFunc("/api/admin/restore", auth.RequireAdmin(app, handlers.RestoreHandler(app)))
 
-	// Apply middleware chain: body size limit → rate limiting → CSRF → security headers → auto login redirect
+	// Apply middleware chain: body size limit → rate limiting → CSRF → security headers → API key checks → auto login redirect
 	bodySizeLimited := middleware.MaxBodySize(1<<20, mux) // 1 MB max request body
-	rateLimited := loginLimiter.LimitPath([]string{"/api/auth/login", "/login"}, bodySizeLimited)
+	rateLimited := loginLimiter.LimitPath([]string{"/api/auth/login", "/login", "/api/auth/passkey/finish", "/api/user/password"},
+		totpLimiter.LimitPath([]string{"/api/auth/login/totp", "/api/auth/login/totp/setup"},
+			accountLimiter.LimitPath([]string{"/api/auth/forgot-password", "/api/auth/reset-password", "/api/auth/signup"}, bodySizeLimited)))
 	csrfProtected := middleware.CSRFProtection(rateLimited)
 	authRedirect := middleware.AutoLoginRedirect(app)
-	handler := middleware.SecurityHeaders(authRedirect(csrfProtected))
+	apiKeyAuth := middleware.APIKeyAuth(app)
+	handler := middleware.SecurityHeaders(apiKeyAuth(authRedirect(csrfProtected)))
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -307,7 +377,7 @@ func main() {
 	<-ctx.Done()
 	log.Println("Shutting down server...")
 
-	// Stop all background goroutines (health checker, session cleanup, rate limiter)
+	// Stop all background goroutines (health checker, session cleanup, directory sync, rate limiter)
 	bgCancel()
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
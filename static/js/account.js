@@ -0,0 +1,400 @@
+        // account.js - Account settings for the current user
+
+        async function loadAccountSecurity() {
+            await Promise.all([loadProfile(), loadTOTPStatus(), loadPasskeys(), loadSessions()]);
+        }
+
+        // Profile
+        async function loadProfile() {
+            const statusText = document.getElementById('profileStatusText');
+            const form = document.getElementById('profileForm');
+            const editable = currentUser && currentUser.source === 'local';
+
+            document.getElementById('passwordSection').style.display = editable ? '' : 'none';
+            if (!editable) {
+                form.style.display = 'none';
+                statusText.style.display = '';
+                statusText.textContent = 'Your profile is managed by your identity provider.';
+                return;
+            }
+
+            try {
+                const resp = await fetch('/api/user/profile', { credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                const profile = await resp.json();
+                document.getElementById('profileDisplayName').value = profile.displayName || '';
+                document.getElementById('profileEmail').value = profile.email || '';
+            } catch (e) {
+                statusText.style.display = '';
+                statusText.textContent = 'Failed to load profile';
+                statusText.style.color = 'var(--red)';
+            }
+        }
+
+        async function saveProfile() {
+            const displayName = document.getElementById('profileDisplayName').value.trim();
+            const email = document.getElementById('profileEmail').value.trim();
+            try {
+                const resp = await fetch('/api/user/profile', {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ displayName, email })
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                currentUser.displayName = displayName || currentUser.username;
+                currentUser.email = email;
+                updateSettingsUserSection();
+                showToast('Profile saved');
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        // Password
+        async function changePassword() {
+            const current = document.getElementById('currentPassword');
+            const next = document.getElementById('newPassword');
+            const confirmNext = document.getElementById('confirmNewPassword');
+
+            if (next.value.length < 8) {
+                showToast('New password must be at least 8 characters');
+                return;
+            }
+            if (next.value !== confirmNext.value) {
+                showToast('New passwords do not match');
+                return;
+            }
+
+            try {
+                const resp = await fetch('/api/user/password', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ currentPassword: current.value, newPassword: next.value })
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                current.value = '';
+                next.value = '';
+                confirmNext.value = '';
+                showToast('Password changed');
+                await loadSessions();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        // Two-Factor Authentication
+
+        async function loadTOTPStatus() {
+            const statusText = document.getElementById('totpStatusText');
+            const actions = document.getElementById('totpActions');
+            actions.innerHTML = '';
+
+            if (!currentUser || (currentUser.source !== 'local' && currentUser.source !== 'ldap')) {
+                statusText.textContent = 'Two-factor authentication for your account is managed by your identity provider.';
+                return;
+            }
+
+            try {
+                const resp = await fetch('/api/user/totp', { credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                const status = await resp.json();
+
+                if (status.enabled) {
+                    statusText.textContent = `Enabled • ${status.recoveryCodesRemaining} recovery code(s) left`;
+                    statusText.style.color = 'var(--green)';
+                    actions.innerHTML = `
+                        <button class="settings-btn" onclick="regenerateRecoveryCodes()">New Recovery Codes</button>
+                        ${status.required ? '' : '<button class="settings-btn secondary" onclick="disableTOTP()">Disable</button>'}
+                    `;
+                } else {
+                    statusText.textContent = status.required
+                        ? 'Required for your account — you will be asked to set it up at your next login.'
+                        : 'Not enabled';
+                    statusText.style.color = status.required ? 'var(--orange)' : '';
+                    actions.innerHTML = '<button class="settings-btn" onclick="startTOTPEnrollment()">Set Up Authenticator</button>';
+                }
+            } catch (e) {
+                statusText.textContent = 'Failed to load two-factor status';
+                statusText.style.color = 'var(--red)';
+            }
+        }
+
+        async function startTOTPEnrollment() {
+            try {
+                const resp = await fetch('/api/user/totp', { method: 'POST', credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                const enrollment = await resp.json();
+
+                document.getElementById('totpEnrollQR').src = enrollment.qrCode;
+                document.getElementById('totpEnrollSecret').textContent = enrollment.secret;
+                document.getElementById('totpEnrollCode').value = '';
+                document.getElementById('totpRecoverySection').style.display = 'none';
+                document.getElementById('totpEnrollSection').style.display = 'block';
+                document.getElementById('totpEnrollCode').focus();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        function cancelTOTPEnrollment() {
+            document.getElementById('totpEnrollSection').style.display = 'none';
+        }
+
+        async function confirmTOTPEnrollment() {
+            const code = document.getElementById('totpEnrollCode').value.replace(/\s/g, '');
+            if (!code) {
+                showToast('Enter the code from your authenticator app');
+                return;
+            }
+            try {
+                const resp = await fetch('/api/user/totp/confirm', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ code })
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                const data = await resp.json();
+
+                document.getElementById('totpEnrollSection').style.display = 'none';
+                showRecoveryCodeList(data.recoveryCodes);
+                showToast('Two-factor authentication enabled');
+                await loadTOTPStatus();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        async function regenerateRecoveryCodes() {
+            const code = prompt('Enter a code from your authenticator app to create new recovery codes. Your old codes will stop working.');
+            if (!code) return;
+            try {
+                const resp = await fetch('/api/user/totp/recovery-codes', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ code: code.replace(/\s/g, '') })
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                const data = await resp.json();
+                showRecoveryCodeList(data.recoveryCodes);
+                await loadTOTPStatus();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        async function disableTOTP() {
+            const code = prompt('Enter a code from your authenticator app (or a recovery code) to disable two-factor authentication.');
+            if (!code) return;
+            try {
+                const resp = await fetch('/api/user/totp', {
+                    method: 'DELETE',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ code: code.trim() })
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                document.getElementById('totpRecoverySection').style.display = 'none';
+                showToast('Two-factor authentication disabled');
+                await loadTOTPStatus();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        function showRecoveryCodeList(codes) {
+            const list = document.getElementById('totpRecoveryCodes');
+            list.innerHTML = codes.map(c => `<span>${escapeHtml(c)}</span>`).join('');
+            document.getElementById('totpRecoverySection').style.display = 'block';
+        }
+
+        // Passkeys
+        async function loadPasskeys() {
+            const statusText = document.getElementById('passkeyStatusText');
+            const list = document.getElementById('passkeyList');
+            const actions = document.getElementById('passkeyActions');
+            list.innerHTML = '';
+            actions.innerHTML = '';
+            statusText.style.color = '';
+
+            if (!currentUser || (currentUser.source !== 'local' && currentUser.source !== 'ldap')) {
+                statusText.textContent = 'Passkeys are only available for accounts that sign in with a password.';
+                return;
+            }
+
+            try {
+                const resp = await fetch('/api/user/passkeys', { credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                const data = await resp.json();
+
+                if (!data.available) {
+                    statusText.textContent = 'Passkeys are not available until an administrator sets the external URL.';
+                } else if (!passkeysSupported()) {
+                    statusText.textContent = 'This browser does not support passkeys.';
+                } else {
+                    statusText.textContent = data.passkeys.length > 0
+                        ? `${data.passkeys.length} passkey(s) registered`
+                        : 'No passkeys registered';
+                    actions.innerHTML = '<button class="settings-btn" onclick="registerPasskey()">Add Passkey</button>';
+                }
+
+                list.innerHTML = data.passkeys.map(p => `
+                    <div class="admin-item">
+                        <div class="admin-item-info">
+                            <div class="admin-item-name">${escapeHtml(p.name)}</div>
+                            <div class="admin-item-meta">Added ${new Date(p.createdAt).toLocaleDateString()}${p.lastUsedAt ? ' \u2022 Last used ' + new Date(p.lastUsedAt).toLocaleDateString() : ''}</div>
+                        </div>
+                        <div class="admin-item-actions">
+                            <button class="admin-action-btn" onclick="renamePasskey(${p.id}, '${escapeHtml(p.name).replace(/'/g, "\\'")}')" title="Rename">
+                                <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                    <path d="M11 4H4a2 2 0 00-2 2v14a2 2 0 002 2h14a2 2 0 002-2v-7"/>
+                                    <path d="M18.5 2.5a2.121 2.121 0 013 3L12 15l-4 1 1-4 9.5-9.5z"/>
+                                </svg>
+                            </button>
+                            <button class="admin-action-btn danger" onclick="deletePasskey(${p.id})" title="Remove">
+                                <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                    <polyline points="3 6 5 6 21 6"/>
+                                    <path d="M19 6v14a2 2 0 01-2 2H7a2 2 0 01-2-2V6m3 0V4a2 2 0 012-2h4a2 2 0 012 2v2"/>
+                                </svg>
+                            </button>
+                        </div>
+                    </div>
+                `).join('');
+            } catch (e) {
+                statusText.textContent = 'Failed to load passkeys';
+                statusText.style.color = 'var(--red)';
+            }
+        }
+
+        async function registerPasskey() {
+            const name = prompt('Name for this passkey (e.g. "Laptop" or "Phone"):', 'Passkey');
+            if (name === null) return;
+            try {
+                const beginResp = await fetch('/api/user/passkeys/register/begin', { method: 'POST', credentials: 'include' });
+                if (!beginResp.ok) throw new Error(await beginResp.text());
+                const begin = await beginResp.json();
+
+                let credential;
+                try {
+                    credential = await passkeyCreate(begin.options);
+                } catch (e) {
+                    showToast('Passkey registration was cancelled');
+                    return;
+                }
+
+                const resp = await fetch('/api/user/passkeys/register/finish', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ ceremony: begin.ceremony, name: name.trim(), credential })
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast('Passkey added');
+                await loadPasskeys();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        async function renamePasskey(id, currentName) {
+            const name = prompt('New name for this passkey:', currentName);
+            if (!name || name.trim() === currentName) return;
+            try {
+                const resp = await fetch(`/api/user/passkeys/${id}`, {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ name: name.trim() })
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                await loadPasskeys();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        async function deletePasskey(id) {
+            if (!confirm('Remove this passkey? You will no longer be able to sign in with it.')) return;
+            try {
+                const resp = await fetch(`/api/user/passkeys/${id}`, { method: 'DELETE', credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast('Passkey removed');
+                await loadPasskeys();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        // Sessions
+        async function loadSessions() {
+            const statusText = document.getElementById('sessionStatusText');
+            const list = document.getElementById('sessionList');
+            const actions = document.getElementById('sessionActions');
+            list.innerHTML = '';
+            actions.innerHTML = '';
+            statusText.style.color = '';
+
+            if (!currentUser || !['local', 'ldap', 'oidc'].includes(currentUser.source)) {
+                statusText.textContent = 'Your sign-in is handled by your reverse proxy.';
+                return;
+            }
+
+            try {
+                const resp = await fetch('/api/user/sessions', { credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                const sessions = await resp.json();
+
+                statusText.textContent = `${sessions.length} active session(s)`;
+                if (sessions.some(s => !s.current)) {
+                    actions.innerHTML = '<button class="settings-btn secondary" onclick="revokeOtherSessions()">Sign Out Other Sessions</button>';
+                }
+
+                list.innerHTML = sessions.map(s => `
+                    <div class="admin-item">
+                        <div class="admin-item-info">
+                            <div class="admin-item-name" title="${escapeHtml(s.userAgent)}">${escapeHtml(s.device)}${s.current ? ' <span style="color: var(--green);">(this device)</span>' : ''}</div>
+                            <div class="admin-item-meta">${escapeHtml(s.ipAddress || 'Unknown IP')} \u2022 Signed in ${new Date(s.createdAt).toLocaleString()}${s.lastSeenAt ? ' \u2022 Last seen ' + new Date(s.lastSeenAt).toLocaleString() : ''}</div>
+                        </div>
+                        <div class="admin-item-actions">
+                            ${s.current ? '' : `<button class="admin-action-btn danger" onclick="revokeSession(${s.id})" title="Sign out">
+                                <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                    <path d="M9 21H5a2 2 0 01-2-2V5a2 2 0 012-2h4"/>
+                                    <polyline points="16 17 21 12 16 7"/>
+                                    <line x1="21" y1="12" x2="9" y2="12"/>
+                                </svg>
+                            </button>`}
+                        </div>
+                    </div>
+                `).join('');
+            } catch (e) {
+                statusText.textContent = 'Failed to load sessions';
+                statusText.style.color = 'var(--red)';
+            }
+        }
+
+        async function revokeSession(id) {
+            if (!confirm('Sign out this session?')) return;
+            try {
+                const resp = await fetch(`/api/user/sessions/${id}`, { method: 'DELETE', credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast('Session signed out');
+                await loadSessions();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        async function revokeOtherSessions() {
+            if (!confirm('Sign out all other sessions?')) return;
+            try {
+                const resp = await fetch('/api/user/sessions', { method: 'DELETE', credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast('Other sessions signed out');
+                await loadSessions();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
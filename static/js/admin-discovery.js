@@ -41,6 +41,28 @@
             document.getElementById('caddyConfigSection').style.display = enabled ? 'block' : 'none';
         }
 
+        function setDiscoverySchedule(source, status) {
+            document.getElementById(source + 'Interval').value = status.interval || '';
+            document.getElementById(source + 'Jitter').value = status.jitter || '';
+        }
+
+        function getDiscoverySchedule(source) {
+            return {
+                interval: parseInt(document.getElementById(source + 'Interval').value, 10) || 0,
+                jitter: parseInt(document.getElementById(source + 'Jitter').value, 10) || 0
+            };
+        }
+
+        function setDiscoveryHint(hint, status) {
+            if (status.lastError) {
+                hint.textContent = `Error: ${status.lastError}`;
+                hint.style.color = 'var(--red)';
+            } else {
+                hint.textContent = `${status.appCount} app(s) discovered${status.engine === 'podman' ? ' via Podman' : ''}`;
+                hint.style.color = 'var(--green)';
+            }
+        }
+
         // Docker Discovery
         async function loadDockerDiscoveryStatus() {
             try {
@@ -58,6 +80,8 @@
                     enabledChk.checked = status.enabled;
                     if (status.socketPath) socketPath.value = status.socketPath;
 
+                    setDiscoverySchedule('docker', status);
+
                     // Show env override warning if applicable
                     if (status.envOverride) {
                         envOverride.style.display = 'flex';
@@ -65,8 +89,7 @@
 
                     // Update hint
                     if (status.enabled) {
-                        hint.textContent = `${status.appCount} app(s) discovered`;
-                        hint.style.color = 'var(--green)';
+                        setDiscoveryHint(hint, status);
                         refreshBtn.style.display = 'flex';
                         configSection.style.display = 'block';
                     } else {
@@ -114,6 +137,8 @@
                     if (status.url) urlInput.value = status.url;
                     if (status.username) usernameInput.value = status.username;
 
+                    setDiscoverySchedule('traefik', status);
+
                     // Show env override warning if applicable
                     if (status.envOverride) {
                         envOverride.style.display = 'flex';
@@ -121,8 +146,7 @@
 
                     // Update hint
                     if (status.enabled) {
-                        hint.textContent = `${status.appCount} app(s) discovered`;
-                        hint.style.color = 'var(--green)';
+                        setDiscoveryHint(hint, status);
                         refreshBtn.style.display = 'flex';
                         configSection.style.display = 'block';
                     } else {
@@ -201,6 +225,8 @@
                     enabledChk.checked = status.enabled;
                     if (status.configPath) pathInput.value = status.configPath;
 
+                    setDiscoverySchedule('nginx', status);
+
                     // Show env override warning if applicable
                     if (status.envOverride) {
                         envOverride.style.display = 'flex';
@@ -208,8 +234,7 @@
 
                     // Update hint
                     if (status.enabled) {
-                        hint.textContent = `${status.appCount} app(s) discovered`;
-                        hint.style.color = 'var(--green)';
+                        setDiscoveryHint(hint, status);
                         refreshBtn.style.display = 'flex';
                         configSection.style.display = 'block';
                     } else {
@@ -257,6 +282,8 @@
                     if (status.url) urlInput.value = status.url;
                     if (status.email) emailInput.value = status.email;
 
+                    setDiscoverySchedule('npm', status);
+
                     // Show env override warning if applicable
                     if (status.envOverride) {
                         envOverride.style.display = 'flex';
@@ -264,8 +291,7 @@
 
                     // Update hint
                     if (status.enabled) {
-                        hint.textContent = `${status.appCount} app(s) discovered`;
-                        hint.style.color = 'var(--green)';
+                        setDiscoveryHint(hint, status);
                         refreshBtn.style.display = 'flex';
                         configSection.style.display = 'block';
                     } else {
@@ -347,6 +373,8 @@
                     if (status.url) urlInput.value = status.url;
                     if (status.username) usernameInput.value = status.username;
 
+                    setDiscoverySchedule('caddy', status);
+
                     // Show env override warning if applicable
                     if (status.envOverride) {
                         envOverride.style.display = 'flex';
@@ -354,8 +382,7 @@
 
                     // Update hint
                     if (status.enabled) {
-                        hint.textContent = `${status.appCount} app(s) discovered`;
-                        hint.style.color = 'var(--green)';
+                        setDiscoveryHint(hint, status);
                         refreshBtn.style.display = 'flex';
                         configSection.style.display = 'block';
                     } else {
@@ -430,7 +457,8 @@
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({
                         enabled: document.getElementById('dockerDiscoveryEnabled').checked,
-                        socketPath: document.getElementById('dockerSocketPath').value
+                        socketPath: document.getElementById('dockerSocketPath').value,
+                        ...getDiscoverySchedule('docker')
                     }),
                     credentials: 'include'
                 });
@@ -443,7 +471,8 @@
                         enabled: document.getElementById('traefikDiscoveryEnabled').checked,
                         url: document.getElementById('traefikUrl').value,
                         username: document.getElementById('traefikUsername').value,
-                        password: document.getElementById('traefikPassword').value
+                        password: document.getElementById('traefikPassword').value,
+                        ...getDiscoverySchedule('traefik')
                     }),
                     credentials: 'include'
                 });
@@ -454,7 +483,8 @@
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({
                         enabled: document.getElementById('nginxDiscoveryEnabled').checked,
-                        configPath: document.getElementById('nginxConfigPath').value
+                        configPath: document.getElementById('nginxConfigPath').value,
+                        ...getDiscoverySchedule('nginx')
                     }),
                     credentials: 'include'
                 });
@@ -467,7 +497,8 @@
                         enabled: document.getElementById('npmDiscoveryEnabled').checked,
                         url: document.getElementById('npmUrl').value,
                         email: document.getElementById('npmEmail').value,
-                        password: document.getElementById('npmPassword').value
+                        password: document.getElementById('npmPassword').value,
+                        ...getDiscoverySchedule('npm')
                     }),
                     credentials: 'include'
                 });
@@ -480,7 +511,8 @@
                         enabled: document.getElementById('caddyDiscoveryEnabled').checked,
                         url: document.getElementById('caddyAdminUrl').value,
                         username: document.getElementById('caddyUsername').value,
-                        password: document.getElementById('caddyPassword').value
+                        password: document.getElementById('caddyPassword').value,
+                        ...getDiscoverySchedule('caddy')
                     }),
                     credentials: 'include'
                 });
@@ -678,7 +710,11 @@
             document.getElementById('discoveredAppOrigSource').textContent = app.source;
 
             const override = app.override;
-            document.getElementById('discoveredAppHidden').checked = override?.hidden || false;
+            const hiddenBox = document.getElementById('discoveredAppHidden');
+            hiddenBox.checked = app.effective?.hidden || false;
+            // Only pin the hidden state when the admin changes it; otherwise hiding rules keep applying
+            hiddenBox.dataset.initial = hiddenBox.checked ? '1' : '';
+            hiddenBox.dataset.hiddenSet = (override?.hiddenSet || override?.hidden) ? '1' : '';
             document.getElementById('discoveredAppNameOverride').value = override?.nameOverride || '';
             document.getElementById('discoveredAppUrlOverride').value = override?.urlOverride || '';
             document.getElementById('discoveredAppDescOverride').value = override?.descriptionOverride || '';
@@ -776,7 +812,9 @@
         async function saveDiscoveredAppConfig() {
             const url = document.getElementById('discoveredAppUrl').value;
             const source = document.getElementById('discoveredAppSource').value;
-            const hidden = document.getElementById('discoveredAppHidden').checked;
+            const hiddenBox = document.getElementById('discoveredAppHidden');
+            const hidden = hiddenBox.checked;
+            const hiddenSet = hiddenBox.dataset.hiddenSet === '1' || hidden !== (hiddenBox.dataset.initial === '1');
             const nameOverride = document.getElementById('discoveredAppNameOverride').value.trim();
             const urlOverride = document.getElementById('discoveredAppUrlOverride').value.trim();
             const descOverride = document.getElementById('discoveredAppDescOverride').value.trim();
@@ -819,7 +857,8 @@
                         descriptionOverride: descOverride,
                         category: hidden ? '' : category,
                         groups: hidden ? [] : groups,
-                        hidden
+                        hidden: hiddenSet && hidden,
+                        hiddenSet
                     })
                 });
                 if (!resp.ok) throw new Error(await resp.text());
@@ -1,6 +1,6 @@
         // admin-users.js - LLDAP/local users and groups management
 
-        // Read-only User List
+        // LLDAP User List
         function renderUsersList() {
             const container = document.getElementById('usersList');
             const searchTerm = document.getElementById('userSearchInput')?.value.toLowerCase() || '';
@@ -16,12 +16,14 @@
                 return;
             }
 
-            container.innerHTML = filteredUsers.map(user => `
+            container.innerHTML = filteredUsers.map(user => {
+                const id = escapeHtml(user.id).replace(/'/g, "\\'");
+                return `
                 <div class="admin-item">
                     <div class="admin-item-avatar">${escapeHtml((user.displayName || user.id)[0].toUpperCase())}</div>
                     <div class="admin-item-info">
                         <div class="admin-item-name">${escapeHtml(user.displayName || user.id)}</div>
-                        <div class="admin-item-meta">${escapeHtml(user.email)}</div>
+                        <div class="admin-item-meta">${escapeHtml(user.id)}${user.email ? ' \u2022 ' + escapeHtml(user.email) : ''}</div>
                         ${user.groups && user.groups.length > 0 ? `
                             <div class="admin-item-groups">
                                 ${user.groups.slice(0, 3).map(g => `<span class="admin-group-badge">${escapeHtml(g)}</span>`).join('')}
@@ -29,24 +31,47 @@
                             </div>
                         ` : ''}
                     </div>
-                </div>
-            `).join('');
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn" onclick="openLLDAPMembershipModal('${id}')" title="Groups">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <path d="M17 21v-2a4 4 0 00-4-4H5a4 4 0 00-4 4v2"/>
+                                <circle cx="9" cy="7" r="4"/>
+                                <path d="M23 21v-2a4 4 0 00-3-3.87M16 3.13a4 4 0 010 7.75"/>
+                            </svg>
+                        </button>
+                        ${adminState.lldapPasswords ? `
+                        <button class="admin-action-btn" onclick="openLLDAPPasswordModal('${id}')" title="Set Password">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <rect x="3" y="11" width="18" height="11" rx="2" ry="2"/>
+                                <path d="M7 11V7a5 5 0 0110 0v4"/>
+                            </svg>
+                        </button>
+                        ` : ''}
+                        <button class="admin-action-btn danger" onclick="confirmDeleteLLDAPUser('${id}')" title="Delete">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="3 6 5 6 21 6"/>
+                                <path d="M19 6v14a2 2 0 01-2 2H7a2 2 0 01-2-2V6m3 0V4a2 2 0 012-2h4a2 2 0 012 2v2"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>`;
+            }).join('');
         }
 
         function filterUsers() {
             renderUsersList();
         }
 
-        // Read-only Group List
+        // LLDAP Group List
         function renderGroupsList() {
             const container = document.getElementById('groupsList');
 
-            if (adminState.groups.length === 0) {
+            if (adminState.lldapGroups.length === 0) {
                 container.innerHTML = '<div class="admin-empty">No groups found</div>';
                 return;
             }
 
-            container.innerHTML = adminState.groups.map(group => `
+            container.innerHTML = adminState.lldapGroups.map(group => `
                 <div class="admin-item">
                     <div class="admin-item-icon">
                         <svg width="20" height="20" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
@@ -59,10 +84,235 @@
                         <div class="admin-item-name">${escapeHtml(group.displayName)}</div>
                         <div class="admin-item-meta">${group.users ? group.users.length : 0} members</div>
                     </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn danger" onclick="confirmDeleteLLDAPGroup(${group.id})" title="Delete">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="3 6 5 6 21 6"/>
+                                <path d="M19 6v14a2 2 0 01-2 2H7a2 2 0 01-2-2V6m3 0V4a2 2 0 012-2h4a2 2 0 012 2v2"/>
+                            </svg>
+                        </button>
+                    </div>
                 </div>
             `).join('');
         }
 
+        // LLDAP user and group management
+
+        // Group checkboxes for LLDAP groups, by group ID
+        function renderLLDAPGroupCheckboxes(containerId, selectedNames, onchange) {
+            const container = document.getElementById(containerId);
+            if (adminState.lldapGroups.length === 0) {
+                container.innerHTML = '<div class="admin-empty">No LLDAP groups</div>';
+                return;
+            }
+            container.innerHTML = adminState.lldapGroups.map(group => `
+                <label class="admin-group-checkbox">
+                    <input type="checkbox" value="${group.id}" ${selectedNames.includes(group.displayName) ? 'checked' : ''} ${onchange ? `onchange="${onchange}(${group.id}, this)"` : ''}>
+                    <span class="admin-group-checkbox-label">${escapeHtml(group.displayName)}</span>
+                </label>
+            `).join('');
+        }
+
+        function openLLDAPUserModal() {
+            document.getElementById('lldapUserId').value = '';
+            document.getElementById('lldapUserEmail').value = '';
+            document.getElementById('lldapUserDisplayName').value = '';
+            document.getElementById('lldapUserPassword').value = '';
+            document.getElementById('lldapUserPasswordGroup').style.display = adminState.lldapPasswords ? '' : 'none';
+            renderLLDAPGroupCheckboxes('lldapUserGroups', [], null);
+            document.getElementById('lldapUserModal').classList.add('open');
+        }
+
+        function closeLLDAPUserModal() {
+            document.getElementById('lldapUserModal').classList.remove('open');
+        }
+
+        async function saveLLDAPUser() {
+            const id = document.getElementById('lldapUserId').value.trim();
+            const email = document.getElementById('lldapUserEmail').value.trim();
+            const displayName = document.getElementById('lldapUserDisplayName').value.trim();
+            const password = document.getElementById('lldapUserPassword').value;
+            const checkboxes = document.querySelectorAll('#lldapUserGroups input[type="checkbox"]:checked');
+            const groups = Array.from(checkboxes).map(cb => parseInt(cb.value, 10));
+
+            if (!id || !email) {
+                showToast('User ID and email are required');
+                return;
+            }
+
+            try {
+                const resp = await fetch('/api/admin/users', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ id, email, displayName, password, groups })
+                });
+                if (!resp.ok) {
+                    const msg = await resp.text();
+                    // The user exists even if its password or groups failed
+                    if (resp.status === 502) {
+                        closeLLDAPUserModal();
+                        await loadLLDAPData();
+                    }
+                    throw new Error(msg);
+                }
+                showToast('User created');
+                closeLLDAPUserModal();
+                await loadLLDAPData();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        function confirmDeleteLLDAPUser(userId) {
+            if (adminState.currentUser && adminState.currentUser.username === userId) {
+                showToast('Cannot delete yourself');
+                return;
+            }
+
+            document.getElementById('confirmDeleteMessage').textContent = `Delete LLDAP user "${userId}"? They will no longer be able to sign in to any app using LLDAP.`;
+            adminState.deleteCallback = async () => {
+                try {
+                    const resp = await fetch(`/api/admin/users/${encodeURIComponent(userId)}`, {
+                        method: 'DELETE',
+                        credentials: 'include'
+                    });
+                    if (!resp.ok) throw new Error(await resp.text());
+                    showToast('User deleted');
+                    closeConfirmDelete();
+                    await loadLLDAPData();
+                } catch (e) {
+                    showToast('Error: ' + e.message);
+                }
+            };
+            document.getElementById('confirmDeleteModal').classList.add('open');
+        }
+
+        function openLLDAPMembershipModal(userId) {
+            const user = adminState.users.find(u => u.id === userId);
+            if (!user) return;
+            document.getElementById('lldapMembershipUserId').value = userId;
+            document.getElementById('lldapMembershipUsername').textContent = user.displayName || userId;
+            renderLLDAPGroupCheckboxes('lldapMembershipGroups', user.groups || [], 'toggleLLDAPMembership');
+            document.getElementById('lldapMembershipModal').classList.add('open');
+        }
+
+        function closeLLDAPMembershipModal() {
+            document.getElementById('lldapMembershipModal').classList.remove('open');
+            loadLLDAPData();
+        }
+
+        // Adds or removes the user right away when a group is (un)checked
+        async function toggleLLDAPMembership(groupId, checkbox) {
+            const userId = encodeURIComponent(document.getElementById('lldapMembershipUserId').value);
+            checkbox.disabled = true;
+            try {
+                const resp = checkbox.checked
+                    ? await fetch(`/api/admin/users/${userId}/groups`, {
+                        method: 'POST',
+                        headers: { 'Content-Type': 'application/json' },
+                        credentials: 'include',
+                        body: JSON.stringify({ groupId })
+                    })
+                    : await fetch(`/api/admin/users/${userId}/groups/${groupId}`, {
+                        method: 'DELETE',
+                        credentials: 'include'
+                    });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast(checkbox.checked ? 'Added to group' : 'Removed from group');
+            } catch (e) {
+                checkbox.checked = !checkbox.checked;
+                showToast('Error: ' + e.message);
+            } finally {
+                checkbox.disabled = false;
+            }
+        }
+
+        function openLLDAPPasswordModal(userId) {
+            document.getElementById('lldapPasswordUserId').value = userId;
+            document.getElementById('lldapPasswordUsername').textContent = userId;
+            document.getElementById('lldapNewPassword').value = '';
+            document.getElementById('lldapConfirmPassword').value = '';
+            document.getElementById('lldapPasswordModal').classList.add('open');
+        }
+
+        function closeLLDAPPasswordModal() {
+            document.getElementById('lldapPasswordModal').classList.remove('open');
+        }
+
+        async function saveLLDAPPassword() {
+            const userId = document.getElementById('lldapPasswordUserId').value;
+            const password = document.getElementById('lldapNewPassword').value;
+            const confirm = document.getElementById('lldapConfirmPassword').value;
+
+            if (password.length < 8) {
+                showToast('Password must be at least 8 characters');
+                return;
+            }
+            if (password !== confirm) {
+                showToast('Passwords do not match');
+                return;
+            }
+
+            try {
+                const resp = await fetch(`/api/admin/users/${encodeURIComponent(userId)}/password`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ password })
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast('Password set');
+                closeLLDAPPasswordModal();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        async function addLLDAPGroup() {
+            const input = document.getElementById('newLLDAPGroupInput');
+            const name = input.value.trim();
+            if (!name) { showToast('Enter a group name'); return; }
+
+            try {
+                const resp = await fetch('/api/admin/groups', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ name })
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                input.value = '';
+                showToast(`Group "${name}" created`);
+                await loadLLDAPData();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        function confirmDeleteLLDAPGroup(groupId) {
+            const group = adminState.lldapGroups.find(g => g.id === groupId);
+            if (!group) return;
+            const members = group.users ? group.users.length : 0;
+            document.getElementById('confirmDeleteMessage').textContent = `Delete LLDAP group "${group.displayName}"?` +
+                (members > 0 ? ` Its ${members} member${members !== 1 ? 's' : ''} will lose access to apps granted to this group.` : '');
+            adminState.deleteCallback = async () => {
+                try {
+                    const resp = await fetch(`/api/admin/groups/${groupId}`, {
+                        method: 'DELETE',
+                        credentials: 'include'
+                    });
+                    if (!resp.ok) throw new Error(await resp.text());
+                    showToast('Group deleted');
+                    closeConfirmDelete();
+                    await loadLLDAPData();
+                } catch (e) {
+                    showToast('Error: ' + e.message);
+                }
+            };
+            document.getElementById('confirmDeleteModal').classList.add('open');
+        }
+
         // Local User Management
         function renderLocalUsersList() {
             const container = document.getElementById('localUsersList');
@@ -93,8 +343,29 @@
                                 ${user.groups.length > 3 ? `<span class="admin-group-badge">+${user.groups.length - 3}</span>` : ''}
                             </div>
                         ` : '<div class="admin-item-meta" style="color: var(--text-tertiary)">No groups</div>'}
+                        ${user.totpEnabled || user.totpRequired || user.disabled || (user.source && user.source !== 'local') ? `
+                            <div class="admin-item-groups">
+                                ${user.source && user.source !== 'local' ? `<span class="admin-group-badge">${user.source === 'ldap' ? 'LDAP' : 'OIDC'}</span>` : ''}
+                                ${user.disabled ? '<span class="admin-group-badge" style="color: var(--red);" title="Removed from the directory">Disabled</span>' : ''}
+                                ${user.totpEnabled ? '<span class="admin-group-badge">2FA</span>' : ''}
+                                ${user.totpRequired ? '<span class="admin-group-badge">2FA required</span>' : ''}
+                            </div>
+                        ` : ''}
                     </div>
                     <div class="admin-item-actions">
+                        <button class="admin-action-btn" onclick="toggleLocalUserTOTPRequired(${user.id})" title="${user.totpRequired ? 'Stop requiring 2FA' : 'Require 2FA'}" style="${user.totpRequired ? 'color: var(--accent);' : ''}">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <path d="M12 22s8-4 8-10V5l-8-3-8 3v7c0 6 8 10 8 10z"/>
+                            </svg>
+                        </button>
+                        ${user.totpEnabled ? `
+                        <button class="admin-action-btn" onclick="confirmResetLocalUserTOTP(${user.id}, '${escapeHtml(user.username).replace(/'/g, "\\'")}')" title="Reset 2FA">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="1 4 1 10 7 10"/>
+                                <path d="M3.51 15a9 9 0 102.13-9.36L1 10"/>
+                            </svg>
+                        </button>
+                        ` : ''}
                         <button class="admin-action-btn" onclick="openPasswordResetModal(${user.id}, '${escapeHtml(user.username).replace(/'/g, "\\'")}')" title="Reset Password">
                             <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
                                 <rect x="3" y="11" width="18" height="11" rx="2" ry="2"/>
@@ -351,14 +622,79 @@
             document.getElementById('confirmDeleteModal').classList.add('open');
         }
 
+        async function toggleLocalUserTOTPRequired(userId) {
+            const user = adminState.localUsers.find(u => u.id === userId);
+            if (!user) return;
+            try {
+                const resp = await fetch(`/api/admin/local-users/${userId}/totp`, {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ required: !user.totpRequired })
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast(user.totpRequired ? '2FA no longer required' : '2FA required at next login');
+                await reloadLocalUsers();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        function confirmResetLocalUserTOTP(userId, username) {
+            document.getElementById('confirmDeleteMessage').textContent = `Reset two-factor authentication for "${username}"? They will have to enroll again if 2FA is required.`;
+            adminState.deleteCallback = async () => {
+                try {
+                    const resp = await fetch(`/api/admin/local-users/${userId}/totp`, {
+                        method: 'DELETE',
+                        credentials: 'include'
+                    });
+                    if (!resp.ok) throw new Error(await resp.text());
+                    showToast('Two-factor authentication reset');
+                    closeConfirmDelete();
+                    await reloadLocalUsers();
+                } catch (e) {
+                    showToast('Error: ' + e.message);
+                }
+            };
+            document.getElementById('confirmDeleteModal').classList.add('open');
+        }
+
         function openPasswordResetModal(userId, username) {
             document.getElementById('passwordResetUserId').value = userId;
             document.getElementById('passwordResetUsername').textContent = username;
             document.getElementById('newPasswordInput').value = '';
             document.getElementById('confirmPasswordInput').value = '';
+            document.getElementById('passwordResetLinkGroup').style.display = 'none';
+            const user = (adminState.localUsers || []).find(u => u.id === userId);
+            document.getElementById('emailResetLinkBtn').style.display = user && user.email ? '' : 'none';
             document.getElementById('passwordResetModal').classList.add('open');
         }
 
+        async function createPasswordResetLink(sendEmail) {
+            const userId = document.getElementById('passwordResetUserId').value;
+            try {
+                const resp = await fetch(`/api/admin/local-users/${userId}/reset-link`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify({ sendEmail })
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                const data = await resp.json();
+
+                document.getElementById('passwordResetLink').value = data.url;
+                let hint = `Valid once, until ${new Date(data.expiresAt).toLocaleString()}.`;
+                if (data.emailed) hint += ' The link was emailed to the user.';
+                if (data.emailError) hint += ' Sending the email failed: ' + data.emailError;
+                document.getElementById('passwordResetLinkHint').textContent = hint;
+                document.getElementById('passwordResetLinkGroup').style.display = 'block';
+                document.getElementById('passwordResetLink').select();
+                showToast(data.emailed ? 'Reset link emailed' : 'Reset link created');
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
         function closePasswordResetModal() {
             document.getElementById('passwordResetModal').classList.remove('open');
         }
@@ -399,3 +735,454 @@
                 showToast('Error: ' + e.message);
             }
         }
+
+        // Active Sessions
+        async function loadAdminSessions() {
+            try {
+                const resp = await fetch('/api/admin/sessions', { credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                adminState.sessions = await resp.json();
+                renderAdminSessions();
+            } catch (e) {
+                document.getElementById('adminSessionsList').innerHTML = '<div class="admin-empty">Failed to load sessions</div>';
+            }
+        }
+
+        function renderAdminSessions() {
+            const container = document.getElementById('adminSessionsList');
+            if (!container) return;
+
+            const searchTerm = document.getElementById('adminSessionSearchInput')?.value.toLowerCase() || '';
+            const sessions = (adminState.sessions || []).filter(s =>
+                s.username.toLowerCase().includes(searchTerm) ||
+                (s.displayName && s.displayName.toLowerCase().includes(searchTerm)) ||
+                s.ipAddress.toLowerCase().includes(searchTerm) ||
+                s.device.toLowerCase().includes(searchTerm)
+            );
+
+            if (sessions.length === 0) {
+                container.innerHTML = '<div class="admin-empty">No active sessions</div>';
+                return;
+            }
+
+            container.innerHTML = sessions.map(s => `
+                <div class="admin-item">
+                    <div class="admin-item-avatar">${escapeHtml((s.displayName || s.username)[0].toUpperCase())}</div>
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">${escapeHtml(s.displayName || s.username)}${s.current ? ' <span style="color: var(--green);">(you)</span>' : ''}</div>
+                        <div class="admin-item-meta" title="${escapeHtml(s.userAgent)}">${escapeHtml(s.username)} \u2022 ${escapeHtml(s.device)} \u2022 ${escapeHtml(s.ipAddress || 'Unknown IP')}</div>
+                        <div class="admin-item-meta">Signed in ${new Date(s.createdAt).toLocaleString()}${s.lastSeenAt ? ' \u2022 Last seen ' + new Date(s.lastSeenAt).toLocaleString() : ''}</div>
+                        <div class="admin-item-groups">
+                            <span class="admin-group-badge">${escapeHtml(s.source)}</span>
+                        </div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn danger" onclick="confirmRevokeAllUserSessions(${s.userId}, '${escapeHtml(s.username).replace(/'/g, "\\'")}')" title="Sign out all sessions of this user">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <path d="M17 21v-2a4 4 0 00-4-4H5a4 4 0 00-4 4v2"/>
+                                <circle cx="9" cy="7" r="4"/>
+                                <line x1="17" y1="8" x2="23" y2="14"/>
+                                <line x1="23" y1="8" x2="17" y2="14"/>
+                            </svg>
+                        </button>
+                        <button class="admin-action-btn danger" onclick="confirmRevokeAdminSession(${s.id})" title="Sign out this session">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <path d="M9 21H5a2 2 0 01-2-2V5a2 2 0 012-2h4"/>
+                                <polyline points="16 17 21 12 16 7"/>
+                                <line x1="21" y1="12" x2="9" y2="12"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>
+            `).join('');
+        }
+
+        async function confirmRevokeAdminSession(sessionId) {
+            if (!confirm('Sign out this session?')) return;
+            try {
+                const resp = await fetch(`/api/admin/sessions/${sessionId}`, { method: 'DELETE', credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast('Session signed out');
+                await loadAdminSessions();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        async function confirmRevokeAllUserSessions(userId, username) {
+            if (!confirm(`Sign out all sessions of "${username}"?`)) return;
+            try {
+                const resp = await fetch(`/api/admin/sessions?user_id=${userId}`, { method: 'DELETE', credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast(`Signed out ${username} everywhere`);
+                await loadAdminSessions();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        // ========== Locked Accounts ==========
+
+        async function loadAdminLockouts() {
+            try {
+                const resp = await fetch('/api/admin/lockouts', { credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                adminState.lockouts = await resp.json();
+                renderAdminLockouts();
+            } catch (e) {
+                document.getElementById('adminLockoutsList').innerHTML = '<div class="admin-empty">Failed to load locked accounts</div>';
+            }
+        }
+
+        function renderAdminLockouts() {
+            const container = document.getElementById('adminLockoutsList');
+            if (!container) return;
+
+            const lockouts = adminState.lockouts || [];
+            if (lockouts.length === 0) {
+                container.innerHTML = '<div class="admin-empty">No recent failed sign-ins</div>';
+                return;
+            }
+
+            container.innerHTML = lockouts.map(l => `
+                <div class="admin-item">
+                    <div class="admin-item-avatar">${escapeHtml(l.username[0].toUpperCase())}</div>
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">${escapeHtml(l.username)}</div>
+                        <div class="admin-item-meta">${l.failures} failed attempt${l.failures === 1 ? '' : 's'} \u2022 Last from ${escapeHtml(l.lastIP || 'Unknown IP')} at ${new Date(l.lastFailureAt).toLocaleString()}</div>
+                        <div class="admin-item-groups">
+                            ${l.lockedUntil ? `<span class="admin-group-badge" style="color: var(--red);">Locked until ${new Date(l.lockedUntil).toLocaleTimeString()}</span>` : '<span class="admin-group-badge">Not locked</span>'}
+                        </div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn" onclick="unlockAccount('${escapeHtml(l.username).replace(/'/g, "\\'")}')" title="Unlock and clear failed attempts">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <rect x="3" y="11" width="18" height="11" rx="2" ry="2"/>
+                                <path d="M7 11V7a5 5 0 019.9-1"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>
+            `).join('');
+        }
+
+        async function unlockAccount(username) {
+            try {
+                const resp = await fetch(`/api/admin/lockouts?username=${encodeURIComponent(username)}`, { method: 'DELETE', credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast(`Unlocked ${username}`);
+                await loadAdminLockouts();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        // ========== Invitations ==========
+
+        async function loadInvitations() {
+            try {
+                const resp = await fetch('/api/admin/invitations', { credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                adminState.invitations = await resp.json();
+                renderInvitations();
+            } catch (e) {
+                document.getElementById('invitationsList').innerHTML = '<div class="admin-empty">Failed to load invitations</div>';
+            }
+        }
+
+        function renderInvitations() {
+            const container = document.getElementById('invitationsList');
+            if (!container) return;
+
+            const invitations = adminState.invitations || [];
+            if (invitations.length === 0) {
+                container.innerHTML = '<div class="admin-empty">No invitations</div>';
+                return;
+            }
+
+            const now = new Date();
+            container.innerHTML = invitations.map(inv => {
+                const expired = new Date(inv.expiresAt) <= now;
+                const usedUp = inv.maxUses > 0 && inv.uses >= inv.maxUses;
+                const status = expired ? 'Expired' : usedUp ? 'Used up' : `Expires ${new Date(inv.expiresAt).toLocaleString()}`;
+                const uses = inv.maxUses > 0 ? `${inv.uses} of ${inv.maxUses} used` : `${inv.uses} used, unlimited`;
+                return `
+                <div class="admin-item">
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">${escapeHtml(inv.note || `Invitation #${inv.id}`)}</div>
+                        <div class="admin-item-meta">${uses} \u2022 ${status}${inv.createdBy ? ` \u2022 by ${escapeHtml(inv.createdBy)}` : ''}</div>
+                        <div class="admin-item-groups">
+                            ${inv.groups.map(g => `<span class="admin-group-badge">${escapeHtml(g)}</span>`).join('')}
+                            ${inv.requireTOTP ? '<span class="admin-group-badge">2FA required</span>' : ''}
+                        </div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn danger" onclick="revokeInvitation(${inv.id})" title="Revoke invitation">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="3 6 5 6 21 6"/>
+                                <path d="M19 6v14a2 2 0 01-2 2H7a2 2 0 01-2-2V6m3 0V4a2 2 0 012-2h4a2 2 0 012 2v2"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>`;
+            }).join('');
+        }
+
+        function openInvitationModal() {
+            document.getElementById('invitationNote').value = '';
+            document.getElementById('invitationExpiry').value = '168';
+            document.getElementById('invitationMaxUses').value = '1';
+            document.getElementById('invitationRequireTOTP').checked = false;
+            document.getElementById('invitationGroups').innerHTML = getLocalGroups().map(group => `
+                <label class="admin-group-checkbox">
+                    <input type="checkbox" value="${escapeHtml(group)}" ${group === 'users' ? 'checked' : ''}>
+                    <span class="admin-group-checkbox-label">${escapeHtml(group)}</span>
+                </label>
+            `).join('');
+            document.getElementById('invitationCreateForm').style.display = 'block';
+            document.getElementById('invitationLinkGroup').style.display = 'none';
+            document.getElementById('invitationCreateBtn').style.display = '';
+            document.getElementById('invitationCancelBtn').textContent = 'Cancel';
+            document.getElementById('invitationModal').classList.add('open');
+        }
+
+        function closeInvitationModal() {
+            document.getElementById('invitationModal').classList.remove('open');
+            document.getElementById('invitationLink').value = '';
+        }
+
+        async function createInvitation() {
+            const groups = Array.from(document.querySelectorAll('#invitationGroups input[type="checkbox"]:checked')).map(cb => cb.value);
+            const body = {
+                note: document.getElementById('invitationNote').value.trim(),
+                groups,
+                expiresInHours: parseInt(document.getElementById('invitationExpiry').value, 10),
+                maxUses: parseInt(document.getElementById('invitationMaxUses').value, 10) || 0,
+                requireTOTP: document.getElementById('invitationRequireTOTP').checked
+            };
+
+            try {
+                const resp = await fetch('/api/admin/invitations', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify(body)
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                const data = await resp.json();
+
+                document.getElementById('invitationCreateForm').style.display = 'none';
+                document.getElementById('invitationCreateBtn').style.display = 'none';
+                document.getElementById('invitationCancelBtn').textContent = 'Done';
+                document.getElementById('invitationLink').value = data.url;
+                document.getElementById('invitationLinkGroup').style.display = 'block';
+                document.getElementById('invitationLink').select();
+                await loadInvitations();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        async function revokeInvitation(id) {
+            if (!confirm('Revoke this invitation? The link stops working immediately.')) return;
+            try {
+                const resp = await fetch(`/api/admin/invitations/${id}`, { method: 'DELETE', credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast('Invitation revoked');
+                await loadInvitations();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        // ========== Group Mapping ==========
+
+        const groupSourceLabels = { '': 'All external sources', authelia: 'Proxy headers', ldap: 'LDAP', oidc: 'OIDC' };
+        const groupActionLabels = { rename: 'Rename to', add: 'Keep and add', drop: 'Drop' };
+
+        async function loadGroupMappings() {
+            try {
+                const resp = await fetch('/api/admin/group-mappings', { credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                const data = await resp.json();
+                adminState.groupMappingRules = data.rules || [];
+                adminState.groupSources = data.sources || [];
+                renderGroupMappings();
+            } catch (e) {
+                document.getElementById('groupMappingRulesList').innerHTML = '<div class="admin-empty">Failed to load group mapping rules</div>';
+            }
+        }
+
+        function renderGroupMappings() {
+            const rulesContainer = document.getElementById('groupMappingRulesList');
+            if (!rulesContainer) return;
+
+            const rules = adminState.groupMappingRules || [];
+            if (rules.length === 0) {
+                rulesContainer.innerHTML = '<div class="admin-empty">No rules. External groups are used as received.</div>';
+            } else {
+                rulesContainer.innerHTML = rules.map(rule => `
+                <div class="admin-item"${rule.enabled ? '' : ' style="opacity: 0.6;"'}>
+                    <div class="admin-item-info">
+                        <div class="admin-item-name"><code>${escapeHtml(rule.match)}</code> → ${rule.action === 'drop' ? 'dropped' : `${escapeHtml(groupActionLabels[rule.action])} <code>${escapeHtml(rule.target)}</code>`}</div>
+                        <div class="admin-item-meta">${escapeHtml(groupSourceLabels[rule.source] || rule.source)} • Position ${rule.position}${rule.enabled ? '' : ' • Disabled'}</div>
+                    </div>
+                    <div class="admin-item-actions">
+                        <button class="admin-action-btn" onclick="openGroupMappingRuleModal(${rule.id})" title="Edit rule">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <path d="M11 4H4a2 2 0 00-2 2v14a2 2 0 002 2h14a2 2 0 002-2v-7"/>
+                                <path d="M18.5 2.5a2.121 2.121 0 013 3L12 15l-4 1 1-4 9.5-9.5z"/>
+                            </svg>
+                        </button>
+                        <button class="admin-action-btn danger" onclick="deleteGroupMappingRule(${rule.id})" title="Delete rule">
+                            <svg width="16" height="16" fill="none" stroke="currentColor" stroke-width="2" viewBox="0 0 24 24">
+                                <polyline points="3 6 5 6 21 6"/>
+                                <path d="M19 6v14a2 2 0 01-2 2H7a2 2 0 01-2-2V6m3 0V4a2 2 0 012-2h4a2 2 0 012 2v2"/>
+                            </svg>
+                        </button>
+                    </div>
+                </div>
+            `).join('');
+            }
+
+            document.getElementById('groupSourcesList').innerHTML = (adminState.groupSources || []).map(src => `
+                <div class="admin-item">
+                    <div class="admin-item-info">
+                        <div class="admin-item-name">${escapeHtml(groupSourceLabels[src.source] || src.source)}</div>
+                        <div style="display: flex; gap: 8px; align-items: center; margin-top: 6px; flex-wrap: wrap;">
+                            <input type="text" id="groupSourceDefaults-${src.source}" class="admin-input" style="flex: 1; min-width: 160px;" placeholder="Default groups, comma-separated" value="${escapeHtml(src.defaultGroups.join(', '))}" autocomplete="off">
+                            <label class="admin-group-checkbox">
+                                <input type="checkbox" id="groupSourceDrop-${src.source}" ${src.dropUnmapped ? 'checked' : ''}>
+                                <span class="admin-group-checkbox-label">Keep only mapped groups</span>
+                            </label>
+                            <button class="settings-btn" onclick="saveGroupSource('${src.source}')" style="padding: 6px 12px; font-size: 12px;">Save</button>
+                        </div>
+                    </div>
+                </div>
+            `).join('');
+        }
+
+        function openGroupMappingRuleModal(id) {
+            const rule = id ? (adminState.groupMappingRules || []).find(r => r.id === id) : null;
+            document.getElementById('groupMappingRuleModalTitle').textContent = rule ? 'Edit Mapping Rule' : 'Add Mapping Rule';
+            document.getElementById('groupMappingRuleId').value = rule ? rule.id : '';
+            document.getElementById('groupMappingRuleSource').value = rule ? rule.source : '';
+            document.getElementById('groupMappingRuleMatch').value = rule ? rule.match : '';
+            document.getElementById('groupMappingRuleAction').value = rule ? rule.action : 'rename';
+            document.getElementById('groupMappingRuleTarget').value = rule ? rule.target : '';
+            document.getElementById('groupMappingRuleTarget').disabled = rule ? rule.action === 'drop' : false;
+            document.getElementById('groupMappingRulePosition').value = rule ? rule.position : (adminState.groupMappingRules || []).length;
+            document.getElementById('groupMappingRuleEnabled').checked = rule ? rule.enabled : true;
+            document.getElementById('groupMappingRuleModal').classList.add('open');
+        }
+
+        function closeGroupMappingRuleModal() {
+            document.getElementById('groupMappingRuleModal').classList.remove('open');
+        }
+
+        async function saveGroupMappingRule() {
+            const id = parseInt(document.getElementById('groupMappingRuleId').value, 10) || 0;
+            const action = document.getElementById('groupMappingRuleAction').value;
+            const rule = {
+                id: id,
+                source: document.getElementById('groupMappingRuleSource').value,
+                match: document.getElementById('groupMappingRuleMatch').value.trim(),
+                action: action,
+                target: action === 'drop' ? '' : document.getElementById('groupMappingRuleTarget').value.trim(),
+                position: parseInt(document.getElementById('groupMappingRulePosition').value, 10) || 0,
+                enabled: document.getElementById('groupMappingRuleEnabled').checked
+            };
+            if (!rule.match) {
+                showToast('Enter a group name or pattern to match');
+                return;
+            }
+            try {
+                const resp = await fetch('/api/admin/group-mappings', {
+                    method: id ? 'PUT' : 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify(rule)
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                closeGroupMappingRuleModal();
+                showToast('Rule saved');
+                await loadGroupMappings();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        async function deleteGroupMappingRule(id) {
+            if (!confirm('Delete this mapping rule? Affected users get the groups as received on their next request.')) return;
+            try {
+                const resp = await fetch(`/api/admin/group-mappings?id=${id}`, { method: 'DELETE', credentials: 'include' });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast('Rule deleted');
+                await loadGroupMappings();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        async function saveGroupSource(source) {
+            const body = {
+                source: source,
+                defaultGroups: document.getElementById(`groupSourceDefaults-${source}`).value.split(',').map(g => g.trim()).filter(Boolean),
+                dropUnmapped: document.getElementById(`groupSourceDrop-${source}`).checked
+            };
+            try {
+                const resp = await fetch('/api/admin/group-mappings/source', {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify(body)
+                });
+                if (!resp.ok) throw new Error(await resp.text());
+                showToast(`${groupSourceLabels[source]} group settings saved`);
+                await loadGroupMappings();
+            } catch (e) {
+                showToast('Error: ' + e.message);
+            }
+        }
+
+        async function testGroupMapping() {
+            const input = document.getElementById('groupMappingTestGroups').value.trim();
+            const result = document.getElementById('groupMappingTestResult');
+            // A single word without commas that names a known user is tested as a username
+            const body = input.includes(',') || !input
+                ? { source: document.getElementById('groupMappingTestSource').value, groups: input.split(',').map(g => g.trim()).filter(Boolean) }
+                : { username: input };
+            try {
+                let resp = await fetch('/api/admin/group-mappings/test', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    credentials: 'include',
+                    body: JSON.stringify(body)
+                });
+                if (resp.status === 404 || resp.status === 400 && body.username) {
+                    // Not an external user: treat the input as a single group name
+                    resp = await fetch('/api/admin/group-mappings/test', {
+                        method: 'POST',
+                        headers: { 'Content-Type': 'application/json' },
+                        credentials: 'include',
+                        body: JSON.stringify({ source: document.getElementById('groupMappingTestSource').value, groups: [input] })
+                    });
+                }
+                if (!resp.ok) throw new Error(await resp.text());
+                const data = await resp.json();
+                const badges = groups => groups.length
+                    ? groups.map(g => `<span class="admin-group-badge">${escapeHtml(g)}</span>`).join('')
+                    : '<span class="admin-group-badge">none</span>';
+                result.innerHTML = `
+                <div class="admin-item" style="margin-top: 8px;">
+                    <div class="admin-item-info">
+                        <div class="admin-item-meta">${escapeHtml(groupSourceLabels[data.source])}: ${escapeHtml((data.input || []).join(', ') || 'no groups')}</div>
+                        ${(data.steps || []).map(s => `<div class="admin-item-meta">${escapeHtml(s.group)} → ${s.ruleId ? `rule at position ${(adminState.groupMappingRules.find(r => r.id === s.ruleId) || {}).position}` : s.action === 'keep' ? 'no rule, kept' : 'no rule, dropped'}</div>`).join('')}
+                        <div class="admin-item-groups">${badges(data.groups)}${data.isAdmin ? '<span class="admin-group-badge" style="color: var(--accent);">Admin</span>' : ''}</div>
+                    </div>
+                </div>`;
+            } catch (e) {
+                result.innerHTML = '';
+                showToast('Error: ' + e.message);
+            }
+        }
@@ -461,6 +461,7 @@
                     const data = await resp.json();
                     adminState.isAdmin = data.isAdmin;
                     adminState.lldapEnabled = data.lldapEnabled;
+                    adminState.lldapPasswords = data.lldapPasswords;
                     adminState.localAuthEnabled = data.localAuthEnabled;
                     adminState.authMode = data.authMode || 'authelia';
                     adminState.currentUser = data.user;
@@ -503,11 +504,12 @@
 
         async function logout() {
             try {
-                await fetch('/api/auth/logout', { method: 'POST', credentials: 'include' });
+                const resp = await fetch('/api/auth/logout', { method: 'POST', credentials: 'include' });
+                const result = await resp.json().catch(() => ({}));
                 if ('serviceWorker' in navigator && navigator.serviceWorker.controller) {
                     navigator.serviceWorker.controller.postMessage({ type: 'CLEAR_CACHES' });
                 }
-                window.location.href = '/login';
+                window.location.href = result.redirect || '/login';
             } catch (e) {
                 showToast('Logout failed');
             }
@@ -0,0 +1,70 @@
+        // passkeys.js - WebAuthn helpers shared by the login page and account settings.
+        // The server sends and expects binary fields as base64url strings.
+
+        function passkeysSupported() {
+            return !!(window.PublicKeyCredential && navigator.credentials);
+        }
+
+        function base64urlToBuffer(value) {
+            const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+            const padded = base64 + '='.repeat((4 - base64.length % 4) % 4);
+            const binary = atob(padded);
+            const bytes = new Uint8Array(binary.length);
+            for (let i = 0; i < binary.length; i++) {
+                bytes[i] = binary.charCodeAt(i);
+            }
+            return bytes.buffer;
+        }
+
+        function bufferToBase64url(buffer) {
+            const bytes = new Uint8Array(buffer);
+            let binary = '';
+            for (let i = 0; i < bytes.length; i++) {
+                binary += String.fromCharCode(bytes[i]);
+            }
+            return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+        }
+
+        function decodeCredentialList(list) {
+            return (list || []).map(c => ({ ...c, id: base64urlToBuffer(c.id) }));
+        }
+
+        // Runs navigator.credentials.create() with options from /api/user/passkeys/register/begin
+        async function passkeyCreate(options) {
+            const publicKey = { ...options.publicKey };
+            publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+            publicKey.user = { ...publicKey.user, id: base64urlToBuffer(publicKey.user.id) };
+            publicKey.excludeCredentials = decodeCredentialList(publicKey.excludeCredentials);
+
+            const cred = await navigator.credentials.create({ publicKey });
+            return {
+                id: cred.id,
+                rawId: bufferToBase64url(cred.rawId),
+                type: cred.type,
+                response: {
+                    clientDataJSON: bufferToBase64url(cred.response.clientDataJSON),
+                    attestationObject: bufferToBase64url(cred.response.attestationObject),
+                    transports: cred.response.getTransports ? cred.response.getTransports() : []
+                }
+            };
+        }
+
+        // Runs navigator.credentials.get() with options from /api/auth/passkey/begin
+        async function passkeyGet(options) {
+            const publicKey = { ...options.publicKey };
+            publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+            publicKey.allowCredentials = decodeCredentialList(publicKey.allowCredentials);
+
+            const cred = await navigator.credentials.get({ publicKey });
+            return {
+                id: cred.id,
+                rawId: bufferToBase64url(cred.rawId),
+                type: cred.type,
+                response: {
+                    clientDataJSON: bufferToBase64url(cred.response.clientDataJSON),
+                    authenticatorData: bufferToBase64url(cred.response.authenticatorData),
+                    signature: bufferToBase64url(cred.response.signature),
+                    userHandle: cred.response.userHandle ? bufferToBase64url(cred.response.userHandle) : ''
+                }
+            };
+        }
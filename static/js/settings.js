@@ -48,6 +48,10 @@
                     if (tab.dataset.tab === 'admin' && adminState.isAdmin) {
                         loadAdminData();
                     }
+                    // Load account security settings when account tab is clicked
+                    if (tab.dataset.tab === 'account') {
+                        loadAccountSecurity();
+                    }
                     // Render My Apps and Favorites lists when that tab is clicked
                     if (tab.dataset.tab === 'favorites') {
                         renderMyAppsList();
@@ -367,6 +371,7 @@
             const section = document.getElementById('settingsUserSection');
             if (isAuthenticated && currentUser) {
                 section.style.display = 'flex';
+                document.getElementById('accountTab').style.display = 'flex';
                 document.getElementById('settingsUserAvatar').textContent = currentUser.username[0].toUpperCase();
                 document.getElementById('settingsUserName').textContent = currentUser.displayName || currentUser.username;
                 document.getElementById('settingsUserSource').textContent = currentUser.source || 'Local';
@@ -387,8 +392,13 @@
         // Logout function
         async function logoutUser() {
             try {
-                await fetch('/api/auth/logout', { method: 'POST', credentials: 'include' });
-                window.location.reload();
+                const resp = await fetch('/api/auth/logout', { method: 'POST', credentials: 'include' });
+                const result = await resp.json().catch(() => ({}));
+                if (result.redirect) {
+                    window.location.href = result.redirect;
+                } else {
+                    window.location.reload();
+                }
             } catch (e) {
                 showToast('Logout failed');
             }